@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
-	"net/http"
 	"strings"
 	"time"
 
@@ -17,7 +19,7 @@ type Login struct {
 	Password string `json:"password" binding:"required"`
 }
 
-func hashPassword(pw string) (string, error) {
+func HashPassword(pw string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
 	return string(bytes), err
 }
@@ -29,6 +31,7 @@ func ValidatePassword(pw string, hash string) bool {
 
 func CreateToken(username string, key string) (string, error) {
 	claims := &jwt.StandardClaims{
+		Subject:   username,
 		ExpiresAt: time.Now().Add(10 * time.Minute).UnixMilli(),
 	}
 
@@ -42,6 +45,29 @@ func CreateToken(username string, key string) (string, error) {
 	return tokenString, nil
 }
 
+// NewDigestKey returns a new base64 encoded Ed25519 seed for DIGEST_KEY.
+func NewDigestKey() (string, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(seed), nil
+}
+
+// DigestKey returns the key that signs audit digests from its base64 encoded
+// seed. It is configured separately from the token key, so that rotating the
+// token key does not change the key digests are checked against.
+func DigestKey(seed string) (ed25519.PrivateKey, error) {
+	if seed == "" {
+		return nil, ErrMissingDigestKey
+	}
+	b, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil || len(b) != ed25519.SeedSize {
+		return nil, ErrInvalidDigestKey
+	}
+	return ed25519.NewKeyFromSeed(b), nil
+}
+
 func ExtractBearerToken(header string) (string, error) {
 	if header == "" {
 		return "", errors.New("bad header value given")
@@ -55,43 +81,73 @@ func ExtractBearerToken(header string) (string, error) {
 	return jwtToken[1], nil
 }
 
-func Authorizer() gin.HandlerFunc {
+// userKey is the context key under which Authorizer stores the token subject.
+const userKey = "user"
+
+// User returns the email of the user the request was authorized for, or ""
+// for public routes.
+func User(c *gin.Context) string {
+	return c.GetString(userKey)
+}
+
+var (
+	ErrMissingToken = errors.New("could not extract token")
+	ErrInvalidToken = errors.New("could not parse token")
+	ErrUnauthorized = errors.New("unauthorized")
+
+	ErrMissingDigestKey = errors.New("DIGEST_KEY is not set, create one with digest-key")
+	ErrInvalidDigestKey = errors.New("DIGEST_KEY is not a base64 encoded 32 byte seed")
+)
+
+// Authorizer rejects requests without a valid bearer token, except for the
+// given public routes. Failures are reported through c.Error, so an error
+// handling middleware has to run before it.
+func Authorizer(publicRoutes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.Request.URL.Path == "/login" {
-			c.Next()
-			return
+		for _, route := range publicRoutes {
+			if c.FullPath() == route {
+				c.Next()
+				return
+			}
 		}
 
 		tokenString, err := ExtractBearerToken(c.GetHeader("Authorization"))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "could not extract token"})
+			c.Error(ErrMissingToken)
+			c.Abort()
 			return
 		}
 
 		env, err := utils.EnvVariables()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load .env file"})
+			c.Error(err)
+			c.Abort()
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		claims := &jwt.StandardClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 			return []byte(env.TokenKey), nil
 		})
 
 		if err != nil {
 			if err == jwt.ErrSignatureInvalid {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+				c.Error(ErrUnauthorized)
+				c.Abort()
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "could not parse token"})
+			c.Error(ErrInvalidToken)
+			c.Abort()
 			return
 		}
 
 		if !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Error(ErrUnauthorized)
+			c.Abort()
 			return
 		}
 
+		c.Set(userKey, claims.Subject)
 		c.Next()
 	}
 }
@@ -36,7 +36,7 @@ func TestHashPassword(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			_, err := hashPassword(test.password)
+			_, err := HashPassword(test.password)
 			if test.shouldError {
 				assert.Error(t, err)
 			} else {
@@ -48,8 +48,23 @@ func TestHashPassword(t *testing.T) {
 
 func TestValidatePassword(t *testing.T) {
 	password := "password"
-	hash, _ := hashPassword(password)
+	hash, _ := HashPassword(password)
 
 	assert.True(t, ValidatePassword(password, hash))
 	assert.False(t, ValidatePassword("invalid", hash))
 }
+
+func TestDigestKey(t *testing.T) {
+	seed, err := NewDigestKey()
+	assert.NoError(t, err)
+	key, err := DigestKey(seed)
+	assert.NoError(t, err)
+	again, err := DigestKey(seed)
+	assert.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	_, err = DigestKey("")
+	assert.ErrorIs(t, err, ErrMissingDigestKey)
+	_, err = DigestKey("c2hvcnQ=")
+	assert.ErrorIs(t, err, ErrInvalidDigestKey)
+}
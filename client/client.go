@@ -0,0 +1,750 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/kilianmandscharo/work_hours/auth"
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/report"
+)
+
+// refreshWindow matches the window in which the server accepts /refresh.
+const refreshWindow = 30 * time.Second
+
+// Error is returned for every response with a status code other than 200. It
+// carries the fields of the server's problem+json body.
+type Error struct {
+	StatusCode int
+	Code       string
+	Title      string
+	Detail     string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("%s (%d): %s", e.Code, e.StatusCode, e.Detail)
+}
+
+// HasCode reports whether err is an *Error with the given error code.
+func HasCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	login     *auth.Login
+	token     string
+	expiresAt time.Time
+}
+
+// New returns a client for the server at baseURL, e.g. http://localhost:8080.
+// If httpClient is nil, http.DefaultClient is used.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Login requests a token and remembers the credentials, so that the client
+// can log in again once the token can no longer be refreshed.
+func (c *Client) Login(email string, password string) error {
+	login := auth.Login{Email: email, Password: password}
+	token, err := c.requestToken(http.MethodPost, "/login", "", login)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.login = &login
+	return c.setToken(token)
+}
+
+// SetToken uses an existing token instead of logging in.
+func (c *Client) SetToken(token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setToken(token)
+}
+
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// Refresh exchanges the current token for a new one. The server only accepts
+// this shortly before the token expires.
+func (c *Client) Refresh() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refresh()
+}
+
+func (c *Client) setToken(token string) error {
+	claims := &jwt.StandardClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		return fmt.Errorf("could not parse token: %w", err)
+	}
+	c.token = token
+	c.expiresAt = time.UnixMilli(claims.ExpiresAt)
+	return nil
+}
+
+func (c *Client) refresh() error {
+	token, err := c.requestToken(http.MethodPost, "/refresh", c.token, nil)
+	if err != nil {
+		return err
+	}
+	return c.setToken(token)
+}
+
+// currentToken returns a token that is valid for more than the refresh
+// window, refreshing it or logging in again if necessary.
+func (c *Client) currentToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Until(c.expiresAt) > refreshWindow {
+		return c.token, nil
+	}
+
+	if c.token != "" && time.Until(c.expiresAt) > 0 {
+		if err := c.refresh(); err == nil {
+			return c.token, nil
+		}
+	}
+
+	if c.login == nil {
+		if c.token == "" {
+			return "", errors.New("not logged in")
+		}
+		return c.token, nil
+	}
+
+	token, err := c.requestToken(http.MethodPost, "/login", "", *c.login)
+	if err != nil {
+		return "", err
+	}
+	if err := c.setToken(token); err != nil {
+		return "", err
+	}
+	return c.token, nil
+}
+
+func (c *Client) requestToken(method string, path string, token string, body any) (string, error) {
+	res, err := c.send(method, path, token, body)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", readError(res)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// rawBody is a request body that is sent as is instead of as JSON.
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+func (c *Client) send(method string, path string, token string, body any) (*http.Response, error) {
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case rawBody:
+		reader = bytes.NewReader(b.data)
+		contentType = b.contentType
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+func readError(res *http.Response) error {
+	e := &Error{StatusCode: res.StatusCode}
+	var problem struct {
+		Code   string `json:"code"`
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&problem); err == nil {
+		e.Code = problem.Code
+		e.Title = problem.Title
+		e.Detail = problem.Detail
+	}
+	return e
+}
+
+// do sends an authorized request and decodes the JSON response into out,
+// unless out is nil. A *[]byte receives the raw response body. A request
+// that is rejected as unauthorized is retried once after logging in again.
+func (c *Client) do(method string, path string, body any, out any) error {
+	err := c.doOnce(method, path, body, out)
+
+	var e *Error
+	if errors.As(err, &e) && e.StatusCode == http.StatusUnauthorized && c.forgetToken() {
+		err = c.doOnce(method, path, body, out)
+	}
+
+	return err
+}
+
+// forgetToken drops the current token if the client can log in again.
+func (c *Client) forgetToken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.login == nil {
+		return false
+	}
+	c.token = ""
+	return true
+}
+
+func (c *Client) doOnce(method string, path string, body any, out any) error {
+	token, err := c.currentToken()
+	if err != nil {
+		return err
+	}
+
+	res, err := c.send(method, path, token, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return readError(res)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw, err = io.ReadAll(res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (c *Client) AddBlock(block models.BlockCreate) (models.Block, error) {
+	var newBlock models.Block
+	err := c.do(http.MethodPost, "/block", block, &newBlock)
+	return newBlock, err
+}
+
+func (c *Client) UpdateBlock(block models.Block) error {
+	return c.do(http.MethodPut, "/block", block, nil)
+}
+
+func (c *Client) UpdateBlockStart(id int, start string) error {
+	return c.do(http.MethodPut, fmt.Sprintf("/block_start/%d", id), models.BodyStart{Start: start}, nil)
+}
+
+func (c *Client) UpdateBlockEnd(id int, end string) error {
+	return c.do(http.MethodPut, fmt.Sprintf("/block_end/%d", id), models.BodyEnd{End: end}, nil)
+}
+
+func (c *Client) UpdateBlockHomeoffice(id int, homeoffice bool) error {
+	return c.do(http.MethodPut, fmt.Sprintf("/block_homeoffice/%d", id), models.BodyHomeoffice{Homeoffice: homeoffice}, nil)
+}
+
+func (c *Client) DeleteBlock(id int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/block/%d", id), nil, nil)
+}
+
+func (c *Client) GetBlock(id int) (models.Block, error) {
+	var block models.Block
+	err := c.do(http.MethodGet, fmt.Sprintf("/block/%d", id), nil, &block)
+	return block, err
+}
+
+// GetBlockHistory lists the audit entries of a block and its pauses, oldest
+// first. It works for deleted blocks as well.
+func (c *Client) GetBlockHistory(id int) ([]models.AuditEntry, error) {
+	var history []models.AuditEntry
+	err := c.do(http.MethodGet, fmt.Sprintf("/block/%d/history", id), nil, &history)
+	return history, err
+}
+
+// GetBlocks lists the blocks that lie completely within the given RFC3339
+// range. Either bound may be empty.
+func (c *Client) GetBlocks(start string, end string) ([]models.Block, error) {
+	return c.getBlocks(start, end, "")
+}
+
+// GetBlocksOverlapping lists the blocks that overlap the given RFC3339 range,
+// including a running block. Either bound may be empty.
+func (c *Client) GetBlocksOverlapping(start string, end string) ([]models.Block, error) {
+	return c.getBlocks(start, end, "overlapping")
+}
+
+func (c *Client) getBlocks(start string, end string, mode string) ([]models.Block, error) {
+	var blocks []models.Block
+	err := c.do(http.MethodGet, rangePath("/block", start, end, mode), nil, &blocks)
+	return blocks, err
+}
+
+func rangePath(path string, start string, end string, mode string) string {
+	query := url.Values{}
+	if start != "" {
+		query.Set("start", start)
+	}
+	if end != "" {
+		query.Set("end", end)
+	}
+	if mode != "" {
+		query.Set("mode", mode)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path
+}
+
+func (c *Client) AddPause(pause models.PauseCreate) (models.Pause, error) {
+	var newPause models.Pause
+	err := c.do(http.MethodPost, "/pause", pause, &newPause)
+	return newPause, err
+}
+
+func (c *Client) UpdatePause(pause models.Pause) error {
+	return c.do(http.MethodPut, "/pause", pause, nil)
+}
+
+func (c *Client) UpdatePauseStart(id int, start string) error {
+	return c.do(http.MethodPut, fmt.Sprintf("/pause_start/%d", id), models.BodyStart{Start: start}, nil)
+}
+
+func (c *Client) UpdatePauseEnd(id int, end string) error {
+	return c.do(http.MethodPut, fmt.Sprintf("/pause_end/%d", id), models.BodyEnd{End: end}, nil)
+}
+
+func (c *Client) DeletePause(id int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/pause/%d", id), nil, nil)
+}
+
+// GetTrash lists the deleted blocks and pauses that have not been purged
+// yet, newest first.
+func (c *Client) GetTrash() ([]models.TrashItem, error) {
+	var trash []models.TrashItem
+	err := c.do(http.MethodGet, "/trash", nil, &trash)
+	return trash, err
+}
+
+// RestoreBlock restores a deleted block with its pauses.
+func (c *Client) RestoreBlock(id int) (models.Block, error) {
+	return c.restore(id, models.TrashBlock)
+}
+
+// RestorePause restores a deleted pause and returns its block.
+func (c *Client) RestorePause(id int) (models.Block, error) {
+	return c.restore(id, models.TrashPause)
+}
+
+func (c *Client) restore(id int, typ string) (models.Block, error) {
+	var block models.Block
+	err := c.do(http.MethodPost, fmt.Sprintf("/trash/%d/restore?type=%s", id, typ), nil, &block)
+	return block, err
+}
+
+func (c *Client) StartBlock(homeoffice bool) (models.Block, error) {
+	var block models.Block
+	err := c.do(http.MethodPost, "/current_block_start?homeoffice="+strconv.FormatBool(homeoffice), nil, &block)
+	return block, err
+}
+
+func (c *Client) EndBlock() (models.Block, error) {
+	var block models.Block
+	err := c.do(http.MethodPost, "/current_block_end", nil, &block)
+	return block, err
+}
+
+func (c *Client) GetCurrentBlock() (models.Block, error) {
+	var block models.Block
+	err := c.do(http.MethodGet, "/block_current", nil, &block)
+	return block, err
+}
+
+func (c *Client) StartPause() (models.Pause, error) {
+	var pause models.Pause
+	err := c.do(http.MethodPost, "/current_pause_start", nil, &pause)
+	return pause, err
+}
+
+func (c *Client) EndPause() (models.Pause, error) {
+	var pause models.Pause
+	err := c.do(http.MethodPost, "/current_pause_end", nil, &pause)
+	return pause, err
+}
+
+func (c *Client) GetSettings() (models.Settings, error) {
+	var settings models.Settings
+	err := c.do(http.MethodGet, "/settings", nil, &settings)
+	return settings, err
+}
+
+func (c *Client) UpdateSettings(settings models.Settings) (models.Settings, error) {
+	var updated models.Settings
+	err := c.do(http.MethodPut, "/settings", settings, &updated)
+	return updated, err
+}
+
+func (c *Client) GetSurchargeConfig() (models.SurchargeConfig, error) {
+	var config models.SurchargeConfig
+	err := c.do(http.MethodGet, "/surcharges", nil, &config)
+	return config, err
+}
+
+func (c *Client) UpdateSurchargeConfig(config models.SurchargeConfig) (models.SurchargeConfig, error) {
+	var updated models.SurchargeConfig
+	err := c.do(http.MethodPut, "/surcharges", config, &updated)
+	return updated, err
+}
+
+// GetPayroll returns the minutes per surcharge category and month of the
+// blocks that lie completely within the given RFC3339 range.
+func (c *Client) GetPayroll(start string, end string) ([]report.PayrollEntry, error) {
+	var entries []report.PayrollEntry
+	err := c.do(http.MethodGet, rangePath("/payroll", start, end, ""), nil, &entries)
+	return entries, err
+}
+
+// TimesheetPDF returns the timesheet of a month like 2023-05 as PDF.
+func (c *Client) TimesheetPDF(month string) ([]byte, error) {
+	var data []byte
+	err := c.do(http.MethodGet, "/export/timesheet.pdf?month="+url.QueryEscape(month), nil, &data)
+	return data, err
+}
+
+// BlocksICS returns the blocks in the range as an iCalendar document.
+func (c *Client) BlocksICS(start string, end string) ([]byte, error) {
+	var data []byte
+	err := c.do(http.MethodGet, rangePath("/export/blocks.ics", start, end, ""), nil, &data)
+	return data, err
+}
+
+func (c *Client) GetFeed() (models.Feed, error) {
+	var feed models.Feed
+	err := c.do(http.MethodGet, "/feed", nil, &feed)
+	return feed, err
+}
+
+// RegenerateFeed replaces the subscription URL of the calendar feed.
+func (c *Client) RegenerateFeed() (models.Feed, error) {
+	var feed models.Feed
+	err := c.do(http.MethodPost, "/feed", nil, &feed)
+	return feed, err
+}
+
+// ImportICS imports the events of an iCalendar file that match the filter as
+// blocks. With dryRun the server only reports what it would import.
+func (c *Client) ImportICS(data []byte, category string, prefix string, dryRun bool) (models.ImportReport, error) {
+	query := url.Values{}
+	if category != "" {
+		query.Set("category", category)
+	}
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	if dryRun {
+		query.Set("dryRun", "true")
+	}
+	path := "/import/ics"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var report models.ImportReport
+	err := c.do(http.MethodPost, path, rawBody{contentType: "text/calendar", data: data}, &report)
+	return report, err
+}
+
+// ExportBlocks returns the blocks in the range in the format of another time
+// tracker, one of timewarrior, toggl-csv and toggl-json.
+func (c *Client) ExportBlocks(format string, start string, end string) ([]byte, error) {
+	query := url.Values{"format": {format}}
+	if start != "" {
+		query.Set("start", start)
+	}
+	if end != "" {
+		query.Set("end", end)
+	}
+
+	var data []byte
+	err := c.do(http.MethodGet, "/export/blocks?"+query.Encode(), nil, &data)
+	return data, err
+}
+
+// ImportBlocks imports the entries of another time tracker as blocks. With
+// dryRun the server only reports what it would import.
+func (c *Client) ImportBlocks(format string, data []byte, dryRun bool) (models.ImportReport, error) {
+	query := url.Values{"format": {format}}
+	if dryRun {
+		query.Set("dryRun", "true")
+	}
+
+	var report models.ImportReport
+	err := c.do(http.MethodPost, "/import/blocks?"+query.Encode(), rawBody{contentType: "text/plain", data: data}, &report)
+	return report, err
+}
+
+// GetLocks lists the locked periods.
+func (c *Client) GetLocks() ([]models.PeriodLock, error) {
+	var locks []models.PeriodLock
+	err := c.do(http.MethodGet, "/lock", nil, &locks)
+	return locks, err
+}
+
+// Lock locks a month like 2023-05 in the user's time zone or a range for
+// changes of blocks and pauses.
+func (c *Client) Lock(lock models.PeriodLockCreate) (models.PeriodLock, error) {
+	var newLock models.PeriodLock
+	err := c.do(http.MethodPost, "/lock", lock, &newLock)
+	return newLock, err
+}
+
+// Reopen removes a lock.
+func (c *Client) Reopen(id int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/lock/%d", id), nil, nil)
+}
+
+// VerifyAudit checks the hash chain of the server's audit log. A broken chain
+// is reported in the result, not as an error.
+func (c *Client) VerifyAudit() (models.AuditVerification, error) {
+	var v models.AuditVerification
+	err := c.do(http.MethodGet, "/audit/verify", nil, &v)
+	return v, err
+}
+
+// GetAuditDigest returns the signed digest of the audit log of a month like
+// 2023-05 that has ended.
+func (c *Client) GetAuditDigest(month string) (models.AuditDigest, error) {
+	var d models.AuditDigest
+	err := c.do(http.MethodGet, "/audit/digest?month="+url.QueryEscape(month), nil, &d)
+	return d, err
+}
+
+// GetBackup returns all data of the server as a versioned backup document.
+func (c *Client) GetBackup() (models.Backup, error) {
+	var backup models.Backup
+	err := c.do(http.MethodGet, "/backup", nil, &backup)
+	return backup, err
+}
+
+// Restore restores a backup with the mode replace or merge, an empty mode
+// replaces.
+func (c *Client) Restore(backup models.Backup, mode string) (models.RestoreReport, error) {
+	path := "/restore"
+	if mode != "" {
+		path += "?" + url.Values{"mode": {mode}}.Encode()
+	}
+
+	var report models.RestoreReport
+	err := c.do(http.MethodPost, path, backup, &report)
+	return report, err
+}
+
+// GetSnapshots lists the snapshots of the database file, newest first.
+func (c *Client) GetSnapshots() ([]models.Snapshot, error) {
+	var snapshots []models.Snapshot
+	err := c.do(http.MethodGet, "/snapshot", nil, &snapshots)
+	return snapshots, err
+}
+
+// CreateSnapshot writes a snapshot of the database file now.
+func (c *Client) CreateSnapshot() (models.Snapshot, error) {
+	var s models.Snapshot
+	err := c.do(http.MethodPost, "/snapshot", nil, &s)
+	return s, err
+}
+
+func (c *Client) GetRates() ([]models.Rate, error) {
+	var rates []models.Rate
+	err := c.do(http.MethodGet, "/rate", nil, &rates)
+	return rates, err
+}
+
+func (c *Client) AddRate(rate models.RateCreate) (models.Rate, error) {
+	var newRate models.Rate
+	err := c.do(http.MethodPost, "/rate", rate, &newRate)
+	return newRate, err
+}
+
+func (c *Client) DeleteRate(id int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/rate/%d", id), nil, nil)
+}
+
+// CreateInvoice bills the unbilled billable blocks within the given RFC3339
+// range.
+func (c *Client) CreateInvoice(start string, end string) (models.Invoice, error) {
+	var invoice models.Invoice
+	err := c.do(http.MethodPost, "/invoice", models.InvoiceCreate{Start: start, End: end}, &invoice)
+	return invoice, err
+}
+
+func (c *Client) GetInvoices() ([]models.Invoice, error) {
+	var invoices []models.Invoice
+	err := c.do(http.MethodGet, "/invoice", nil, &invoices)
+	return invoices, err
+}
+
+func (c *Client) GetInvoice(id int) (models.Invoice, error) {
+	var invoice models.Invoice
+	err := c.do(http.MethodGet, fmt.Sprintf("/invoice/%d", id), nil, &invoice)
+	return invoice, err
+}
+
+// InvoiceHTML returns the invoice rendered as an HTML page.
+func (c *Client) InvoiceHTML(id int) ([]byte, error) {
+	var data []byte
+	err := c.do(http.MethodGet, fmt.Sprintf("/invoice/%d/html", id), nil, &data)
+	return data, err
+}
+
+// InvoicePDF returns the invoice rendered as a PDF document.
+func (c *Client) InvoicePDF(id int) ([]byte, error) {
+	var data []byte
+	err := c.do(http.MethodGet, fmt.Sprintf("/invoice/%d/pdf", id), nil, &data)
+	return data, err
+}
+
+// OpenAPISpec returns the server's OpenAPI document.
+// SetUserRole sets the role of a user to employee, manager or admin. Only
+// admins may do this.
+func (c *Client) SetUserRole(email string, role string) error {
+	return c.do(http.MethodPut, "/user/"+url.PathEscape(email)+"/role", models.RoleUpdate{Role: role}, nil)
+}
+
+func (c *Client) GetTeams() ([]models.Team, error) {
+	var teams []models.Team
+	err := c.do(http.MethodGet, "/team", nil, &teams)
+	return teams, err
+}
+
+func (c *Client) AddTeam(name string) (models.Team, error) {
+	var team models.Team
+	err := c.do(http.MethodPost, "/team", models.TeamCreate{Name: name}, &team)
+	return team, err
+}
+
+func (c *Client) AddTeamMember(teamID int, email string) error {
+	return c.do(http.MethodPost, fmt.Sprintf("/team/%d/member", teamID), models.TeamMemberCreate{Email: email}, nil)
+}
+
+func (c *Client) RemoveTeamMember(teamID int, email string) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/team/%d/member/%s", teamID, url.PathEscape(email)), nil, nil)
+}
+
+// GetTeamOverview returns the state and totals of each member of a team.
+func (c *Client) GetTeamOverview(teamID int) (models.TeamOverview, error) {
+	var overview models.TeamOverview
+	err := c.do(http.MethodGet, fmt.Sprintf("/team/%d/overview", teamID), nil, &overview)
+	return overview, err
+}
+
+// Submit submits the week or month containing a date like 2023-05-10 in the
+// user's time zone for review.
+func (c *Client) Submit(submission models.SubmissionCreate) (models.Submission, error) {
+	var s models.Submission
+	err := c.do(http.MethodPost, "/submission", submission, &s)
+	return s, err
+}
+
+// GetSubmissions returns the user's own submissions and those they may
+// review with the given status, all if it is empty.
+func (c *Client) GetSubmissions(status string) ([]models.Submission, error) {
+	var submissions []models.Submission
+	err := c.do(http.MethodGet, "/submission?status="+url.QueryEscape(status), nil, &submissions)
+	return submissions, err
+}
+
+func (c *Client) GetSubmission(id int) (models.Submission, error) {
+	var s models.Submission
+	err := c.do(http.MethodGet, fmt.Sprintf("/submission/%d", id), nil, &s)
+	return s, err
+}
+
+// Approve approves a submission, which locks its period.
+func (c *Client) Approve(id int, comment string) (models.Submission, error) {
+	var s models.Submission
+	err := c.do(http.MethodPost, fmt.Sprintf("/submission/%d/approve", id), models.SubmissionReview{Comment: comment}, &s)
+	return s, err
+}
+
+// Reject returns a submission to the employee with the reason.
+func (c *Client) Reject(id int, reason string) (models.Submission, error) {
+	var s models.Submission
+	err := c.do(http.MethodPost, fmt.Sprintf("/submission/%d/reject", id), models.SubmissionReview{Comment: reason}, &s)
+	return s, err
+}
+
+// GetEvents returns the workflow events the user may see with an id greater
+// than since.
+func (c *Client) GetEvents(since int) ([]models.WorkflowEvent, error) {
+	var events []models.WorkflowEvent
+	err := c.do(http.MethodGet, fmt.Sprintf("/events?since=%d", since), nil, &events)
+	return events, err
+}
+
+func (c *Client) OpenAPISpec() (map[string]any, error) {
+	res, err := c.send(http.MethodGet, "/openapi.json", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, readError(res)
+	}
+
+	var spec map[string]any
+	err = json.NewDecoder(res.Body).Decode(&spec)
+	return spec, err
+}
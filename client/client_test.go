@@ -0,0 +1,450 @@
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/kilianmandscharo/work_hours/auth"
+	"github.com/kilianmandscharo/work_hours/database"
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/server"
+	"github.com/kilianmandscharo/work_hours/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClient returns a client logged in as the test user and the store
+// as seen by that user.
+func newTestClient(t *testing.T) (*Client, database.Store) {
+	gin.SetMode(gin.TestMode)
+	db := database.NewMemoryStore()
+	ts := httptest.NewServer(server.NewRouter(db))
+	t.Cleanup(func() {
+		ts.Close()
+		db.Close()
+	})
+
+	envTest, err := utils.EnvTestVariables()
+	assert.NoError(t, err)
+
+	c := New(ts.URL, ts.Client())
+	assert.NoError(t, c.Login(envTest.Email, envTest.Password))
+	return c, db.WithUser(envTest.Email)
+}
+
+func createToken(t *testing.T, expiresIn time.Duration) string {
+	env, err := utils.EnvVariables()
+	assert.NoError(t, err)
+	claims := &jwt.StandardClaims{ExpiresAt: time.Now().Add(expiresIn).UnixMilli()}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(env.TokenKey))
+	assert.NoError(t, err)
+	return token
+}
+
+func TestLogin(t *testing.T) {
+	c, _ := newTestClient(t)
+	assert.NotEmpty(t, c.Token())
+
+	err := c.Login("invalid@example.com", "invalid")
+	assert.True(t, HasCode(err, "invalid_email"))
+
+	unauthenticated := New(c.baseURL, nil)
+	_, err = unauthenticated.GetBlocks("", "")
+	assert.Error(t, err)
+}
+
+func TestBlocks(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	blocks, err := c.GetBlocks("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(blocks))
+
+	block, err := c.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	utils.AssertTestBlock(t, block)
+
+	block, err = c.GetBlock(block.Id)
+	assert.NoError(t, err)
+	utils.AssertTestBlock(t, block)
+	assert.Equal(t, 1, len(block.Pauses))
+	utils.AssertTestPause(t, block.Pauses[0])
+
+	assert.NoError(t, c.UpdateBlock(utils.TestBlockUpdated()))
+	block, err = c.GetBlock(utils.BID)
+	assert.NoError(t, err)
+	utils.AssertTestBlockUpdated(t, block)
+
+	assert.NoError(t, c.UpdateBlockStart(utils.BID, utils.BStart))
+	assert.NoError(t, c.UpdateBlockEnd(utils.BID, utils.BEnd))
+	assert.NoError(t, c.UpdateBlockHomeoffice(utils.BID, true))
+	block, err = c.GetBlock(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, utils.BStart, block.Start)
+	assert.Equal(t, utils.BEnd, block.End)
+	assert.True(t, block.Homeoffice)
+
+	blocks, err = c.GetBlocks("2023-05-01T00:00:00Z", "2023-05-31T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+
+	blocks, err = c.GetBlocks("2023-05-09T12:00:00Z", "2023-05-10T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(blocks))
+	blocks, err = c.GetBlocksOverlapping("2023-05-09T12:00:00Z", "2023-05-10T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+
+	assert.NoError(t, c.DeleteBlock(utils.BID))
+
+	_, err = c.GetBlock(utils.BID)
+	assert.True(t, HasCode(err, "block_not_found"))
+
+	err = c.DeleteBlock(utils.BID)
+	var e *Error
+	assert.ErrorAs(t, err, &e)
+	assert.Equal(t, http.StatusNotFound, e.StatusCode)
+}
+
+func TestBlockHistory(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	_, err := c.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	assert.NoError(t, c.UpdateBlockHomeoffice(utils.BID, true))
+	assert.NoError(t, c.DeleteBlock(utils.BID))
+
+	history, err := c.GetBlockHistory(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(history))
+	var ops []string
+	for _, e := range history {
+		ops = append(ops, e.Operation)
+	}
+	assert.Equal(t, []string{"create", "update", "delete"}, ops)
+	assert.NotEqual(t, "system", history[0].User)
+
+	_, err = c.GetBlockHistory(99)
+	assert.True(t, HasCode(err, "block_not_found"))
+}
+
+func TestLocks(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	_, err := c.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	lock, err := c.Lock(models.PeriodLockCreate{Start: "2023-05-01T00:00:00Z", End: "2023-06-01T00:00:00Z"})
+	assert.NoError(t, err)
+	locks, err := c.GetLocks()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.PeriodLock{lock}, locks)
+
+	assert.True(t, HasCode(c.DeleteBlock(utils.BID), "period_locked"))
+	assert.NoError(t, c.Reopen(lock.Id))
+	assert.NoError(t, c.DeleteBlock(utils.BID))
+	assert.True(t, HasCode(c.Reopen(lock.Id), "lock_not_found"))
+}
+
+func TestTrash(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	_, err := c.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	assert.NoError(t, c.DeletePause(utils.PID))
+	assert.NoError(t, c.DeleteBlock(utils.BID))
+	trash, err := c.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(trash))
+	assert.Equal(t, utils.BID, trash[0].Id)
+
+	_, err = c.RestorePause(utils.PID)
+	assert.True(t, HasCode(err, "block_not_found"))
+	block, err := c.RestoreBlock(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(block.Pauses))
+	block, err = c.RestorePause(utils.PID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(block.Pauses))
+	_, err = c.RestoreBlock(utils.BID)
+	assert.True(t, HasCode(err, "trash_item_not_found"))
+}
+
+func TestAudit(t *testing.T) {
+	c, _ := newTestClient(t)
+	seed, err := auth.NewDigestKey()
+	assert.NoError(t, err)
+	t.Setenv("DIGEST_KEY", seed)
+
+	_, err = c.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	v, err := c.VerifyAudit()
+	assert.NoError(t, err)
+	assert.True(t, v.Valid)
+	assert.Equal(t, 1, v.Entries)
+
+	d, err := c.GetAuditDigest("2023-05")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, d.Signature)
+
+	_, err = c.GetAuditDigest(time.Now().Format("2006-01"))
+	assert.True(t, HasCode(err, "month_not_closed"))
+}
+
+func TestPauses(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	_, err := c.AddPause(utils.TestPauseCreate())
+	assert.True(t, HasCode(err, "block_not_found"))
+
+	_, err = c.AddBlock(utils.TestBlockCreateWithoutPause())
+	assert.NoError(t, err)
+
+	pause, err := c.AddPause(utils.TestPauseCreate())
+	assert.NoError(t, err)
+	utils.AssertTestPause(t, pause)
+
+	assert.NoError(t, c.UpdatePause(utils.TestPauseUpdated()))
+	assert.NoError(t, c.UpdatePauseStart(utils.PID, utils.PStart))
+	assert.NoError(t, c.UpdatePauseEnd(utils.PID, utils.PEnd))
+
+	block, err := c.GetBlock(utils.BID)
+	assert.NoError(t, err)
+	utils.AssertTestPause(t, block.Pauses[0])
+
+	assert.NoError(t, c.DeletePause(utils.PID))
+	assert.True(t, HasCode(c.DeletePause(utils.PID), "pause_not_found"))
+}
+
+func TestCurrentBlock(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	_, err := c.GetCurrentBlock()
+	assert.True(t, HasCode(err, "no_block_active"))
+
+	block, err := c.StartBlock(true)
+	assert.NoError(t, err)
+	assert.True(t, block.Homeoffice)
+
+	_, err = c.StartBlock(false)
+	assert.True(t, HasCode(err, "block_already_active"))
+
+	current, err := c.GetCurrentBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, block.Id, current.Id)
+
+	pause, err := c.StartPause()
+	assert.NoError(t, err)
+	assert.Equal(t, block.Id, pause.BlockID)
+
+	_, err = c.EndBlock()
+	assert.True(t, HasCode(err, "pause_not_ended"))
+
+	pause, err = c.EndPause()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pause.End)
+
+	block, err = c.EndBlock()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, block.End)
+}
+
+func TestSettings(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	settings, err := c.GetSettings()
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultSettings(), settings)
+
+	settings, err = c.UpdateSettings(models.Settings{Timezone: "Europe/Berlin"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Europe/Berlin", settings.Timezone)
+
+	_, err = c.UpdateSettings(models.Settings{Timezone: "invalid"})
+	assert.True(t, HasCode(err, "invalid_timezone"))
+}
+
+func TestSurcharges(t *testing.T) {
+	c, db := newTestClient(t)
+
+	config := models.DefaultSurchargeConfig()
+	config.Holidays = []string{"2023-05-01"}
+	updated, err := c.UpdateSurchargeConfig(config)
+	assert.NoError(t, err)
+	assert.Equal(t, config, updated)
+
+	fetched, err := c.GetSurchargeConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, config, fetched)
+
+	_, err = db.AddBlock(models.BlockCreate{Start: "2023-05-01T08:00:00Z", End: "2023-05-01T10:00:00Z"})
+	assert.NoError(t, err)
+	entries, err := c.GetPayroll("2023-05-01T00:00:00Z", "2023-06-01T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "holiday", entries[0].Categories[3].Category)
+	assert.Equal(t, 120, entries[0].Categories[3].Minutes)
+}
+
+func TestTimesheetPDF(t *testing.T) {
+	c, db := newTestClient(t)
+
+	_, err := db.AddBlock(models.BlockCreate{Start: "2023-05-02T08:00:00Z", End: "2023-05-02T16:00:00Z"})
+	assert.NoError(t, err)
+	data, err := c.TimesheetPDF("2023-05")
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-")))
+
+	_, err = c.TimesheetPDF("May")
+	assert.True(t, HasCode(err, "invalid_month"))
+}
+
+func TestCalendar(t *testing.T) {
+	c, db := newTestClient(t)
+
+	_, err := db.AddBlock(models.BlockCreate{Start: "2023-05-02T08:00:00Z", End: "2023-05-02T16:00:00Z"})
+	assert.NoError(t, err)
+	data, err := c.BlocksICS("2023-05-01T00:00:00Z", "2023-06-01T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "DTSTART:20230502T080000Z")
+
+	_, err = c.GetFeed()
+	assert.True(t, HasCode(err, "feed_not_found"))
+	feed, err := c.RegenerateFeed()
+	assert.NoError(t, err)
+	fetched, err := c.GetFeed()
+	assert.NoError(t, err)
+	assert.Equal(t, feed, fetched)
+
+	res, err := http.Get(feed.URL)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestImportICS(t *testing.T) {
+	c, db := newTestClient(t)
+
+	_, err := db.AddBlock(models.BlockCreate{Start: "2023-05-02T08:00:00Z", End: "2023-05-02T16:00:00Z", Project: "Website"})
+	assert.NoError(t, err)
+	data, err := c.BlocksICS("", "")
+	assert.NoError(t, err)
+
+	report, err := c.ImportICS(data, "website", "", true)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, models.ImportOverlap, report.Results[0].Status)
+
+	_, err = c.ImportICS([]byte("BEGIN:VEVENT"), "", "", false)
+	assert.True(t, HasCode(err, "invalid_calendar"))
+}
+
+func TestConvertBlocks(t *testing.T) {
+	c, db := newTestClient(t)
+
+	_, err := db.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	data, err := c.ExportBlocks("timewarrior", "2023-05-01T00:00:00Z", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "inc "))
+
+	report, err := c.ImportBlocks("timewarrior", data, true)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportOverlap, report.Results[0].Status)
+
+	_, err = c.ExportBlocks("excel", "", "")
+	assert.True(t, HasCode(err, "invalid_format"))
+	_, err = c.ImportBlocks("toggl-json", []byte("{"), false)
+	assert.True(t, HasCode(err, "invalid_import"))
+}
+
+func TestBackup(t *testing.T) {
+	c, db := newTestClient(t)
+
+	_, err := db.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	backup, err := c.GetBackup()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(backup.Blocks))
+
+	_, err = db.DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+	report, err := c.Restore(backup, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Blocks)
+	restored, err := c.GetBackup()
+	assert.NoError(t, err)
+	assert.Equal(t, backup, restored)
+
+	_, err = c.Restore(backup, "append")
+	assert.True(t, HasCode(err, "invalid_mode"))
+	backup.Version = 0
+	_, err = c.Restore(backup, "merge")
+	assert.True(t, HasCode(err, "invalid_backup"))
+}
+
+func TestSnapshotsDisabled(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	_, err := c.GetSnapshots()
+	assert.True(t, HasCode(err, "snapshots_disabled"))
+	_, err = c.CreateSnapshot()
+	assert.True(t, HasCode(err, "snapshots_disabled"))
+}
+
+func TestWorkflowNotSupported(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	_, err := c.Submit(models.SubmissionCreate{Period: "week", Date: "2023-05-10"})
+	assert.True(t, HasCode(err, "not_supported"))
+	_, err = c.GetEvents(0)
+	assert.True(t, HasCode(err, "not_supported"))
+}
+
+func TestAutomaticRefresh(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	expiring := createToken(t, 10*time.Second)
+	assert.NoError(t, c.SetToken(expiring))
+
+	_, err := c.GetBlocks("", "")
+	assert.NoError(t, err)
+	assert.NotEqual(t, expiring, c.Token())
+	assert.True(t, time.Until(c.expiresAt) > refreshWindow)
+}
+
+func TestLoginAfterExpiry(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	expired := createToken(t, -time.Minute)
+	assert.NoError(t, c.SetToken(expired))
+
+	_, err := c.GetBlocks("", "")
+	assert.NoError(t, err)
+	assert.NotEqual(t, expired, c.Token())
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	spec, err := c.OpenAPISpec()
+	assert.NoError(t, err)
+	assert.Contains(t, spec, "paths")
+}
+
+func TestErrorWithoutProblem(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	c := New(ts.URL, nil)
+	assert.NoError(t, c.SetToken(createToken(t, time.Hour)))
+	_, err := c.GetBlock(1)
+	var e *Error
+	assert.ErrorAs(t, err, &e)
+	assert.Equal(t, http.StatusNotFound, e.StatusCode)
+	assert.Equal(t, "", e.Code)
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/auth"
+	"github.com/kilianmandscharo/work_hours/convert"
+	"github.com/kilianmandscharo/work_hours/database"
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/report"
+	"github.com/kilianmandscharo/work_hours/server"
+	"github.com/kilianmandscharo/work_hours/snapshot"
+	"github.com/kilianmandscharo/work_hours/utils"
+)
+
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	dbPath := fs.String("db", os.Getenv("WORK_HOURS_DB"), "path of the SQLite database or postgres:// URL (default $WORK_HOURS_DB or ~/.work_hours_data/data.db)")
+	return fs, dbPath
+}
+
+func openDatabase(dbPath string) (*database.DB, error) {
+	db, err := database.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open database: %w", err)
+	}
+
+	if err := db.Init(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not initialize database: %w", err)
+	}
+	if _, err := db.AdoptBlocks(envOwner()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not assign blocks without a creator: %w", err)
+	}
+
+	return db, nil
+}
+
+// envOwner returns the user of the env file, who created the blocks of the
+// time before there were accounts, or "" without an env file.
+func envOwner() string {
+	env, err := utils.EnvVariables()
+	if err != nil {
+		return ""
+	}
+	return env.Email
+}
+
+func readLine(stdin io.Reader) (string, error) {
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func runServe(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs, dbPath := newFlagSet("serve")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	snapshotDir := fs.String("snapshot-dir", "", "write daily snapshots of the SQLite database to this directory")
+	snapshotAt := fs.String("snapshot-at", "03:00", "local time of day to write the daily snapshot")
+	keepDaily := fs.Int("keep-daily", 7, "number of days to keep the newest snapshot of")
+	keepMonthly := fs.Int("keep-monthly", 12, "number of months to keep the newest snapshot of")
+	trashRetention := fs.Duration("trash-retention", 30*24*time.Hour, "purge deleted blocks and pauses from the trash after this long, 0 keeps them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *trashRetention < 0 {
+		return errors.New("-trash-retention must not be negative")
+	}
+
+	var at time.Duration
+	if *snapshotDir != "" {
+		if database.IsPostgresURL(*dbPath) {
+			return errors.New("snapshots are not supported for PostgreSQL, use pg_dump")
+		}
+		if *keepDaily < 0 || *keepMonthly < 0 {
+			return errors.New("-keep-daily and -keep-monthly must not be negative")
+		}
+		var err error
+		if at, err = snapshot.ParseClock(*snapshotAt); err != nil {
+			return err
+		}
+	}
+
+	db, err := openDatabase(*dbPath)
+	if err != nil {
+		return err
+	}
+
+	s := server.NewServer(*addr, db)
+	if *snapshotDir != "" {
+		retention := snapshot.Retention{Daily: *keepDaily, Monthly: *keepMonthly}
+		s.EnableSnapshots(snapshot.New(*snapshotDir, db, retention), at)
+	}
+	if *trashRetention > 0 {
+		s.EnableTrashPurge(*trashRetention)
+	}
+	return s.ListenAndServe()
+}
+
+func runMigrate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs, dbPath := newFlagSet("migrate")
+	owner := fs.String("owner", envOwner(), "user who becomes the creator of blocks without one (default EMAIL of the .env file)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := database.Open(*dbPath)
+	if err != nil {
+		return fmt.Errorf("could not open database: %w", err)
+	}
+	defer db.Close()
+
+	from, err := db.SchemaVersion()
+	if err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+	applied, err := db.Migrate()
+	if err != nil {
+		return fmt.Errorf("could not migrate database after %d migrations: %w", applied, err)
+	}
+
+	if applied == 0 {
+		fmt.Fprintf(stdout, "database is up to date at version %d\n", from)
+	} else {
+		fmt.Fprintf(stdout, "applied %d migrations, version %d to %d\n", applied, from+1, from+applied)
+	}
+
+	if *owner == "" {
+		return nil
+	}
+	adopted, err := db.AdoptBlocks(*owner)
+	if err != nil {
+		return fmt.Errorf("could not assign blocks without a creator: %w", err)
+	}
+	if adopted > 0 {
+		fmt.Fprintf(stdout, "assigned %d blocks without a creator to %s\n", adopted, *owner)
+	}
+	return nil
+}
+
+func runHashPassword(args []string, stdin io.Reader, stdout io.Writer) error {
+	var password string
+	if len(args) > 0 {
+		password = args[0]
+	} else {
+		var err error
+		if password, err = readLine(stdin); err != nil {
+			return err
+		}
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, hash)
+	return nil
+}
+
+func runDigestKey(args []string, stdin io.Reader, stdout io.Writer) error {
+	key, err := auth.NewDigestKey()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, key)
+	return nil
+}
+
+func runUser(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: user <add|list|disable|enable|role> [flags] [email] [role]")
+	}
+
+	fs, dbPath := newFlagSet("user " + args[0])
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	db, err := openDatabase(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "add":
+		if fs.NArg() != 1 {
+			return errors.New("usage: user add [flags] <email>, password is read from stdin")
+		}
+		password, err := readLine(stdin)
+		if err != nil {
+			return err
+		}
+		if password == "" {
+			return errors.New("password must not be empty")
+		}
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		user, err := db.AddUser(fs.Arg(0), hash)
+		if err != nil {
+			return fmt.Errorf("could not add user: %w", err)
+		}
+		fmt.Fprintf(stdout, "added user %d (%s)\n", user.Id, user.Email)
+	case "list":
+		users, err := db.GetAllUsers()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tEMAIL\tDISABLED\tROLE")
+		for _, u := range users {
+			fmt.Fprintf(w, "%d\t%s\t%t\t%s\n", u.Id, u.Email, u.Disabled, u.Role)
+		}
+		return w.Flush()
+	case "disable", "enable":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: user %s [flags] <email>", args[0])
+		}
+		rowsAffected, err := db.SetUserDisabled(fs.Arg(0), args[0] == "disable")
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("user %s not found", fs.Arg(0))
+		}
+		fmt.Fprintf(stdout, "%sd user %s\n", args[0], fs.Arg(0))
+	case "role":
+		if fs.NArg() != 2 {
+			return errors.New("usage: user role [flags] <email> <employee|manager|admin>")
+		}
+		rowsAffected, err := db.SetUserRole(fs.Arg(0), fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("user %s not found", fs.Arg(0))
+		}
+		fmt.Fprintf(stdout, "user %s is now %s\n", fs.Arg(0), fs.Arg(1))
+	default:
+		return fmt.Errorf("unknown user command %q", args[0])
+	}
+
+	return nil
+}
+
+func getBlocks(db *database.DB, start, end string) ([]models.Block, error) {
+	timeRange, err := database.ParseTimeRange(start, end, "")
+	if err != nil {
+		return nil, err
+	}
+	return db.GetBlocksInRange(timeRange)
+}
+
+// userLocation returns the time zone of the user with the given email, or
+// the local time zone without one.
+func userLocation(db *database.DB, email string) (*time.Location, error) {
+	if email == "" {
+		return time.Local, nil
+	}
+	settings, err := db.GetSettings(email)
+	if err != nil {
+		return nil, err
+	}
+	return settings.Location()
+}
+
+// formatNames lists the formats the export and import commands accept.
+func formatNames() string {
+	names := []string{"json"}
+	for _, f := range convert.Formats {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func runExport(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs, dbPath := newFlagSet("export")
+	start := fs.String("start", "", "only export blocks starting at or after this RFC3339 time")
+	end := fs.String("end", "", "only export blocks ending at or before this RFC3339 time")
+	out := fs.String("o", "", "output file (default stdout)")
+	formatName := fs.String("format", "json", "one of "+formatNames())
+	user := fs.String("user", "", "write local times in this user's time zone")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var format convert.Format
+	if *formatName != "json" {
+		var err error
+		if format, err = convert.LookupFormat(*formatName); err != nil {
+			return err
+		}
+	}
+
+	db, err := openDatabase(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	blocks, err := getBlocks(db, *start, *end)
+	if err != nil {
+		return err
+	}
+	if blocks == nil {
+		blocks = []models.Block{}
+	}
+
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *formatName != "json" {
+		loc, err := userLocation(db, *user)
+		if err != nil {
+			return err
+		}
+		entries, err := convert.FromBlocks(blocks)
+		if err != nil {
+			return err
+		}
+		return format.Encode(w, entries, convert.Options{Loc: loc, Email: *user})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(blocks)
+}
+
+func runImport(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs, dbPath := newFlagSet("import")
+	in := fs.String("i", "", "input file (default stdin)")
+	formatName := fs.String("format", "json", "one of "+formatNames())
+	user := fs.String("user", "", "create the blocks as this user and read local times in their time zone")
+	dryRun := fs.Bool("dry-run", false, "only report what would be imported")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	r := stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var format convert.Format
+	if *formatName != "json" {
+		var err error
+		if format, err = convert.LookupFormat(*formatName); err != nil {
+			return err
+		}
+	}
+
+	db, err := openDatabase(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var blocks []models.BlockImport
+	if *formatName == "json" {
+		blocks, err = decodeJSONBlocks(r)
+	} else {
+		blocks, err = decodeConverted(db, format, *user, r)
+	}
+	if err != nil {
+		return err
+	}
+
+	var store database.Store = db
+	if *user != "" {
+		store = db.WithUser(*user)
+	}
+	// a single transaction, so that a failing block leaves nothing behind
+	result, err := store.ImportBlocks(blocks, *dryRun)
+	if err != nil {
+		return fmt.Errorf("could not import blocks: %w", err)
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tEND\tSTATUS\tBLOCK")
+	for _, res := range result.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", res.Start, res.End, res.Status, res.BlockID)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	verb := "imported"
+	if *dryRun {
+		verb = "would import"
+	}
+	fmt.Fprintf(stdout, "%s %d blocks, skipped %d\n", verb, result.Created, result.Skipped)
+	return nil
+}
+
+// decodeJSONBlocks reads blocks as written by export. Like the converted
+// formats, the UID of a block is its start, so that importing the same file
+// again skips the blocks imported before.
+func decodeJSONBlocks(r io.Reader) ([]models.BlockImport, error) {
+	var blocks []models.BlockCreate
+	if err := json.NewDecoder(r).Decode(&blocks); err != nil {
+		return nil, fmt.Errorf("could not read blocks: %w", err)
+	}
+
+	imports := make([]models.BlockImport, 0, len(blocks))
+	for i, block := range blocks {
+		if !block.Valid() {
+			return nil, fmt.Errorf("block %d: invalid datetime found", i)
+		}
+		start, _ := time.Parse(time.RFC3339, block.Start)
+		imports = append(imports, models.BlockImport{
+			UID:   "json:" + start.UTC().Format("20060102T150405Z"),
+			Block: block,
+		})
+	}
+	return imports, nil
+}
+
+// decodeConverted reads the entries of another time tracker like the
+// server's import endpoint.
+func decodeConverted(db *database.DB, format convert.Format, user string, r io.Reader) ([]models.BlockImport, error) {
+	loc, err := userLocation(db, user)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := format.Decode(r, convert.Options{Loc: loc, Email: user})
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s entries: %w", format.Name, err)
+	}
+	return convert.ToBlocks(entries, format.Name, loc), nil
+}
+
+func runBackup(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs, dbPath := newFlagSet("backup")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: backup [flags] <destination>")
+	}
+
+	db, err := openDatabase(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.Backup(fs.Arg(0)); err != nil {
+		return fmt.Errorf("could not write backup: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "wrote backup to %s\n", fs.Arg(0))
+	return nil
+}
+
+func runRestore(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs, dbPath := newFlagSet("restore")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: restore [flags] <snapshot>")
+	}
+	if database.IsPostgresURL(*dbPath) {
+		return errors.New("restore is not supported for PostgreSQL, use pg_restore")
+	}
+
+	dest := *dbPath
+	if dest == "" {
+		var err error
+		if dest, err = database.DefaultPath(); err != nil {
+			return err
+		}
+	}
+	if err := database.RestoreSnapshot(fs.Arg(0), dest); err != nil {
+		return fmt.Errorf("could not restore snapshot: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "restored %s from %s\n", dest, fs.Arg(0))
+	return nil
+}
+
+func runReport(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs, dbPath := newFlagSet("report")
+	start := fs.String("start", "", "only include blocks starting at or after this RFC3339 time")
+	end := fs.String("end", "", "only include blocks ending at or before this RFC3339 time")
+	periodFlag := fs.String("period", "day", "group by day, week or month")
+	user := fs.String("user", "", "group by the calendar of this user's time zone")
+	attributionFlag := fs.String("attribute", "split", "split blocks crossing midnight between days or count them on their start day")
+	check := fs.Bool("check", false, "also list the days on which the blocks of -user break the working time rules")
+	defaults := report.DefaultComplianceRules()
+	maxDaily := fs.Duration("max-daily", defaults.MaxDaily, "maximum net time worked on a day for -check, 0 to skip")
+	minRest := fs.Duration("min-rest", defaults.MinRest, "minimum rest between the work of two days for -check, 0 to skip")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *check && *user == "" {
+		return errors.New("-check needs the -user whose blocks to check")
+	}
+
+	period, err := report.ParsePeriod(*periodFlag)
+	if err != nil {
+		return err
+	}
+	attribution, err := report.ParseAttribution(*attributionFlag)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	blocks, err := getBlocks(db, *start, *end)
+	if err != nil {
+		return err
+	}
+
+	loc, err := userLocation(db, *user)
+	if err != nil {
+		return err
+	}
+
+	entries, err := report.Summarize(blocks, period, loc, attribution)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tBLOCKS\tHOMEOFFICE\tPAUSES\tNET")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", e.Period, e.Blocks, e.Homeoffice, e.Pauses, e.Net)
+	}
+	if err := w.Flush(); err != nil || !*check {
+		return err
+	}
+
+	// The rules apply to one person, so only the user's own blocks count.
+	timeRange, err := database.ParseTimeRange(*start, *end, "")
+	if err != nil {
+		return err
+	}
+	userBlocks, err := db.GetUserBlocksInRange(*user, timeRange)
+	if err != nil {
+		return err
+	}
+	violations, err := report.Check(userBlocks, loc, attribution, report.ComplianceRules{MaxDaily: *maxDaily, MinRest: *minRest})
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		fmt.Fprintln(stdout, "\nno violations")
+		return nil
+	}
+	fmt.Fprintln(stdout)
+	w = tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tRULE\tACTUAL\tLIMIT")
+	for _, v := range violations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.Day, v.Rule, v.Actual, v.Limit)
+	}
+	return w.Flush()
+}
+
+func runAudit(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: audit <verify|digest> [flags]")
+	}
+
+	fs, dbPath := newFlagSet("audit " + args[0])
+	month := fs.String("month", "", "month of the digest as YYYY-MM")
+	user := fs.String("user", "", "bound the month in this user's time zone")
+	out := fs.String("o", "", "output file of the digest (default stdout)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	db, err := openDatabase(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "verify":
+		v, err := db.VerifyAuditChain()
+		if err != nil {
+			return err
+		}
+		if !v.Valid {
+			return fmt.Errorf("audit log broken at entry %d: %s", v.BrokenID, v.Reason)
+		}
+		fmt.Fprintf(stdout, "audit log intact, %d entries, head %s\n", v.Entries, v.Head)
+	case "digest":
+		loc, err := userLocation(db, *user)
+		if err != nil {
+			return err
+		}
+		env, err := utils.EnvVariables()
+		if err != nil {
+			return fmt.Errorf("could not load env file: %w", err)
+		}
+		key, err := auth.DigestKey(env.DigestKey)
+		if err != nil {
+			return err
+		}
+		digest, err := database.MonthAuditDigest(db, *month, loc, time.Now(), key)
+		if err != nil {
+			return err
+		}
+
+		w := stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(digest)
+	default:
+		return fmt.Errorf("unknown audit command %q", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/auth"
+	"github.com/kilianmandscharo/work_hours/database"
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout)
+	return stdout.String(), err
+}
+
+func TestUnknownCommand(t *testing.T) {
+	_, err := runCommand(t, "", "invalid")
+	assert.Error(t, err)
+}
+
+func TestHashPasswordCommand(t *testing.T) {
+	out, err := runCommand(t, "", "hash-password", "password")
+	assert.NoError(t, err)
+	assert.True(t, auth.ValidatePassword("password", strings.TrimSpace(out)))
+
+	out, err = runCommand(t, "password\n", "hash-password")
+	assert.NoError(t, err)
+	assert.True(t, auth.ValidatePassword("password", strings.TrimSpace(out)))
+}
+
+func TestUserCommand(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+
+	_, err := runCommand(t, "password\n", "user", "add", "-db", dbPath, "test@example.com")
+	assert.NoError(t, err)
+
+	_, err = runCommand(t, "password\n", "user", "add", "-db", dbPath, "test@example.com")
+	assert.Error(t, err)
+
+	_, err = runCommand(t, "", "user", "disable", "-db", dbPath, "test@example.com")
+	assert.NoError(t, err)
+
+	_, err = runCommand(t, "", "user", "disable", "-db", dbPath, "invalid@example.com")
+	assert.Error(t, err)
+
+	_, err = runCommand(t, "", "user", "role", "-db", dbPath, "test@example.com", "manager")
+	assert.NoError(t, err)
+
+	_, err = runCommand(t, "", "user", "role", "-db", dbPath, "test@example.com", "boss")
+	assert.Error(t, err)
+
+	out, err := runCommand(t, "", "user", "list", "-db", dbPath)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "test@example.com")
+	assert.Contains(t, out, "true")
+	assert.Contains(t, out, "manager")
+}
+
+func TestExportImportCommands(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.db")
+	target := filepath.Join(dir, "target.db")
+
+	data, err := json.Marshal([]models.BlockCreate{utils.TestBlockCreate()})
+	assert.NoError(t, err)
+
+	_, err = runCommand(t, string(data), "import", "-db", source)
+	assert.NoError(t, err)
+
+	exported, err := runCommand(t, "", "export", "-db", source)
+	assert.NoError(t, err)
+
+	out, err := runCommand(t, exported, "import", "-db", target, "-dry-run")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "would import 1 blocks, skipped 0")
+	out, err = runCommand(t, exported, "import", "-db", target)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "imported 1 blocks, skipped 0")
+	out, err = runCommand(t, exported, "import", "-db", target)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "imported 0 blocks, skipped 1")
+
+	out, err = runCommand(t, "", "export", "-db", target)
+	assert.NoError(t, err)
+	assert.Equal(t, exported, out)
+
+	var blocks []models.Block
+	assert.NoError(t, json.Unmarshal([]byte(out), &blocks))
+	assert.Equal(t, 1, len(blocks))
+	utils.AssertTestBlock(t, blocks[0])
+	utils.AssertTestPause(t, blocks[0].Pauses[0])
+
+	// -user creates the blocks as that user, whose UIDs are their own.
+	out, err = runCommand(t, exported, "import", "-db", target, "-user", "other@example.com")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "imported 1 blocks, skipped 0")
+	db, err := database.Open(target)
+	assert.NoError(t, err)
+	defer db.Close()
+	owned, err := db.WithOwner("other@example.com").GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(owned))
+}
+
+func TestConvertCommands(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.db")
+
+	data, err := json.Marshal([]models.BlockCreate{utils.TestBlockCreate()})
+	assert.NoError(t, err)
+	_, err = runCommand(t, string(data), "import", "-db", source)
+	assert.NoError(t, err)
+
+	for _, format := range []string{"timewarrior", "toggl-csv", "toggl-json"} {
+		t.Run(format, func(t *testing.T) {
+			target := filepath.Join(dir, format+".db")
+			exported, err := runCommand(t, "", "export", "-db", source, "-format", format)
+			assert.NoError(t, err)
+
+			out, err := runCommand(t, exported, "import", "-db", target, "-format", format, "-dry-run")
+			assert.NoError(t, err)
+			assert.Contains(t, out, "would import 1 blocks, skipped 0")
+
+			out, err = runCommand(t, exported, "import", "-db", target, "-format", format)
+			assert.NoError(t, err)
+			assert.Contains(t, out, "skipped 0")
+
+			out, err = runCommand(t, exported, "import", "-db", target, "-format", format)
+			assert.NoError(t, err)
+			assert.Contains(t, out, "imported 0 blocks, skipped 1")
+
+			out, err = runCommand(t, "", "export", "-db", target)
+			assert.NoError(t, err)
+			var blocks []models.Block
+			assert.NoError(t, json.Unmarshal([]byte(out), &blocks))
+			assert.Equal(t, 1, len(blocks))
+			assert.Equal(t, 1, len(blocks[0].Pauses))
+		})
+	}
+
+	_, err = runCommand(t, "", "export", "-db", source, "-format", "excel")
+	assert.Error(t, err)
+	_, err = runCommand(t, "garbage", "import", "-db", source, "-format", "timewarrior")
+	assert.Error(t, err)
+}
+
+func TestMigrateCommand(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+
+	out, err := runCommand(t, "", "migrate", "-db", dbPath)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "applied ")
+	assert.Contains(t, out, " migrations, version 1 to ")
+
+	out, err = runCommand(t, "", "migrate", "-db", dbPath)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "database is up to date at version ")
+}
+
+func TestMigrateCommandOwner(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+
+	_, err := runCommand(t, "", "migrate", "-db", dbPath, "-owner", "")
+	assert.NoError(t, err)
+	conn, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = conn.Exec(`INSERT INTO block (start, "end", homeoffice, created_by) VALUES ('2023-06-01T08:00:00Z', '2023-06-01T16:00:00Z', 0, '')`)
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Close())
+
+	out, err := runCommand(t, "", "migrate", "-db", dbPath, "-owner", "legacy@example.com")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "assigned 1 blocks without a creator to legacy@example.com")
+
+	out, err = runCommand(t, "", "migrate", "-db", dbPath, "-owner", "legacy@example.com")
+	assert.NoError(t, err)
+	assert.NotContains(t, out, "assigned ")
+}
+
+func TestBackupCommand(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.db")
+	dest := filepath.Join(dir, "backup.db")
+
+	_, err := runCommand(t, "", "migrate", "-db", dbPath)
+	assert.NoError(t, err)
+
+	_, err = runCommand(t, "", "backup", "-db", dbPath, dest)
+	assert.NoError(t, err)
+	_, err = os.Stat(dest)
+	assert.NoError(t, err)
+
+	_, err = runCommand(t, "", "backup", "-db", dbPath, dest)
+	assert.Error(t, err)
+}
+
+func TestRestoreCommand(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.db")
+	snapshot := filepath.Join(dir, "snapshot.db")
+
+	data, err := json.Marshal([]models.BlockCreate{utils.TestBlockCreate()})
+	assert.NoError(t, err)
+	_, err = runCommand(t, string(data), "import", "-db", dbPath)
+	assert.NoError(t, err)
+	_, err = runCommand(t, "", "backup", "-db", dbPath, snapshot)
+	assert.NoError(t, err)
+
+	data, err = json.Marshal([]models.BlockCreate{{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T15:00:00Z"}})
+	assert.NoError(t, err)
+	_, err = runCommand(t, string(data), "import", "-db", dbPath)
+	assert.NoError(t, err)
+
+	out, err := runCommand(t, "", "restore", "-db", dbPath, snapshot)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "restored "+dbPath)
+	_, err = os.Stat(dbPath + ".before-restore")
+	assert.NoError(t, err)
+
+	out, err = runCommand(t, "", "export", "-db", dbPath)
+	assert.NoError(t, err)
+	var blocks []models.Block
+	assert.NoError(t, json.Unmarshal([]byte(out), &blocks))
+	assert.Equal(t, 1, len(blocks))
+	utils.AssertTestBlock(t, blocks[0])
+
+	notDatabase := filepath.Join(dir, "notes.txt")
+	assert.NoError(t, os.WriteFile(notDatabase, []byte("not a database"), 0o600))
+	_, err = runCommand(t, "", "restore", "-db", dbPath, notDatabase)
+	assert.Error(t, err)
+	_, err = runCommand(t, "", "restore", "-db", dbPath, filepath.Join(dir, "missing.db"))
+	assert.Error(t, err)
+}
+
+func TestAuditCommand(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+
+	data, err := json.Marshal([]models.BlockCreate{utils.TestBlockCreate()})
+	assert.NoError(t, err)
+	_, err = runCommand(t, string(data), "import", "-db", dbPath)
+	assert.NoError(t, err)
+
+	out, err := runCommand(t, "", "audit", "verify", "-db", dbPath)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "audit log intact, 1 entries")
+
+	t.Setenv("DIGEST_KEY", "")
+	_, err = runCommand(t, "", "audit", "digest", "-db", dbPath, "-month", "2023-05")
+	assert.ErrorIs(t, err, auth.ErrMissingDigestKey)
+
+	seed, err := runCommand(t, "", "digest-key")
+	assert.NoError(t, err)
+	t.Setenv("DIGEST_KEY", strings.TrimSpace(seed))
+	out, err = runCommand(t, "", "audit", "digest", "-db", dbPath, "-month", "2023-05")
+	assert.NoError(t, err)
+	var digest models.AuditDigest
+	assert.NoError(t, json.Unmarshal([]byte(out), &digest))
+	assert.Equal(t, "2023-05", digest.Month)
+	assert.True(t, database.VerifyAuditDigest(digest))
+
+	_, err = runCommand(t, "", "audit", "digest", "-db", dbPath, "-month", time.Now().Format("2006-01"))
+	assert.ErrorIs(t, err, database.ErrMonthNotClosed)
+	_, err = runCommand(t, "", "audit", "digest", "-db", dbPath)
+	assert.Error(t, err)
+}
+
+func TestReportCommand(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+
+	data, err := json.Marshal([]models.BlockCreate{utils.TestBlockCreate()})
+	assert.NoError(t, err)
+	_, err = runCommand(t, string(data), "import", "-db", dbPath)
+	assert.NoError(t, err)
+
+	out, err := runCommand(t, "", "report", "-db", dbPath, "-period", "month")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "2023-05")
+	assert.Contains(t, out, "8h0m0s")
+
+	_, err = runCommand(t, "", "report", "-db", dbPath, "-period", "year")
+	assert.Error(t, err)
+
+	out, err = runCommand(t, "", "report", "-db", dbPath, "-attribute", "start")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "8h0m0s")
+
+	_, err = runCommand(t, "", "report", "-db", dbPath, "-attribute", "end")
+	assert.Error(t, err)
+
+	_, err = runCommand(t, "", "report", "-db", dbPath, "-check")
+	assert.Error(t, err)
+	out, err = runCommand(t, "", "report", "-db", dbPath, "-check", "-user", "system")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "no violations")
+	out, err = runCommand(t, "", "report", "-db", dbPath, "-check", "-user", "system", "-max-daily", "7h")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "2023-05-09  max-daily  8h0m0s  7h0m0s")
+}
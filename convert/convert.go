@@ -0,0 +1,183 @@
+// Package convert translates blocks from and to the formats of other time
+// trackers, Timewarrior and Toggl. Both track flat intervals, which are
+// merged into blocks with pauses on import and split up again on export.
+package convert
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/report"
+)
+
+// HomeofficeTag marks intervals worked from home.
+const HomeofficeTag = "homeoffice"
+
+// Entry is a single tracked interval. End is zero while it is running. The
+// project is kept apart from the other tags, even for Timewarrior which
+// only knows tags.
+type Entry struct {
+	Start       time.Time
+	End         time.Time
+	Project     string
+	Description string
+	Tags        []string
+	Billable    bool
+}
+
+func (e Entry) homeoffice() bool {
+	for _, tag := range e.Tags {
+		if tag == HomeofficeTag {
+			return true
+		}
+	}
+	return false
+}
+
+// Options are passed to every format. Loc is the time zone of local times
+// and of the days gaps are merged within, Email is written where a format
+// requires a user.
+type Options struct {
+	Loc   *time.Location
+	Email string
+}
+
+// Format reads and writes entries in the file format of another tracker.
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	Decode      func(r io.Reader, opts Options) ([]Entry, error)
+	Encode      func(w io.Writer, entries []Entry, opts Options) error
+}
+
+// Formats lists the supported formats.
+var Formats = []Format{
+	{Name: "timewarrior", ContentType: "text/plain; charset=utf-8", Extension: "data", Decode: DecodeTimewarrior, Encode: EncodeTimewarrior},
+	{Name: "toggl-csv", ContentType: "text/csv; charset=utf-8", Extension: "csv", Decode: DecodeTogglCSV, Encode: EncodeTogglCSV},
+	{Name: "toggl-json", ContentType: "application/json; charset=utf-8", Extension: "json", Decode: DecodeTogglJSON, Encode: EncodeTogglJSON},
+}
+
+// LookupFormat returns the format with the given name.
+func LookupFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return Format{}, fmt.Errorf("unknown format %q", name)
+}
+
+// FromBlocks splits every block into the entries worked between its pauses.
+// A running block ends with a running entry, unless it is paused right now.
+func FromBlocks(blocks []models.Block) ([]Entry, error) {
+	var entries []Entry
+	for _, b := range blocks {
+		start, err := time.Parse(time.RFC3339, b.Start)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", b.Id, err)
+		}
+		var end time.Time
+		if b.End != "" {
+			if end, err = time.Parse(time.RFC3339, b.End); err != nil {
+				return nil, fmt.Errorf("block %d: %w", b.Id, err)
+			}
+		}
+
+		template := Entry{Project: b.Project, Billable: b.Billable}
+		if b.Homeoffice {
+			template.Tags = []string{HomeofficeTag}
+		}
+
+		pauses := make([]models.Pause, len(b.Pauses))
+		copy(pauses, b.Pauses)
+		sort.Slice(pauses, func(i, j int) bool { return pauses[i].Start < pauses[j].Start })
+
+		running := true
+		for _, p := range pauses {
+			pauseStart, err := time.Parse(time.RFC3339, p.Start)
+			if err != nil {
+				return nil, fmt.Errorf("pause %d: %w", p.Id, err)
+			}
+			if pauseStart.After(start) {
+				e := template
+				e.Start, e.End = start, pauseStart
+				entries = append(entries, e)
+			}
+			if p.End == "" {
+				running = false
+				break
+			}
+			if start, err = time.Parse(time.RFC3339, p.End); err != nil {
+				return nil, fmt.Errorf("pause %d: %w", p.Id, err)
+			}
+		}
+
+		if running && (end.IsZero() || end.After(start)) {
+			e := template
+			e.Start, e.End = start, end
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// continues reports whether next continues the block that ends with last:
+// it starts after last but before dayEnd and shares its project.
+func continues(last Entry, next Entry, dayEnd time.Time) bool {
+	return !next.Start.Before(last.End) && next.Start.Before(dayEnd) &&
+		next.Project == last.Project && next.Billable == last.Billable
+}
+
+// ToBlocks merges the finished entries of a day that share their project
+// into blocks, the gaps between them become pauses. Running entries are
+// skipped. The UID of a block is the source and its start, so that importing
+// the same file again finds the blocks imported before.
+func ToBlocks(entries []Entry, source string, loc *time.Location) []models.BlockImport {
+	var finished []Entry
+	for _, e := range entries {
+		if !e.End.IsZero() {
+			finished = append(finished, e)
+		}
+	}
+	sort.SliceStable(finished, func(i, j int) bool { return finished[i].Start.Before(finished[j].Start) })
+
+	format := func(t time.Time) string {
+		return t.In(loc).Format(time.RFC3339)
+	}
+
+	blocks := []models.BlockImport{}
+	for i := 0; i < len(finished); {
+		first := finished[i]
+		block := models.BlockCreate{
+			Start:      format(first.Start),
+			Project:    first.Project,
+			Billable:   first.Billable,
+			Homeoffice: first.homeoffice(),
+		}
+
+		_, dayEnd := report.DayBounds(first.Start, loc)
+		last := first
+		for i++; i < len(finished) && continues(last, finished[i], dayEnd); i++ {
+			next := finished[i]
+			if next.Start.After(last.End) {
+				block.Pauses = append(block.Pauses, models.PauseWithoutBlockID{
+					Start: format(last.End),
+					End:   format(next.Start),
+				})
+			}
+			block.Homeoffice = block.Homeoffice || next.homeoffice()
+			last = next
+		}
+		block.End = format(last.End)
+
+		blocks = append(blocks, models.BlockImport{
+			UID:   source + ":" + first.Start.UTC().Format("20060102T150405Z"),
+			Block: block,
+		})
+	}
+	return blocks
+}
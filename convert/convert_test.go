@@ -0,0 +1,153 @@
+package convert
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func testBlocks() []models.Block {
+	return []models.Block{
+		{
+			Id:         1,
+			Start:      "2023-05-09T07:00:00Z",
+			End:        "2023-05-09T15:30:00Z",
+			Homeoffice: true,
+			Project:    "Web site",
+			Billable:   true,
+			Pauses: []models.Pause{
+				{Id: 2, Start: "2023-05-09T12:30:00Z", End: "2023-05-09T13:00:00Z"},
+				{Id: 1, Start: "2023-05-09T10:00:00Z", End: "2023-05-09T10:15:00Z"},
+			},
+		},
+		{
+			Id:    2,
+			Start: "2023-05-10T07:00:00Z",
+			Pauses: []models.Pause{
+				{Id: 3, Start: "2023-05-10T09:00:00Z"},
+			},
+		},
+		{Id: 3, Start: "2023-05-11T07:00:00Z"},
+	}
+}
+
+func TestFromBlocks(t *testing.T) {
+	entries, err := FromBlocks(testBlocks())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(entries))
+
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		assert.NoError(t, err)
+		return parsed
+	}
+	assert.Equal(t, Entry{
+		Start:    at("2023-05-09T07:00:00Z"),
+		End:      at("2023-05-09T10:00:00Z"),
+		Project:  "Web site",
+		Tags:     []string{HomeofficeTag},
+		Billable: true,
+	}, entries[0])
+	assert.Equal(t, at("2023-05-09T10:15:00Z"), entries[1].Start)
+	assert.Equal(t, at("2023-05-09T13:00:00Z"), entries[2].Start)
+	assert.Equal(t, at("2023-05-09T15:30:00Z"), entries[2].End)
+	assert.Equal(t, at("2023-05-10T09:00:00Z"), entries[3].End)
+	assert.True(t, entries[4].End.IsZero())
+}
+
+func TestToBlocks(t *testing.T) {
+	entries, err := FromBlocks(testBlocks())
+	assert.NoError(t, err)
+	entries = append(entries, Entry{
+		Start:   entries[2].End.Add(time.Hour),
+		End:     entries[2].End.Add(2 * time.Hour),
+		Project: "Other",
+	})
+
+	blocks := ToBlocks(entries, "test", time.UTC)
+	assert.Equal(t, []models.BlockImport{
+		{
+			UID: "test:20230509T070000Z",
+			Block: models.BlockCreate{
+				Start:      "2023-05-09T07:00:00Z",
+				End:        "2023-05-09T15:30:00Z",
+				Homeoffice: true,
+				Project:    "Web site",
+				Billable:   true,
+				Pauses: []models.PauseWithoutBlockID{
+					{Start: "2023-05-09T10:00:00Z", End: "2023-05-09T10:15:00Z"},
+					{Start: "2023-05-09T12:30:00Z", End: "2023-05-09T13:00:00Z"},
+				},
+			},
+		},
+		{
+			UID:   "test:20230509T163000Z",
+			Block: models.BlockCreate{Start: "2023-05-09T16:30:00Z", End: "2023-05-09T17:30:00Z", Project: "Other"},
+		},
+		{
+			UID:   "test:20230510T070000Z",
+			Block: models.BlockCreate{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T09:00:00Z"},
+		},
+	}, blocks)
+}
+
+func TestToBlocksDays(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	entries := []Entry{
+		{Start: time.Date(2023, 5, 9, 20, 0, 0, 0, berlin), End: time.Date(2023, 5, 9, 22, 0, 0, 0, berlin)},
+		{Start: time.Date(2023, 5, 9, 23, 0, 0, 0, berlin), End: time.Date(2023, 5, 10, 1, 0, 0, 0, berlin)},
+		{Start: time.Date(2023, 5, 10, 2, 0, 0, 0, berlin), End: time.Date(2023, 5, 10, 3, 0, 0, 0, berlin)},
+	}
+
+	blocks := ToBlocks(entries, "test", berlin)
+	assert.Equal(t, 2, len(blocks))
+	assert.Equal(t, "2023-05-09T20:00:00+02:00", blocks[0].Block.Start)
+	assert.Equal(t, "2023-05-10T01:00:00+02:00", blocks[0].Block.End)
+	assert.Equal(t, 1, len(blocks[0].Block.Pauses))
+	assert.Equal(t, "2023-05-10T02:00:00+02:00", blocks[1].Block.Start)
+}
+
+func TestRoundTrip(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	opts := Options{Loc: berlin, Email: "test@test.com"}
+
+	for _, format := range Formats {
+		t.Run(format.Name, func(t *testing.T) {
+			entries, err := FromBlocks(testBlocks()[:1])
+			assert.NoError(t, err)
+			entries[0].Description = `notes with "quotes" # and hash`
+
+			var buf bytes.Buffer
+			assert.NoError(t, format.Encode(&buf, entries, opts))
+			decoded, err := format.Decode(&buf, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, len(entries), len(decoded))
+			for i := range entries {
+				assert.True(t, entries[i].Start.Equal(decoded[i].Start))
+				assert.True(t, entries[i].End.Equal(decoded[i].End))
+				assert.Equal(t, entries[i].Project, decoded[i].Project)
+				assert.Equal(t, entries[i].Tags, decoded[i].Tags)
+				assert.Equal(t, entries[i].Description, decoded[i].Description)
+			}
+
+			blocks := ToBlocks(decoded, format.Name, berlin)
+			assert.Equal(t, 1, len(blocks))
+			assert.Equal(t, 2, len(blocks[0].Block.Pauses))
+			assert.True(t, blocks[0].Block.Homeoffice)
+		})
+	}
+}
+
+func TestLookupFormat(t *testing.T) {
+	format, err := LookupFormat("toggl-csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "csv", format.Extension)
+
+	_, err = LookupFormat("excel")
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timewarriorFormat is the format of the times in Timewarrior's data files,
+// always in UTC.
+const timewarriorFormat = "20060102T150405Z"
+
+// splitTags splits the tags of a data file line at spaces. Tags containing
+// spaces are quoted.
+func splitTags(s string) ([]string, error) {
+	var tags []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] != '"' {
+			tag, rest, _ := strings.Cut(s, " ")
+			tags = append(tags, tag)
+			s = rest
+			continue
+		}
+
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag %s", s)
+		}
+		tag, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+		s = s[len(quoted):]
+	}
+	return tags, nil
+}
+
+func quoteTag(tag string) string {
+	if tag == "" || strings.ContainsAny(tag, " \"#\\") {
+		return strconv.Quote(tag)
+	}
+	return tag
+}
+
+// parseTimewarriorLine parses a line like
+// inc 20230509T070000Z - 20230509T120000Z # Website homeoffice # "notes".
+func parseTimewarriorLine(line string) (Entry, error) {
+	var e Entry
+	rest, ok := strings.CutPrefix(line, "inc ")
+	if !ok {
+		return e, fmt.Errorf("expected inc, got %q", line)
+	}
+
+	interval, tags, _ := strings.Cut(rest, " # ")
+	startValue, endValue, closed := strings.Cut(strings.TrimSpace(interval), " - ")
+	var err error
+	if e.Start, err = time.Parse(timewarriorFormat, startValue); err != nil {
+		return e, fmt.Errorf("invalid start %q", startValue)
+	}
+	if closed {
+		if e.End, err = time.Parse(timewarriorFormat, endValue); err != nil {
+			return e, fmt.Errorf("invalid end %q", endValue)
+		}
+	}
+
+	tags, annotation, annotated := strings.Cut(tags, " # ")
+	if annotated {
+		if e.Description, err = strconv.Unquote(strings.TrimSpace(annotation)); err != nil {
+			e.Description = strings.TrimSpace(annotation)
+		}
+	}
+	list, err := splitTags(tags)
+	if err != nil {
+		return e, err
+	}
+	for _, tag := range list {
+		if e.Project == "" && tag != HomeofficeTag {
+			e.Project = tag
+		} else {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	return e, nil
+}
+
+// DecodeTimewarrior reads the intervals of Timewarrior data files, like
+// ~/.timewarrior/data/2023-05.data. The first tag that is not the
+// homeoffice tag becomes the project, the annotation the description.
+func DecodeTimewarrior(r io.Reader, opts Options) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		e, err := parseTimewarriorLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// EncodeTimewarrior writes the entries as lines of a Timewarrior data file,
+// with the project as the first tag.
+func EncodeTimewarrior(w io.Writer, entries []Entry, opts Options) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		bw.WriteString("inc " + e.Start.UTC().Format(timewarriorFormat))
+		if !e.End.IsZero() {
+			bw.WriteString(" - " + e.End.UTC().Format(timewarriorFormat))
+		}
+
+		var tags []string
+		if e.Project != "" {
+			tags = append(tags, quoteTag(e.Project))
+		}
+		for _, tag := range e.Tags {
+			tags = append(tags, quoteTag(tag))
+		}
+		if len(tags) > 0 || e.Description != "" {
+			bw.WriteString(" # " + strings.Join(tags, " "))
+		}
+		if e.Description != "" {
+			bw.WriteString(" # " + strconv.Quote(e.Description))
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
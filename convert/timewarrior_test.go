@@ -0,0 +1,53 @@
+package convert
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeTimewarrior(t *testing.T) {
+	data := "inc 20230509T070000Z - 20230509T100000Z # homeoffice \"Web site\" meeting # \"daily\"\n" +
+		"\n" +
+		"inc 20230509T101500Z - 20230509T120000Z\n" +
+		"inc 20230510T070000Z # Website\n"
+
+	entries, err := DecodeTimewarrior(strings.NewReader(data), Options{Loc: time.UTC})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, Entry{
+		Start:       time.Date(2023, 5, 9, 7, 0, 0, 0, time.UTC),
+		End:         time.Date(2023, 5, 9, 10, 0, 0, 0, time.UTC),
+		Project:     "Web site",
+		Tags:        []string{HomeofficeTag, "meeting"},
+		Description: "daily",
+	}, entries[0])
+	assert.Equal(t, "", entries[1].Project)
+	assert.True(t, entries[2].End.IsZero())
+	assert.Equal(t, "Website", entries[2].Project)
+
+	for _, invalid := range []string{
+		"exc 20230509T070000Z\n",
+		"inc 2023-05-09\n",
+		"inc 20230509T070000Z - later\n",
+		"inc 20230509T070000Z # \"open\n",
+	} {
+		_, err := DecodeTimewarrior(strings.NewReader(invalid), Options{Loc: time.UTC})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestEncodeTimewarrior(t *testing.T) {
+	entries := []Entry{
+		{Start: time.Date(2023, 5, 9, 9, 0, 0, 0, time.FixedZone("", 2*60*60)), End: time.Date(2023, 5, 9, 10, 0, 0, 0, time.UTC), Project: "Web site", Tags: []string{HomeofficeTag}},
+		{Start: time.Date(2023, 5, 10, 7, 0, 0, 0, time.UTC), Description: "open"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeTimewarrior(&buf, entries, Options{Loc: time.UTC}))
+	assert.Equal(t, "inc 20230509T070000Z - 20230509T100000Z # \"Web site\" homeoffice\n"+
+		"inc 20230510T070000Z #  # \"open\"\n", buf.String())
+}
@@ -0,0 +1,216 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var togglCSVHeader = []string{
+	"Email", "Project", "Description", "Billable",
+	"Start date", "Start time", "End date", "End time", "Duration", "Tags",
+}
+
+func splitTogglTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseTogglDuration parses a duration like 01:30:00.
+func parseTogglDuration(s string) (time.Duration, error) {
+	var h, m, sec int
+	if _, err := fmt.Sscanf(s, "%d:%d:%d", &h, &m, &sec); err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second, nil
+}
+
+func formatTogglDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// DecodeTogglCSV reads a detailed report exported from Toggl Track as CSV.
+// Columns are found by their header, dates and times are local to
+// opts.Loc. Rows without an end time end after their duration.
+func DecodeTogglCSV(r io.Reader, opts Options) ([]Entry, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"start date", "start time"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+
+	var entries []Entry
+	for n := 2; ; n++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		e := Entry{
+			Project:     field("project"),
+			Description: field("description"),
+			Billable:    strings.EqualFold(field("billable"), "yes"),
+			Tags:        splitTogglTags(field("tags")),
+		}
+		if e.Start, err = time.ParseInLocation(time.DateTime, field("start date")+" "+field("start time"), opts.Loc); err != nil {
+			return nil, fmt.Errorf("row %d: invalid start", n)
+		}
+		if field("end date") != "" {
+			if e.End, err = time.ParseInLocation(time.DateTime, field("end date")+" "+field("end time"), opts.Loc); err != nil {
+				return nil, fmt.Errorf("row %d: invalid end", n)
+			}
+		} else {
+			d, err := parseTogglDuration(field("duration"))
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", n, err)
+			}
+			e.End = e.Start.Add(d)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// EncodeTogglCSV writes the finished entries in the CSV format Toggl Track
+// imports, with local times in opts.Loc.
+func EncodeTogglCSV(w io.Writer, entries []Entry, opts Options) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(togglCSVHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.End.IsZero() {
+			continue
+		}
+		billable := "No"
+		if e.Billable {
+			billable = "Yes"
+		}
+		start, end := e.Start.In(opts.Loc), e.End.In(opts.Loc)
+		err := writer.Write([]string{
+			opts.Email, e.Project, e.Description, billable,
+			start.Format(time.DateOnly), start.Format(time.TimeOnly),
+			end.Format(time.DateOnly), end.Format(time.TimeOnly),
+			formatTogglDuration(end.Sub(start)), strings.Join(e.Tags, ", "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// togglEntry is a time entry of Toggl's detailed report as JSON. Dur is in
+// milliseconds. Entries of Toggl's API name the end stop instead.
+type togglEntry struct {
+	ID          int64    `json:"id,omitempty"`
+	User        string   `json:"user,omitempty"`
+	Project     string   `json:"project"`
+	Description string   `json:"description"`
+	Start       string   `json:"start"`
+	End         string   `json:"end,omitempty"`
+	Stop        string   `json:"stop,omitempty"`
+	Dur         int64    `json:"dur"`
+	Tags        []string `json:"tags"`
+	Billable    bool     `json:"billable"`
+}
+
+// DecodeTogglJSON reads time entries exported from Toggl Track as JSON,
+// either as a list or as the data of a detailed report.
+func DecodeTogglJSON(r io.Reader, opts Options) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []togglEntry
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '{' {
+		var report struct {
+			Data []togglEntry `json:"data"`
+		}
+		err = json.Unmarshal(data, &report)
+		raw = report.Data
+	} else {
+		err = json.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(raw))
+	for i, t := range raw {
+		e := Entry{Project: t.Project, Description: t.Description, Tags: t.Tags, Billable: t.Billable}
+		if e.Start, err = time.Parse(time.RFC3339, t.Start); err != nil {
+			return nil, fmt.Errorf("entry %d: invalid start %q", i, t.Start)
+		}
+		end := t.End
+		if end == "" {
+			end = t.Stop
+		}
+		if end != "" {
+			if e.End, err = time.Parse(time.RFC3339, end); err != nil {
+				return nil, fmt.Errorf("entry %d: invalid end %q", i, end)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// EncodeTogglJSON writes the entries like the time entries of Toggl's
+// detailed report. Running entries have no end.
+func EncodeTogglJSON(w io.Writer, entries []Entry, opts Options) error {
+	raw := make([]togglEntry, 0, len(entries))
+	for _, e := range entries {
+		t := togglEntry{
+			User:        opts.Email,
+			Project:     e.Project,
+			Description: e.Description,
+			Start:       e.Start.In(opts.Loc).Format(time.RFC3339),
+			Tags:        e.Tags,
+			Billable:    e.Billable,
+		}
+		if t.Tags == nil {
+			t.Tags = []string{}
+		}
+		if !e.End.IsZero() {
+			t.End = e.End.In(opts.Loc).Format(time.RFC3339)
+			t.Dur = e.End.Sub(e.Start).Milliseconds()
+		}
+		raw = append(raw, t)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(raw)
+}
@@ -0,0 +1,71 @@
+package convert
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeTogglCSV(t *testing.T) {
+	data := "\ufeffUser,Email,Client,Project,Task,Description,Billable,Start date,Start time,End date,End time,Duration,Tags,Amount ()\n" +
+		"Test,test@test.com,,Website,,Design,Yes,2023-05-09,09:00:00,2023-05-09,12:00:00,03:00:00,\"homeoffice, design\",\n" +
+		"Test,test@test.com,,,,,No,2023-05-09,13:00:00,,,01:30:00,,\n"
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	entries, err := DecodeTogglCSV(strings.NewReader(data), Options{Loc: berlin})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "2023-05-09T07:00:00Z", entries[0].Start.UTC().Format(time.RFC3339))
+	assert.Equal(t, 3*time.Hour, entries[0].End.Sub(entries[0].Start))
+	assert.Equal(t, "Website", entries[0].Project)
+	assert.Equal(t, "Design", entries[0].Description)
+	assert.True(t, entries[0].Billable)
+	assert.Equal(t, []string{HomeofficeTag, "design"}, entries[0].Tags)
+	assert.Equal(t, 90*time.Minute, entries[1].End.Sub(entries[1].Start))
+
+	for _, invalid := range []string{
+		"Project,Description\nWebsite,Design\n",
+		"Start date,Start time,Duration\n2023-05-09,9 am,01:00:00\n",
+		"Start date,Start time,Duration\n2023-05-09,09:00:00,an hour\n",
+	} {
+		_, err := DecodeTogglCSV(strings.NewReader(invalid), Options{Loc: berlin})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestEncodeTogglCSV(t *testing.T) {
+	entries := []Entry{
+		{Start: time.Date(2023, 5, 9, 7, 0, 0, 0, time.UTC), End: time.Date(2023, 5, 9, 8, 30, 15, 0, time.UTC), Project: "Website", Billable: true},
+		{Start: time.Date(2023, 5, 10, 7, 0, 0, 0, time.UTC)},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeTogglCSV(&buf, entries, Options{Loc: time.UTC, Email: "test@test.com"}))
+	assert.Equal(t, "Email,Project,Description,Billable,Start date,Start time,End date,End time,Duration,Tags\n"+
+		"test@test.com,Website,,Yes,2023-05-09,07:00:00,2023-05-09,08:30:15,01:30:15,\n", buf.String())
+}
+
+func TestDecodeTogglJSON(t *testing.T) {
+	report := `{"data": [{"id": 1, "project": "Website", "description": "Design", "start": "2023-05-09T09:00:00+02:00", "end": "2023-05-09T12:00:00+02:00", "dur": 10800000, "tags": ["homeoffice"], "billable": true}]}`
+	entries, err := DecodeTogglJSON(strings.NewReader(report), Options{Loc: time.UTC})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "Website", entries[0].Project)
+	assert.Equal(t, 3*time.Hour, entries[0].End.Sub(entries[0].Start))
+
+	list := `[{"description": "", "start": "2023-05-09T07:00:00Z", "stop": "2023-05-09T08:00:00Z", "tags": null}, {"start": "2023-05-10T07:00:00Z", "stop": null}]`
+	entries, err = DecodeTogglJSON(strings.NewReader(list), Options{Loc: time.UTC})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, time.Hour, entries[0].End.Sub(entries[0].Start))
+	assert.True(t, entries[1].End.IsZero())
+
+	for _, invalid := range []string{`{"data": 1}`, `[{"start": "today"}]`, `[{"start": "2023-05-10T07:00:00Z", "end": "later"}]`} {
+		_, err := DecodeTogglJSON(strings.NewReader(invalid), Options{Loc: time.UTC})
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,490 @@
+package database
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/report"
+)
+
+// Audited entities.
+const (
+	EntityBlock      = "block"
+	EntityPause      = "pause"
+	EntitySettings   = "settings"
+	EntitySurcharges = "surcharges"
+	EntityFeed       = "feed"
+	EntityRate       = "rate"
+	EntityInvoice    = "invoice"
+	EntityUser       = "user"
+	EntityLock       = "lock"
+	EntityTeam       = "team"
+	EntitySubmission = "submission"
+)
+
+// Audited operations.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+	// OpRestore brings a deleted block or pause back from the trash, OpPurge
+	// removes it for good.
+	OpRestore = "restore"
+	OpPurge   = "purge"
+)
+
+// SystemUser is recorded for changes made without a user, such as those of
+// the command line.
+const SystemUser = "system"
+
+func auditUser(user string) string {
+	if user == "" {
+		return SystemUser
+	}
+	return user
+}
+
+// auditJSON marshals an entity for the audit log. Nil values, including nil
+// pointers, are stored as NULL.
+func auditJSON(v any) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+	return data, nil
+}
+
+func newAuditEntry(user string, entity string, entityID string, blockID int, op string, before, after any) (models.AuditEntry, error) {
+	entry := models.AuditEntry{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		User:      auditUser(user),
+		Entity:    entity,
+		EntityID:  entityID,
+		BlockID:   blockID,
+		Operation: op,
+	}
+	var err error
+	if entry.Before, err = auditJSON(before); err != nil {
+		return entry, err
+	}
+	entry.After, err = auditJSON(after)
+	return entry, err
+}
+
+func nullJSON(data json.RawMessage) sql.NullString {
+	return sql.NullString{String: string(data), Valid: data != nil}
+}
+
+// auditHash returns the hex SHA-256 of the previous hash and the recorded
+// fields of e. The id is left out, since it is only known after the insert;
+// the order is covered by the previous hash.
+func auditHash(prev string, e models.AuditEntry) string {
+	// a struct marshals deterministically, and the raw JSON is already
+	// compact as written by auditJSON
+	data, _ := json.Marshal(struct {
+		PrevHash  string          `json:"prevHash"`
+		Timestamp string          `json:"timestamp"`
+		User      string          `json:"user"`
+		Entity    string          `json:"entity"`
+		EntityID  string          `json:"entityID"`
+		BlockID   int             `json:"blockID"`
+		Operation string          `json:"operation"`
+		Before    json.RawMessage `json:"before"`
+		After     json.RawMessage `json:"after"`
+	}{prev, e.Timestamp, e.User, e.Entity, e.EntityID, e.BlockID, e.Operation, e.Before, e.After})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// chain recomputes the hashes of the entries in order and returns the hash
+// of each of them, or a verification naming the first entry that does not
+// match. Entries recorded before the log was chained have no hashes; they
+// are covered by the first chained entry instead.
+func chain(entries []models.AuditEntry) ([]string, models.AuditVerification) {
+	v := models.AuditVerification{Valid: true, Entries: len(entries)}
+	hashes := make([]string, len(entries))
+	prev, chained := "", false
+	for i, e := range entries {
+		hash := auditHash(prev, e)
+		switch {
+		case !chained && e.PrevHash == "" && e.Hash == "":
+		case e.PrevHash != prev:
+			v.Valid, v.BrokenID, v.Reason = false, e.Id, "previous hash does not match the entry before"
+			return hashes, v
+		case e.Hash != hash:
+			v.Valid, v.BrokenID, v.Reason = false, e.Id, "hash does not match the entry"
+			return hashes, v
+		default:
+			chained = true
+		}
+		hashes[i] = hash
+		prev = hash
+	}
+	v.Head = prev
+	return hashes, v
+}
+
+// digest sums up the entries recorded within [start, end). The chain has to
+// be valid.
+func digest(entries []models.AuditEntry, start, end time.Time) (models.AuditDigest, error) {
+	hashes, v := chain(entries)
+	if !v.Valid {
+		return models.AuditDigest{}, ErrAuditChainBroken
+	}
+
+	d := models.AuditDigest{
+		Start: start.Format(time.RFC3339),
+		End:   end.Format(time.RFC3339),
+	}
+	for i, e := range entries {
+		ts, err := time.Parse(time.RFC3339, e.Timestamp)
+		if err != nil {
+			return d, err
+		}
+		if !ts.Before(end) {
+			break
+		}
+		if ts.Before(start) {
+			d.PrevHash = hashes[i]
+		} else {
+			if d.Entries == 0 {
+				d.FirstID = e.Id
+			}
+			d.Entries++
+			d.LastID = e.Id
+		}
+		d.Hash = hashes[i]
+	}
+	return d, nil
+}
+
+// MonthAuditDigest returns the digest of the audit log of a month as YYYY-MM
+// in loc, signed with key. It fails with ErrMonthNotClosed unless the month
+// has ended by now.
+func MonthAuditDigest(s Store, month string, loc *time.Location, now time.Time, key ed25519.PrivateKey) (models.AuditDigest, error) {
+	start, end, err := report.MonthBounds(month, loc)
+	if err != nil {
+		return models.AuditDigest{}, ErrInvalidMonth
+	}
+	if end.After(now) {
+		return models.AuditDigest{}, ErrMonthNotClosed
+	}
+
+	d, err := s.AuditDigest(start, end)
+	if err != nil {
+		return models.AuditDigest{}, err
+	}
+	d.Month, d.Timezone = month, loc.String()
+	if err := SignAuditDigest(&d, key); err != nil {
+		return models.AuditDigest{}, err
+	}
+	return d, nil
+}
+
+// SignAuditDigest sets the public key of key and the signature of d.
+func SignAuditDigest(d *models.AuditDigest, key ed25519.PrivateKey) error {
+	d.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	d.Signature = ""
+	payload, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	d.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	return nil
+}
+
+// VerifyAuditDigest reports whether the signature of d was made with the
+// key d names. Whether that key can be trusted has to be checked separately.
+func VerifyAuditDigest(d models.AuditDigest) bool {
+	publicKey, err := base64.StdEncoding.DecodeString(d.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(d.Signature)
+	if err != nil {
+		return false
+	}
+	d.Signature = ""
+	payload, err := json.Marshal(d)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(publicKey, payload, signature)
+}
+
+// WithUser returns a view of the database that records changes as made by
+// the user with the given email.
+func (db *DB) WithUser(email string) Store {
+	view := *db
+	view.user = email
+	return &view
+}
+
+// WithOwner returns a view of the database that records changes as made by
+// the user with the given email and only sees the blocks and pauses they
+// created.
+func (db *DB) WithOwner(email string) Store {
+	view := *db
+	view.user = email
+	view.owner = email
+	return &view
+}
+
+// audit appends an entry to the audit log. It has to be called within the
+// transaction of the change.
+func (db *DB) audit(entity string, entityID string, blockID int, op string, before, after any) error {
+	entry, err := newAuditEntry(db.user, entity, entityID, blockID, op, before, after)
+	if err != nil {
+		return err
+	}
+
+	if err := db.lockAudit(); err != nil {
+		return err
+	}
+	if entry.PrevHash, err = db.auditHead(); err != nil {
+		return err
+	}
+	entry.Hash = auditHash(entry.PrevHash, entry)
+
+	q := `
+  INSERT INTO audit
+  (ts, user_email, entity, entity_id, block_id, operation, before_json, after_json, prev_hash, hash)
+  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+  `
+	blockIDValue := sql.NullInt64{Int64: int64(entry.BlockID), Valid: entry.BlockID != 0}
+	_, err = db.exec(q, entry.Timestamp, entry.User, entry.Entity, entry.EntityID,
+		blockIDValue, entry.Operation, nullJSON(entry.Before), nullJSON(entry.After),
+		entry.PrevHash, entry.Hash)
+	return err
+}
+
+// lockAudit locks the audit table until the end of the transaction, so that
+// concurrent changes do not chain to the same entry. SQLite already
+// serializes write transactions.
+func (db *DB) lockAudit() error {
+	if db.dialect != postgres {
+		return nil
+	}
+	q := `
+  LOCK TABLE audit IN SHARE ROW EXCLUSIVE MODE
+  `
+	_, err := db.exec(q)
+	return err
+}
+
+// auditHead returns the hash of the last entry, computing the chain over the
+// entries recorded before the log was chained if it has none.
+func (db *DB) auditHead() (string, error) {
+	q := `
+  SELECT hash FROM audit
+  ORDER BY id DESC
+  LIMIT 1
+  `
+	var head string
+	err := db.queryRow(q).Scan(&head)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil || head != "" {
+		return head, err
+	}
+
+	entries, err := db.auditEntries("")
+	if err != nil {
+		return "", err
+	}
+	_, v := chain(entries)
+	if !v.Valid {
+		return "", ErrAuditChainBroken
+	}
+	return v.Head, nil
+}
+
+// auditEntries returns the entries matching the where clause, which may be
+// empty, in the order they were recorded.
+func (db *DB) auditEntries(where string, args ...any) ([]models.AuditEntry, error) {
+	q := `
+  SELECT id, ts, user_email, entity, entity_id, block_id, operation, before_json, after_json, prev_hash, hash
+  FROM audit
+  ` + where + `
+  ORDER BY id
+  `
+	rows, err := db.query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		var blockID sql.NullInt64
+		var before, after sql.NullString
+		err := rows.Scan(&e.Id, &e.Timestamp, &e.User, &e.Entity, &e.EntityID,
+			&blockID, &e.Operation, &before, &after, &e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		e.BlockID = int(blockID.Int64)
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// auditBlock records a change of a block. Every change of a block goes
+// through here, so it also rejects changes that touch a locked period with
+// ErrPeriodLocked, which rolls back the transaction.
+func (db *DB) auditBlock(op string, id int, before, after *models.Block) error {
+	creator, err := db.blockCreator(id)
+	if err != nil {
+		return err
+	}
+	if err := db.checkUnlocked(creator, blockSpans(before, after)...); err != nil {
+		return err
+	}
+	return db.audit(EntityBlock, strconv.Itoa(id), id, op, before, after)
+}
+
+// auditPause is auditBlock for pauses.
+func (db *DB) auditPause(op string, id int, blockID int, before, after *models.Pause) error {
+	creator, err := db.blockCreator(blockID)
+	if err != nil {
+		return err
+	}
+	if err := db.checkUnlocked(creator, pauseSpans(before, after)...); err != nil {
+		return err
+	}
+	return db.audit(EntityPause, strconv.Itoa(id), blockID, op, before, after)
+}
+
+// GetBlockHistory returns the audit entries of the block with the given id
+// and of its pauses in the order they were recorded. Deleted blocks keep
+// their history.
+func (db *DB) GetBlockHistory(id int) ([]models.AuditEntry, error) {
+	if db.owner != "" {
+		creator, err := db.blockCreator(id)
+		if err != nil {
+			return nil, err
+		}
+		if creator != db.owner {
+			return nil, ErrBlockNotFound
+		}
+	}
+	entries, err := db.auditEntries("WHERE block_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrBlockNotFound
+	}
+	return entries, nil
+}
+
+// VerifyAuditChain recomputes the hash chain of the whole audit log.
+func (db *DB) VerifyAuditChain() (models.AuditVerification, error) {
+	entries, err := db.auditEntries("")
+	if err != nil {
+		return models.AuditVerification{}, err
+	}
+	_, v := chain(entries)
+	return v, nil
+}
+
+// AuditDigest sums up the entries recorded within [start, end). It fails
+// with ErrAuditChainBroken if the chain does not verify.
+func (db *DB) AuditDigest(start, end time.Time) (models.AuditDigest, error) {
+	entries, err := db.auditEntries("")
+	if err != nil {
+		return models.AuditDigest{}, err
+	}
+	return digest(entries, start, end)
+}
+
+// WithUser returns a view of the store that records changes as made by the
+// user with the given email. It shares the data with m.
+func (m *MemoryStore) WithUser(email string) Store {
+	return &MemoryStore{memoryState: m.memoryState, user: email, owner: m.owner}
+}
+
+// WithOwner returns a view of the store that records changes as made by the
+// user with the given email and only sees the blocks and pauses they created.
+func (m *MemoryStore) WithOwner(email string) Store {
+	return &MemoryStore{memoryState: m.memoryState, user: email, owner: email}
+}
+
+// audit appends an entry to the audit log. It has to be called with the lock
+// held.
+func (m *MemoryStore) audit(entity string, entityID string, blockID int, op string, before, after any) {
+	// the models the memory store records always marshal
+	entry, _ := newAuditEntry(m.user, entity, entityID, blockID, op, before, after)
+	entry.Id = len(m.auditLog) + 1
+	if len(m.auditLog) > 0 {
+		entry.PrevHash = m.auditLog[len(m.auditLog)-1].Hash
+	}
+	entry.Hash = auditHash(entry.PrevHash, entry)
+	m.auditLog = append(m.auditLog, entry)
+}
+
+// auditBlock records a change of a block. Unlike DB.auditBlock it does not
+// check the locks, the memory store cannot roll back and checks them before
+// changing anything.
+func (m *MemoryStore) auditBlock(op string, id int, before, after *models.Block) {
+	m.audit(EntityBlock, strconv.Itoa(id), id, op, before, after)
+}
+
+func (m *MemoryStore) auditPause(op string, id int, blockID int, before, after *models.Pause) {
+	m.audit(EntityPause, strconv.Itoa(id), blockID, op, before, after)
+}
+
+func (m *MemoryStore) GetBlockHistory(id int) ([]models.AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owner != "" {
+		b, ok := m.blocks[id]
+		if !ok {
+			b = m.trashBlocks[id].block
+		}
+		if b.createdBy != m.owner {
+			return nil, ErrBlockNotFound
+		}
+	}
+
+	var entries []models.AuditEntry
+	for _, e := range m.auditLog {
+		if e.BlockID == id {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, ErrBlockNotFound
+	}
+	return entries, nil
+}
+
+func (m *MemoryStore) VerifyAuditChain() (models.AuditVerification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, v := chain(m.auditLog)
+	return v, nil
+}
+
+func (m *MemoryStore) AuditDigest(start, end time.Time) (models.AuditDigest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return digest(m.auditLog, start, end)
+}
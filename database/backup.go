@@ -0,0 +1,1210 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/datetime"
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+type RestoreMode string
+
+const (
+	// RestoreReplace deletes all blocks, pauses, settings, rates, invoices,
+	// locks, feeds and, if the backup has a workflow, accounts, teams and
+	// submissions, purges the trash and restores those of the backup with
+	// their ids and the current blocks and pauses.
+	RestoreReplace RestoreMode = "replace"
+	// RestoreMerge adds the finished blocks of the backup that do not exist
+	// yet with new ids and overwrites the settings of the users in the
+	// backup. The current block and pause, rates, invoices, locks, feeds and
+	// the workflow are left alone, so billed blocks cannot be merged.
+	RestoreMerge RestoreMode = "merge"
+)
+
+// ParseRestoreMode parses a restore mode, which defaults to RestoreReplace.
+func ParseRestoreMode(mode string) (RestoreMode, error) {
+	switch RestoreMode(mode) {
+	case "", RestoreReplace:
+		return RestoreReplace, nil
+	case RestoreMerge:
+		return RestoreMerge, nil
+	default:
+		return "", ErrInvalidRestoreMode
+	}
+}
+
+func invalidBackup(format string, args ...any) error {
+	return NewValidationError("invalid_backup", fmt.Sprintf(format, args...))
+}
+
+func validTimestamps(start, end string, running bool) bool {
+	if !datetime.IsValidRFC3339(start) {
+		return false
+	}
+	return datetime.IsValidRFC3339(end) || (running && end == "")
+}
+
+// validateBackup checks the whole document before anything is restored. Only
+// the current blocks and pauses may lack an end. It fills in missing block
+// ids of pauses and the emails of current blocks, drops current entries
+// without a block and normalizes the settings.
+func validateBackup(backup *models.Backup) error {
+	if backup.Version != models.BackupVersion && backup.Version != 1 {
+		return invalidBackup("unsupported backup version %d", backup.Version)
+	}
+
+	currents := models.BackupCurrents{}
+	currentPauses := make(map[int]int)
+	for _, c := range backup.Current {
+		if c.BlockID == -1 {
+			if c.PauseID != -1 {
+				return invalidBackup("current pause %d is not a running pause of the current block", c.PauseID)
+			}
+			continue
+		}
+		if _, ok := currentPauses[c.BlockID]; ok {
+			return invalidBackup("duplicate current block %d", c.BlockID)
+		}
+		currentPauses[c.BlockID] = c.PauseID
+		currents = append(currents, c)
+	}
+	backup.Current = currents
+
+	blocks := make(map[int]*models.BackupBlock)
+	pauses := make(map[int]*models.Pause)
+	uids := make(map[[2]string]bool)
+	for i := range backup.Blocks {
+		block := &backup.Blocks[i]
+		if block.Id <= 0 || blocks[block.Id] != nil {
+			return invalidBackup("invalid or duplicate block id %d", block.Id)
+		}
+		blocks[block.Id] = block
+
+		currentPauseID, running := currentPauses[block.Id]
+		if !validTimestamps(block.Start, block.End, running) {
+			return invalidBackup("invalid start or end of block %d", block.Id)
+		}
+		if block.ImportUID != "" {
+			uid := [2]string{block.CreatedBy, block.ImportUID}
+			if uids[uid] {
+				return invalidBackup("duplicate import UID %q", block.ImportUID)
+			}
+			uids[uid] = true
+		}
+
+		for j := range block.Pauses {
+			pause := &block.Pauses[j]
+			if pause.Id <= 0 || pauses[pause.Id] != nil {
+				return invalidBackup("invalid or duplicate pause id %d", pause.Id)
+			}
+			pauses[pause.Id] = pause
+
+			if pause.BlockID == 0 {
+				pause.BlockID = block.Id
+			}
+			if pause.BlockID != block.Id {
+				return invalidBackup("pause %d is listed with block %d but belongs to block %d",
+					pause.Id, block.Id, pause.BlockID)
+			}
+			if !validTimestamps(pause.Start, pause.End, running && pause.Id == currentPauseID) {
+				return invalidBackup("invalid start or end of pause %d", pause.Id)
+			}
+		}
+	}
+
+	working := make(map[string]bool)
+	for i := range backup.Current {
+		current := &backup.Current[i]
+		block := blocks[current.BlockID]
+		if block == nil || block.End != "" {
+			return invalidBackup("current block %d is not a running block of the backup", current.BlockID)
+		}
+		if current.Email != "" && current.Email != block.CreatedBy {
+			return invalidBackup("current block %d of %s was created by %q", current.BlockID, current.Email, block.CreatedBy)
+		}
+		current.Email = block.CreatedBy
+		if working[current.Email] {
+			return invalidBackup("more than one current block of %q", current.Email)
+		}
+		working[current.Email] = true
+		if current.PauseID != -1 {
+			if pause := pauses[current.PauseID]; pause == nil || pause.BlockID != current.BlockID || pause.End != "" {
+				return invalidBackup("current pause %d is not a running pause of the current block", current.PauseID)
+			}
+		}
+	}
+
+	emails := make(map[string]bool)
+	for i := range backup.Settings {
+		s := &backup.Settings[i]
+		if s.Email == "" || emails[s.Email] {
+			return invalidBackup("missing or duplicate email %q in settings", s.Email)
+		}
+		emails[s.Email] = true
+
+		settings, err := normalizeSettings(s.Settings)
+		if err != nil {
+			return invalidBackup("settings of %s: %s", s.Email, err)
+		}
+		s.Settings = settings
+	}
+
+	if backup.Surcharges != nil {
+		if err := validateSurchargeConfig(*backup.Surcharges); err != nil {
+			return invalidBackup("surcharges: %s", err)
+		}
+	}
+	if err := validateBilling(backup, blocks); err != nil {
+		return err
+	}
+	if err := validateFeeds(backup.Feeds); err != nil {
+		return err
+	}
+	return validateWorkflow(backup)
+}
+
+// validateFeeds checks that every feed has a user and a secret, both unique.
+func validateFeeds(feeds []models.BackupFeed) error {
+	emails := make(map[string]bool)
+	secrets := make(map[string]bool)
+	for _, f := range feeds {
+		if f.Email == "" || emails[f.Email] {
+			return invalidBackup("missing or duplicate feed user %q", f.Email)
+		}
+		emails[f.Email] = true
+		if f.Secret == "" || secrets[f.Secret] {
+			return invalidBackup("missing or duplicate secret of the feed of %q", f.Email)
+		}
+		secrets[f.Secret] = true
+	}
+	return nil
+}
+
+// validateBilling checks the rates, invoices and locks and that every billed
+// block refers to an invoice of the backup that lists it.
+func validateBilling(backup *models.Backup, blocks map[int]*models.BackupBlock) error {
+	rates := make(map[int]bool)
+	for _, r := range backup.Rates {
+		if r.Id <= 0 || rates[r.Id] {
+			return invalidBackup("invalid or duplicate rate id %d", r.Id)
+		}
+		rates[r.Id] = true
+		if _, err := time.Parse(time.DateOnly, r.EffectiveFrom); err != nil || r.Email == "" || r.CentsPerHour <= 0 {
+			return invalidBackup("invalid rate %d", r.Id)
+		}
+	}
+
+	invoices := make(map[int]bool)
+	numbers := make(map[string]bool)
+	for _, inv := range backup.Invoices {
+		if inv.Id <= 0 || invoices[inv.Id] {
+			return invalidBackup("invalid or duplicate invoice id %d", inv.Id)
+		}
+		invoices[inv.Id] = true
+		if inv.Number == "" || numbers[inv.Number] {
+			return invalidBackup("missing or duplicate invoice number %q", inv.Number)
+		}
+		numbers[inv.Number] = true
+		if len(inv.Lines) == 0 {
+			return invalidBackup("invoice %d has no lines", inv.Id)
+		}
+		for _, line := range inv.Lines {
+			if block := blocks[line.BlockID]; block == nil || block.InvoiceID != inv.Id {
+				return invalidBackup("invoice %d bills block %d, which is not billed with it", inv.Id, line.BlockID)
+			}
+		}
+	}
+	for _, b := range backup.Blocks {
+		if b.InvoiceID != 0 && !invoices[b.InvoiceID] {
+			return invalidBackup("block %d is billed with invoice %d, which is not in the backup", b.Id, b.InvoiceID)
+		}
+	}
+
+	locks := make(map[int]bool)
+	for _, l := range backup.Locks {
+		if l.Id <= 0 || locks[l.Id] {
+			return invalidBackup("invalid or duplicate lock id %d", l.Id)
+		}
+		locks[l.Id] = true
+		start, startErr := time.Parse(time.RFC3339, l.Start)
+		end, endErr := time.Parse(time.RFC3339, l.End)
+		if startErr != nil || endErr != nil || !start.Before(end) {
+			return invalidBackup("invalid start or end of lock %d", l.Id)
+		}
+	}
+	return nil
+}
+
+// validateWorkflow checks the accounts, teams, submissions and events and
+// that every approved submission refers to a lock of the backup.
+func validateWorkflow(backup *models.Backup) error {
+	if backup.Workflow == nil {
+		return nil
+	}
+	w := backup.Workflow
+
+	ids := make(map[int]bool)
+	emails := make(map[string]bool)
+	for _, a := range w.Accounts {
+		if a.Id <= 0 || ids[a.Id] {
+			return invalidBackup("invalid or duplicate account id %d", a.Id)
+		}
+		ids[a.Id] = true
+		if a.Email == "" || emails[a.Email] {
+			return invalidBackup("missing or duplicate account email %q", a.Email)
+		}
+		emails[a.Email] = true
+		if a.PasswordHash == "" || !validRole(a.Role) {
+			return invalidBackup("invalid account %d", a.Id)
+		}
+	}
+
+	teams := make(map[int]bool)
+	names := make(map[string]bool)
+	for _, t := range w.Teams {
+		if t.Id <= 0 || teams[t.Id] {
+			return invalidBackup("invalid or duplicate team id %d", t.Id)
+		}
+		teams[t.Id] = true
+		if t.Name == "" || names[t.Name] {
+			return invalidBackup("missing or duplicate team name %q", t.Name)
+		}
+		names[t.Name] = true
+		members := make(map[string]bool)
+		for _, m := range t.Members {
+			if m == "" || members[m] {
+				return invalidBackup("missing or duplicate member %q of team %d", m, t.Id)
+			}
+			members[m] = true
+		}
+	}
+
+	locks := make(map[int]bool)
+	for _, l := range backup.Locks {
+		locks[l.Id] = true
+	}
+	submissions := make(map[int]bool)
+	for _, sub := range w.Submissions {
+		if sub.Id <= 0 || submissions[sub.Id] {
+			return invalidBackup("invalid or duplicate submission id %d", sub.Id)
+		}
+		submissions[sub.Id] = true
+		if sub.Email == "" || !datetime.IsValidRFC3339(sub.Start) || !datetime.IsValidRFC3339(sub.End) {
+			return invalidBackup("invalid submission %d", sub.Id)
+		}
+		switch sub.Status {
+		case models.SubmissionSubmitted, models.SubmissionRejected:
+		case models.SubmissionApproved:
+			if !locks[sub.LockID] {
+				return invalidBackup("submission %d is approved with lock %d, which is not in the backup", sub.Id, sub.LockID)
+			}
+		default:
+			return invalidBackup("invalid status %q of submission %d", sub.Status, sub.Id)
+		}
+	}
+
+	events := make(map[int]bool)
+	for _, e := range w.Events {
+		if e.Id <= 0 || events[e.Id] {
+			return invalidBackup("invalid or duplicate event id %d", e.Id)
+		}
+		events[e.Id] = true
+		if !submissions[e.SubmissionID] {
+			return invalidBackup("event %d belongs to submission %d, which is not in the backup", e.Id, e.SubmissionID)
+		}
+	}
+	return nil
+}
+
+// checkMergeable rejects merging billed blocks, since their invoices are
+// only restored by replacing restores.
+func checkMergeable(backup models.Backup) error {
+	for _, b := range backup.Blocks {
+		if b.InvoiceID != 0 {
+			return invalidBackup("block %d is billed, billed blocks can only be restored with mode=replace", b.Id)
+		}
+	}
+	return nil
+}
+
+func pausesWithoutBlockID(pauses []models.Pause) []models.PauseWithoutBlockID {
+	var result []models.PauseWithoutBlockID
+	for _, p := range pauses {
+		result = append(result, models.PauseWithoutBlockID{Start: p.Start, End: p.End})
+	}
+	return result
+}
+
+// ExportBackup returns all blocks with their pauses, the current block and
+// pause of every user, the settings of all users, the surcharge configuration, the rates,
+// the invoices, the locks and the workflow.
+func (db *DB) ExportBackup() (models.Backup, error) {
+	backup := models.Backup{
+		Version: models.BackupVersion,
+		Blocks:  []models.BackupBlock{},
+		Current: models.BackupCurrents{},
+	}
+	err := db.transaction(func(tx *DB) error {
+		blocks, err := tx.GetAllBlocks()
+		if err != nil {
+			return err
+		}
+		uids, err := tx.importUIDs()
+		if err != nil {
+			return err
+		}
+		creators, err := tx.blockCreators()
+		if err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			backup.Blocks = append(backup.Blocks, models.BackupBlock{Block: b, ImportUID: uids[b.Id], CreatedBy: creators[b.Id]})
+		}
+
+		if backup.Current, err = tx.allCurrents(); err != nil {
+			return err
+		}
+		if backup.Settings, err = tx.allSettings(); err != nil {
+			return err
+		}
+		if backup.Rates, err = tx.allRates(); err != nil {
+			return err
+		}
+		if backup.Invoices, err = tx.getInvoices(""); err != nil {
+			return err
+		}
+		if backup.Locks, err = tx.GetLocks(); err != nil {
+			return err
+		}
+		if backup.Workflow, err = tx.exportWorkflow(); err != nil {
+			return err
+		}
+		if backup.Feeds, err = tx.allFeeds(); err != nil {
+			return err
+		}
+
+		config, err := tx.GetSurchargeConfig()
+		backup.Surcharges = &config
+		return err
+	})
+	if err != nil {
+		return models.Backup{}, err
+	}
+	return backup, nil
+}
+
+// exportWorkflow returns the accounts, teams, submissions and events, nil if
+// there are none, like in the backups of the memory store.
+func (db *DB) exportWorkflow() (*models.BackupWorkflow, error) {
+	w := &models.BackupWorkflow{Accounts: []models.BackupAccount{}}
+	q := `
+  SELECT id, email, disabled, role, pw_hash FROM account
+  ORDER BY id
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.BackupAccount
+		if err := rows.Scan(&a.Id, &a.Email, &a.Disabled, &a.Role, &a.PasswordHash); err != nil {
+			return nil, err
+		}
+		w.Accounts = append(w.Accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if w.Teams, err = db.GetTeams(); err != nil {
+		return nil, err
+	}
+	if w.Submissions, err = db.GetSubmissions(nil, ""); err != nil {
+		return nil, err
+	}
+	if w.Events, err = db.GetWorkflowEvents(nil, 0); err != nil {
+		return nil, err
+	}
+	if len(w.Accounts) == 0 && len(w.Teams) == 0 && len(w.Submissions) == 0 {
+		return nil, nil
+	}
+	return w, nil
+}
+
+func (db *DB) importUIDs() (map[int]string, error) {
+	q := `
+  SELECT id, import_uid FROM block
+  WHERE import_uid IS NOT NULL AND deleted_at IS NULL
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uids := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var uid string
+		if err := rows.Scan(&id, &uid); err != nil {
+			return nil, err
+		}
+		uids[id] = uid
+	}
+	return uids, rows.Err()
+}
+
+func (db *DB) blockCreators() (map[int]string, error) {
+	q := `
+  SELECT id, created_by FROM block
+  WHERE created_by <> '' AND deleted_at IS NULL
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	creators := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var creator string
+		if err := rows.Scan(&id, &creator); err != nil {
+			return nil, err
+		}
+		creators[id] = creator
+	}
+	return creators, rows.Err()
+}
+
+// allCurrents returns the current block and pause of every user with a
+// running block.
+func (db *DB) allCurrents() (models.BackupCurrents, error) {
+	q := `
+  SELECT email, current_block_id, current_pause_id FROM current
+  WHERE current_block_id <> -1
+  ORDER BY email
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currents := models.BackupCurrents{}
+	for rows.Next() {
+		var c models.BackupCurrent
+		if err := rows.Scan(&c.Email, &c.BlockID, &c.PauseID); err != nil {
+			return nil, err
+		}
+		currents = append(currents, c)
+	}
+	return currents, rows.Err()
+}
+
+// creator returns the user who created a block of a backup, the restoring
+// user if the backup does not name one.
+func creator(b models.BackupBlock, user string) string {
+	if b.CreatedBy != "" {
+		return b.CreatedBy
+	}
+	return auditUser(user)
+}
+
+// RestoreBackup validates the backup and restores it in a single
+// transaction, so that an invalid backup or a failure changes nothing.
+func (db *DB) RestoreBackup(backup models.Backup, mode RestoreMode) (models.RestoreReport, error) {
+	if err := validateBackup(&backup); err != nil {
+		return models.RestoreReport{}, err
+	}
+
+	report := models.RestoreReport{Mode: string(mode)}
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.lockCurrent(); err != nil {
+			return err
+		}
+
+		var err error
+		if mode == RestoreMerge {
+			if err := checkMergeable(backup); err != nil {
+				return err
+			}
+			err = tx.mergeBlocks(backup.Blocks, &report)
+		} else {
+			err = tx.replaceBlocks(backup, &report)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, s := range backup.Settings {
+			if err := tx.UpdateSettings(s.Email, s.Settings); err != nil {
+				return err
+			}
+		}
+		if backup.Surcharges != nil {
+			return tx.UpdateSurchargeConfig(*backup.Surcharges)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.RestoreReport{}, err
+	}
+	return report, nil
+}
+
+// replaceBlocks deletes all blocks, pauses, settings, rates and invoices and
+// inserts those of the backup with their ids. The locks are replaced last, so
+// that the existing locks guard the replaced blocks, followed by the
+// workflow, whose submissions refer to them.
+func (db *DB) replaceBlocks(backup models.Backup, report *models.RestoreReport) error {
+	blocks, err := db.GetAllBlocks()
+	if err != nil {
+		return err
+	}
+	for i := range blocks {
+		if err := db.auditBlock(OpDelete, blocks[i].Id, &blocks[i], nil); err != nil {
+			return err
+		}
+	}
+	// Backups do not include the trash, so replacing purges it.
+	trash, err := db.GetTrash()
+	if err != nil {
+		return err
+	}
+	for _, item := range trash {
+		if item.Block != nil {
+			err = db.audit(EntityBlock, strconv.Itoa(item.Id), item.Id, OpPurge, item.Block, nil)
+		} else {
+			err = db.audit(EntityPause, strconv.Itoa(item.Id), item.Pause.BlockID, OpPurge, item.Pause, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	settings, err := db.allSettings()
+	if err != nil {
+		return err
+	}
+	for _, s := range settings {
+		if err := db.audit(EntitySettings, s.Email, 0, OpDelete, s.Settings, nil); err != nil {
+			return err
+		}
+	}
+	rates, err := db.allRates()
+	if err != nil {
+		return err
+	}
+	for _, r := range rates {
+		if err := db.audit(EntityRate, strconv.Itoa(r.Id), 0, OpDelete, r, nil); err != nil {
+			return err
+		}
+	}
+	invoices, err := db.getInvoices("")
+	if err != nil {
+		return err
+	}
+	for _, inv := range invoices {
+		if err := db.audit(EntityInvoice, strconv.Itoa(inv.Id), 0, OpDelete, inv, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, q := range []string{
+		`DELETE FROM pause`, `DELETE FROM block`, `DELETE FROM setting`,
+		`DELETE FROM invoice_line`, `DELETE FROM invoice`, `DELETE FROM rate`,
+	} {
+		if _, err := db.exec(q); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range backup.Rates {
+		q := `
+    INSERT INTO rate (id, email, project, cents_per_hour, effective_from)
+    VALUES (?, ?, ?, ?, ?)
+    `
+		if _, err := db.exec(q, r.Id, r.Email, r.Project, r.CentsPerHour, r.EffectiveFrom); err != nil {
+			return err
+		}
+		if err := db.audit(EntityRate, strconv.Itoa(r.Id), 0, OpCreate, nil, r); err != nil {
+			return err
+		}
+	}
+	for _, inv := range backup.Invoices {
+		if err := db.insertInvoice(inv); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range backup.Blocks {
+		q := `
+    INSERT INTO block (id, start, "end", homeoffice, project, billable,
+    invoice_id, import_uid, start_unix, end_unix, created_by)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+		invoiceID := sql.NullInt64{Int64: int64(b.InvoiceID), Valid: b.InvoiceID != 0}
+		uid := sql.NullString{String: b.ImportUID, Valid: b.ImportUID != ""}
+		_, err := db.exec(q, b.Id, b.Start, b.End, b.Homeoffice, b.Project, b.Billable,
+			invoiceID, uid, unixSeconds(b.Start), unixSeconds(b.End), creator(b, db.user))
+		if err != nil {
+			return err
+		}
+		if err := db.auditBlock(OpCreate, b.Id, nil, &b.Block); err != nil {
+			return err
+		}
+		report.Blocks++
+
+		for _, p := range b.Pauses {
+			q := `
+      INSERT INTO pause (id, start, "end", block_id)
+      VALUES (?, ?, ?, ?)
+      `
+			if _, err := db.exec(q, p.Id, p.Start, p.End, p.BlockID); err != nil {
+				return err
+			}
+			report.Pauses++
+		}
+	}
+
+	if _, err := db.exec(`UPDATE current SET current_block_id = -1, current_pause_id = -1`); err != nil {
+		return err
+	}
+	for _, c := range backup.Current {
+		email := c.Email
+		if email == "" {
+			email = auditUser(db.user)
+		}
+		if err := db.addCurrent(email); err != nil {
+			return err
+		}
+		q := `
+    UPDATE current
+    SET current_block_id = ?, current_pause_id = ?
+    WHERE email = ?
+    `
+		if _, err := db.exec(q, c.BlockID, c.PauseID, email); err != nil {
+			return err
+		}
+	}
+	if err := db.replaceLocks(backup.Locks); err != nil {
+		return err
+	}
+	if err := db.replaceFeeds(backup.Feeds); err != nil {
+		return err
+	}
+	if err := db.replaceWorkflow(backup.Workflow); err != nil {
+		return err
+	}
+
+	// SQLite continues after the highest id, PostgreSQL's sequences have to
+	// be moved past the inserted ids.
+	if db.dialect == postgres {
+		for _, table := range []string{"block", "pause", "rate", "invoice", "invoice_line", "period_lock",
+			"account", "team", "submission", "submission_event"} {
+			q := `SELECT setval(pg_get_serial_sequence('` + table + `', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM ` + table
+			if _, err := db.exec(q); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insertInvoice inserts an invoice of a backup with its id and lines.
+func (db *DB) insertInvoice(inv models.Invoice) error {
+	q := `
+  INSERT INTO invoice (id, number, email, created, start, "end", total_cents)
+  VALUES (?, ?, ?, ?, ?, ?, ?)
+  `
+	if _, err := db.exec(q, inv.Id, inv.Number, inv.Email, inv.Created, inv.Start, inv.End, inv.TotalCents); err != nil {
+		return err
+	}
+	for _, line := range inv.Lines {
+		q := `
+    INSERT INTO invoice_line
+    (invoice_id, block_id, date, project, minutes, cents_per_hour, amount_cents)
+    VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+		_, err := db.exec(q, inv.Id, line.BlockID, line.Date, line.Project, line.Minutes,
+			line.CentsPerHour, line.AmountCents)
+		if err != nil {
+			return err
+		}
+	}
+	return db.audit(EntityInvoice, strconv.Itoa(inv.Id), 0, OpCreate, nil, inv)
+}
+
+// replaceLocks deletes all locks and inserts those of the backup with their
+// ids.
+func (db *DB) replaceLocks(locks []models.PeriodLock) error {
+	existing, err := db.GetLocks()
+	if err != nil {
+		return err
+	}
+	for _, l := range existing {
+		if err := db.audit(EntityLock, strconv.Itoa(l.Id), 0, OpDelete, l, nil); err != nil {
+			return err
+		}
+	}
+	if _, err := db.exec(`DELETE FROM period_lock`); err != nil {
+		return err
+	}
+
+	for _, l := range locks {
+		q := `
+    INSERT INTO period_lock (id, start, "end", locked_by, created, owner)
+    VALUES (?, ?, ?, ?, ?, ?)
+    `
+		if _, err := db.exec(q, l.Id, l.Start, l.End, l.LockedBy, l.Created, l.Owner); err != nil {
+			return err
+		}
+		if err := db.audit(EntityLock, strconv.Itoa(l.Id), 0, OpCreate, nil, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceFeeds deletes all feeds and inserts those of the backup. Like
+// RegenerateFeedSecret, it only audits the changes, not the secrets.
+func (db *DB) replaceFeeds(feeds []models.BackupFeed) error {
+	existing, err := db.allFeeds()
+	if err != nil {
+		return err
+	}
+	for _, f := range existing {
+		if err := db.audit(EntityFeed, f.Email, 0, OpDelete, nil, nil); err != nil {
+			return err
+		}
+	}
+	if _, err := db.exec(`DELETE FROM feed`); err != nil {
+		return err
+	}
+
+	for _, f := range feeds {
+		if _, err := db.exec(`INSERT INTO feed (email, secret) VALUES (?, ?)`, f.Email, f.Secret); err != nil {
+			return err
+		}
+		if err := db.audit(EntityFeed, f.Email, 0, OpCreate, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceWorkflow deletes all accounts, teams, submissions and events and
+// inserts those of the workflow with their ids. Without a workflow, it keeps
+// the accounts and teams and fails if there are submissions, whose locks
+// have just been replaced.
+func (db *DB) replaceWorkflow(w *models.BackupWorkflow) error {
+	if w == nil {
+		var count int
+		if err := db.queryRow(`SELECT COUNT(*) FROM submission`).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return invalidBackup("the backup has no workflow, but there are submissions, whose locks it would replace")
+		}
+		return nil
+	}
+
+	users, err := db.GetAllUsers()
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if err := db.audit(EntityUser, u.Email, 0, OpDelete, u, nil); err != nil {
+			return err
+		}
+	}
+	teams, err := db.GetTeams()
+	if err != nil {
+		return err
+	}
+	for _, t := range teams {
+		if err := db.audit(EntityTeam, strconv.Itoa(t.Id), 0, OpDelete, t, nil); err != nil {
+			return err
+		}
+	}
+	submissions, err := db.GetSubmissions(nil, "")
+	if err != nil {
+		return err
+	}
+	for _, s := range submissions {
+		if err := db.audit(EntitySubmission, strconv.Itoa(s.Id), 0, OpDelete, s, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, q := range []string{
+		`DELETE FROM submission_event`, `DELETE FROM submission`,
+		`DELETE FROM team_member`, `DELETE FROM team`, `DELETE FROM account`,
+	} {
+		if _, err := db.exec(q); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range w.Accounts {
+		q := `
+    INSERT INTO account (id, email, pw_hash, disabled, role)
+    VALUES (?, ?, ?, ?, ?)
+    `
+		if _, err := db.exec(q, a.Id, a.Email, a.PasswordHash, a.Disabled, a.Role); err != nil {
+			return err
+		}
+		if err := db.audit(EntityUser, a.Email, 0, OpCreate, nil, a.User); err != nil {
+			return err
+		}
+	}
+	for _, t := range w.Teams {
+		if _, err := db.exec(`INSERT INTO team (id, name) VALUES (?, ?)`, t.Id, t.Name); err != nil {
+			return err
+		}
+		for _, email := range t.Members {
+			if _, err := db.exec(`INSERT INTO team_member (team_id, email) VALUES (?, ?)`, t.Id, email); err != nil {
+				return err
+			}
+		}
+		if err := db.audit(EntityTeam, strconv.Itoa(t.Id), 0, OpCreate, nil, t); err != nil {
+			return err
+		}
+	}
+	for _, s := range w.Submissions {
+		q := `
+    INSERT INTO submission (` + submissionColumns + `)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+		_, err := db.exec(q, s.Id, s.Email, s.Period, s.Start, s.End, s.Status, s.Comment,
+			s.ReviewComment, s.ReviewedBy, s.Submitted, s.Reviewed, s.LockID)
+		if err != nil {
+			return err
+		}
+		if err := db.audit(EntitySubmission, strconv.Itoa(s.Id), 0, OpCreate, nil, s); err != nil {
+			return err
+		}
+	}
+	for _, e := range w.Events {
+		q := `
+    INSERT INTO submission_event (id, submission_id, email, actor, type, comment, ts)
+    VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+		if _, err := db.exec(q, e.Id, e.SubmissionID, e.Email, e.Actor, e.Type, e.Comment, e.Timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeBlocks adds the finished blocks of the backup with new ids, skipping
+// those with the start and end of an existing block of their creator or an
+// import UID that their creator has imported already.
+func (db *DB) mergeBlocks(blocks []models.BackupBlock, report *models.RestoreReport) error {
+	for _, b := range blocks {
+		if b.End == "" {
+			report.Skipped++
+			continue
+		}
+
+		q := `
+    SELECT EXISTS (SELECT 1 FROM block
+      WHERE created_by = ? AND start = ? AND "end" = ? AND deleted_at IS NULL)
+    `
+		var exists bool
+		if err := db.queryRow(q, creator(b, db.user), b.Start, b.End).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists && b.ImportUID != "" {
+			var err error
+			if _, exists, err = db.importedBlockID(creator(b, db.user), b.ImportUID); err != nil {
+				return err
+			}
+		}
+		if exists {
+			report.Skipped++
+			continue
+		}
+
+		block := models.BlockCreate{
+			Start:      b.Start,
+			End:        b.End,
+			Homeoffice: b.Homeoffice,
+			Project:    b.Project,
+			Billable:   b.Billable,
+			Pauses:     pausesWithoutBlockID(b.Pauses),
+		}
+		var err error
+		if b.ImportUID != "" {
+			_, err = db.addImportedBlock(creator(b, db.user), models.BlockImport{UID: b.ImportUID, Block: block})
+		} else {
+			_, err = db.addBlock(creator(b, db.user), block)
+		}
+		if err != nil {
+			return err
+		}
+		report.Blocks++
+		report.Pauses += len(b.Pauses)
+	}
+	return nil
+}
+
+// ExportBackup returns the same document as DB.ExportBackup.
+func (m *MemoryStore) ExportBackup() (models.Backup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	backup := models.Backup{
+		Version:  models.BackupVersion,
+		Blocks:   []models.BackupBlock{},
+		Current:  models.BackupCurrents{},
+		Settings: []models.UserSettings{},
+		Locks:    m.sortedLocks(),
+		Feeds:    m.sortedFeeds(),
+	}
+	for email, c := range m.currents {
+		if c.blockID != -1 {
+			backup.Current = append(backup.Current, models.BackupCurrent{Email: email, BlockID: c.blockID, PauseID: c.pauseID})
+		}
+	}
+	sort.Slice(backup.Current, func(i, j int) bool {
+		return backup.Current[i].Email < backup.Current[j].Email
+	})
+	for _, b := range m.filterBlocks(func(memoryBlock) bool { return true }) {
+		backup.Blocks = append(backup.Blocks, models.BackupBlock{
+			Block:     b,
+			ImportUID: m.blocks[b.Id].importUID,
+			CreatedBy: m.blocks[b.Id].createdBy,
+		})
+	}
+
+	for email, settings := range m.settings {
+		backup.Settings = append(backup.Settings, models.UserSettings{Email: email, Settings: settings})
+	}
+	sort.Slice(backup.Settings, func(i, j int) bool {
+		return backup.Settings[i].Email < backup.Settings[j].Email
+	})
+
+	config := models.DefaultSurchargeConfig()
+	if m.surcharges != nil {
+		config = *m.surcharges
+	}
+	backup.Surcharges = &config
+	return backup, nil
+}
+
+// RestoreBackup restores the backup like DB.RestoreBackup. Backups with
+// rates, invoices or a workflow are rejected, since the memory store has
+// neither billing nor accounts.
+func (m *MemoryStore) RestoreBackup(backup models.Backup, mode RestoreMode) (models.RestoreReport, error) {
+	if err := validateBackup(&backup); err != nil {
+		return models.RestoreReport{}, err
+	}
+	if len(backup.Rates) > 0 || len(backup.Invoices) > 0 {
+		return models.RestoreReport{}, invalidBackup("rates and invoices can only be restored to SQLite or PostgreSQL")
+	}
+	if w := backup.Workflow; w != nil && (len(w.Accounts) > 0 || len(w.Teams) > 0 || len(w.Submissions) > 0) {
+		return models.RestoreReport{}, invalidBackup("accounts, teams and submissions can only be restored to SQLite or PostgreSQL")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := models.RestoreReport{Mode: string(mode)}
+	if mode == RestoreMerge {
+		if err := checkMergeable(backup); err != nil {
+			return models.RestoreReport{}, err
+		}
+		if err := m.mergeBlocks(backup.Blocks, &report); err != nil {
+			return models.RestoreReport{}, err
+		}
+	} else {
+		if err := m.replaceBlocks(backup, &report); err != nil {
+			return models.RestoreReport{}, err
+		}
+	}
+
+	for _, s := range backup.Settings {
+		before, ok := m.settings[s.Email]
+		if !ok {
+			before = models.DefaultSettings()
+		}
+		m.settings[s.Email] = s.Settings
+		m.audit(EntitySettings, s.Email, 0, OpUpdate, before, s.Settings)
+	}
+	if backup.Surcharges != nil {
+		before := models.DefaultSurchargeConfig()
+		if m.surcharges != nil {
+			before = *m.surcharges
+		}
+		config := *backup.Surcharges
+		m.surcharges = &config
+		m.audit(EntitySurcharges, "", 0, OpUpdate, before, config)
+	}
+	return report, nil
+}
+
+// replaceBlocks is DB.replaceBlocks. It checks the locks of all replaced and
+// restored blocks first, since it cannot roll back.
+func (m *MemoryStore) replaceBlocks(backup models.Backup, report *models.RestoreReport) error {
+	existing := m.filterBlocks(func(memoryBlock) bool { return true })
+	for i := range existing {
+		if err := m.checkUnlocked(m.blocks[existing[i].Id].createdBy, blockSpans(&existing[i])...); err != nil {
+			return err
+		}
+	}
+	for i := range backup.Blocks {
+		if err := m.checkUnlocked(creator(backup.Blocks[i], m.user), blockSpans(&backup.Blocks[i].Block)...); err != nil {
+			return err
+		}
+	}
+
+	for i := range existing {
+		m.auditBlock(OpDelete, existing[i].Id, &existing[i], nil)
+	}
+	for _, item := range m.trashItems() {
+		if item.Block != nil {
+			m.audit(EntityBlock, strconv.Itoa(item.Id), item.Id, OpPurge, item.Block, nil)
+		} else {
+			m.audit(EntityPause, strconv.Itoa(item.Id), item.Pause.BlockID, OpPurge, item.Pause, nil)
+		}
+	}
+	emails := make([]string, 0, len(m.settings))
+	for email := range m.settings {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		m.audit(EntitySettings, email, 0, OpDelete, m.settings[email], nil)
+	}
+
+	m.blocks = make(map[int]memoryBlock)
+	m.pauses = make(map[int]models.Pause)
+	m.trashBlocks = make(map[int]memoryTrashBlock)
+	m.trashPauses = make(map[int]memoryTrashPause)
+	m.settings = make(map[string]models.Settings)
+	m.nextBlockID, m.nextPauseID = 1, 1
+
+	for _, b := range backup.Blocks {
+		m.blocks[b.Id] = memoryBlock{
+			start:      b.Start,
+			end:        b.End,
+			homeoffice: b.Homeoffice,
+			project:    b.Project,
+			billable:   b.Billable,
+			importUID:  b.ImportUID,
+			createdBy:  creator(b, m.user),
+		}
+		if b.Id >= m.nextBlockID {
+			m.nextBlockID = b.Id + 1
+		}
+		block := b.Block
+		m.auditBlock(OpCreate, b.Id, nil, &block)
+		report.Blocks++
+
+		for _, p := range b.Pauses {
+			m.pauses[p.Id] = p
+			if p.Id >= m.nextPauseID {
+				m.nextPauseID = p.Id + 1
+			}
+			report.Pauses++
+		}
+	}
+
+	m.currents = make(map[string]memoryCurrent)
+	for _, c := range backup.Current {
+		email := c.Email
+		if email == "" {
+			email = auditUser(m.user)
+		}
+		m.currents[email] = memoryCurrent{blockID: c.BlockID, pauseID: c.PauseID}
+	}
+
+	for _, l := range m.sortedLocks() {
+		m.audit(EntityLock, strconv.Itoa(l.Id), 0, OpDelete, l, nil)
+	}
+	m.locks = make(map[int]models.PeriodLock)
+	m.nextLockID = 1
+	for _, l := range backup.Locks {
+		m.locks[l.Id] = l
+		if l.Id >= m.nextLockID {
+			m.nextLockID = l.Id + 1
+		}
+		m.audit(EntityLock, strconv.Itoa(l.Id), 0, OpCreate, nil, l)
+	}
+
+	for _, f := range m.sortedFeeds() {
+		m.audit(EntityFeed, f.Email, 0, OpDelete, nil, nil)
+	}
+	m.feeds = make(map[string]string)
+	for _, f := range backup.Feeds {
+		m.feeds[f.Email] = f.Secret
+		m.audit(EntityFeed, f.Email, 0, OpCreate, nil, nil)
+	}
+	return nil
+}
+
+// mergeBlocks is DB.mergeBlocks. It checks the locks of the added blocks
+// first, since it cannot roll back.
+func (m *MemoryStore) mergeBlocks(blocks []models.BackupBlock, report *models.RestoreReport) error {
+	var added []models.BackupBlock
+	for _, b := range blocks {
+		exists := b.End == ""
+		owner := creator(b, m.user)
+		for _, existing := range m.blocks {
+			if existing.createdBy != owner {
+				continue
+			}
+			if existing.start == b.Start && existing.end == b.End ||
+				b.ImportUID != "" && existing.importUID == b.ImportUID {
+				exists = true
+			}
+		}
+		for _, a := range added {
+			if creator(a, m.user) != owner {
+				continue
+			}
+			if a.Start == b.Start && a.End == b.End ||
+				b.ImportUID != "" && a.ImportUID == b.ImportUID {
+				exists = true
+			}
+		}
+		if exists {
+			report.Skipped++
+			continue
+		}
+		added = append(added, b)
+	}
+
+	for i := range added {
+		if err := m.checkUnlocked(creator(added[i], m.user), blockSpans(&added[i].Block)...); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range added {
+		_, err := m.addImportedBlock(creator(b, m.user), models.BlockImport{
+			UID: b.ImportUID,
+			Block: models.BlockCreate{
+				Start:      b.Start,
+				End:        b.End,
+				Homeoffice: b.Homeoffice,
+				Project:    b.Project,
+				Billable:   b.Billable,
+				Pauses:     pausesWithoutBlockID(b.Pauses),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		report.Blocks++
+		report.Pauses += len(b.Pauses)
+	}
+	return nil
+}
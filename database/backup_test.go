@@ -0,0 +1,86 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// backupTables are the tables a backup holds. The audit log is not part of
+// it, since it is append-only and restores append to it, and neither is
+// schema_migrations, which Migrate fills.
+var backupTables = []string{
+	"block", "pause", "current", "account", "setting", "surcharge_config", "rate",
+	"invoice", "invoice_line", "feed", "period_lock", "team", "team_member",
+	"submission", "submission_event",
+}
+
+func rowCounts(t *testing.T, db *DB) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for _, table := range backupTables {
+		var count int
+		assert.NoError(t, db.queryRow(`SELECT COUNT(*) FROM `+table).Scan(&count))
+		counts[table] = count
+	}
+	return counts
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	const employee, manager = "employee@test.com", "manager@test.com"
+	db := GetNewTestDatabase()
+	defer db.Close()
+
+	for _, email := range []string{employee, manager} {
+		_, err := db.AddUser(email, "hash")
+		assert.NoError(t, err)
+	}
+	_, err := db.SetUserRole(manager, models.RoleManager)
+	assert.NoError(t, err)
+	team, err := db.AddTeam("Backend")
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddTeamMember(team.Id, employee))
+	assert.NoError(t, db.UpdateSettings(employee, models.Settings{Timezone: "UTC"}))
+	assert.NoError(t, db.UpdateSurchargeConfig(models.SurchargeConfig{Rules: []models.SurchargeRule{}, Holidays: []string{"2023-05-18"}}))
+	_, err = db.RegenerateFeedSecret(employee)
+	assert.NoError(t, err)
+
+	user := db.WithUser(employee)
+	_, err = db.AddRate(employee, models.RateCreate{CentsPerHour: 6000, EffectiveFrom: "2023-01-01"})
+	assert.NoError(t, err)
+	_, err = user.AddBlock(models.BlockCreate{Start: "2023-05-10T08:00:00Z", End: "2023-05-10T16:00:00Z", Billable: true,
+		Pauses: []models.PauseWithoutBlockID{{Start: "2023-05-10T12:00:00Z", End: "2023-05-10T12:30:00Z"}}})
+	assert.NoError(t, err)
+	may := TimeRange{Start: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)}
+	_, err = db.CreateInvoice(employee, may, time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	start := time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC)
+	submitted, err := db.Submit(employee, "week", start, start.AddDate(0, 0, 7), "")
+	assert.NoError(t, err)
+	_, err = db.WithUser(manager).(*DB).ApproveSubmission(submitted.Id, "")
+	assert.NoError(t, err)
+
+	_, err = user.StartBlock(true, time.Date(2023, 6, 2, 8, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	_, err = user.StartPause(time.Date(2023, 6, 2, 10, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	want := rowCounts(t, db)
+	for table, count := range want {
+		assert.NotZero(t, count, table)
+	}
+
+	backup, err := db.ExportBackup()
+	assert.NoError(t, err)
+	restored, err := NewDatabaseAt(filepath.Join(t.TempDir(), "restored.db"))
+	assert.NoError(t, err)
+	defer restored.Close()
+	assert.NoError(t, restored.Init())
+	_, err = restored.RestoreBackup(backup, RestoreReplace)
+	assert.NoError(t, err)
+	assert.Equal(t, want, rowCounts(t, restored))
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+const benchmarkBlocks = 10000
+
+// newBenchmarkDatabase returns a database with one block per day, each with
+// two pauses, starting on 2000-01-01.
+func newBenchmarkDatabase(b *testing.B) *DB {
+	db, err := NewDatabaseAt(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := db.Init(); err != nil {
+		b.Fatal(err)
+	}
+
+	day := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = db.transaction(func(tx *DB) error {
+		for i := 0; i < benchmarkBlocks; i++ {
+			at := func(hour, minute int) string {
+				return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute).Format(time.RFC3339)
+			}
+			_, err := tx.AddBlock(models.BlockCreate{
+				Start: at(8, 0),
+				End:   at(17, 0),
+				Pauses: []models.PauseWithoutBlockID{
+					{Start: at(10, 0), End: at(10, 15)},
+					{Start: at(12, 0), End: at(12, 45)},
+				},
+			})
+			if err != nil {
+				return err
+			}
+			day = day.AddDate(0, 0, 1)
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+// getBlocksPerBlock loads blocks the way they were loaded before getBlocks:
+// one query for the blocks and one more for the pauses of every block. It is
+// the baseline of the benchmarks.
+func (db *DB) getBlocksPerBlock(where string, args ...any) ([]models.Block, error) {
+	q := `
+  SELECT id, start, "end", homeoffice FROM block
+  ` + where + `
+  ORDER BY id
+  `
+	rows, err := db.query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []models.Block
+	for rows.Next() {
+		var b models.Block
+		if err := rows.Scan(&b.Id, &b.Start, &b.End, &b.Homeoffice); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range blocks {
+		if blocks[i].Pauses, err = db.GetPausesByBlockID(blocks[i].Id); err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+func BenchmarkGetAllBlocks(b *testing.B) {
+	db := newBenchmarkDatabase(b)
+	defer db.Close()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		blocks, err := db.GetAllBlocks()
+		if err != nil || len(blocks) != benchmarkBlocks {
+			b.Fatalf("got %d blocks, %v", len(blocks), err)
+		}
+	}
+}
+
+func BenchmarkGetBlocksInRange(b *testing.B) {
+	db := newBenchmarkDatabase(b)
+	defer db.Close()
+	year, err := ParseTimeRange("2010-01-01T00:00:00Z", "2011-01-01T00:00:00Z", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		blocks, err := db.GetBlocksInRange(year)
+		if err != nil || len(blocks) != 365 {
+			b.Fatalf("got %d blocks, %v", len(blocks), err)
+		}
+	}
+}
+
+func BenchmarkGetAllBlocksPerBlock(b *testing.B) {
+	db := newBenchmarkDatabase(b)
+	defer db.Close()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		blocks, err := db.getBlocksPerBlock("")
+		if err != nil || len(blocks) != benchmarkBlocks {
+			b.Fatalf("got %d blocks, %v", len(blocks), err)
+		}
+	}
+}
+
+func BenchmarkGetBlocksInRangePerBlock(b *testing.B) {
+	db := newBenchmarkDatabase(b)
+	defer db.Close()
+	conditions, args := TimeRange{
+		Start: time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2011, 1, 1, 0, 0, 0, 0, time.UTC),
+	}.conditions()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		blocks, err := db.getBlocksPerBlock(where(conditions), args...)
+		if err != nil || len(blocks) != 365 {
+			b.Fatalf("got %d blocks, %v", len(blocks), err)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/report"
+)
+
+func errRateMissing(project string, date string) error {
+	return &Error{
+		Kind:    ErrInvalidState,
+		Code:    "rate_missing",
+		Message: fmt.Sprintf("no rate for project %q on %s", project, date),
+	}
+}
+
+func (db *DB) AddRate(email string, rate models.RateCreate) (models.Rate, error) {
+	if _, err := time.Parse(time.DateOnly, rate.EffectiveFrom); err != nil || rate.CentsPerHour <= 0 {
+		return models.Rate{}, ErrInvalidRate
+	}
+
+	var newRate models.Rate
+	err := db.transaction(func(tx *DB) error {
+		q := `
+    INSERT INTO rate (email, project, cents_per_hour, effective_from)
+    VALUES (?, ?, ?, ?)
+    `
+		id, err := tx.insert(q, email, rate.Project, rate.CentsPerHour, rate.EffectiveFrom)
+		if err != nil {
+			return err
+		}
+
+		newRate = models.Rate{
+			Id:            id,
+			Email:         email,
+			Project:       rate.Project,
+			CentsPerHour:  rate.CentsPerHour,
+			EffectiveFrom: rate.EffectiveFrom,
+		}
+		return tx.audit(EntityRate, strconv.Itoa(id), 0, OpCreate, nil, newRate)
+	})
+	if err != nil {
+		return models.Rate{}, err
+	}
+	return newRate, nil
+}
+
+// GetRates returns the rates of a user ordered by the date they take effect.
+func (db *DB) GetRates(email string) ([]models.Rate, error) {
+	q := `
+  SELECT id, email, project, cents_per_hour, effective_from FROM rate
+  WHERE email = ?
+  ORDER BY effective_from, id
+  `
+	rows, err := db.query(q, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []models.Rate
+	for rows.Next() {
+		var r models.Rate
+		if err := rows.Scan(&r.Id, &r.Email, &r.Project, &r.CentsPerHour, &r.EffectiveFrom); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+
+	return rates, rows.Err()
+}
+
+func (db *DB) DeleteRate(email string, id int) (int, error) {
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		q := `
+    SELECT id, email, project, cents_per_hour, effective_from FROM rate
+    WHERE id = ? AND email = ?
+    `
+		var before models.Rate
+		err := tx.queryRow(q, id, email).Scan(&before.Id, &before.Email, &before.Project,
+			&before.CentsPerHour, &before.EffectiveFrom)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		q = `
+    DELETE FROM rate
+    WHERE id = ? AND email = ?
+    `
+		result, err := tx.exec(q, id, email)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		return tx.audit(EntityRate, strconv.Itoa(id), 0, OpDelete, before, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// allRates returns the rates of all users ordered by id.
+func (db *DB) allRates() ([]models.Rate, error) {
+	q := `
+  SELECT id, email, project, cents_per_hour, effective_from FROM rate
+  ORDER BY id
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []models.Rate
+	for rows.Next() {
+		var r models.Rate
+		if err := rows.Scan(&r.Id, &r.Email, &r.Project, &r.CentsPerHour, &r.EffectiveFrom); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+
+	return rates, rows.Err()
+}
+
+// rateFor returns the rate that applies to a project on the given date: the
+// latest rate of the project itself or, without one, the latest rate for all
+// projects. rates must be ordered by the date they take effect.
+func rateFor(rates []models.Rate, project string, date string) (models.Rate, bool) {
+	var general, specific models.Rate
+	var hasGeneral, hasSpecific bool
+	for _, r := range rates {
+		if r.EffectiveFrom > date {
+			break
+		}
+		if r.Project == project {
+			specific, hasSpecific = r, true
+		}
+		if r.Project == "" {
+			general, hasGeneral = r, true
+		}
+	}
+	if hasSpecific {
+		return specific, true
+	}
+	return general, hasGeneral
+}
+
+// invoiceLines prices the net time of each block, rounded to minutes, with
+// the rate of the day the block started on in loc.
+func invoiceLines(blocks []models.Block, rates []models.Rate, loc *time.Location) ([]models.InvoiceLine, int64, error) {
+	var lines []models.InvoiceLine
+	var total int64
+	for _, b := range blocks {
+		start, err := time.Parse(time.RFC3339, b.Start)
+		if err != nil {
+			return nil, 0, err
+		}
+		net, _, err := report.NetDuration(b)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		date := start.In(loc).Format(time.DateOnly)
+		rate, ok := rateFor(rates, b.Project, date)
+		if !ok {
+			return nil, 0, errRateMissing(b.Project, date)
+		}
+
+		minutes := int(net.Round(time.Minute) / time.Minute)
+		amount := (int64(minutes)*rate.CentsPerHour + 30) / 60
+		lines = append(lines, models.InvoiceLine{
+			BlockID:      b.Id,
+			Date:         date,
+			Project:      b.Project,
+			Minutes:      minutes,
+			CentsPerHour: rate.CentsPerHour,
+			AmountCents:  amount,
+		})
+		total += amount
+	}
+	return lines, total, nil
+}
+
+// lockInvoices serializes the creation of invoices on PostgreSQL, so that
+// numbers are handed out without gaps and no block is billed twice.
+func (db *DB) lockInvoices() error {
+	if db.dialect != postgres {
+		return nil
+	}
+	_, err := db.exec("LOCK TABLE invoice IN EXCLUSIVE MODE")
+	return err
+}
+
+// nextInvoiceNumber returns the number of the next invoice created in the
+// given year, like 2023-0001.
+func (db *DB) nextInvoiceNumber(year int) (string, error) {
+	q := `
+  SELECT COUNT(*) FROM invoice
+  WHERE number LIKE ?
+  `
+	var count int
+	if err := db.queryRow(q, fmt.Sprintf("%d-%%", year)).Scan(&count); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%04d", year, count+1), nil
+}
+
+// CreateInvoice bills the finished billable blocks of the user within the
+// range that have not been billed yet with the rates of the user. at is the
+// time of creation, its location determines the days of the blocks.
+func (db *DB) CreateInvoice(email string, r TimeRange, at time.Time) (models.Invoice, error) {
+	r.Mode = RangeContained
+	conditions, args := r.conditions()
+	conditions = append(conditions, "block.billable", "block.invoice_id IS NULL", "block.end_unix IS NOT NULL",
+		"block.created_by = ?")
+	args = append(args, email)
+
+	invoice := models.Invoice{
+		Email:   email,
+		Created: at.Format(time.RFC3339),
+	}
+	if !r.Start.IsZero() {
+		invoice.Start = r.Start.In(at.Location()).Format(time.RFC3339)
+	}
+	if !r.End.IsZero() {
+		invoice.End = r.End.In(at.Location()).Format(time.RFC3339)
+	}
+
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.lockInvoices(); err != nil {
+			return err
+		}
+		if tx.dialect == postgres {
+			q := "SELECT block.id FROM block " + where(conditions) + " FOR UPDATE"
+			if _, err := tx.exec(q, args...); err != nil {
+				return err
+			}
+		}
+
+		blocks, err := tx.getBlocks(conditions, args...)
+		if err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return ErrNoBillableBlocks
+		}
+		rates, err := tx.GetRates(email)
+		if err != nil {
+			return err
+		}
+		invoice.Lines, invoice.TotalCents, err = invoiceLines(blocks, rates, at.Location())
+		if err != nil {
+			return err
+		}
+
+		invoice.Number, err = tx.nextInvoiceNumber(at.Year())
+		if err != nil {
+			return err
+		}
+		q := `
+    INSERT INTO invoice (number, email, created, start, "end", total_cents)
+    VALUES (?, ?, ?, ?, ?, ?)
+    `
+		invoice.Id, err = tx.insert(q, invoice.Number, invoice.Email, invoice.Created,
+			invoice.Start, invoice.End, invoice.TotalCents)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range invoice.Lines {
+			q := `
+      INSERT INTO invoice_line
+      (invoice_id, block_id, date, project, minutes, cents_per_hour, amount_cents)
+      VALUES (?, ?, ?, ?, ?, ?, ?)
+      `
+			_, err := tx.insert(q, invoice.Id, line.BlockID, line.Date, line.Project,
+				line.Minutes, line.CentsPerHour, line.AmountCents)
+			if err != nil {
+				return err
+			}
+
+			q = `
+      UPDATE block
+      SET invoice_id = ?
+      WHERE id = ?
+      `
+			if _, err := tx.exec(q, invoice.Id, line.BlockID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.audit(EntityInvoice, strconv.Itoa(invoice.Id), 0, OpCreate, nil, invoice); err != nil {
+			return err
+		}
+		for _, before := range blocks {
+			after := before
+			after.InvoiceID = invoice.Id
+			// billing leaves the times alone, so it is allowed in locked
+			// periods
+			if err := tx.audit(EntityBlock, strconv.Itoa(before.Id), before.Id, OpUpdate, &before, &after); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Invoice{}, err
+	}
+
+	return invoice, nil
+}
+
+func (db *DB) getInvoices(where string, args ...any) ([]models.Invoice, error) {
+	q := `
+  SELECT invoice.id, number, email, created, start, "end", total_cents,
+  block_id, date, project, minutes, cents_per_hour, amount_cents
+  FROM invoice
+  JOIN invoice_line ON invoice_line.invoice_id = invoice.id
+  ` + where + `
+  ORDER BY invoice.id, invoice_line.id
+  `
+	rows, err := db.query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []models.Invoice
+	for rows.Next() {
+		var inv models.Invoice
+		var line models.InvoiceLine
+		err := rows.Scan(&inv.Id, &inv.Number, &inv.Email, &inv.Created, &inv.Start, &inv.End,
+			&inv.TotalCents, &line.BlockID, &line.Date, &line.Project, &line.Minutes,
+			&line.CentsPerHour, &line.AmountCents)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(invoices) == 0 || invoices[len(invoices)-1].Id != inv.Id {
+			invoices = append(invoices, inv)
+		}
+		last := &invoices[len(invoices)-1]
+		last.Lines = append(last.Lines, line)
+	}
+
+	return invoices, rows.Err()
+}
+
+// GetInvoices returns the invoices of a user ordered by id.
+func (db *DB) GetInvoices(email string) ([]models.Invoice, error) {
+	return db.getInvoices("WHERE invoice.email = ?", email)
+}
+
+func (db *DB) GetInvoiceByID(email string, id int) (models.Invoice, error) {
+	invoices, err := db.getInvoices("WHERE invoice.email = ? AND invoice.id = ?", email, id)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if len(invoices) == 0 {
+		return models.Invoice{}, ErrInvoiceNotFound
+	}
+	return invoices[0], nil
+}
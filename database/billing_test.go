@@ -0,0 +1,186 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteBilling(t *testing.T) {
+	db := GetNewTestDatabase()
+	defer db.Close()
+	testBilling(t, db)
+}
+
+func TestPostgresBilling(t *testing.T) {
+	db := newPostgresTestDatabase(t)
+	defer db.Close()
+	testBilling(t, db)
+}
+
+func testBilling(t *testing.T, db *DB) {
+	const email = "test@test.com"
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	at := time.Date(2023, 6, 1, 10, 0, 0, 0, berlin)
+	may := TimeRange{
+		Start: time.Date(2023, 5, 1, 0, 0, 0, 0, berlin),
+		End:   time.Date(2023, 6, 1, 0, 0, 0, 0, berlin),
+	}
+
+	_, err = db.AddRate(email, models.RateCreate{CentsPerHour: 0, EffectiveFrom: "2023-01-01"})
+	assert.ErrorIs(t, err, ErrInvalidRate)
+	_, err = db.AddRate(email, models.RateCreate{CentsPerHour: 100, EffectiveFrom: "2023-01"})
+	assert.ErrorIs(t, err, ErrInvalidRate)
+
+	general, err := db.AddRate(email, models.RateCreate{CentsPerHour: 6000, EffectiveFrom: "2023-01-01"})
+	assert.NoError(t, err)
+	_, err = db.AddRate(email, models.RateCreate{CentsPerHour: 9000, EffectiveFrom: "2023-05-10"})
+	assert.NoError(t, err)
+	_, err = db.AddRate(email, models.RateCreate{Project: "website", CentsPerHour: 7500, EffectiveFrom: "2023-01-01"})
+	assert.NoError(t, err)
+	_, err = db.AddRate("other@test.com", models.RateCreate{CentsPerHour: 1, EffectiveFrom: "2023-01-01"})
+	assert.NoError(t, err)
+
+	rates, err := db.GetRates(email)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(rates))
+
+	_, err = db.CreateInvoice(email, may, at)
+	assert.ErrorIs(t, err, ErrNoBillableBlocks)
+
+	blocks := []models.BlockCreate{
+		// Starts on May 9 in Berlin, before the general rate went up.
+		{Start: "2023-05-08T22:30:00Z", End: "2023-05-09T00:30:00Z", Billable: true},
+		{Start: "2023-05-10T08:00:00+02:00", End: "2023-05-10T16:30:00+02:00", Billable: true,
+			Pauses: []models.PauseWithoutBlockID{{Start: "2023-05-10T12:00:00+02:00", End: "2023-05-10T12:30:00+02:00"}}},
+		{Start: "2023-05-11T08:00:00+02:00", End: "2023-05-11T08:20:00+02:00", Billable: true, Project: "website"},
+		{Start: "2023-05-12T08:00:00+02:00", End: "2023-05-12T10:00:00+02:00"},
+		{Start: "2023-06-01T08:00:00+02:00", End: "2023-06-01T10:00:00+02:00", Billable: true},
+	}
+	user := db.WithUser(email)
+	var ids []int
+	for _, b := range blocks {
+		newBlock, err := user.AddBlock(b)
+		assert.NoError(t, err)
+		ids = append(ids, newBlock.Id)
+	}
+
+	// Blocks of other users are neither billed nor marked as billed.
+	other, err := db.WithUser("other@test.com").AddBlock(models.BlockCreate{
+		Start: "2023-05-15T08:00:00+02:00", End: "2023-05-15T10:00:00+02:00", Billable: true})
+	assert.NoError(t, err)
+
+	invoice, err := db.CreateInvoice(email, may, at)
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-0001", invoice.Number)
+	assert.Equal(t, "2023-05-01T00:00:00+02:00", invoice.Start)
+	assert.Equal(t, "2023-06-01T00:00:00+02:00", invoice.End)
+	assert.Equal(t, []models.InvoiceLine{
+		{BlockID: ids[0], Date: "2023-05-09", Minutes: 120, CentsPerHour: 6000, AmountCents: 12000},
+		{BlockID: ids[1], Date: "2023-05-10", Minutes: 480, CentsPerHour: 9000, AmountCents: 72000},
+		{BlockID: ids[2], Date: "2023-05-11", Project: "website", Minutes: 20, CentsPerHour: 7500, AmountCents: 2500},
+	}, invoice.Lines)
+	assert.Equal(t, int64(86500), invoice.TotalCents)
+	other, err = db.GetBlockByID(other.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, other.InvoiceID)
+
+	stored, err := db.GetInvoiceByID(email, invoice.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, invoice, stored)
+	_, err = db.GetInvoiceByID("other@test.com", invoice.Id)
+	assert.ErrorIs(t, err, ErrInvoiceNotFound)
+
+	// Billed blocks cannot be changed or billed again.
+	block, err := db.GetBlockByID(ids[1])
+	assert.NoError(t, err)
+	assert.Equal(t, invoice.Id, block.InvoiceID)
+	_, err = db.UpdateBlock(block)
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.UpdateBlockStart(block.Id, block.Start)
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.UpdateBlockEnd(block.Id, block.End)
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.UpdateBlockHomeoffice(block.Id, true)
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.UpdatePauseStart(block.Pauses[0].Id, block.Pauses[0].Start)
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.UpdatePauseEnd(block.Pauses[0].Id, block.Pauses[0].End)
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.UpdatePause(block.Pauses[0])
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.DeletePause(block.Pauses[0].Id)
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.AddPause(models.PauseCreate{Start: block.Start, End: block.Start, BlockID: block.Id})
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.DeleteBlock(block.Id)
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	_, err = db.CreateInvoice(email, may, at)
+	assert.ErrorIs(t, err, ErrNoBillableBlocks)
+
+	// Unbilled blocks can still be changed.
+	n, err := db.UpdateBlockHomeoffice(ids[3], true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	invoice, err = db.CreateInvoice(email, TimeRange{}, at)
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-0002", invoice.Number)
+	assert.Equal(t, 1, len(invoice.Lines))
+
+	invoices, err := db.GetInvoices(email)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(invoices))
+
+	_, err = user.AddBlock(models.BlockCreate{Start: "2022-12-30T08:00:00+01:00", End: "2022-12-30T09:00:00+01:00", Billable: true, Project: "app"})
+	assert.NoError(t, err)
+	n, err = db.DeleteRate(email, general.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = db.CreateInvoice(email, TimeRange{}, at)
+	var e *Error
+	assert.ErrorAs(t, err, &e)
+	assert.Equal(t, "rate_missing", e.Code)
+
+	// Backups keep rates, invoices and locks, so billed blocks stay billed.
+	_, err = db.AddLock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), "")
+	assert.NoError(t, err)
+	backup, err := db.ExportBackup()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(backup.Rates))
+	assert.Equal(t, 2, len(backup.Invoices))
+	assert.Equal(t, 1, len(backup.Locks))
+	want, err := json.Marshal(backup)
+	assert.NoError(t, err)
+
+	_, err = db.DeleteRate(email, backup.Rates[1].Id)
+	assert.NoError(t, err)
+	_, err = db.DeleteLock(backup.Locks[0].Id)
+	assert.NoError(t, err)
+	_, err = db.RestoreBackup(backup, RestoreReplace)
+	assert.NoError(t, err)
+	restored, err := db.ExportBackup()
+	assert.NoError(t, err)
+	data, err := json.Marshal(restored)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(want), string(data))
+	block, err = db.GetBlockByID(ids[1])
+	assert.NoError(t, err)
+	_, err = db.DeleteBlock(block.Id)
+	assert.ErrorIs(t, err, ErrBlockBilled)
+	invoices, err = db.GetInvoices(email)
+	assert.NoError(t, err)
+	assert.Equal(t, backup.Invoices, invoices)
+
+	_, err = db.RestoreBackup(backup, RestoreMerge)
+	assert.ErrorIs(t, err, ErrValidation)
+	_, err = NewMemoryStore().RestoreBackup(backup, RestoreReplace)
+	assert.ErrorIs(t, err, ErrValidation)
+	backup.Invoices = backup.Invoices[1:]
+	_, err = db.RestoreBackup(backup, RestoreReplace)
+	assert.ErrorIs(t, err, ErrValidation)
+}
@@ -3,17 +3,59 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kilianmandscharo/work_hours/models"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+type dialect int
+
+const (
+	sqlite dialect = iota
+	postgres
+)
+
 type DB struct {
-	db *sql.DB
+	conn    *sql.DB
+	db      queryer
+	dialect dialect
+	// user is recorded in the audit log, see WithUser.
+	user string
+	// owner restricts the blocks and pauses to those created by this user,
+	// see WithOwner.
+	owner string
+}
+
+// Open opens a PostgreSQL database for postgres:// and postgresql:// URLs
+// and the SQLite database file at dsn otherwise. An empty dsn opens the
+// SQLite database at the default path.
+func Open(dsn string) (*DB, error) {
+	switch {
+	case IsPostgresURL(dsn):
+		return NewPostgresDatabase(dsn)
+	case dsn == "":
+		return NewDatabase()
+	default:
+		return NewDatabaseAt(dsn)
+	}
+}
+
+// IsPostgresURL reports whether Open opens dsn as a PostgreSQL database.
+func IsPostgresURL(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
 }
 
 func GetNewTestDatabase() *DB {
@@ -33,178 +75,660 @@ func NewTestDatabase() (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &DB{db: db}, nil
+	return &DB{conn: db, db: db}, nil
 }
 
 func NewDatabase() (*DB, error) {
-	homeDir, err := os.UserHomeDir()
+	dataPath, err := DefaultPath()
 	if err != nil {
 		return nil, err
 	}
 
-	dataPath := path.Join(homeDir, ".work_hours_data")
-
-	if _, err := os.Stat(dataPath); err != nil {
-		err = os.Mkdir(dataPath, os.ModePerm)
+	if _, err := os.Stat(path.Dir(dataPath)); err != nil {
+		err = os.Mkdir(path.Dir(dataPath), os.ModePerm)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	db, err := sql.Open("sqlite3", path.Join(dataPath, "data.db?_foreign_keys=true"))
+	return NewDatabaseAt(dataPath)
+}
+
+func NewDatabaseAt(dataPath string) (*DB, error) {
+	db, err := sql.Open("sqlite3", dataPath+"?_foreign_keys=true&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, err
 	}
 
-	return &DB{db: db}, nil
+	return &DB{conn: db, db: db}, nil
 }
 
-func (db *DB) Init() error {
-	q := `
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(homeDir, ".work_hours_data", "data.db"), nil
+}
+
+var migrations = []string{
+	`
   CREATE TABLE IF NOT EXISTS block
   (id INTEGER PRIMARY KEY ASC,
   start TEXT,
   end TEXT,
   homeoffice INTEGER)
-  `
-	_, err := db.db.Exec(q)
-	if err != nil {
-		return err
-	}
-	q = `
+  `,
+	`
   CREATE TABLE IF NOT EXISTS pause 
   (id INTEGER PRIMARY KEY ASC, 
   start TEXT, 
   end TEXT, 
   block_id INTEGER, 
   FOREIGN KEY(block_id) REFERENCES block(id) ON DELETE CASCADE)
-  `
-	_, err = db.db.Exec(q)
-	if err != nil {
-		return err
-	}
-
-	q = `
+  `,
+	`
   CREATE TABLE IF NOT EXISTS current 
   (id INTEGER PRIMARY KEY ASC, 
   current_block_id INTEGER, 
   current_pause_id INTEGER)
+  `,
+	`
+  INSERT OR IGNORE INTO current (id, current_block_id, current_pause_id)
+  VALUES (1, -1, -1)
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS account
+  (id INTEGER PRIMARY KEY ASC,
+  email TEXT NOT NULL UNIQUE,
+  pw_hash TEXT NOT NULL,
+  disabled INTEGER NOT NULL DEFAULT 0)
+  `,
+	`
+  CREATE INDEX IF NOT EXISTS pause_block_id ON pause (block_id)
+  `,
+	`
+  CREATE INDEX IF NOT EXISTS block_start ON block (start)
+  `,
+	`
+  ALTER TABLE block ADD COLUMN start_unix INTEGER
+  `,
+	`
+  ALTER TABLE block ADD COLUMN end_unix INTEGER
+  `,
+	`
+  UPDATE block
+  SET start_unix = CAST(strftime('%s', start) AS INTEGER),
+  end_unix = CAST(strftime('%s', "end") AS INTEGER)
+  `,
+	`
+  CREATE INDEX IF NOT EXISTS block_start_unix ON block (start_unix)
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS setting
+  (email TEXT PRIMARY KEY,
+  timezone TEXT NOT NULL)
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS surcharge_config
+  (id INTEGER PRIMARY KEY,
+  config TEXT NOT NULL)
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS rate
+  (id INTEGER PRIMARY KEY ASC,
+  email TEXT NOT NULL,
+  project TEXT NOT NULL DEFAULT '',
+  cents_per_hour INTEGER NOT NULL,
+  effective_from TEXT NOT NULL)
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS invoice
+  (id INTEGER PRIMARY KEY ASC,
+  number TEXT NOT NULL UNIQUE,
+  email TEXT NOT NULL,
+  created TEXT NOT NULL,
+  start TEXT NOT NULL,
+  "end" TEXT NOT NULL,
+  total_cents INTEGER NOT NULL)
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS invoice_line
+  (id INTEGER PRIMARY KEY ASC,
+  invoice_id INTEGER NOT NULL,
+  block_id INTEGER NOT NULL,
+  date TEXT NOT NULL,
+  project TEXT NOT NULL,
+  minutes INTEGER NOT NULL,
+  cents_per_hour INTEGER NOT NULL,
+  amount_cents INTEGER NOT NULL,
+  FOREIGN KEY(invoice_id) REFERENCES invoice(id))
+  `,
+	`
+  ALTER TABLE block ADD COLUMN project TEXT NOT NULL DEFAULT ''
+  `,
+	`
+  ALTER TABLE block ADD COLUMN billable INTEGER NOT NULL DEFAULT 0
+  `,
+	`
+  ALTER TABLE block ADD COLUMN invoice_id INTEGER REFERENCES invoice(id)
+  `,
+	`
+  ALTER TABLE setting ADD COLUMN target_minutes TEXT NOT NULL DEFAULT ''
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS feed
+  (email TEXT PRIMARY KEY,
+  secret TEXT NOT NULL UNIQUE)
+  `,
+	`
+  ALTER TABLE block ADD COLUMN import_uid TEXT
+  `,
+	`
+  CREATE UNIQUE INDEX IF NOT EXISTS block_import_uid ON block (import_uid)
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS audit
+  (id INTEGER PRIMARY KEY ASC,
+  ts TEXT NOT NULL,
+  user_email TEXT NOT NULL,
+  entity TEXT NOT NULL,
+  entity_id TEXT NOT NULL,
+  block_id INTEGER,
+  operation TEXT NOT NULL,
+  before_json TEXT,
+  after_json TEXT)
+  `,
+	`
+  CREATE INDEX IF NOT EXISTS audit_block_id ON audit (block_id)
+  `,
+	`
+  CREATE TRIGGER IF NOT EXISTS audit_no_update BEFORE UPDATE ON audit
+  BEGIN
+    SELECT RAISE(ABORT, 'the audit log is append-only');
+  END
+  `,
+	`
+  CREATE TRIGGER IF NOT EXISTS audit_no_delete BEFORE DELETE ON audit
+  BEGIN
+    SELECT RAISE(ABORT, 'the audit log is append-only');
+  END
+  `,
+	`
+  ALTER TABLE audit ADD COLUMN prev_hash TEXT NOT NULL DEFAULT ''
+  `,
+	`
+  ALTER TABLE audit ADD COLUMN hash TEXT NOT NULL DEFAULT ''
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS period_lock
+  (id INTEGER PRIMARY KEY ASC,
+  start TEXT NOT NULL,
+  "end" TEXT NOT NULL,
+  locked_by TEXT NOT NULL,
+  created TEXT NOT NULL)
+  `,
+	`
+  ALTER TABLE account ADD COLUMN role TEXT NOT NULL DEFAULT 'employee'
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS team
+  (id INTEGER PRIMARY KEY ASC,
+  name TEXT NOT NULL UNIQUE)
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS team_member
+  (team_id INTEGER NOT NULL REFERENCES team (id),
+  email TEXT NOT NULL,
+  PRIMARY KEY (team_id, email))
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS submission
+  (id INTEGER PRIMARY KEY ASC,
+  email TEXT NOT NULL,
+  period TEXT NOT NULL,
+  start TEXT NOT NULL,
+  "end" TEXT NOT NULL,
+  status TEXT NOT NULL,
+  comment TEXT NOT NULL,
+  review_comment TEXT NOT NULL DEFAULT '',
+  reviewed_by TEXT NOT NULL DEFAULT '',
+  submitted TEXT NOT NULL,
+  reviewed TEXT NOT NULL DEFAULT '',
+  lock_id INTEGER NOT NULL DEFAULT 0)
+  `,
+	`
+  CREATE INDEX IF NOT EXISTS submission_email ON submission (email, start)
+  `,
+	`
+  CREATE TABLE IF NOT EXISTS submission_event
+  (id INTEGER PRIMARY KEY ASC,
+  submission_id INTEGER NOT NULL REFERENCES submission (id),
+  email TEXT NOT NULL,
+  actor TEXT NOT NULL,
+  type TEXT NOT NULL,
+  comment TEXT NOT NULL,
+  ts TEXT NOT NULL)
+  `,
+	`
+  ALTER TABLE block ADD COLUMN created_by TEXT NOT NULL DEFAULT ''
+  `,
+	`
+  UPDATE block
+  SET created_by = COALESCE((
+    SELECT audit.user_email FROM audit
+    WHERE audit.entity = 'block' AND audit.operation = 'create'
+    AND audit.entity_id = CAST(block.id AS TEXT)
+    ORDER BY audit.id DESC
+    LIMIT 1), '')
+  `,
+	`
+  ALTER TABLE block ADD COLUMN deleted_at TEXT
+  `,
+	`
+  ALTER TABLE pause ADD COLUMN deleted_at TEXT
+  `,
+	`
+  ALTER TABLE period_lock ADD COLUMN owner TEXT NOT NULL DEFAULT ''
+  `,
+	`
+  UPDATE period_lock
+  SET owner = COALESCE((
+    SELECT submission.email FROM submission
+    WHERE submission.lock_id = period_lock.id), '')
+  `,
+	`
+  ALTER TABLE current ADD COLUMN email TEXT NOT NULL DEFAULT ''
+  `,
+	`
+  UPDATE current
+  SET email = COALESCE((
+    SELECT block.created_by FROM block
+    WHERE block.id = current.current_block_id), '')
+  `,
+	`
+  CREATE UNIQUE INDEX IF NOT EXISTS current_email ON current (email)
+  `,
+	`
+  DROP INDEX IF EXISTS block_import_uid
+  `,
+	`
+  CREATE UNIQUE INDEX IF NOT EXISTS block_created_by_import_uid ON block (created_by, import_uid)
+  `,
+}
+
+func (db *DB) migrations() []string {
+	if db.dialect == postgres {
+		return postgresMigrations
+	}
+	return migrations
+}
+
+func (db *DB) Init() error {
+	_, err := db.Migrate()
+	return err
+}
+
+// SchemaVersion returns the number of migrations applied to the database, 0
+// for a new one.
+func (db *DB) SchemaVersion() (int, error) {
+	q := `
+  CREATE TABLE IF NOT EXISTS schema_migrations
+  (version INTEGER PRIMARY KEY)
   `
-	_, err = db.db.Exec(q)
-	if err != nil {
-		return err
+	if _, err := db.exec(q); err != nil {
+		return 0, err
 	}
 
+	var version int
 	q = `
-  INSERT OR IGNORE INTO current (id, current_block_id, current_pause_id)
-  VALUES (1, -1, -1)
+  SELECT COALESCE(MAX(version), 0) FROM schema_migrations
   `
-	_, err = db.db.Exec(q)
+	err := db.queryRow(q).Scan(&version)
+	return version, err
+}
+
+// Migrate applies all migrations that have not been recorded in the
+// schema_migrations table yet and returns how many were applied.
+func (db *DB) Migrate() (int, error) {
+	current, err := db.SchemaVersion()
 	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	migrations := db.migrations()
+	for i := current; i < len(migrations); i++ {
+		tx, err := db.conn.Begin()
+		if err != nil {
+			return applied, err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return applied, err
+		}
+		q := `
+    INSERT INTO schema_migrations (version)
+    VALUES (?)
+    `
+		if _, err := tx.Exec(db.rebind(q), i+1); err != nil {
+			tx.Rollback()
+			return applied, err
+		}
+		if err := tx.Commit(); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+// AdoptBlocks makes owner the creator of the blocks without one, which were
+// created before creators were recorded and could not be attributed through
+// the audit log, and gives owner the current block and pause that belong to
+// nobody unless owner has its own. It returns the number of adopted blocks.
+func (db *DB) AdoptBlocks(owner string) (int, error) {
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		q := `
+    UPDATE block
+    SET created_by = ?
+    WHERE created_by = ''
+    `
+		result, err := tx.exec(q, owner)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		q = `
+    UPDATE current
+    SET email = ?
+    WHERE email = '' AND NOT EXISTS (SELECT 1 FROM current AS other WHERE other.email = ?)
+    `
+		_, err = tx.exec(q, owner, owner)
 		return err
+	})
+	if err != nil {
+		return 0, err
 	}
+	return int(rowsAffected), nil
+}
 
-	return nil
+// Backup writes a consistent copy of the database to the given file, which
+// must not exist yet. PostgreSQL databases are backed up with pg_dump.
+func (db *DB) Backup(dest string) error {
+	if db.dialect == postgres {
+		return errors.New("backup is not supported for PostgreSQL, use pg_dump")
+	}
+	_, err := db.exec("VACUUM INTO ?", dest)
+	return err
 }
 
-func (db *DB) Close() error {
-	err := db.db.Close()
+// RestoreSnapshot replaces the SQLite database at dest with the snapshot at
+// src, such as one written by Backup. Nothing may have the database open.
+// The snapshot is checked for integrity first, and the replaced database is
+// kept as dest + ".before-restore".
+func RestoreSnapshot(src, dest string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	snapshot, err := sql.Open("sqlite3", "file:"+src+"?mode=ro")
 	if err != nil {
 		return err
 	}
-	return nil
-}
+	defer snapshot.Close()
 
-func (db *DB) getBlocksFromRows(rows *sql.Rows) ([]models.Block, error) {
-	var blocks []models.Block
-	for rows.Next() {
-		var b models.Block
-		err := rows.Scan(&b.Id, &b.Start, &b.End, &b.Homeoffice)
+	var result string
+	if err := snapshot.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("%s is not a database: %w", src, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s is corrupt: %s", src, result)
+	}
+	if _, err := snapshot.Exec("SELECT COUNT(*) FROM block"); err != nil {
+		return fmt.Errorf("%s is not a work hours database: %w", src, err)
+	}
+
+	tmp := dest + ".restore"
+	os.Remove(tmp)
+	if _, err := snapshot.Exec("VACUUM INTO ?", tmp); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		before := dest + ".before-restore"
+		os.Remove(before)
+		current, err := NewDatabaseAt(dest)
 		if err != nil {
-			return nil, err
+			return err
 		}
-
-		pauses, err := db.GetPausesByBlockID(b.Id)
+		err = current.Backup(before)
+		current.Close()
 		if err != nil {
-			return nil, err
+			os.Remove(tmp)
+			return fmt.Errorf("could not keep the current database: %w", err)
 		}
-		b.Pauses = pauses
-
-		blocks = append(blocks, b)
 	}
 
-	return blocks, nil
+	// A WAL left over from the replaced database would be applied to the
+	// snapshot.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dest + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(tmp, dest)
 }
 
-func (db *DB) GetBlocksAfterStart(start string) ([]models.Block, error) {
-	q := `
-  SELECT * FROM block
-  WHERE start > date(?)
-  `
-	rows, err := db.db.Query(q, start)
+func (db *DB) Close() error {
+	err := db.conn.Close()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	return nil
+}
+
+// Checkpoint moves the contents of the write-ahead log into the database
+// file, so that nothing is left in the WAL once the database is closed.
+func (db *DB) Checkpoint() error {
+	if db.dialect == postgres {
+		return nil
+	}
+	_, err := db.exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
 
-	blocks, err := db.getBlocksFromRows(rows)
+// rebind replaces the ? placeholders with $1, $2, ... for PostgreSQL.
+func (db *DB) rebind(q string) string {
+	if db.dialect != postgres {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (db *DB) exec(q string, args ...any) (sql.Result, error) {
+	return db.db.Exec(db.rebind(q), args...)
+}
 
-	return blocks, nil
+func (db *DB) query(q string, args ...any) (*sql.Rows, error) {
+	return db.db.Query(db.rebind(q), args...)
 }
 
-func (db *DB) GetBlocksBeforeEnd(end string) ([]models.Block, error) {
+func (db *DB) queryRow(q string, args ...any) *sql.Row {
+	return db.db.QueryRow(db.rebind(q), args...)
+}
+
+// insert runs an INSERT statement and returns the id of the new row.
+func (db *DB) insert(q string, args ...any) (int, error) {
+	var id int
+	err := db.queryRow(q+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// lockCurrent locks the current row of the user until the end of the
+// transaction, so that concurrent StartBlock and EndBlock calls of the same
+// user are serialized. SQLite already does this by beginning every
+// transaction immediately.
+func (db *DB) lockCurrent() error {
+	if db.dialect != postgres {
+		return nil
+	}
+	email := auditUser(db.user)
+	if err := db.addCurrent(email); err != nil {
+		return err
+	}
 	q := `
-  SELECT * FROM block
-  WHERE end < date(?)
+  SELECT id FROM current
+  WHERE email = ?
+  FOR UPDATE
   `
-	rows, err := db.db.Query(q, end)
+	_, err := db.exec(q, email)
+	return err
+}
+
+// transaction runs fn with a DB whose queries all go through the same
+// transaction. Nested calls reuse the outer transaction.
+func (db *DB) transaction(fn func(tx *DB) error) error {
+	if _, ok := db.db.(*sql.Tx); ok {
+		return fn(db)
+	}
+
+	tx, err := db.conn.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	blocks, err := db.getBlocksFromRows(rows)
+	if err := fn(&DB{conn: db.conn, db: tx, dialect: db.dialect, user: db.user, owner: db.owner}); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	return blocks, nil
+	return tx.Commit()
 }
 
-func (db *DB) GetBlocksWithinRange(start, end string) ([]models.Block, error) {
-	q := `
-  SELECT * FROM block
-  WHERE start > date(?) AND end < date(?)
+// selectBlocks selects blocks joined with their pauses that have not been
+// deleted, one row per pause and one row with NULL pause columns for blocks
+// without pauses. Queries have to order by block.id, so that the rows of a
+// block are adjacent.
+const selectBlocks = `
+  SELECT block.id, block.start, block."end", block.homeoffice,
+  block.project, block.billable, block.invoice_id,
+  pause.id, pause.start, pause."end"
+  FROM block
+  LEFT JOIN pause ON pause.block_id = block.id AND pause.deleted_at IS NULL
   `
-	rows, err := db.db.Query(q, start, end)
-	if err != nil {
-		return nil, err
+
+// getBlocks loads the blocks matching all conditions that have not been
+// deleted.
+func (db *DB) getBlocks(conditions []string, args ...any) ([]models.Block, error) {
+	owned, ownerArgs := db.owned()
+	conditions = append(conditions, "block.deleted_at IS NULL")
+	if owned != "" {
+		conditions = append(conditions, owned)
 	}
-	defer rows.Close()
+	return db.queryBlocks(where(conditions), append(args, ownerArgs...)...)
+}
 
-	blocks, err := db.getBlocksFromRows(rows)
+// owned returns the condition on block and its arguments that restrict a
+// query to the blocks of the owner, empty if the view is not restricted.
+func (db *DB) owned() (string, []any) {
+	if db.owner == "" {
+		return "", nil
+	}
+	return "block.created_by = ?", []any{db.owner}
+}
 
-	return blocks, nil
+// andOwned is owned for queries that already have a WHERE clause.
+func (db *DB) andOwned() (string, []any) {
+	owned, args := db.owned()
+	if owned == "" {
+		return "", nil
+	}
+	return " AND " + owned, args
 }
 
-func (db *DB) GetAllBlocks() ([]models.Block, error) {
-	q := `
-  SELECT * FROM block
+// queryBlocks loads the blocks matching the given WHERE clause together with
+// their pauses in a single query.
+func (db *DB) queryBlocks(where string, args ...any) ([]models.Block, error) {
+	q := selectBlocks + where + `
+  ORDER BY block.id, pause.id
   `
-	rows, err := db.db.Query(q)
+	rows, err := db.query(q, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	blocks, err := db.getBlocksFromRows(rows)
+	var blocks []models.Block
+	for rows.Next() {
+		var b models.Block
+		var invoiceID, pauseID sql.NullInt64
+		var pauseStart, pauseEnd sql.NullString
+		err := rows.Scan(&b.Id, &b.Start, &b.End, &b.Homeoffice, &b.Project, &b.Billable,
+			&invoiceID, &pauseID, &pauseStart, &pauseEnd)
+		if err != nil {
+			return nil, err
+		}
+		b.InvoiceID = int(invoiceID.Int64)
+
+		if len(blocks) == 0 || blocks[len(blocks)-1].Id != b.Id {
+			blocks = append(blocks, b)
+		}
+		if pauseID.Valid {
+			last := &blocks[len(blocks)-1]
+			last.Pauses = append(last.Pauses, models.Pause{
+				Id:      int(pauseID.Int64),
+				Start:   pauseStart.String,
+				End:     pauseEnd.String,
+				BlockID: b.Id,
+			})
+		}
+	}
 
-	return blocks, nil
+	return blocks, rows.Err()
 }
 
+// GetBlocksInRange returns the blocks that match the range, ordered by id.
+func (db *DB) GetBlocksInRange(r TimeRange) ([]models.Block, error) {
+	conditions, args := r.conditions()
+	return db.getBlocks(conditions, args...)
+}
+
+func (db *DB) GetAllBlocks() ([]models.Block, error) {
+	return db.getBlocks(nil)
+}
+
+// selectPauses selects the pauses that have not been deleted, together with
+// their block.
+const selectPauses = `
+  SELECT pause.id, pause.start, pause."end", pause.block_id FROM pause
+  JOIN block ON block.id = pause.block_id
+  WHERE pause.deleted_at IS NULL AND block.deleted_at IS NULL
+  `
+
 func (db *DB) GetPausesByBlockID(blockID int) ([]models.Pause, error) {
-	q := `
-  SELECT * FROM pause
-  WHERE block_id = ?
+	owned, args := db.andOwned()
+	q := selectPauses + `
+  AND pause.block_id = ?` + owned + `
+  ORDER BY pause.id
   `
-	rows, err := db.db.Query(q, blockID)
+	rows, err := db.query(q, append([]any{blockID}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -221,216 +745,372 @@ func (db *DB) GetPausesByBlockID(blockID int) ([]models.Pause, error) {
 		pauses = append(pauses, p)
 	}
 
-	return pauses, nil
+	return pauses, rows.Err()
 }
 
 func (db *DB) GetBlockByID(id int) (models.Block, error) {
-	q := `
-  SELECT * FROM block
-  WHERE id = ?
-  `
-	row := db.db.QueryRow(q, id)
-	var b models.Block
-	if err := row.Scan(&b.Id, &b.Start, &b.End, &b.Homeoffice); err != nil {
-		return b, err
-	}
-	pauses, err := db.GetPausesByBlockID(b.Id)
+	blocks, err := db.getBlocks([]string{"block.id = ?"}, id)
 	if err != nil {
-		return b, err
+		return models.Block{}, err
+	}
+	if len(blocks) == 0 {
+		return models.Block{}, ErrBlockNotFound
 	}
-	b.Pauses = pauses
-	return b, nil
+	return blocks[0], nil
 }
 
 func (db *DB) GetPauseByID(id int) (models.Pause, error) {
-	q := `
-  SELECT * FROM pause
-  WHERE id = ?
-  `
-	row := db.db.QueryRow(q, id)
+	owned, args := db.andOwned()
+	q := selectPauses + `
+  AND pause.id = ?` + owned
+	row := db.queryRow(q, append([]any{id}, args...)...)
 	var p models.Pause
 	if err := row.Scan(&p.Id, &p.Start, &p.End, &p.BlockID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return p, ErrPauseNotFound
+		}
 		return p, err
 	}
 	return p, nil
 }
 
 func (db *DB) AddBlock(block models.BlockCreate) (models.Block, error) {
-	var newBlock models.Block
-	q := `
-  INSERT INTO block (start, end, homeoffice)
-  VALUES (?, ?, ?)
-  `
-	result, err := db.db.Exec(q, block.Start, block.End, block.Homeoffice)
-	if err != nil {
-		return newBlock, err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return newBlock, err
-	}
+	return db.addBlock(auditUser(db.user), block)
+}
 
-	for _, pause := range block.Pauses {
-		newPause, err := db.AddPause(
-			models.PauseCreate{
-				Start:   pause.Start,
-				End:     pause.End,
-				BlockID: int(id)})
+// addBlock adds a block created by creator.
+func (db *DB) addBlock(creator string, block models.BlockCreate) (models.Block, error) {
+	var newBlock models.Block
+	err := db.transaction(func(tx *DB) error {
+		q := `
+    INSERT INTO block (start, "end", homeoffice, project, billable, start_unix, end_unix, created_by)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+		id, err := tx.insert(q, block.Start, block.End, block.Homeoffice, block.Project,
+			block.Billable, unixSeconds(block.Start), unixSeconds(block.End), creator)
 		if err != nil {
-			return newBlock, err
+			return err
 		}
-		newBlock.Pauses = append(newBlock.Pauses, newPause)
+
+		newBlock = models.Block{
+			Id:         id,
+			Start:      block.Start,
+			End:        block.End,
+			Homeoffice: block.Homeoffice,
+			Project:    block.Project,
+			Billable:   block.Billable,
+		}
+		for _, pause := range block.Pauses {
+			newPause, err := tx.insertPause(
+				models.PauseCreate{
+					Start:   pause.Start,
+					End:     pause.End,
+					BlockID: id})
+			if err != nil {
+				return err
+			}
+			newBlock.Pauses = append(newBlock.Pauses, newPause)
+		}
+
+		return tx.auditBlock(OpCreate, id, nil, &newBlock)
+	})
+	if err != nil {
+		return models.Block{}, err
 	}
 
-	newBlock.Id = int(id)
-	newBlock.Start = block.Start
-	newBlock.End = block.End
 	return newBlock, nil
 }
 
-func (db *DB) AddPause(pause models.PauseCreate) (models.Pause, error) {
-	var newPause models.Pause
-	s := `
-  INSERT INTO pause (start, end, block_id)
+// insertPause inserts a pause without checking its block. The pauses of a
+// new block are recorded in the audit log together with the block.
+func (db *DB) insertPause(pause models.PauseCreate) (models.Pause, error) {
+	q := `
+  INSERT INTO pause (start, "end", block_id)
   VALUES (?, ?, ?)
   `
-	result, err := db.db.Exec(s, pause.Start, pause.End, pause.BlockID)
+	id, err := db.insert(q, pause.Start, pause.End, pause.BlockID)
 	if err != nil {
-		return newPause, err
+		return models.Pause{}, err
 	}
+	return models.Pause{Id: id, Start: pause.Start, End: pause.End, BlockID: pause.BlockID}, nil
+}
+
+func (db *DB) AddPause(pause models.PauseCreate) (models.Pause, error) {
+	var newPause models.Pause
+	err := db.transaction(func(tx *DB) error {
+		var exists bool
+		owned, args := tx.andOwned()
+		q := `
+    SELECT EXISTS (SELECT 1 FROM block WHERE id = ? AND deleted_at IS NULL` + owned + `)
+    `
+		if err := tx.queryRow(q, append([]any{pause.BlockID}, args...)...).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrBlockNotFound
+		}
+		if err := tx.checkBlockEditable(pause.BlockID); err != nil {
+			return err
+		}
 
-	id, err := result.LastInsertId()
+		var err error
+		if newPause, err = tx.insertPause(pause); err != nil {
+			return err
+		}
+		return tx.auditPause(OpCreate, newPause.Id, newPause.BlockID, nil, &newPause)
+	})
 	if err != nil {
-		return newPause, err
+		return models.Pause{}, err
 	}
 
-	newPause.Id = int(id)
-	newPause.Start = pause.Start
-	newPause.End = pause.End
-	newPause.BlockID = pause.BlockID
 	return newPause, nil
 }
 
 func (db *DB) DeleteBlock(id int) (int, error) {
-	currentBlockID, err := db.getCurrentBlockID()
-	if err != nil {
-		return 0, err
-	}
-	if id == currentBlockID {
-		err := db.setCurrentBlockID(-1)
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.lockCurrent(); err != nil {
+			return err
+		}
+		if err := tx.checkBlockEditable(id); err != nil {
+			return err
+		}
+		before, err := tx.GetBlockByID(id)
+		if errors.Is(err, ErrBlockNotFound) {
+			return nil
+		}
 		if err != nil {
-			return 0, err
+			return err
 		}
 
-		err = db.setCurrentPauseID(-1)
-		if err != nil {
-			return 0, err
+		q := `
+    UPDATE current
+    SET current_block_id = -1, current_pause_id = -1
+    WHERE current_block_id = ?
+    `
+		if _, err := tx.exec(q, id); err != nil {
+			return err
 		}
-	}
 
-	q := `
-  DELETE FROM block
-  WHERE id = ?
-  `
+		q = `
+    UPDATE block
+    SET deleted_at = ?
+    WHERE id = ? AND deleted_at IS NULL
+    `
+		result, err := tx.exec(q, time.Now().UTC().Format(time.RFC3339), id)
+		if err != nil {
+			return err
+		}
 
-	result, err := db.db.Exec(q, id)
+		if rowsAffected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		return tx.auditBlock(OpDelete, id, &before, nil)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return int(rowsAffected), nil
+}
+
+func (db *DB) DeletePause(id int) (int, error) {
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.lockCurrent(); err != nil {
+			return err
+		}
+		if err := tx.checkPauseEditable(id); err != nil {
+			return err
+		}
+		before, err := tx.GetPauseByID(id)
+		if errors.Is(err, ErrPauseNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		q := `
+    UPDATE current
+    SET current_pause_id = -1
+    WHERE current_pause_id = ?
+    `
+		if _, err := tx.exec(q, id); err != nil {
+			return err
+		}
+
+		q = `
+    UPDATE pause
+    SET deleted_at = ?
+    WHERE id = ? AND deleted_at IS NULL
+    `
+		result, err := tx.exec(q, time.Now().UTC().Format(time.RFC3339), id)
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		return tx.auditPause(OpDelete, id, before.BlockID, &before, nil)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	return int(rowsAffected), err
+	return int(rowsAffected), nil
 }
 
-func (db *DB) DeletePause(id int) (int, error) {
-	currentPauseID, err := db.getCurrentPauseID()
-	if err != nil {
-		return 0, err
+// forUpdate locks the selected rows until the end of the transaction on
+// PostgreSQL. SQLite transactions already hold the write lock.
+func (db *DB) forUpdate() string {
+	if db.dialect == postgres {
+		return " FOR UPDATE"
 	}
-	if currentPauseID == id {
-		err := db.setCurrentPauseID(-1)
-		if err != nil {
-			return 0, err
+	return ""
+}
+
+// checkBlockEditable returns ErrBlockBilled if the block has been billed. A
+// block that does not exist or belongs to another user than the owner is
+// left to the caller, which affects no rows.
+func (db *DB) checkBlockEditable(id int) error {
+	owned, args := db.andOwned()
+	q := `
+  SELECT invoice_id FROM block
+  WHERE id = ?` + owned + `
+  ` + db.forUpdate()
+	var invoiceID sql.NullInt64
+	if err := db.queryRow(q, append([]any{id}, args...)...).Scan(&invoiceID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
 		}
+		return err
 	}
+	if invoiceID.Valid {
+		return ErrBlockBilled
+	}
+	return nil
+}
 
+// checkPauseEditable returns ErrBlockBilled if the block of the pause has
+// been billed.
+func (db *DB) checkPauseEditable(id int) error {
 	q := `
-  DELETE FROM pause
+  SELECT block_id FROM pause
   WHERE id = ?
   `
-	result, err := db.db.Exec(q, id)
+	var blockID int
+	if err := db.queryRow(q, id).Scan(&blockID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	return db.checkBlockEditable(blockID)
+}
+
+// updateBlock runs an UPDATE of the block with the given id, whose last
+// argument has to be the id, records the change in the audit log and returns
+// the number of affected rows.
+func (db *DB) updateBlock(id int, q string, args ...any) (int, error) {
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.checkBlockEditable(id); err != nil {
+			return err
+		}
+		before, err := tx.GetBlockByID(id)
+		if errors.Is(err, ErrBlockNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.exec(q, args...)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		after, err := tx.GetBlockByID(id)
+		if err != nil {
+			return err
+		}
+		return tx.auditBlock(OpUpdate, id, &before, &after)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return int(rowsAffected), nil
+}
+
+// updatePause is updateBlock for pauses.
+func (db *DB) updatePause(id int, q string, args ...any) (int, error) {
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.checkPauseEditable(id); err != nil {
+			return err
+		}
+		before, err := tx.GetPauseByID(id)
+		if errors.Is(err, ErrPauseNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.exec(q, args...)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		after, err := tx.GetPauseByID(id)
+		if err != nil {
+			return err
+		}
+		return tx.auditPause(OpUpdate, id, after.BlockID, &before, &after)
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	return int(rowsAffected), err
+	return int(rowsAffected), nil
 }
 
 func (db *DB) UpdateBlock(block models.Block) (int, error) {
 	q := `
   UPDATE block
-  SET start = ?, end = ?, homeoffice = ?
+  SET start = ?, "end" = ?, homeoffice = ?, project = ?, billable = ?,
+  start_unix = ?, end_unix = ?
   WHERE id = ?
   `
-	result, err := db.db.Exec(q, block.Start, block.End, block.Homeoffice, block.Id)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(rowsAffected), nil
+	return db.updateBlock(block.Id, q, block.Start, block.End, block.Homeoffice,
+		block.Project, block.Billable, unixSeconds(block.Start), unixSeconds(block.End), block.Id)
 }
 
 func (db *DB) UpdateBlockStart(id int, start string) (int, error) {
 	q := `
   UPDATE block
-  SET start = ?
+  SET start = ?, start_unix = ?
   WHERE id = ?
   `
-	result, err := db.db.Exec(q, start, id)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(rowsAffected), nil
+	return db.updateBlock(id, q, start, unixSeconds(start), id)
 }
 
 func (db *DB) UpdateBlockEnd(id int, end string) (int, error) {
 	q := `
   UPDATE block
-  SET end = ?
+  SET "end" = ?, end_unix = ?
   WHERE id = ?
   `
-	result, err := db.db.Exec(q, end, id)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(rowsAffected), nil
+	return db.updateBlock(id, q, end, unixSeconds(end), id)
 }
 
 func (db *DB) UpdateBlockHomeoffice(id int, homeoffice bool) (int, error) {
@@ -439,36 +1119,16 @@ func (db *DB) UpdateBlockHomeoffice(id int, homeoffice bool) (int, error) {
   SET homeoffice = ?
   WHERE id = ?
   `
-	result, err := db.db.Exec(q, homeoffice, id)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(rowsAffected), nil
+	return db.updateBlock(id, q, homeoffice, id)
 }
 
 func (db *DB) UpdatePause(pause models.Pause) (int, error) {
 	q := `
   UPDATE pause
-  SET start = ?, end = ?
+  SET start = ?, "end" = ?
   WHERE id = ?
   `
-	result, err := db.db.Exec(q, pause.Start, pause.End, pause.Id)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(rowsAffected), nil
+	return db.updatePause(pause.Id, q, pause.Start, pause.End, pause.Id)
 }
 
 func (db *DB) UpdatePauseStart(id int, start string) (int, error) {
@@ -477,49 +1137,31 @@ func (db *DB) UpdatePauseStart(id int, start string) (int, error) {
   SET start = ?
   WHERE id = ?
   `
-	result, err := db.db.Exec(q, start, id)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(rowsAffected), nil
+	return db.updatePause(id, q, start, id)
 }
 
 func (db *DB) UpdatePauseEnd(id int, end string) (int, error) {
 	q := `
   UPDATE pause
-  SET end = ?
+  SET "end" = ?
   WHERE id = ?
   `
-	result, err := db.db.Exec(q, end, id)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(rowsAffected), nil
+	return db.updatePause(id, q, end, id)
 }
 
+// getCurrentBlockID returns the id of the running block of the user, -1 if
+// there is none.
 func (db *DB) getCurrentBlockID() (int, error) {
 	q := `
   SELECT current_block_id from current
-  WHERE id = 1
+  WHERE email = ?
   `
 
-	row := db.db.QueryRow(q)
-
 	var id int
-
-	if err := row.Scan(&id); err != nil {
+	if err := db.queryRow(q, auditUser(db.user)).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return -1, nil
+		}
 		return -1, err
 	}
 
@@ -527,32 +1169,34 @@ func (db *DB) getCurrentBlockID() (int, error) {
 }
 
 func (db *DB) setCurrentBlockID(id int) error {
+	email := auditUser(db.user)
+	if err := db.addCurrent(email); err != nil {
+		return err
+	}
+
 	q := `
   UPDATE current
   SET current_block_id = ?
-  WHERE id = 1
+  WHERE email = ?
   `
 
-	_, err := db.db.Exec(q, id)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+	_, err := db.exec(q, id, email)
+	return err
 }
 
+// getCurrentPauseID returns the id of the running pause of the user, -1 if
+// there is none.
 func (db *DB) getCurrentPauseID() (int, error) {
 	q := `
   SELECT current_pause_id from current
-  WHERE id = 1
+  WHERE email = ?
   `
 
-	row := db.db.QueryRow(q)
-
 	var id int
-
-	if err := row.Scan(&id); err != nil {
+	if err := db.queryRow(q, auditUser(db.user)).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return -1, nil
+		}
 		return -1, err
 	}
 
@@ -560,87 +1204,119 @@ func (db *DB) getCurrentPauseID() (int, error) {
 }
 
 func (db *DB) setCurrentPauseID(id int) error {
+	email := auditUser(db.user)
+	if err := db.addCurrent(email); err != nil {
+		return err
+	}
+
 	q := `
   UPDATE current
   SET current_pause_id = ?
-  WHERE id = 1
+  WHERE email = ?
   `
 
-	_, err := db.db.Exec(q, id)
-
-	if err != nil {
-		return err
-	}
+	_, err := db.exec(q, id, email)
+	return err
+}
 
-	return nil
+// addCurrent adds the row holding the current block and pause of the user
+// unless it already exists.
+func (db *DB) addCurrent(email string) error {
+	q := `
+  INSERT INTO current (email, current_block_id, current_pause_id)
+  VALUES (?, -1, -1)
+  ON CONFLICT (email) DO NOTHING
+  `
+	_, err := db.exec(q, email)
+	return err
 }
 
-func (db *DB) StartBlock(homeoffice bool) (models.Block, error) {
+// StartBlock starts a new current block at the given time. The timestamp is
+// stored with the offset of at's location.
+func (db *DB) StartBlock(homeoffice bool, at time.Time) (models.Block, error) {
 	var newBlock models.Block
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.lockCurrent(); err != nil {
+			return err
+		}
 
-	currentBlockID, err := db.getCurrentBlockID()
-	if err != nil {
-		return newBlock, err
-	}
-	if currentBlockID != -1 {
-		return newBlock, errors.New("current block already active")
-	}
+		currentBlockID, err := tx.getCurrentBlockID()
+		if err != nil {
+			return err
+		}
+		if currentBlockID != -1 {
+			return ErrBlockAlreadyActive
+		}
 
-	block := models.BlockCreate{
-		Start:      time.Now().Format(time.RFC3339),
-		Homeoffice: homeoffice,
-	}
-	newBlock, err = db.AddBlock(block)
-	if err != nil {
-		return newBlock, err
-	}
+		block := models.BlockCreate{
+			Start:      at.Format(time.RFC3339),
+			Homeoffice: homeoffice,
+		}
+		newBlock, err = tx.AddBlock(block)
+		if err != nil {
+			return err
+		}
 
-	err = db.setCurrentBlockID(newBlock.Id)
+		return tx.setCurrentBlockID(newBlock.Id)
+	})
 	if err != nil {
-		return newBlock, err
+		return models.Block{}, err
 	}
 
 	return newBlock, nil
 }
 
-func (db *DB) EndBlock() (models.Block, error) {
+func (db *DB) EndBlock(at time.Time) (models.Block, error) {
 	var block models.Block
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.lockCurrent(); err != nil {
+			return err
+		}
 
-	currentBlockID, err := db.getCurrentBlockID()
-	if err != nil {
-		return block, err
-	}
-	if currentBlockID == -1 {
-		return block, errors.New("no current block active")
-	}
+		currentBlockID, err := tx.getCurrentBlockID()
+		if err != nil {
+			return err
+		}
+		if currentBlockID == -1 {
+			return ErrNoBlockActive
+		}
 
-	currentPauseID, err := db.getCurrentPauseID()
-	if err != nil {
-		return block, err
-	}
-	if currentPauseID != -1 {
-		return block, errors.New("pause not ended")
-	}
+		currentPauseID, err := tx.getCurrentPauseID()
+		if err != nil {
+			return err
+		}
+		if currentPauseID != -1 {
+			return ErrPauseNotEnded
+		}
 
-	q := `
-  UPDATE block
-  SET end = ?
-  WHERE id = ?
-  `
-	end := time.Now().Format(time.RFC3339)
-	_, err = db.db.Exec(q, end, currentBlockID)
-	if err != nil {
-		return block, err
-	}
+		before, err := tx.GetBlockByID(currentBlockID)
+		if err != nil {
+			return err
+		}
 
-	block, err = db.GetBlockByID(currentBlockID)
-	if err != nil {
-		return block, err
-	}
+		q := `
+    UPDATE block
+    SET "end" = ?, end_unix = ?
+    WHERE id = ?
+    `
+		end := at.Format(time.RFC3339)
+		_, err = tx.exec(q, end, unixSeconds(end), currentBlockID)
+		if err != nil {
+			return err
+		}
 
-	err = db.setCurrentBlockID(-1)
+		block, err = tx.GetBlockByID(currentBlockID)
+		if err != nil {
+			return err
+		}
+		if err := tx.auditBlock(OpUpdate, block.Id, &before, &block); err != nil {
+			return err
+		}
+
+		return tx.setCurrentBlockID(-1)
+	})
 	if err != nil {
-		return block, err
+		return models.Block{}, err
 	}
 
 	return block, nil
@@ -653,6 +1329,9 @@ func (db *DB) GetCurrentBlock() (models.Block, error) {
 	if err != nil {
 		return block, err
 	}
+	if currentBlockID == -1 {
+		return block, ErrNoBlockActive
+	}
 
 	block, err = db.GetBlockByID(currentBlockID)
 	if err != nil {
@@ -662,72 +1341,90 @@ func (db *DB) GetCurrentBlock() (models.Block, error) {
 	return block, nil
 }
 
-func (db *DB) StartPause() (models.Pause, error) {
+func (db *DB) StartPause(at time.Time) (models.Pause, error) {
 	var newPause models.Pause
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.lockCurrent(); err != nil {
+			return err
+		}
 
-	currentBlockID, err := db.getCurrentBlockID()
-	if err != nil {
-		return newPause, err
-	}
-	if currentBlockID == -1 {
-		return newPause, errors.New("no current block active")
-	}
+		currentBlockID, err := tx.getCurrentBlockID()
+		if err != nil {
+			return err
+		}
+		if currentBlockID == -1 {
+			return ErrNoBlockActive
+		}
 
-	currentPauseID, err := db.getCurrentPauseID()
-	if err != nil {
-		return newPause, err
-	}
-	if currentPauseID != -1 {
-		return newPause, errors.New("current pause already active")
-	}
+		currentPauseID, err := tx.getCurrentPauseID()
+		if err != nil {
+			return err
+		}
+		if currentPauseID != -1 {
+			return ErrPauseAlreadyActive
+		}
 
-	pause := models.PauseCreate{
-		Start:   time.Now().Format(time.RFC3339),
-		BlockID: currentBlockID,
-	}
-	newPause, err = db.AddPause(pause)
-	if err != nil {
-		return newPause, err
-	}
+		pause := models.PauseCreate{
+			Start:   at.Format(time.RFC3339),
+			BlockID: currentBlockID,
+		}
+		newPause, err = tx.AddPause(pause)
+		if err != nil {
+			return err
+		}
 
-	err = db.setCurrentPauseID(newPause.Id)
+		return tx.setCurrentPauseID(newPause.Id)
+	})
 	if err != nil {
-		return newPause, err
+		return models.Pause{}, err
 	}
 
 	return newPause, nil
 }
 
-func (db *DB) EndPause() (models.Pause, error) {
+func (db *DB) EndPause(at time.Time) (models.Pause, error) {
 	var pause models.Pause
+	err := db.transaction(func(tx *DB) error {
+		if err := tx.lockCurrent(); err != nil {
+			return err
+		}
 
-	currentPauseID, err := db.getCurrentPauseID()
-	if err != nil {
-		return pause, err
-	}
-	if currentPauseID == -1 {
-		return pause, errors.New("no current pause active")
-	}
+		currentPauseID, err := tx.getCurrentPauseID()
+		if err != nil {
+			return err
+		}
+		if currentPauseID == -1 {
+			return ErrNoPauseActive
+		}
 
-	q := `
-  UPDATE pause
-  SET end = ?
-  WHERE id = ?
-  `
-	end := time.Now().Format(time.RFC3339)
-	_, err = db.db.Exec(q, end, currentPauseID)
-	if err != nil {
-		return pause, err
-	}
+		before, err := tx.GetPauseByID(currentPauseID)
+		if err != nil {
+			return err
+		}
 
-	pause, err = db.GetPauseByID(currentPauseID)
-	if err != nil {
-		return pause, err
-	}
+		q := `
+    UPDATE pause
+    SET "end" = ?
+    WHERE id = ?
+    `
+		end := at.Format(time.RFC3339)
+		_, err = tx.exec(q, end, currentPauseID)
+		if err != nil {
+			return err
+		}
+
+		pause, err = tx.GetPauseByID(currentPauseID)
+		if err != nil {
+			return err
+		}
+		if err := tx.auditPause(OpUpdate, pause.Id, pause.BlockID, &before, &pause); err != nil {
+			return err
+		}
 
-	err = db.setCurrentPauseID(-1)
+		return tx.setCurrentPauseID(-1)
+	})
 	if err != nil {
-		return pause, err
+		return models.Pause{}, err
 	}
 
 	return pause, nil
@@ -1,8 +1,13 @@
 package database
 
 import (
+	"crypto/ed25519"
+	"database/sql"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/kilianmandscharo/work_hours/models"
 	"github.com/kilianmandscharo/work_hours/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -84,7 +89,7 @@ func TestAddPause(t *testing.T) {
 	defer db.Close()
 
 	_, err := db.AddPause(utils.TestPauseCreate())
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
 
 	db.AddBlock(utils.TestBlockCreateWithoutPause())
 
@@ -98,7 +103,8 @@ func TestGetBlockByID(t *testing.T) {
 	defer db.Close()
 
 	_, err := db.GetBlockByID(utils.BID)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+	assert.ErrorIs(t, err, ErrNotFound)
 
 	db.AddBlock(utils.TestBlockCreate())
 
@@ -114,7 +120,7 @@ func TestGetPauseByID(t *testing.T) {
 	defer db.Close()
 
 	_, err := db.GetPauseByID(utils.PID)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrPauseNotFound)
 
 	db.AddBlock(utils.TestBlockCreate())
 
@@ -123,7 +129,13 @@ func TestGetPauseByID(t *testing.T) {
 	utils.AssertTestPause(t, p)
 }
 
-func TestGetBlocksWithinRange(t *testing.T) {
+func parseTimeRange(t *testing.T, start, end string) TimeRange {
+	r, err := ParseTimeRange(start, end, "")
+	assert.NoError(t, err)
+	return r
+}
+
+func TestGetBlocksInRange(t *testing.T) {
 	db := GetNewTestDatabase()
 	defer db.Close()
 
@@ -172,10 +184,7 @@ func TestGetBlocksWithinRange(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		blocks, err := db.GetBlocksWithinRange(
-			testCase.start,
-			testCase.end,
-		)
+		blocks, err := db.GetBlocksInRange(parseTimeRange(t, testCase.start, testCase.end))
 		assert.NoError(t, err)
 		assert.Equal(t, testCase.length, len(blocks))
 
@@ -185,7 +194,7 @@ func TestGetBlocksWithinRange(t *testing.T) {
 	}
 }
 
-func TestGetBlocksAfterStart(t *testing.T) {
+func TestGetBlocksInRangeWithoutEnd(t *testing.T) {
 	db := GetNewTestDatabase()
 	defer db.Close()
 
@@ -218,15 +227,13 @@ func TestGetBlocksAfterStart(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		blocks, err := db.GetBlocksAfterStart(
-			testCase.start,
-		)
+		blocks, err := db.GetBlocksInRange(parseTimeRange(t, testCase.start, ""))
 		assert.NoError(t, err)
 		assert.Equal(t, testCase.length, len(blocks))
 	}
 }
 
-func TestGetBlocksBeforeEnd(t *testing.T) {
+func TestGetBlocksInRangeWithoutStart(t *testing.T) {
 	db := GetNewTestDatabase()
 	defer db.Close()
 
@@ -259,9 +266,7 @@ func TestGetBlocksBeforeEnd(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		blocks, err := db.GetBlocksBeforeEnd(
-			testCase.start,
-		)
+		blocks, err := db.GetBlocksInRange(parseTimeRange(t, "", testCase.start))
 		assert.NoError(t, err)
 		assert.Equal(t, testCase.length, len(blocks))
 	}
@@ -308,9 +313,9 @@ func TestDeleteCurrentBlock(t *testing.T) {
 	db := GetNewTestDatabase()
 	defer db.Close()
 
-	_, err := db.StartBlock(false)
+	_, err := db.StartBlock(false, time.Now())
 	assert.NoError(t, err)
-	_, err = db.StartPause()
+	_, err = db.StartPause(time.Now())
 	assert.NoError(t, err)
 
 	rowsAffected, err := db.DeleteBlock(utils.BID)
@@ -346,9 +351,9 @@ func TestDeleteCurrentPause(t *testing.T) {
 	db := GetNewTestDatabase()
 	defer db.Close()
 
-	_, err := db.StartBlock(false)
+	_, err := db.StartBlock(false, time.Now())
 	assert.NoError(t, err)
-	_, err = db.StartPause()
+	_, err = db.StartPause(time.Now())
 	assert.NoError(t, err)
 
 	rowsAffected, err := db.DeletePause(utils.PID)
@@ -496,7 +501,7 @@ func TestStartBlock(t *testing.T) {
 	defer db.Close()
 
 	t.Run("start successful", func(t *testing.T) {
-		_, err := db.StartBlock(false)
+		_, err := db.StartBlock(false, time.Now())
 		assert.NoError(t, err)
 		currentBlockID, err := db.getCurrentBlockID()
 		assert.NoError(t, err)
@@ -504,8 +509,9 @@ func TestStartBlock(t *testing.T) {
 	})
 
 	t.Run("block already active", func(t *testing.T) {
-		_, err := db.StartBlock(false)
-		assert.Error(t, err)
+		_, err := db.StartBlock(false, time.Now())
+		assert.ErrorIs(t, err, ErrBlockAlreadyActive)
+		assert.ErrorIs(t, err, ErrConflict)
 	})
 }
 
@@ -514,14 +520,15 @@ func TestEndBlock(t *testing.T) {
 	defer db.Close()
 
 	t.Run("no block active", func(t *testing.T) {
-		_, err := db.EndBlock()
-		assert.Error(t, err)
+		_, err := db.EndBlock(time.Now())
+		assert.ErrorIs(t, err, ErrNoBlockActive)
+		assert.ErrorIs(t, err, ErrInvalidState)
 	})
 
 	t.Run("end successful", func(t *testing.T) {
-		newBlock, err := db.StartBlock(false)
+		newBlock, err := db.StartBlock(false, time.Now())
 		assert.NoError(t, err)
-		block, err := db.EndBlock()
+		block, err := db.EndBlock(time.Now())
 		assert.NoError(t, err)
 		assert.Equal(t, newBlock.Id, block.Id)
 		assert.Equal(t, newBlock.Start, block.Start)
@@ -536,14 +543,14 @@ func TestStartPause(t *testing.T) {
 	defer db.Close()
 
 	t.Run("no block active", func(t *testing.T) {
-		_, err := db.StartPause()
+		_, err := db.StartPause(time.Now())
 		assert.Error(t, err)
 	})
 
 	t.Run("start successful", func(t *testing.T) {
-		_, err := db.StartBlock(false)
+		_, err := db.StartBlock(false, time.Now())
 		assert.NoError(t, err)
-		_, err = db.StartPause()
+		_, err = db.StartPause(time.Now())
 		assert.NoError(t, err)
 		currentPauseID, err := db.getCurrentPauseID()
 		assert.NoError(t, err)
@@ -551,8 +558,8 @@ func TestStartPause(t *testing.T) {
 	})
 
 	t.Run("pause already active", func(t *testing.T) {
-		_, err := db.StartPause()
-		assert.Error(t, err)
+		_, err := db.StartPause(time.Now())
+		assert.ErrorIs(t, err, ErrPauseAlreadyActive)
 	})
 }
 
@@ -561,16 +568,16 @@ func TestEndPause(t *testing.T) {
 	defer db.Close()
 
 	t.Run("no pause active", func(t *testing.T) {
-		_, err := db.StartBlock(false)
+		_, err := db.StartBlock(false, time.Now())
 		assert.NoError(t, err)
-		_, err = db.EndPause()
-		assert.Error(t, err)
+		_, err = db.EndPause(time.Now())
+		assert.ErrorIs(t, err, ErrNoPauseActive)
 	})
 
 	t.Run("end successful", func(t *testing.T) {
-		_, err := db.StartPause()
+		_, err := db.StartPause(time.Now())
 		assert.NoError(t, err)
-		_, err = db.EndPause()
+		_, err = db.EndPause(time.Now())
 		assert.NoError(t, err)
 		currentPauseID, err := db.getCurrentPauseID()
 		assert.NoError(t, err)
@@ -585,11 +592,11 @@ func TestGetCurrentBlock(t *testing.T) {
 
 	t.Run("no block active", func(t *testing.T) {
 		_, err := db.GetCurrentBlock()
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrNoBlockActive)
 	})
 
 	t.Run("get successful", func(t *testing.T) {
-		newBlock, err := db.StartBlock(false)
+		newBlock, err := db.StartBlock(false, time.Now())
 		assert.NoError(t, err)
 		block, err := db.GetCurrentBlock()
 		assert.NoError(t, err)
@@ -597,3 +604,213 @@ func TestGetCurrentBlock(t *testing.T) {
 		assert.Equal(t, newBlock.Start, block.Start)
 	})
 }
+
+func TestMigrate(t *testing.T) {
+	db := GetNewTestDatabase()
+	defer db.Close()
+
+	applied, err := db.Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	var version int
+	err = db.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+}
+
+func TestUsers(t *testing.T) {
+	db := GetNewTestDatabase()
+	defer db.Close()
+
+	users, err := db.GetAllUsers()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(users))
+
+	u, err := db.AddUser("test@example.com", "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, u.Id)
+
+	_, err = db.AddUser("test@example.com", "hash")
+	assert.Error(t, err)
+
+	rowsAffected, err := db.SetUserDisabled("test@example.com", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rowsAffected)
+
+	u, hash, err := db.GetUserCredentials("test@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "hash", hash)
+	assert.True(t, u.Disabled)
+
+	_, _, err = db.GetUserCredentials("invalid@example.com")
+	assert.Error(t, err)
+}
+
+func TestParseTimeRange(t *testing.T) {
+	r, err := ParseTimeRange("", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, TimeRange{Mode: RangeContained}, r)
+
+	r, err = ParseTimeRange("2023-06-01T00:00:00+02:00", "", "overlapping")
+	assert.NoError(t, err)
+	assert.Equal(t, RangeOverlapping, r.Mode)
+	assert.Equal(t, int64(1685570400), r.Start.Unix())
+
+	_, err = ParseTimeRange("invalid", "", "")
+	assert.ErrorIs(t, err, ErrInvalidStart)
+	_, err = ParseTimeRange("", "2023-06-01", "")
+	assert.ErrorIs(t, err, ErrInvalidEnd)
+	_, err = ParseTimeRange("", "", "within")
+	assert.ErrorIs(t, err, ErrInvalidRangeMode)
+}
+
+func TestMigrateUnixColumns(t *testing.T) {
+	db, err := NewDatabaseAt(filepath.Join(t.TempDir(), "data.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// the migrations before the *_unix columns were added
+	all := migrations
+	migrations = all[:7]
+	_, err = db.Migrate()
+	migrations = all
+	assert.NoError(t, err)
+
+	q := `
+  INSERT INTO block (start, "end", homeoffice)
+  VALUES (?, ?, ?), (?, ?, ?)
+  `
+	_, err = db.exec(q,
+		"2023-06-01T01:00:00+02:00", "2023-06-01T05:00:00+02:00", false,
+		"2023-06-02T08:00:00Z", "", false)
+	assert.NoError(t, err)
+
+	_, err = db.Migrate()
+	assert.NoError(t, err)
+
+	var startUnix, endUnix sql.NullInt64
+	err = db.queryRow("SELECT start_unix, end_unix FROM block WHERE id = 1").Scan(&startUnix, &endUnix)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1685574000), startUnix.Int64)
+	assert.Equal(t, int64(1685588400), endUnix.Int64)
+
+	err = db.queryRow("SELECT start_unix, end_unix FROM block WHERE id = 2").Scan(&startUnix, &endUnix)
+	assert.NoError(t, err)
+	assert.True(t, startUnix.Valid)
+	assert.False(t, endUnix.Valid)
+}
+
+func TestAdoptBlocks(t *testing.T) {
+	db, err := NewDatabaseAt(filepath.Join(t.TempDir(), "data.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// the migrations before the audit log was added
+	all := migrations
+	migrations = all[:23]
+	_, err = db.Migrate()
+	migrations = all
+	assert.NoError(t, err)
+
+	q := `
+  INSERT INTO block (start, "end", homeoffice)
+  VALUES (?, ?, ?), (?, ?, ?)
+  `
+	_, err = db.exec(q,
+		"2023-06-01T08:00:00Z", "2023-06-01T16:00:00Z", false,
+		"2023-06-02T08:00:00Z", "", true)
+	assert.NoError(t, err)
+	_, err = db.exec(`INSERT INTO pause (start, "end", block_id) VALUES ('2023-06-02T12:00:00Z', '', 2)`)
+	assert.NoError(t, err)
+	_, err = db.exec(`UPDATE current SET current_block_id = 2, current_pause_id = 1`)
+	assert.NoError(t, err)
+
+	_, err = db.Migrate()
+	assert.NoError(t, err)
+	const owner = "owner@example.com"
+	_, err = db.WithOwner(owner).GetCurrentBlock()
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+
+	adopted, err := db.AdoptBlocks(owner)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, adopted)
+	blocks, err := db.WithOwner(owner).GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(blocks))
+	current, err := db.WithOwner(owner).GetCurrentBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, current.Id)
+	_, err = db.WithOwner(owner).EndPause(time.Date(2023, 6, 2, 13, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	adopted, err = db.AdoptBlocks("other@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, adopted)
+	_, err = db.WithOwner("other@example.com").GetCurrentBlock()
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+}
+
+func TestAuditAppendOnly(t *testing.T) {
+	db := GetNewTestDatabase()
+	defer db.Close()
+	_, err := db.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+
+	_, err = db.db.Exec("UPDATE audit SET user_email = 'someone'")
+	assert.Error(t, err)
+	_, err = db.db.Exec("DELETE FROM audit")
+	assert.Error(t, err)
+
+	history, err := db.GetBlockHistory(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.Equal(t, SystemUser, history[0].User)
+}
+
+func TestAuditChainTampered(t *testing.T) {
+	db := GetNewTestDatabase()
+	defer db.Close()
+
+	// entries recorded before the log was chained are covered by the first
+	// chained entry
+	_, err := db.db.Exec(`
+  INSERT INTO audit (ts, user_email, entity, entity_id, operation)
+  VALUES ('2023-05-01T00:00:00Z', 'system', 'settings', 'a@example.com', 'update')
+  `)
+	assert.NoError(t, err)
+	_, err = db.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	_, err = db.UpdateBlockHomeoffice(utils.BID, true)
+	assert.NoError(t, err)
+
+	v, err := db.VerifyAuditChain()
+	assert.NoError(t, err)
+	assert.True(t, v.Valid)
+	assert.Equal(t, 3, v.Entries)
+
+	_, err = db.db.Exec("DROP TRIGGER audit_no_update")
+	assert.NoError(t, err)
+	_, err = db.db.Exec("UPDATE audit SET user_email = 'someone' WHERE id = 1")
+	assert.NoError(t, err)
+
+	v, err = db.VerifyAuditChain()
+	assert.NoError(t, err)
+	assert.False(t, v.Valid)
+	assert.Equal(t, 2, v.BrokenID)
+	_, err = db.AuditDigest(time.Time{}, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, ErrAuditChainBroken)
+	_, err = db.AddPause(models.PauseCreate{Start: utils.PStartUpdated, End: utils.PEndUpdated, BlockID: utils.BID})
+	assert.NoError(t, err)
+}
+
+func TestAuditDigestSignature(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	d := models.AuditDigest{Month: "2023-05", Entries: 3, Hash: "abc"}
+	assert.NoError(t, SignAuditDigest(&d, key))
+	assert.True(t, VerifyAuditDigest(d))
+
+	d.Entries = 2
+	assert.False(t, VerifyAuditDigest(d))
+}
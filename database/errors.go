@@ -0,0 +1,221 @@
+package database
+
+import (
+	"errors"
+)
+
+// Error kinds. Every *Error wraps exactly one of them, so callers can match
+// whole classes of errors with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrInvalidState = errors.New("invalid state")
+	ErrValidation   = errors.New("validation failed")
+)
+
+// Error is a domain error with a stable, machine-readable code.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func NewValidationError(code string, message string) *Error {
+	return &Error{Kind: ErrValidation, Code: code, Message: message}
+}
+
+var (
+	ErrBlockNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "block_not_found",
+		Message: "block not found",
+	}
+	ErrPauseNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "pause_not_found",
+		Message: "pause not found",
+	}
+	ErrUserNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "user_not_found",
+		Message: "user not found",
+	}
+	ErrBlockAlreadyActive = &Error{
+		Kind:    ErrConflict,
+		Code:    "block_already_active",
+		Message: "current block already active",
+	}
+	ErrPauseAlreadyActive = &Error{
+		Kind:    ErrConflict,
+		Code:    "pause_already_active",
+		Message: "current pause already active",
+	}
+	ErrNoBlockActive = &Error{
+		Kind:    ErrInvalidState,
+		Code:    "no_block_active",
+		Message: "no current block active",
+	}
+	ErrNoPauseActive = &Error{
+		Kind:    ErrInvalidState,
+		Code:    "no_pause_active",
+		Message: "no current pause active",
+	}
+	ErrBlockBilled = &Error{
+		Kind:    ErrConflict,
+		Code:    "block_billed",
+		Message: "block has been billed and cannot be changed",
+	}
+	ErrNoBillableBlocks = &Error{
+		Kind:    ErrInvalidState,
+		Code:    "no_billable_blocks",
+		Message: "no finished billable blocks left to bill in range",
+	}
+	ErrFeedNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "feed_not_found",
+		Message: "calendar feed not found",
+	}
+	ErrInvoiceNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "invoice_not_found",
+		Message: "invoice not found",
+	}
+	ErrRateNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "rate_not_found",
+		Message: "rate not found",
+	}
+	ErrInvalidRate = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_rate",
+		Message: "rate must be positive and effective from a date as 2006-01-02",
+	}
+	ErrPauseNotEnded = &Error{
+		Kind:    ErrInvalidState,
+		Code:    "pause_not_ended",
+		Message: "pause not ended",
+	}
+	ErrInvalidStart = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_start",
+		Message: "invalid start format",
+	}
+	ErrInvalidEnd = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_end",
+		Message: "invalid end format",
+	}
+	ErrInvalidTimezone = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_timezone",
+		Message: "timezone must be an IANA time zone name",
+	}
+	ErrInvalidTarget = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_target",
+		Message: "target minutes must be given for all 7 days of the week and lie between 0 and 1440",
+	}
+	ErrInvalidRangeMode = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_mode",
+		Message: "mode must be contained or overlapping",
+	}
+	ErrAuditChainBroken = &Error{
+		Kind:    ErrConflict,
+		Code:    "audit_chain_broken",
+		Message: "the hash chain of the audit log is broken, verify it for details",
+	}
+	ErrInvalidMonth = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_month",
+		Message: "month must have the format YYYY-MM",
+	}
+	ErrMonthNotClosed = &Error{
+		Kind:    ErrInvalidState,
+		Code:    "month_not_closed",
+		Message: "a digest can only be exported for a month that has ended",
+	}
+	ErrPeriodLocked = &Error{
+		Kind:    ErrConflict,
+		Code:    "period_locked",
+		Message: "the period is locked, reopen it to make changes",
+	}
+	ErrLockNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "lock_not_found",
+		Message: "lock not found",
+	}
+	ErrInvalidLock = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_lock",
+		Message: "a lock needs a month as 2006-01 or a start before its end as RFC3339",
+	}
+	ErrInvalidRole = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_role",
+		Message: "role must be employee, manager or admin",
+	}
+	ErrTeamNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "team_not_found",
+		Message: "team not found",
+	}
+	ErrTeamExists = &Error{
+		Kind:    ErrConflict,
+		Code:    "team_exists",
+		Message: "a team with this name already exists",
+	}
+	ErrTeamMemberNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "team_member_not_found",
+		Message: "the user is not a member of the team",
+	}
+	ErrInvalidTeam = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_team",
+		Message: "a team needs a name",
+	}
+	ErrSubmissionNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "submission_not_found",
+		Message: "submission not found",
+	}
+	ErrInvalidSubmission = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_submission",
+		Message: "a submission needs a period of week or month and a date as 2006-01-02",
+	}
+	ErrAlreadySubmitted = &Error{
+		Kind:    ErrConflict,
+		Code:    "already_submitted",
+		Message: "the period has already been submitted",
+	}
+	ErrSubmissionNotPending = &Error{
+		Kind:    ErrInvalidState,
+		Code:    "submission_not_pending",
+		Message: "the submission has already been reviewed",
+	}
+	ErrReasonRequired = &Error{
+		Kind:    ErrValidation,
+		Code:    "reason_required",
+		Message: "a rejection needs a comment with the reason",
+	}
+	ErrTrashItemNotFound = &Error{
+		Kind:    ErrNotFound,
+		Code:    "trash_item_not_found",
+		Message: "the item is not in the trash",
+	}
+	ErrInvalidRestoreMode = &Error{
+		Kind:    ErrValidation,
+		Code:    "invalid_mode",
+		Message: "mode must be replace or merge",
+	}
+)
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"sort"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// newFeedSecret returns a random secret that identifies the calendar feed of
+// a user in its URL.
+func newFeedSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetFeedSecret returns the secret of the user's calendar feed, or
+// ErrFeedNotFound if the user has not created one.
+func (db *DB) GetFeedSecret(email string) (string, error) {
+	q := `
+  SELECT secret FROM feed
+  WHERE email = ?
+  `
+	var secret string
+	if err := db.queryRow(q, email).Scan(&secret); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrFeedNotFound
+		}
+		return "", err
+	}
+	return secret, nil
+}
+
+// RegenerateFeedSecret replaces the secret of the user's calendar feed with a
+// new one, so that the old feed URL stops working.
+func (db *DB) RegenerateFeedSecret(email string) (string, error) {
+	secret, err := newFeedSecret()
+	if err != nil {
+		return "", err
+	}
+
+	// The secret is a credential, so only the change itself is audited.
+	err = db.transaction(func(tx *DB) error {
+		q := `
+    INSERT INTO feed (email, secret)
+    VALUES (?, ?)
+    ON CONFLICT (email) DO UPDATE
+    SET secret = excluded.secret
+    `
+		if _, err := tx.exec(q, email, secret); err != nil {
+			return err
+		}
+		return tx.audit(EntityFeed, email, 0, OpUpdate, nil, nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// GetFeedUser returns the email of the user the feed secret belongs to.
+func (db *DB) GetFeedUser(secret string) (string, error) {
+	q := `
+  SELECT email FROM feed
+  WHERE secret = ?
+  `
+	var email string
+	if err := db.queryRow(q, secret).Scan(&email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrFeedNotFound
+		}
+		return "", err
+	}
+	return email, nil
+}
+
+// allFeeds returns the feeds of all users, ordered by email.
+func (db *DB) allFeeds() ([]models.BackupFeed, error) {
+	q := `
+  SELECT email, secret FROM feed
+  ORDER BY email
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []models.BackupFeed
+	for rows.Next() {
+		var f models.BackupFeed
+		if err := rows.Scan(&f.Email, &f.Secret); err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, f)
+	}
+	return feeds, rows.Err()
+}
+
+// sortedFeeds returns the feeds ordered by email, like DB.allFeeds.
+func (m *MemoryStore) sortedFeeds() []models.BackupFeed {
+	var feeds []models.BackupFeed
+	for email, secret := range m.feeds {
+		feeds = append(feeds, models.BackupFeed{Email: email, Secret: secret})
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].Email < feeds[j].Email
+	})
+	return feeds
+}
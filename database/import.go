@@ -0,0 +1,250 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// blockImporter is what importBlocks needs from a store. It is called within
+// a single transaction or under the lock of the memory store.
+type blockImporter interface {
+	importedBlockID(owner string, uid string) (int, bool, error)
+	overlappingBlockID(owner string, start time.Time, end time.Time) (int, bool, error)
+	addImportedBlock(creator string, block models.BlockImport) (int, error)
+	checkUnlocked(owner string, spans ...span) error
+}
+
+// importBlock adds the block for owner unless owner imported its UID before,
+// its range is invalid, it overlaps a block of owner or a locked period.
+func importBlock(s blockImporter, owner string, b models.BlockImport) (models.ImportResult, error) {
+	result := models.ImportResult{UID: b.UID, Start: b.Block.Start, End: b.Block.End}
+
+	if id, ok, err := s.importedBlockID(owner, b.UID); err != nil || ok {
+		result.Status, result.BlockID = models.ImportDuplicate, id
+		return result, err
+	}
+
+	start, startErr := time.Parse(time.RFC3339, b.Block.Start)
+	end, endErr := time.Parse(time.RFC3339, b.Block.End)
+	if b.UID == "" || startErr != nil || endErr != nil || !end.After(start) {
+		result.Status = models.ImportInvalid
+		return result, nil
+	}
+
+	if id, ok, err := s.overlappingBlockID(owner, start, end); err != nil || ok {
+		result.Status, result.BlockID = models.ImportOverlap, id
+		return result, err
+	}
+
+	if err := s.checkUnlocked(owner, blockSpans(&models.Block{Start: b.Block.Start, End: b.Block.End})...); err != nil {
+		if errors.Is(err, ErrPeriodLocked) {
+			result.Status, err = models.ImportLocked, nil
+		}
+		return result, err
+	}
+
+	id, err := s.addImportedBlock(owner, b)
+	result.Status, result.BlockID = models.ImportCreated, id
+	return result, err
+}
+
+// importBlocks imports the blocks one after another, so that a block also
+// overlaps the blocks created earlier in the same import.
+func importBlocks(s blockImporter, owner string, blocks []models.BlockImport) (models.ImportReport, error) {
+	report := models.ImportReport{Results: []models.ImportResult{}}
+	for _, b := range blocks {
+		result, err := importBlock(s, owner, b)
+		if err != nil {
+			return report, err
+		}
+		if result.Status == models.ImportCreated {
+			report.Created++
+		} else {
+			report.Skipped++
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// ImportBlocks imports the blocks in a single transaction. A dry run reports
+// the same results but rolls back.
+func (db *DB) ImportBlocks(blocks []models.BlockImport, dryRun bool) (models.ImportReport, error) {
+	var report models.ImportReport
+	err := db.transaction(func(tx *DB) error {
+		var err error
+		if report, err = importBlocks(tx, auditUser(tx.user), blocks); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return models.ImportReport{}, err
+	}
+
+	if dryRun {
+		report.DryRun = true
+		clearCreatedIDs(report.Results)
+	}
+	return report, nil
+}
+
+func clearCreatedIDs(results []models.ImportResult) {
+	for i := range results {
+		if results[i].Status == models.ImportCreated {
+			results[i].BlockID = 0
+		}
+	}
+}
+
+func (db *DB) importedBlockID(owner string, uid string) (int, bool, error) {
+	q := `
+  SELECT id FROM block
+  WHERE created_by = ? AND import_uid = ? AND deleted_at IS NULL
+  `
+	var id int
+	if err := db.queryRow(q, owner, uid).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+func (db *DB) overlappingBlockID(owner string, start time.Time, end time.Time) (int, bool, error) {
+	conditions, args := TimeRange{Start: start, End: end, Mode: RangeOverlapping}.conditions()
+	conditions = append(conditions, "block.created_by = ?", "block.deleted_at IS NULL")
+	args = append(args, owner)
+	q := `
+  SELECT block.id FROM block
+  ` + where(conditions) + `
+  ORDER BY block.id
+  LIMIT 1
+  `
+	var id int
+	if err := db.queryRow(q, args...).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// addImportedBlock adds the block with its UID. A deleted block of the
+// creator with the same UID gives it up, so that deleted events can be
+// imported again.
+func (db *DB) addImportedBlock(creator string, block models.BlockImport) (int, error) {
+	newBlock, err := db.addBlock(creator, block.Block)
+	if err != nil {
+		return 0, err
+	}
+
+	q := `
+  UPDATE block SET import_uid = NULL
+  WHERE created_by = ? AND import_uid = ? AND deleted_at IS NOT NULL
+  `
+	if _, err := db.exec(q, creator, block.UID); err != nil {
+		return 0, err
+	}
+
+	q = `
+  UPDATE block SET import_uid = ?
+  WHERE id = ?
+  `
+	_, err = db.exec(q, block.UID, newBlock.Id)
+	return newBlock.Id, err
+}
+
+// ImportBlocks imports the blocks like DB.ImportBlocks. A dry run restores
+// the blocks afterwards.
+func (m *MemoryStore) ImportBlocks(blocks []models.BlockImport, dryRun bool) (models.ImportReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := make(map[int]memoryBlock, len(m.blocks))
+	for id, b := range m.blocks {
+		saved[id] = b
+	}
+	savedPauses := make(map[int]models.Pause, len(m.pauses))
+	for id, p := range m.pauses {
+		savedPauses[id] = p
+	}
+	savedTrash := make(map[int]memoryTrashBlock, len(m.trashBlocks))
+	for id, t := range m.trashBlocks {
+		savedTrash[id] = t
+	}
+	nextBlockID, nextPauseID := m.nextBlockID, m.nextPauseID
+	audited := len(m.auditLog)
+
+	report, err := importBlocks(m, auditUser(m.user), blocks)
+	if err != nil || dryRun {
+		m.blocks, m.pauses, m.trashBlocks = saved, savedPauses, savedTrash
+		m.nextBlockID, m.nextPauseID = nextBlockID, nextPauseID
+		m.auditLog = m.auditLog[:audited]
+	}
+	if err != nil {
+		return models.ImportReport{}, err
+	}
+
+	if dryRun {
+		report.DryRun = true
+		clearCreatedIDs(report.Results)
+	}
+	return report, nil
+}
+
+func (m *MemoryStore) importedBlockID(owner string, uid string) (int, bool, error) {
+	for id, b := range m.blocks {
+		if b.createdBy == owner && b.importUID == uid {
+			return id, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (m *MemoryStore) overlappingBlockID(owner string, start time.Time, end time.Time) (int, bool, error) {
+	r := TimeRange{Start: start, End: end, Mode: RangeOverlapping}
+	blocks := m.filterBlocks(func(b memoryBlock) bool {
+		if b.createdBy != owner {
+			return false
+		}
+		blockStart, err := time.Parse(time.RFC3339, b.start)
+		if err != nil {
+			return false
+		}
+		blockEnd, _ := time.Parse(time.RFC3339, b.end)
+		return r.matches(blockStart, blockEnd)
+	})
+	if len(blocks) == 0 {
+		return 0, false, nil
+	}
+	return blocks[0].Id, true, nil
+}
+
+func (m *MemoryStore) addImportedBlock(creator string, block models.BlockImport) (int, error) {
+	newBlock, err := m.addBlock(creator, block.Block)
+	if err != nil {
+		return 0, err
+	}
+	for id, t := range m.trashBlocks {
+		if t.block.createdBy == creator && t.block.importUID == block.UID {
+			t.block.importUID = ""
+			m.trashBlocks[id] = t
+		}
+	}
+	b := m.blocks[newBlock.Id]
+	b.importUID = block.UID
+	m.blocks[newBlock.Id] = b
+	return newBlock.Id, nil
+}
@@ -0,0 +1,267 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// span is the time a block or pause covers. A running one only covers its
+// start.
+type span struct {
+	start string
+	end   string
+}
+
+func blockSpans(blocks ...*models.Block) []span {
+	var spans []span
+	for _, b := range blocks {
+		if b == nil {
+			continue
+		}
+		spans = append(spans, span{b.Start, b.End})
+		for _, p := range b.Pauses {
+			spans = append(spans, span{p.Start, p.End})
+		}
+	}
+	return spans
+}
+
+func pauseSpans(pauses ...*models.Pause) []span {
+	var spans []span
+	for _, p := range pauses {
+		if p != nil {
+			spans = append(spans, span{p.Start, p.End})
+		}
+	}
+	return spans
+}
+
+// touches reports whether the span overlaps [start, end). A span that ends
+// exactly at start does not.
+func (s span) touches(start, end time.Time) bool {
+	from, err := time.Parse(time.RFC3339, s.start)
+	if err != nil {
+		return false
+	}
+	if !from.Before(end) {
+		return false
+	}
+	if !from.Before(start) {
+		return true
+	}
+	to, err := time.Parse(time.RFC3339, s.end)
+	return err == nil && to.After(start)
+}
+
+// checkUnlocked returns ErrPeriodLocked if one of the spans of a block
+// created by owner touches one of the locks that apply to it, those of owner
+// and those of all users.
+func checkUnlocked(locks []models.PeriodLock, owner string, spans []span) error {
+	for _, l := range locks {
+		if l.Owner != "" && l.Owner != owner {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, l.Start)
+		if err != nil {
+			return err
+		}
+		end, err := time.Parse(time.RFC3339, l.End)
+		if err != nil {
+			return err
+		}
+		for _, s := range spans {
+			if s.touches(start, end) {
+				return ErrPeriodLocked
+			}
+		}
+	}
+	return nil
+}
+
+func newLock(start, end time.Time, user string, owner string) (models.PeriodLock, error) {
+	if !start.Before(end) {
+		return models.PeriodLock{}, ErrInvalidLock
+	}
+	return models.PeriodLock{
+		Start:    start.UTC().Format(time.RFC3339),
+		End:      end.UTC().Format(time.RFC3339),
+		LockedBy: auditUser(user),
+		Created:  time.Now().UTC().Format(time.RFC3339),
+		Owner:    owner,
+	}, nil
+}
+
+// GetLocks returns all locks ordered by their start.
+func (db *DB) GetLocks() ([]models.PeriodLock, error) {
+	q := `
+  SELECT id, start, "end", locked_by, created, owner FROM period_lock
+  ORDER BY start, id
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locks := []models.PeriodLock{}
+	for rows.Next() {
+		var l models.PeriodLock
+		if err := rows.Scan(&l.Id, &l.Start, &l.End, &l.LockedBy, &l.Created, &l.Owner); err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return locks, rows.Err()
+}
+
+// AddLock locks [start, end) for changes of the blocks and pauses created by
+// owner, or of those of all users if owner is empty. Locks may overlap.
+func (db *DB) AddLock(start, end time.Time, owner string) (models.PeriodLock, error) {
+	lock, err := newLock(start, end, db.user, owner)
+	if err != nil {
+		return lock, err
+	}
+
+	err = db.transaction(func(tx *DB) error {
+		q := `
+    INSERT INTO period_lock (start, "end", locked_by, created, owner)
+    VALUES (?, ?, ?, ?, ?)
+    `
+		id, err := tx.insert(q, lock.Start, lock.End, lock.LockedBy, lock.Created, lock.Owner)
+		if err != nil {
+			return err
+		}
+		lock.Id = id
+		return tx.audit(EntityLock, strconv.Itoa(lock.Id), 0, OpCreate, nil, lock)
+	})
+	if err != nil {
+		return models.PeriodLock{}, err
+	}
+	return lock, nil
+}
+
+// DeleteLock reopens a locked period. The lock stays in the audit log.
+func (db *DB) DeleteLock(id int) (int, error) {
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		q := `
+    SELECT id, start, "end", locked_by, created, owner FROM period_lock
+    WHERE id = ?
+    `
+		var before models.PeriodLock
+		err := tx.queryRow(q, id).Scan(&before.Id, &before.Start, &before.End,
+			&before.LockedBy, &before.Created, &before.Owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		q = `
+    DELETE FROM period_lock
+    WHERE id = ?
+    `
+		result, err := tx.exec(q, id)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		return tx.audit(EntityLock, strconv.Itoa(id), 0, OpDelete, before, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(rowsAffected), nil
+}
+
+func (db *DB) checkUnlocked(owner string, spans ...span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	locks, err := db.GetLocks()
+	if err != nil {
+		return err
+	}
+	return checkUnlocked(locks, owner, spans)
+}
+
+// blockCreator returns the user who created the block with the given id,
+// empty if it does not exist.
+func (db *DB) blockCreator(id int) (string, error) {
+	q := `
+  SELECT created_by FROM block
+  WHERE id = ?
+  `
+	var creator string
+	err := db.queryRow(q, id).Scan(&creator)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return creator, err
+}
+
+func (m *MemoryStore) GetLocks() ([]models.PeriodLock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sortedLocks(), nil
+}
+
+// sortedLocks has to be called with m.mu held.
+func (m *MemoryStore) sortedLocks() []models.PeriodLock {
+	locks := make([]models.PeriodLock, 0, len(m.locks))
+	for _, l := range m.locks {
+		locks = append(locks, l)
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		if locks[i].Start != locks[j].Start {
+			return locks[i].Start < locks[j].Start
+		}
+		return locks[i].Id < locks[j].Id
+	})
+	return locks
+}
+
+func (m *MemoryStore) AddLock(start, end time.Time, owner string) (models.PeriodLock, error) {
+	lock, err := newLock(start, end, m.user, owner)
+	if err != nil {
+		return lock, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock.Id = m.nextLockID
+	m.nextLockID++
+	m.locks[lock.Id] = lock
+	m.audit(EntityLock, strconv.Itoa(lock.Id), 0, OpCreate, nil, lock)
+	return lock, nil
+}
+
+func (m *MemoryStore) DeleteLock(id int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before, ok := m.locks[id]
+	if !ok {
+		return 0, nil
+	}
+	delete(m.locks, id)
+	m.audit(EntityLock, strconv.Itoa(id), 0, OpDelete, before, nil)
+	return 1, nil
+}
+
+// checkUnlocked has to be called with m.mu held.
+func (m *MemoryStore) checkUnlocked(owner string, spans ...span) error {
+	locks := make([]models.PeriodLock, 0, len(m.locks))
+	for _, l := range m.locks {
+		locks = append(locks, l)
+	}
+	return checkUnlocked(locks, owner, spans)
+}
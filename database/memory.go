@@ -0,0 +1,616 @@
+package database
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+type memoryBlock struct {
+	start      string
+	end        string
+	homeoffice bool
+	project    string
+	billable   bool
+	importUID  string
+	// createdBy is the user who created the block, see DB.AddBlock.
+	createdBy string
+}
+
+// MemoryStore is a Store that keeps all data in memory. It has the same
+// semantics as DB and is meant for tests and for embedding the server
+// without cgo. It does not support billing, so its blocks are never billed.
+type MemoryStore struct {
+	*memoryState
+	// user is recorded in the audit log, see WithUser.
+	user string
+	// owner restricts the blocks and pauses to those created by this user,
+	// see WithOwner.
+	owner string
+}
+
+type memoryState struct {
+	mu          sync.Mutex
+	blocks      map[int]memoryBlock
+	pauses      map[int]models.Pause
+	nextBlockID int
+	nextPauseID int
+	currents    map[string]memoryCurrent
+	settings    map[string]models.Settings
+	surcharges  *models.SurchargeConfig
+	feeds       map[string]string
+	auditLog    []models.AuditEntry
+	locks       map[int]models.PeriodLock
+	nextLockID  int
+	trashBlocks map[int]memoryTrashBlock
+	trashPauses map[int]memoryTrashPause
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{memoryState: &memoryState{
+		blocks:      make(map[int]memoryBlock),
+		pauses:      make(map[int]models.Pause),
+		nextBlockID: 1,
+		nextPauseID: 1,
+		currents:    make(map[string]memoryCurrent),
+		settings:    make(map[string]models.Settings),
+		feeds:       make(map[string]string),
+		locks:       make(map[int]models.PeriodLock),
+		nextLockID:  1,
+		trashBlocks: make(map[int]memoryTrashBlock),
+		trashPauses: make(map[int]memoryTrashPause),
+	}}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// memoryCurrent holds the running block and pause of a user, -1 if there is
+// none.
+type memoryCurrent struct {
+	blockID int
+	pauseID int
+}
+
+// current returns the running block and pause of the user. m.mu must be
+// held.
+func (m *MemoryStore) current() memoryCurrent {
+	if c, ok := m.currents[auditUser(m.user)]; ok {
+		return c
+	}
+	return memoryCurrent{blockID: -1, pauseID: -1}
+}
+
+// setCurrent replaces the running block and pause of the user. m.mu must be
+// held.
+func (m *MemoryStore) setCurrent(c memoryCurrent) {
+	m.currents[auditUser(m.user)] = c
+}
+
+func (m *MemoryStore) pausesByBlockID(blockID int) []models.Pause {
+	var pauses []models.Pause
+	for _, p := range m.pauses {
+		if p.BlockID == blockID {
+			pauses = append(pauses, p)
+		}
+	}
+	sort.Slice(pauses, func(i, j int) bool {
+		return pauses[i].Id < pauses[j].Id
+	})
+	return pauses
+}
+
+// owns reports whether the block is visible to the owner of the view.
+func (m *MemoryStore) owns(b memoryBlock) bool {
+	return m.owner == "" || b.createdBy == m.owner
+}
+
+func (m *MemoryStore) block(id int) (models.Block, bool) {
+	b, ok := m.blocks[id]
+	if !ok || !m.owns(b) {
+		return models.Block{}, false
+	}
+	return models.Block{
+		Id:         id,
+		Start:      b.start,
+		End:        b.end,
+		Homeoffice: b.homeoffice,
+		Project:    b.project,
+		Billable:   b.billable,
+		Pauses:     m.pausesByBlockID(id),
+	}, true
+}
+
+func (m *MemoryStore) filterBlocks(keep func(b memoryBlock) bool) []models.Block {
+	var ids []int
+	for id, b := range m.blocks {
+		if m.owns(b) && keep(b) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	var blocks []models.Block
+	for _, id := range ids {
+		b, _ := m.block(id)
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+func (m *MemoryStore) GetAllBlocks() ([]models.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filterBlocks(func(b memoryBlock) bool { return true }), nil
+}
+
+func (m *MemoryStore) GetBlocksInRange(r TimeRange) ([]models.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filterBlocks(func(b memoryBlock) bool {
+		start, err := time.Parse(time.RFC3339, b.start)
+		if err != nil {
+			return false
+		}
+		end, _ := time.Parse(time.RFC3339, b.end)
+		return r.matches(start, end)
+	}), nil
+}
+
+func (m *MemoryStore) GetUserBlocksInRange(email string, r TimeRange) ([]models.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filterBlocks(func(b memoryBlock) bool {
+		start, err := time.Parse(time.RFC3339, b.start)
+		if err != nil || b.createdBy != email {
+			return false
+		}
+		end, _ := time.Parse(time.RFC3339, b.end)
+		return r.matches(start, end)
+	}), nil
+}
+
+func (m *MemoryStore) GetPausesByBlockID(blockID int) ([]models.Pause, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.owns(m.blocks[blockID]) {
+		return nil, nil
+	}
+	return m.pausesByBlockID(blockID), nil
+}
+
+func (m *MemoryStore) GetBlockByID(id int) (models.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.block(id)
+	if !ok {
+		return b, ErrBlockNotFound
+	}
+	return b, nil
+}
+
+func (m *MemoryStore) GetPauseByID(id int) (models.Pause, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.pauses[id]
+	if !ok || !m.owns(m.blocks[p.BlockID]) {
+		return models.Pause{}, ErrPauseNotFound
+	}
+	return p, nil
+}
+
+func (m *MemoryStore) addBlock(creator string, block models.BlockCreate) (models.Block, error) {
+	spans := []span{{block.Start, block.End}}
+	for _, p := range block.Pauses {
+		spans = append(spans, span{p.Start, p.End})
+	}
+	if err := m.checkUnlocked(creator, spans...); err != nil {
+		return models.Block{}, err
+	}
+
+	id := m.nextBlockID
+	m.nextBlockID++
+	m.blocks[id] = memoryBlock{
+		start:      block.Start,
+		end:        block.End,
+		homeoffice: block.Homeoffice,
+		project:    block.Project,
+		billable:   block.Billable,
+		createdBy:  creator,
+	}
+
+	newBlock := models.Block{
+		Id:         id,
+		Start:      block.Start,
+		End:        block.End,
+		Homeoffice: block.Homeoffice,
+		Project:    block.Project,
+		Billable:   block.Billable,
+	}
+	for _, pause := range block.Pauses {
+		newPause := m.insertPause(models.PauseCreate{
+			Start:   pause.Start,
+			End:     pause.End,
+			BlockID: id,
+		})
+		newBlock.Pauses = append(newBlock.Pauses, newPause)
+	}
+	m.auditBlock(OpCreate, id, nil, &newBlock)
+	return newBlock, nil
+}
+
+func (m *MemoryStore) AddBlock(block models.BlockCreate) (models.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addBlock(auditUser(m.user), block)
+}
+
+func (m *MemoryStore) insertPause(pause models.PauseCreate) models.Pause {
+	id := m.nextPauseID
+	m.nextPauseID++
+	newPause := models.Pause{
+		Id:      id,
+		Start:   pause.Start,
+		End:     pause.End,
+		BlockID: pause.BlockID,
+	}
+	m.pauses[id] = newPause
+	return newPause
+}
+
+func (m *MemoryStore) addPause(pause models.PauseCreate) (models.Pause, error) {
+	if b, ok := m.blocks[pause.BlockID]; !ok || !m.owns(b) {
+		return models.Pause{}, ErrBlockNotFound
+	}
+	if err := m.checkUnlocked(m.blocks[pause.BlockID].createdBy, span{pause.Start, pause.End}); err != nil {
+		return models.Pause{}, err
+	}
+
+	newPause := m.insertPause(pause)
+	m.auditPause(OpCreate, newPause.Id, newPause.BlockID, nil, &newPause)
+	return newPause, nil
+}
+
+func (m *MemoryStore) AddPause(pause models.PauseCreate) (models.Pause, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addPause(pause)
+}
+
+func (m *MemoryStore) DeleteBlock(id int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before, ok := m.block(id)
+	if !ok {
+		return 0, nil
+	}
+	if err := m.checkUnlocked(m.blocks[id].createdBy, blockSpans(&before)...); err != nil {
+		return 0, err
+	}
+
+	for email, c := range m.currents {
+		if c.blockID == id {
+			m.currents[email] = memoryCurrent{blockID: -1, pauseID: -1}
+		}
+	}
+
+	m.trashBlocks[id] = memoryTrashBlock{
+		block:     m.blocks[id],
+		pauses:    before.Pauses,
+		deletedAt: deletedAt(time.Now()),
+	}
+	delete(m.blocks, id)
+	for pauseID, p := range m.pauses {
+		if p.BlockID == id {
+			delete(m.pauses, pauseID)
+		}
+	}
+	m.auditBlock(OpDelete, id, &before, nil)
+	return 1, nil
+}
+
+func (m *MemoryStore) DeletePause(id int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before, ok := m.pauses[id]
+	if !ok || !m.owns(m.blocks[before.BlockID]) {
+		return 0, nil
+	}
+	if err := m.checkUnlocked(m.blocks[before.BlockID].createdBy, pauseSpans(&before)...); err != nil {
+		return 0, err
+	}
+
+	for email, c := range m.currents {
+		if c.pauseID == id {
+			m.currents[email] = memoryCurrent{blockID: c.blockID, pauseID: -1}
+		}
+	}
+
+	m.trashPauses[id] = memoryTrashPause{pause: before, deletedAt: deletedAt(time.Now())}
+	delete(m.pauses, id)
+	m.auditPause(OpDelete, id, before.BlockID, &before, nil)
+	return 1, nil
+}
+
+func (m *MemoryStore) updateBlock(id int, update func(b *memoryBlock)) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.blocks[id]
+	if !ok || !m.owns(b) {
+		return 0, nil
+	}
+	before, _ := m.block(id)
+	update(&b)
+	if err := m.checkUnlocked(b.createdBy, append(blockSpans(&before), span{b.start, b.end})...); err != nil {
+		return 0, err
+	}
+	m.blocks[id] = b
+	after, _ := m.block(id)
+	m.auditBlock(OpUpdate, id, &before, &after)
+	return 1, nil
+}
+
+func (m *MemoryStore) UpdateBlock(block models.Block) (int, error) {
+	return m.updateBlock(block.Id, func(b *memoryBlock) {
+		b.start = block.Start
+		b.end = block.End
+		b.homeoffice = block.Homeoffice
+		b.project = block.Project
+		b.billable = block.Billable
+	})
+}
+
+func (m *MemoryStore) UpdateBlockStart(id int, start string) (int, error) {
+	return m.updateBlock(id, func(b *memoryBlock) {
+		b.start = start
+	})
+}
+
+func (m *MemoryStore) UpdateBlockEnd(id int, end string) (int, error) {
+	return m.updateBlock(id, func(b *memoryBlock) {
+		b.end = end
+	})
+}
+
+func (m *MemoryStore) UpdateBlockHomeoffice(id int, homeoffice bool) (int, error) {
+	return m.updateBlock(id, func(b *memoryBlock) {
+		b.homeoffice = homeoffice
+	})
+}
+
+func (m *MemoryStore) updatePause(id int, update func(p *models.Pause)) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.pauses[id]
+	if !ok || !m.owns(m.blocks[p.BlockID]) {
+		return 0, nil
+	}
+	before := p
+	update(&p)
+	if err := m.checkUnlocked(m.blocks[p.BlockID].createdBy, pauseSpans(&before, &p)...); err != nil {
+		return 0, err
+	}
+	m.pauses[id] = p
+	m.auditPause(OpUpdate, id, p.BlockID, &before, &p)
+	return 1, nil
+}
+
+func (m *MemoryStore) UpdatePause(pause models.Pause) (int, error) {
+	return m.updatePause(pause.Id, func(p *models.Pause) {
+		p.Start = pause.Start
+		p.End = pause.End
+	})
+}
+
+func (m *MemoryStore) UpdatePauseStart(id int, start string) (int, error) {
+	return m.updatePause(id, func(p *models.Pause) {
+		p.Start = start
+	})
+}
+
+func (m *MemoryStore) UpdatePauseEnd(id int, end string) (int, error) {
+	return m.updatePause(id, func(p *models.Pause) {
+		p.End = end
+	})
+}
+
+func (m *MemoryStore) StartBlock(homeoffice bool, at time.Time) (models.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.current().blockID != -1 {
+		return models.Block{}, ErrBlockAlreadyActive
+	}
+
+	newBlock, err := m.addBlock(auditUser(m.user), models.BlockCreate{
+		Start:      at.Format(time.RFC3339),
+		Homeoffice: homeoffice,
+	})
+	if err != nil {
+		return newBlock, err
+	}
+	m.setCurrent(memoryCurrent{blockID: newBlock.Id, pauseID: -1})
+	return newBlock, nil
+}
+
+func (m *MemoryStore) EndBlock(at time.Time) (models.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.current()
+	if current.blockID == -1 {
+		return models.Block{}, ErrNoBlockActive
+	}
+	if current.pauseID != -1 {
+		return models.Block{}, ErrPauseNotEnded
+	}
+
+	before, _ := m.block(current.blockID)
+	b := m.blocks[current.blockID]
+	b.end = at.Format(time.RFC3339)
+	if err := m.checkUnlocked(b.createdBy, span{b.start, b.end}); err != nil {
+		return models.Block{}, err
+	}
+	m.blocks[current.blockID] = b
+
+	block, _ := m.block(current.blockID)
+	m.auditBlock(OpUpdate, block.Id, &before, &block)
+	m.setCurrent(memoryCurrent{blockID: -1, pauseID: -1})
+	return block, nil
+}
+
+func (m *MemoryStore) GetCurrentBlock() (models.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.current()
+	if current.blockID == -1 {
+		return models.Block{}, ErrNoBlockActive
+	}
+	b, ok := m.block(current.blockID)
+	if !ok {
+		return b, ErrBlockNotFound
+	}
+	return b, nil
+}
+
+func (m *MemoryStore) StartPause(at time.Time) (models.Pause, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.current()
+	if current.blockID == -1 {
+		return models.Pause{}, ErrNoBlockActive
+	}
+	if current.pauseID != -1 {
+		return models.Pause{}, ErrPauseAlreadyActive
+	}
+
+	newPause, err := m.addPause(models.PauseCreate{
+		Start:   at.Format(time.RFC3339),
+		BlockID: current.blockID,
+	})
+	if err != nil {
+		return newPause, err
+	}
+	m.setCurrent(memoryCurrent{blockID: current.blockID, pauseID: newPause.Id})
+	return newPause, nil
+}
+
+func (m *MemoryStore) EndPause(at time.Time) (models.Pause, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.current()
+	if current.pauseID == -1 {
+		return models.Pause{}, ErrNoPauseActive
+	}
+
+	p := m.pauses[current.pauseID]
+	before := p
+	p.End = at.Format(time.RFC3339)
+	if err := m.checkUnlocked(m.blocks[p.BlockID].createdBy, pauseSpans(&p)...); err != nil {
+		return models.Pause{}, err
+	}
+	m.pauses[current.pauseID] = p
+	m.auditPause(OpUpdate, p.Id, p.BlockID, &before, &p)
+	m.setCurrent(memoryCurrent{blockID: current.blockID, pauseID: -1})
+	return p, nil
+}
+
+func (m *MemoryStore) GetSettings(email string) (models.Settings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings, ok := m.settings[email]
+	if !ok {
+		return models.DefaultSettings(), nil
+	}
+	return settings, nil
+}
+
+func (m *MemoryStore) UpdateSettings(email string, settings models.Settings) error {
+	settings, err := normalizeSettings(settings)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before, ok := m.settings[email]
+	if !ok {
+		before = models.DefaultSettings()
+	}
+	m.settings[email] = settings
+	m.audit(EntitySettings, email, 0, OpUpdate, before, settings)
+	return nil
+}
+
+func (m *MemoryStore) GetSurchargeConfig() (models.SurchargeConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.surcharges == nil {
+		return models.DefaultSurchargeConfig(), nil
+	}
+	return *m.surcharges, nil
+}
+
+func (m *MemoryStore) UpdateSurchargeConfig(config models.SurchargeConfig) error {
+	if err := validateSurchargeConfig(config); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := models.DefaultSurchargeConfig()
+	if m.surcharges != nil {
+		before = *m.surcharges
+	}
+	m.surcharges = &config
+	m.audit(EntitySurcharges, "", 0, OpUpdate, before, config)
+	return nil
+}
+
+func (m *MemoryStore) GetFeedSecret(email string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.feeds[email]
+	if !ok {
+		return "", ErrFeedNotFound
+	}
+	return secret, nil
+}
+
+func (m *MemoryStore) RegenerateFeedSecret(email string) (string, error) {
+	secret, err := newFeedSecret()
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.feeds[email] = secret
+	m.audit(EntityFeed, email, 0, OpUpdate, nil, nil)
+	return secret, nil
+}
+
+func (m *MemoryStore) GetFeedUser(secret string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for email, s := range m.feeds {
+		if s == secret {
+			return email, nil
+		}
+	}
+	return "", ErrFeedNotFound
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// postgresTestURL names the environment variable with the URL of a scratch
+// PostgreSQL database. Its public schema is dropped before every test.
+const postgresTestURL = "WORK_HOURS_TEST_POSTGRES"
+
+func newPostgresTestDatabase(t *testing.T) *DB {
+	dsn := os.Getenv(postgresTestURL)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresTestURL)
+	}
+
+	db, err := NewPostgresDatabase(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.conn.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRebind(t *testing.T) {
+	db := &DB{dialect: postgres}
+	assert.Equal(t, "UPDATE block SET start = $1 WHERE id = $2", db.rebind("UPDATE block SET start = ? WHERE id = ?"))
+
+	db = &DB{dialect: sqlite}
+	assert.Equal(t, "SELECT * FROM block WHERE id = ?", db.rebind("SELECT * FROM block WHERE id = ?"))
+}
+
+func TestOpen(t *testing.T) {
+	db, err := Open("postgres://localhost/work_hours?sslmode=disable")
+	assert.NoError(t, err)
+	assert.Equal(t, postgres, db.dialect)
+	db.Close()
+
+	db, err = Open(filepath.Join(t.TempDir(), "data.db"))
+	assert.NoError(t, err)
+	assert.Equal(t, sqlite, db.dialect)
+	db.Close()
+}
+
+func TestPostgresStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return newPostgresTestDatabase(t) })
+}
+
+func TestPostgresMigrate(t *testing.T) {
+	db := newPostgresTestDatabase(t)
+	defer db.Close()
+
+	applied, err := db.Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, applied)
+	assert.Equal(t, len(migrations), len(postgresMigrations))
+}
+
+func TestPostgresConcurrentStartBlock(t *testing.T) {
+	db := newPostgresTestDatabase(t)
+	defer db.Close()
+
+	const n = 10
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.StartBlock(false, time.Now())
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	started := 0
+	for err := range errs {
+		if err == nil {
+			started++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrBlockAlreadyActive)
+	}
+	assert.Equal(t, 1, started)
+
+	blocks, err := db.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+}
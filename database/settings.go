@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// normalizeSettings validates the settings and fills in the default target
+// minutes if none are given.
+func normalizeSettings(settings models.Settings) (models.Settings, error) {
+	if settings.Timezone == "" {
+		return settings, ErrInvalidTimezone
+	}
+	if _, err := settings.Location(); err != nil {
+		return settings, ErrInvalidTimezone
+	}
+
+	if settings.TargetMinutes == nil {
+		settings.TargetMinutes = models.DefaultTargetMinutes()
+	}
+	if len(settings.TargetMinutes) != 7 {
+		return settings, ErrInvalidTarget
+	}
+	for _, minutes := range settings.TargetMinutes {
+		if minutes < 0 || minutes > 24*60 {
+			return settings, ErrInvalidTarget
+		}
+	}
+	return settings, nil
+}
+
+// GetSettings returns the settings of the user with the given email, or the
+// default settings if the user has not saved any.
+func (db *DB) GetSettings(email string) (models.Settings, error) {
+	q := `
+  SELECT timezone, target_minutes FROM setting
+  WHERE email = ?
+  `
+	var settings models.Settings
+	var targets string
+	err := db.queryRow(q, email).Scan(&settings.Timezone, &targets)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DefaultSettings(), nil
+		}
+		return settings, err
+	}
+
+	settings.TargetMinutes, err = parseTargetMinutes(targets)
+	return settings, err
+}
+
+// parseTargetMinutes parses the target_minutes column, which is empty for
+// settings saved before targets existed.
+func parseTargetMinutes(targets string) ([]int, error) {
+	minutes := models.DefaultTargetMinutes()
+	if targets == "" {
+		return minutes, nil
+	}
+	err := json.Unmarshal([]byte(targets), &minutes)
+	return minutes, err
+}
+
+// allSettings returns the saved settings of all users, ordered by email.
+func (db *DB) allSettings() ([]models.UserSettings, error) {
+	q := `
+  SELECT email, timezone, target_minutes FROM setting
+  ORDER BY email
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := []models.UserSettings{}
+	for rows.Next() {
+		var s models.UserSettings
+		var targets string
+		if err := rows.Scan(&s.Email, &s.Timezone, &targets); err != nil {
+			return nil, err
+		}
+		if s.TargetMinutes, err = parseTargetMinutes(targets); err != nil {
+			return nil, err
+		}
+		settings = append(settings, s)
+	}
+	return settings, rows.Err()
+}
+
+func (db *DB) UpdateSettings(email string, settings models.Settings) error {
+	settings, err := normalizeSettings(settings)
+	if err != nil {
+		return err
+	}
+	targets, err := json.Marshal(settings.TargetMinutes)
+	if err != nil {
+		return err
+	}
+
+	return db.transaction(func(tx *DB) error {
+		before, err := tx.GetSettings(email)
+		if err != nil {
+			return err
+		}
+
+		q := `
+    INSERT INTO setting (email, timezone, target_minutes)
+    VALUES (?, ?, ?)
+    ON CONFLICT (email) DO UPDATE
+    SET timezone = excluded.timezone, target_minutes = excluded.target_minutes
+    `
+		if _, err := tx.exec(q, email, settings.Timezone, string(targets)); err != nil {
+			return err
+		}
+		return tx.audit(EntitySettings, email, 0, OpUpdate, before, settings)
+	})
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// Store covers all block, pause, current-state, settings and feed operations
+// the server needs. DB implements it on top of SQLite or PostgreSQL,
+// MemoryStore keeps everything in memory and does not need cgo.
+type Store interface {
+	AddBlock(block models.BlockCreate) (models.Block, error)
+	GetBlockByID(id int) (models.Block, error)
+	GetAllBlocks() ([]models.Block, error)
+	GetBlocksInRange(r TimeRange) ([]models.Block, error)
+	// GetUserBlocksInRange returns the blocks of the range created by the
+	// user with the given email.
+	GetUserBlocksInRange(email string, r TimeRange) ([]models.Block, error)
+	UpdateBlock(block models.Block) (int, error)
+	UpdateBlockStart(id int, start string) (int, error)
+	UpdateBlockEnd(id int, end string) (int, error)
+	UpdateBlockHomeoffice(id int, homeoffice bool) (int, error)
+	DeleteBlock(id int) (int, error)
+
+	AddPause(pause models.PauseCreate) (models.Pause, error)
+	GetPauseByID(id int) (models.Pause, error)
+	GetPausesByBlockID(blockID int) ([]models.Pause, error)
+	UpdatePause(pause models.Pause) (int, error)
+	UpdatePauseStart(id int, start string) (int, error)
+	UpdatePauseEnd(id int, end string) (int, error)
+	DeletePause(id int) (int, error)
+
+	StartBlock(homeoffice bool, at time.Time) (models.Block, error)
+	EndBlock(at time.Time) (models.Block, error)
+	GetCurrentBlock() (models.Block, error)
+	StartPause(at time.Time) (models.Pause, error)
+	EndPause(at time.Time) (models.Pause, error)
+
+	GetSettings(email string) (models.Settings, error)
+	UpdateSettings(email string, settings models.Settings) error
+
+	GetSurchargeConfig() (models.SurchargeConfig, error)
+	UpdateSurchargeConfig(config models.SurchargeConfig) error
+
+	GetFeedSecret(email string) (string, error)
+	RegenerateFeedSecret(email string) (string, error)
+	GetFeedUser(secret string) (string, error)
+
+	ImportBlocks(blocks []models.BlockImport, dryRun bool) (models.ImportReport, error)
+
+	GetBlockHistory(id int) ([]models.AuditEntry, error)
+	VerifyAuditChain() (models.AuditVerification, error)
+	AuditDigest(start, end time.Time) (models.AuditDigest, error)
+	// WithUser returns a view of the store that records its changes in the
+	// audit log as made by the user with the given email.
+	WithUser(email string) Store
+	// WithOwner is WithUser for a view that only sees the blocks and pauses
+	// created by the user. Blocks and pauses of other users are not found.
+	WithOwner(email string) Store
+
+	// Changes of blocks and pauses that touch a locked period fail with
+	// ErrPeriodLocked. AddLock locks the blocks created by owner, or those
+	// of all users if owner is empty. DeleteLock reopens the period.
+	GetLocks() ([]models.PeriodLock, error)
+	AddLock(start, end time.Time, owner string) (models.PeriodLock, error)
+	DeleteLock(id int) (int, error)
+
+	// DeleteBlock and DeletePause move blocks and pauses to the trash, from
+	// where they can be restored until PurgeTrash deletes them for good.
+	GetTrash() ([]models.TrashItem, error)
+	RestoreBlock(id int) (models.Block, error)
+	RestorePause(id int) (models.Pause, error)
+	PurgeTrash(before time.Time) (int, error)
+
+	ExportBackup() (models.Backup, error)
+	RestoreBackup(backup models.Backup, mode RestoreMode) (models.RestoreReport, error)
+
+	Close() error
+}
+
+// UserStore is implemented by stores that manage login accounts.
+type UserStore interface {
+	GetUserCredentials(email string) (models.User, string, error)
+}
+
+// BillingStore is implemented by stores that can bill blocks. Rates and
+// invoices belong to the user with the given email.
+type BillingStore interface {
+	AddRate(email string, rate models.RateCreate) (models.Rate, error)
+	GetRates(email string) ([]models.Rate, error)
+	DeleteRate(email string, id int) (int, error)
+
+	CreateInvoice(email string, r TimeRange, at time.Time) (models.Invoice, error)
+	GetInvoices(email string) ([]models.Invoice, error)
+	GetInvoiceByID(email string, id int) (models.Invoice, error)
+}
+
+// WorkflowStore is implemented by stores that know the roles and teams of
+// their users and let them submit weeks and months for review. Reviews are
+// made by the user of the store.
+type WorkflowStore interface {
+	UserStore
+	SetUserRole(email string, role string) (int, error)
+
+	GetTeams() ([]models.Team, error)
+	GetTeam(id int) (models.Team, error)
+	AddTeam(name string) (models.Team, error)
+	AddTeamMember(teamID int, email string) error
+	RemoveTeamMember(teamID int, email string) (int, error)
+	ManagedUsers(manager string) ([]string, error)
+
+	Submit(email string, period string, start, end time.Time, comment string) (models.Submission, error)
+	GetSubmission(id int) (models.Submission, error)
+	GetSubmissions(emails []string, status string) ([]models.Submission, error)
+	ApproveSubmission(id int, comment string) (models.Submission, error)
+	RejectSubmission(id int, reason string) (models.Submission, error)
+	GetWorkflowEvents(emails []string, since int) ([]models.WorkflowEvent, error)
+}
+
+// Checkpointer is implemented by stores that buffer writes which should be
+// flushed before shutting down.
+type Checkpointer interface {
+	Checkpoint() error
+}
+
+var (
+	_ Store        = (*DB)(nil)
+	_ UserStore    = (*DB)(nil)
+	_ BillingStore = (*DB)(nil)
+	_ Checkpointer = (*DB)(nil)
+	_ Store        = (*MemoryStore)(nil)
+)
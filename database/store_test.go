@@ -0,0 +1,1056 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// testStore runs the conformance tests every Store implementation has to pass.
+// newStore must return an empty store for every call and may skip the test.
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Store)
+	}{
+		{"Blocks", testStoreBlocks},
+		{"Pauses", testStorePauses},
+		{"BlocksWithPauses", testStoreBlocksWithPauses},
+		{"Ranges", testStoreRanges},
+		{"RangeInstants", testStoreRangeInstants},
+		{"Current", testStoreCurrent},
+		{"DeleteCurrent", testStoreDeleteCurrent},
+		{"Settings", testStoreSettings},
+		{"Surcharges", testStoreSurcharges},
+		{"Project", testStoreProject},
+		{"Feed", testStoreFeed},
+		{"Import", testStoreImport},
+		{"Backup", testStoreBackup},
+		{"Audit", testStoreAudit},
+		{"AuditChain", testStoreAuditChain},
+		{"Locks", testStoreLocks},
+		{"Trash", testStoreTrash},
+		{"Owner", testStoreOwner},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newStore(t)
+			defer s.Close()
+			test.run(t, s)
+		})
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return GetNewTestDatabase() })
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return NewMemoryStore() })
+}
+
+func testStoreBlocks(t *testing.T, s Store) {
+	blocks, err := s.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(blocks))
+
+	block, err := s.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	utils.AssertTestBlock(t, block)
+	assert.Equal(t, 1, len(block.Pauses))
+
+	block, err = s.GetBlockByID(utils.BID)
+	assert.NoError(t, err)
+	utils.AssertTestBlock(t, block)
+	utils.AssertTestPause(t, block.Pauses[0])
+
+	_, err = s.GetBlockByID(2)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+
+	n, err := s.UpdateBlock(utils.TestBlockUpdated())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	block, err = s.GetBlockByID(utils.BID)
+	assert.NoError(t, err)
+	utils.AssertTestBlockUpdated(t, block)
+
+	n, err = s.UpdateBlockStart(utils.BID, utils.BStart)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = s.UpdateBlockEnd(utils.BID, utils.BEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = s.UpdateBlockHomeoffice(utils.BID, utils.BHomeoffice)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	block, err = s.GetBlockByID(utils.BID)
+	assert.NoError(t, err)
+	utils.AssertTestBlock(t, block)
+
+	n, err = s.UpdateBlockStart(2, utils.BStart)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	second, err := s.AddBlock(utils.TestBlockCreateWithoutPause())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, second.Id)
+	assert.Equal(t, 0, len(second.Pauses))
+
+	blocks, err = s.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(blocks))
+	assert.Equal(t, 1, blocks[0].Id)
+	assert.Equal(t, 2, blocks[1].Id)
+
+	n, err = s.DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = s.DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = s.GetPauseByID(utils.PID)
+	assert.ErrorIs(t, err, ErrPauseNotFound)
+}
+
+func testStorePauses(t *testing.T, s Store) {
+	_, err := s.AddPause(utils.TestPauseCreate())
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+
+	_, err = s.AddBlock(utils.TestBlockCreateWithoutPause())
+	assert.NoError(t, err)
+
+	pause, err := s.AddPause(utils.TestPauseCreate())
+	assert.NoError(t, err)
+	utils.AssertTestPause(t, pause)
+
+	pause, err = s.GetPauseByID(utils.PID)
+	assert.NoError(t, err)
+	utils.AssertTestPause(t, pause)
+
+	n, err := s.UpdatePause(utils.TestPauseUpdated())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	pause, err = s.GetPauseByID(utils.PID)
+	assert.NoError(t, err)
+	utils.AssertTestPauseUpdated(t, pause)
+
+	n, err = s.UpdatePauseStart(utils.PID, utils.PStart)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = s.UpdatePauseEnd(utils.PID, utils.PEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	pauses, err := s.GetPausesByBlockID(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pauses))
+	utils.AssertTestPause(t, pauses[0])
+
+	n, err = s.UpdatePauseEnd(2, utils.PEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = s.DeletePause(utils.PID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = s.DeletePause(utils.PID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = s.GetPauseByID(utils.PID)
+	assert.ErrorIs(t, err, ErrPauseNotFound)
+}
+
+func testStoreBlocksWithPauses(t *testing.T, s Store) {
+	withPauses := models.BlockCreate{
+		Start: "2023-05-09T07:00:00Z",
+		End:   "2023-05-09T15:30:00Z",
+		Pauses: []models.PauseWithoutBlockID{
+			{Start: "2023-05-09T09:00:00Z", End: "2023-05-09T09:15:00Z"},
+			{Start: "2023-05-09T12:00:00Z", End: "2023-05-09T12:30:00Z"},
+		},
+	}
+	_, err := s.AddBlock(withPauses)
+	assert.NoError(t, err)
+	_, err = s.AddBlock(utils.TestBlockCreateWithoutPause())
+	assert.NoError(t, err)
+	_, err = s.AddBlock(withPauses)
+	assert.NoError(t, err)
+
+	blocks, err := s.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(blocks))
+	for i, want := range []int{2, 0, 2} {
+		assert.Equal(t, i+1, blocks[i].Id)
+		assert.Equal(t, want, len(blocks[i].Pauses))
+		for _, p := range blocks[i].Pauses {
+			assert.Equal(t, blocks[i].Id, p.BlockID)
+		}
+	}
+	assert.Equal(t, "2023-05-09T09:00:00Z", blocks[2].Pauses[0].Start)
+	assert.Equal(t, "2023-05-09T12:30:00Z", blocks[2].Pauses[1].End)
+
+	block, err := s.GetBlockByID(3)
+	assert.NoError(t, err)
+	assert.Equal(t, blocks[2], block)
+}
+
+func testStoreRanges(t *testing.T, s Store) {
+	for _, block := range utils.CreateRangeTestBlocks() {
+		_, err := s.AddBlock(block)
+		assert.NoError(t, err)
+	}
+
+	blocks, err := s.GetBlocksInRange(parseTimeRange(t, "2023-05-01T07:00:00Z", "2023-07-31T07:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(blocks))
+
+	blocks, err = s.GetBlocksInRange(parseTimeRange(t, "2023-06-01T07:00:00Z", "2023-06-30T07:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+	assert.Equal(t, 2, blocks[0].Id)
+
+	blocks, err = s.GetBlocksInRange(parseTimeRange(t, "2023-01-01T07:00:00Z", "2023-01-31T07:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(blocks))
+
+	blocks, err = s.GetBlocksInRange(parseTimeRange(t, "2023-06-01T07:00:00Z", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(blocks))
+
+	blocks, err = s.GetBlocksInRange(parseTimeRange(t, "", "2023-06-30T07:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(blocks))
+
+	blocks, err = s.GetBlocksInRange(TimeRange{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(blocks))
+}
+
+func testStoreRangeInstants(t *testing.T, s Store) {
+	// 2023-05-31T23:00:00Z to 2023-06-01T03:00:00Z
+	nearMidnight, err := s.AddBlock(models.BlockCreate{
+		Start: "2023-06-01T01:00:00+02:00",
+		End:   "2023-06-01T05:00:00+02:00",
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		start, end string
+		mode       RangeMode
+		found      bool
+	}{
+		{"contained in UTC day", "2023-06-01T00:00:00Z", "2023-06-02T00:00:00Z", RangeContained, false},
+		{"overlapping UTC day", "2023-06-01T00:00:00Z", "2023-06-02T00:00:00Z", RangeOverlapping, true},
+		{"contained in local day", "2023-06-01T00:00:00+02:00", "2023-06-02T00:00:00+02:00", RangeContained, true},
+		{"overlapping previous UTC day", "2023-05-31T00:00:00Z", "2023-06-01T00:00:00Z", RangeOverlapping, true},
+		{"contained in previous UTC day", "2023-05-31T00:00:00Z", "2023-06-01T00:00:00Z", RangeContained, false},
+		{"end is exclusive", "2023-05-30T00:00:00Z", "2023-05-31T23:00:00Z", RangeOverlapping, false},
+		{"start is exclusive for overlaps", "2023-06-01T03:00:00Z", "2023-06-02T00:00:00Z", RangeOverlapping, false},
+		{"bounds are inclusive for containment", "2023-05-31T23:00:00Z", "2023-06-01T03:00:00Z", RangeContained, true},
+	}
+
+	for _, test := range tests {
+		r, err := ParseTimeRange(test.start, test.end, string(test.mode))
+		assert.NoError(t, err)
+		blocks, err := s.GetBlocksInRange(r)
+		assert.NoError(t, err)
+		if test.found {
+			assert.Equal(t, 1, len(blocks), test.name)
+		} else {
+			assert.Equal(t, 0, len(blocks), test.name)
+		}
+	}
+
+	running, err := s.StartBlock(false, time.Now())
+	assert.NoError(t, err)
+
+	blocks, err := s.GetBlocksInRange(parseTimeRange(t, "2023-01-01T00:00:00Z", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(blocks))
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	blocks, err = s.GetBlocksInRange(parseTimeRange(t, "2023-06-02T00:00:00Z", future))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(blocks))
+
+	r, err := ParseTimeRange("2023-06-02T00:00:00Z", future, string(RangeOverlapping))
+	assert.NoError(t, err)
+	blocks, err = s.GetBlocksInRange(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+	assert.Equal(t, running.Id, blocks[0].Id)
+
+	n, err := s.UpdateBlockStart(nearMidnight.Id, "2023-06-01T02:00:00+02:00")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	blocks, err = s.GetBlocksInRange(parseTimeRange(t, "2023-06-01T00:00:00Z", "2023-06-02T00:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+}
+
+func testStoreCurrent(t *testing.T, s Store) {
+	_, err := s.GetCurrentBlock()
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+	_, err = s.EndBlock(time.Now())
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+	_, err = s.StartPause(time.Now())
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+	_, err = s.EndPause(time.Now())
+	assert.ErrorIs(t, err, ErrNoPauseActive)
+
+	block, err := s.StartBlock(true, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, block.Homeoffice)
+	assert.NotEmpty(t, block.Start)
+	assert.Empty(t, block.End)
+
+	_, err = s.StartBlock(false, time.Now())
+	assert.ErrorIs(t, err, ErrBlockAlreadyActive)
+
+	current, err := s.GetCurrentBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, block.Id, current.Id)
+
+	pause, err := s.StartPause(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, block.Id, pause.BlockID)
+	assert.Empty(t, pause.End)
+
+	_, err = s.StartPause(time.Now())
+	assert.ErrorIs(t, err, ErrPauseAlreadyActive)
+	_, err = s.EndBlock(time.Now())
+	assert.ErrorIs(t, err, ErrPauseNotEnded)
+
+	pause, err = s.EndPause(time.Now())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pause.End)
+
+	block, err = s.EndBlock(time.Now())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, block.End)
+	assert.Equal(t, 1, len(block.Pauses))
+
+	_, err = s.GetCurrentBlock()
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+}
+
+func testStoreDeleteCurrent(t *testing.T, s Store) {
+	block, err := s.StartBlock(false, time.Now())
+	assert.NoError(t, err)
+	pause, err := s.StartPause(time.Now())
+	assert.NoError(t, err)
+
+	n, err := s.DeletePause(pause.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = s.EndPause(time.Now())
+	assert.ErrorIs(t, err, ErrNoPauseActive)
+
+	n, err = s.DeleteBlock(block.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = s.GetCurrentBlock()
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+
+	_, err = s.StartBlock(false, time.Now())
+	assert.NoError(t, err)
+}
+
+func testStoreSettings(t *testing.T, s Store) {
+	settings, err := s.GetSettings("test@test.com")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultSettings(), settings)
+
+	err = s.UpdateSettings("test@test.com", models.Settings{Timezone: "Europe/Berlin"})
+	assert.NoError(t, err)
+	err = s.UpdateSettings("test@test.com", models.Settings{Timezone: "America/New_York"})
+	assert.NoError(t, err)
+
+	settings, err = s.GetSettings("test@test.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "America/New_York", settings.Timezone)
+
+	settings, err = s.GetSettings("other@test.com")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultSettings(), settings)
+
+	err = s.UpdateSettings("test@test.com", models.Settings{Timezone: "Mars/Olympus_Mons"})
+	assert.ErrorIs(t, err, ErrInvalidTimezone)
+	err = s.UpdateSettings("test@test.com", models.Settings{})
+	assert.ErrorIs(t, err, ErrInvalidTimezone)
+
+	targets := []int{0, 360, 360, 360, 360, 240, 0}
+	err = s.UpdateSettings("test@test.com", models.Settings{Timezone: "UTC", TargetMinutes: targets})
+	assert.NoError(t, err)
+	settings, err = s.GetSettings("test@test.com")
+	assert.NoError(t, err)
+	assert.Equal(t, targets, settings.TargetMinutes)
+	assert.Equal(t, 4*time.Hour, settings.Target(time.Friday))
+
+	for _, invalid := range [][]int{{480}, {0, 480, 480, 480, 480, 480, -1}, {0, 480, 480, 480, 480, 1441, 0}} {
+		err = s.UpdateSettings("test@test.com", models.Settings{Timezone: "UTC", TargetMinutes: invalid})
+		assert.ErrorIs(t, err, ErrInvalidTarget)
+	}
+}
+
+func testStoreSurcharges(t *testing.T, s Store) {
+	config, err := s.GetSurchargeConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultSurchargeConfig(), config)
+
+	config.Rules[0].Percent = 40
+	config.Holidays = []string{"2023-12-25"}
+	assert.NoError(t, s.UpdateSurchargeConfig(config))
+
+	updated, err := s.GetSurchargeConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, config, updated)
+
+	invalid := []models.SurchargeConfig{
+		{Rules: []models.SurchargeRule{{Category: ""}}},
+		{Rules: []models.SurchargeRule{{Category: models.RegularCategory}}},
+		{Rules: []models.SurchargeRule{{Category: "night"}, {Category: "night"}}},
+		{Rules: []models.SurchargeRule{{Category: "night", Percent: -1}}},
+		{Rules: []models.SurchargeRule{{Category: "night", Weekdays: []time.Weekday{7}}}},
+		{Rules: []models.SurchargeRule{{Category: "night", From: "20:00"}}},
+		{Rules: []models.SurchargeRule{{Category: "night", From: "25:00", To: "06:00"}}},
+		{Holidays: []string{"2023-13-01"}},
+	}
+	for _, c := range invalid {
+		err := s.UpdateSurchargeConfig(c)
+		assert.ErrorIs(t, err, ErrValidation)
+	}
+}
+
+func testStoreProject(t *testing.T, s Store) {
+	block, err := s.AddBlock(models.BlockCreate{
+		Start:    "2023-05-09T08:00:00Z",
+		End:      "2023-05-09T16:00:00Z",
+		Project:  "website",
+		Billable: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "website", block.Project)
+	assert.True(t, block.Billable)
+
+	block.Project = "app"
+	block.Billable = false
+	n, err := s.UpdateBlock(block)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	updated, err := s.GetBlockByID(block.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "app", updated.Project)
+	assert.False(t, updated.Billable)
+	assert.Equal(t, 0, updated.InvoiceID)
+}
+
+func testStoreFeed(t *testing.T, s Store) {
+	_, err := s.GetFeedSecret("test@test.com")
+	assert.ErrorIs(t, err, ErrFeedNotFound)
+
+	first, err := s.RegenerateFeedSecret("test@test.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 64, len(first))
+	secret, err := s.GetFeedSecret("test@test.com")
+	assert.NoError(t, err)
+	assert.Equal(t, first, secret)
+	email, err := s.GetFeedUser(first)
+	assert.NoError(t, err)
+	assert.Equal(t, "test@test.com", email)
+
+	second, err := s.RegenerateFeedSecret("test@test.com")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	_, err = s.GetFeedUser(first)
+	assert.ErrorIs(t, err, ErrFeedNotFound)
+	email, err = s.GetFeedUser(second)
+	assert.NoError(t, err)
+	assert.Equal(t, "test@test.com", email)
+}
+
+func testStoreImport(t *testing.T, s Store) {
+	existing, err := s.AddBlock(models.BlockCreate{Start: "2023-05-09T07:00:00Z", End: "2023-05-09T15:00:00Z"})
+	assert.NoError(t, err)
+
+	blocks := []models.BlockImport{
+		{UID: "a", Block: models.BlockCreate{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T15:00:00Z", Project: "Website"}},
+		{UID: "b", Block: models.BlockCreate{Start: "2023-05-09T14:00:00Z", End: "2023-05-09T18:00:00Z"}},
+		{UID: "c", Block: models.BlockCreate{Start: "2023-05-10T14:00:00Z", End: "2023-05-10T16:00:00Z"}},
+		{UID: "d", Block: models.BlockCreate{Start: "2023-05-11T16:00:00Z", End: "2023-05-11T16:00:00Z"}},
+		{UID: "a", Block: models.BlockCreate{Start: "2023-05-12T07:00:00Z", End: "2023-05-12T15:00:00Z"}},
+	}
+	statuses := func(report models.ImportReport) []string {
+		var statuses []string
+		for _, r := range report.Results {
+			statuses = append(statuses, r.Status)
+		}
+		return statuses
+	}
+
+	report, err := s.ImportBlocks(blocks, true)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{"created", "overlap", "overlap", "invalid", "duplicate"}, statuses(report))
+	assert.Equal(t, 0, report.Results[0].BlockID)
+	assert.Equal(t, existing.Id, report.Results[1].BlockID)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 4, report.Skipped)
+	all, err := s.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(all))
+
+	report, err = s.ImportBlocks(blocks, false)
+	assert.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Equal(t, []string{"created", "overlap", "overlap", "invalid", "duplicate"}, statuses(report))
+	created := report.Results[0].BlockID
+	assert.Equal(t, created, report.Results[2].BlockID)
+	assert.Equal(t, created, report.Results[4].BlockID)
+	block, err := s.GetBlockByID(created)
+	assert.NoError(t, err)
+	assert.Equal(t, "Website", block.Project)
+
+	report, err = s.ImportBlocks(blocks[:1], false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"duplicate"}, statuses(report))
+	all, err = s.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(all))
+
+	// The UIDs and blocks of other users do not count.
+	other := s.WithUser("other@example.com").WithOwner("other@example.com")
+	report, err = other.ImportBlocks(blocks[:2], false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"created", "created"}, statuses(report))
+	report, err = other.ImportBlocks(blocks[:1], false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"duplicate"}, statuses(report))
+	all, err = s.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(all))
+}
+
+func testStoreBackup(t *testing.T, s Store) {
+	_, err := s.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	_, err = s.ImportBlocks([]models.BlockImport{
+		{UID: "a", Block: models.BlockCreate{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T15:00:00Z", Project: "Website", Billable: true}},
+	}, false)
+	assert.NoError(t, err)
+	at := time.Date(2023, 5, 11, 8, 0, 0, 0, time.UTC)
+	_, err = s.StartBlock(true, at)
+	assert.NoError(t, err)
+	_, err = s.StartPause(at.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, s.UpdateSettings("b@example.com", models.Settings{Timezone: "Europe/Berlin"}))
+	assert.NoError(t, s.UpdateSettings("a@example.com", models.Settings{Timezone: "UTC", TargetMinutes: []int{0, 240, 240, 240, 240, 240, 0}}))
+	assert.NoError(t, s.UpdateSurchargeConfig(models.SurchargeConfig{Rules: []models.SurchargeRule{}, Holidays: []string{"2023-05-18"}}))
+
+	backup, err := s.ExportBackup()
+	assert.NoError(t, err)
+	assert.Equal(t, models.BackupVersion, backup.Version)
+	assert.Equal(t, 3, len(backup.Blocks))
+	assert.Equal(t, "a", backup.Blocks[1].ImportUID)
+	assert.Equal(t, models.BackupCurrents{{Email: "system", BlockID: 3, PauseID: 2}}, backup.Current)
+	assert.Equal(t, "a@example.com", backup.Settings[0].Email)
+	want, err := json.Marshal(backup)
+	assert.NoError(t, err)
+
+	roundTrip := func(s Store) {
+		t.Helper()
+		backup, err := s.ExportBackup()
+		assert.NoError(t, err)
+		data, err := json.Marshal(backup)
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(want), string(data))
+	}
+
+	// Both stores write the same document.
+	other := NewMemoryStore()
+	report, err := other.RestoreBackup(backup, RestoreReplace)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RestoreReport{Mode: "replace", Blocks: 3, Pauses: 2}, report)
+	roundTrip(other)
+
+	_, err = s.DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+	_, err = s.EndPause(at.Add(2 * time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, s.UpdateSettings("c@example.com", models.Settings{Timezone: "UTC"}))
+	_, err = s.RestoreBackup(backup, RestoreReplace)
+	assert.NoError(t, err)
+	roundTrip(s)
+
+	_, err = s.EndPause(at.Add(2 * time.Hour))
+	assert.NoError(t, err)
+	block, err := s.AddBlock(models.BlockCreate{Start: "2023-05-12T07:00:00Z", End: "2023-05-12T15:00:00Z"})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, block.Id)
+
+	merged := NewMemoryStore()
+	_, err = merged.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	report, err = merged.RestoreBackup(backup, RestoreMerge)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RestoreReport{Mode: "merge", Blocks: 1, Pauses: 0, Skipped: 2}, report)
+	current, err := merged.GetCurrentBlock()
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+	assert.Equal(t, 0, current.Id)
+	report, err = merged.RestoreBackup(backup, RestoreMerge)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Blocks)
+
+	invalid := []func(b *models.Backup){
+		func(b *models.Backup) { b.Version = 3 },
+		func(b *models.Backup) { b.Blocks[1].Id = b.Blocks[0].Id },
+		func(b *models.Backup) { b.Blocks[0].End = "" },
+		func(b *models.Backup) { b.Blocks[0].Pauses[0].Start = "yesterday" },
+		func(b *models.Backup) { b.Blocks[0].Pauses[0].BlockID = 2 },
+		func(b *models.Backup) { b.Current[0].BlockID = 1 },
+		func(b *models.Backup) { b.Current[0].PauseID = 1 },
+		func(b *models.Backup) { b.Current[0].Email = "a@example.com" },
+		func(b *models.Backup) { b.Current = append(b.Current, b.Current[0]) },
+		func(b *models.Backup) { b.Settings[0].Timezone = "Mars/Olympus" },
+		func(b *models.Backup) { b.Surcharges = &models.SurchargeConfig{Holidays: []string{"soon"}} },
+		func(b *models.Backup) { b.Blocks[1].InvoiceID = 1 },
+		func(b *models.Backup) {
+			b.Locks = []models.PeriodLock{{Id: 1, Start: "2023-06-01T00:00:00Z", End: "2023-05-01T00:00:00Z"}}
+		},
+	}
+	for _, change := range invalid {
+		var b models.Backup
+		assert.NoError(t, json.Unmarshal(want, &b))
+		change(&b)
+		_, err := other.RestoreBackup(b, RestoreReplace)
+		assert.ErrorIs(t, err, ErrValidation)
+	}
+	roundTrip(other)
+
+	// Version 1 documents have a single current block.
+	var doc map[string]any
+	assert.NoError(t, json.Unmarshal(want, &doc))
+	doc["version"] = 1
+	doc["current"] = map[string]any{"blockID": 3, "pauseID": 2}
+	data, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	var v1 models.Backup
+	assert.NoError(t, json.Unmarshal(data, &v1))
+	_, err = NewMemoryStore().RestoreBackup(v1, RestoreReplace)
+	assert.NoError(t, err)
+	roundTrip(other)
+
+	// Every user keeps their own current block.
+	started, err := other.WithUser("a@example.com").StartBlock(false, at)
+	assert.NoError(t, err)
+	backup, err = other.ExportBackup()
+	assert.NoError(t, err)
+	assert.Equal(t, models.BackupCurrents{
+		{Email: "a@example.com", BlockID: started.Id, PauseID: -1},
+		{Email: "system", BlockID: 3, PauseID: 2},
+	}, backup.Current)
+	restored := NewMemoryStore()
+	_, err = restored.RestoreBackup(backup, RestoreReplace)
+	assert.NoError(t, err)
+	current, err = restored.WithUser("a@example.com").GetCurrentBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, started.Id, current.Id)
+	current, err = restored.GetCurrentBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, current.Id)
+
+	// Blocks keep their creator, in both modes.
+	assert.Equal(t, "system", backup.Blocks[0].CreatedBy)
+	var owned models.Backup
+	assert.NoError(t, json.Unmarshal(want, &owned))
+	owned.Blocks[0].CreatedBy = "a@example.com"
+	_, err = s.RestoreBackup(owned, RestoreReplace)
+	assert.NoError(t, err)
+	blocks, err := s.GetUserBlocksInRange("a@example.com", TimeRange{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+	assert.Equal(t, owned.Blocks[0].Id, blocks[0].Id)
+	merged = NewMemoryStore()
+	_, err = merged.RestoreBackup(owned, RestoreMerge)
+	assert.NoError(t, err)
+	blocks, err = merged.GetUserBlocksInRange("a@example.com", TimeRange{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+
+	mode, err := ParseRestoreMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, RestoreReplace, mode)
+	_, err = ParseRestoreMode("append")
+	assert.ErrorIs(t, err, ErrInvalidRestoreMode)
+}
+
+func testStoreAudit(t *testing.T, s Store) {
+	_, err := s.GetBlockHistory(utils.BID)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+
+	_, err = s.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	user := s.WithUser("a@example.com")
+	_, err = user.UpdateBlockHomeoffice(utils.BID, true)
+	assert.NoError(t, err)
+	_, err = user.UpdatePauseEnd(utils.PID, utils.PEndUpdated)
+	assert.NoError(t, err)
+	_, err = user.DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+
+	history, err := s.GetBlockHistory(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(history))
+
+	create := history[0]
+	assert.Equal(t, SystemUser, create.User)
+	assert.Equal(t, EntityBlock, create.Entity)
+	assert.Equal(t, OpCreate, create.Operation)
+	assert.Nil(t, create.Before)
+	var block models.Block
+	assert.NoError(t, json.Unmarshal(create.After, &block))
+	utils.AssertTestBlock(t, block)
+	assert.Equal(t, 1, len(block.Pauses))
+
+	homeoffice := history[1]
+	assert.Equal(t, "a@example.com", homeoffice.User)
+	assert.Equal(t, OpUpdate, homeoffice.Operation)
+	assert.NoError(t, json.Unmarshal(homeoffice.Before, &block))
+	assert.False(t, block.Homeoffice)
+	assert.NoError(t, json.Unmarshal(homeoffice.After, &block))
+	assert.True(t, block.Homeoffice)
+
+	pause := history[2]
+	assert.Equal(t, EntityPause, pause.Entity)
+	assert.Equal(t, "1", pause.EntityID)
+	assert.Equal(t, utils.BID, pause.BlockID)
+	var p models.Pause
+	assert.NoError(t, json.Unmarshal(pause.After, &p))
+	assert.Equal(t, utils.PEndUpdated, p.End)
+
+	deleted := history[3]
+	assert.Equal(t, OpDelete, deleted.Operation)
+	assert.NotNil(t, deleted.Before)
+	assert.Nil(t, deleted.After)
+	for i, e := range history {
+		assert.Equal(t, history[0].Id+i, e.Id)
+		_, err := time.Parse(time.RFC3339, e.Timestamp)
+		assert.NoError(t, err)
+	}
+}
+
+func testStoreAuditChain(t *testing.T, s Store) {
+	v, err := s.VerifyAuditChain()
+	assert.NoError(t, err)
+	assert.Equal(t, models.AuditVerification{Valid: true}, v)
+
+	_, err = s.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	_, err = s.UpdateBlockHomeoffice(utils.BID, true)
+	assert.NoError(t, err)
+	assert.NoError(t, s.UpdateSettings("a@example.com", models.Settings{Timezone: "UTC"}))
+
+	v, err = s.VerifyAuditChain()
+	assert.NoError(t, err)
+	assert.True(t, v.Valid)
+	assert.Equal(t, 3, v.Entries)
+
+	history, err := s.GetBlockHistory(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, "", history[0].PrevHash)
+	assert.Equal(t, history[0].Hash, history[1].PrevHash)
+	assert.Equal(t, 64, len(history[1].Hash))
+
+	now := time.Now()
+	d, err := s.AuditDigest(now.Add(-time.Hour), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, d.Entries)
+	assert.Equal(t, history[0].Id, d.FirstID)
+	assert.Equal(t, "", d.PrevHash)
+	assert.Equal(t, v.Head, d.Hash)
+
+	d, err = s.AuditDigest(now.Add(time.Hour), now.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, d.Entries)
+	assert.Equal(t, v.Head, d.PrevHash)
+	assert.Equal(t, v.Head, d.Hash)
+}
+
+func testStoreLocks(t *testing.T, s Store) {
+	may := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	june := may.AddDate(0, 1, 0)
+	_, err := s.AddLock(june, may, "")
+	assert.ErrorIs(t, err, ErrInvalidLock)
+
+	_, err = s.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	april, err := s.AddBlock(models.BlockCreate{Start: "2023-04-30T20:00:00Z", End: "2023-05-01T00:00:00Z"})
+	assert.NoError(t, err)
+	backup, err := s.ExportBackup()
+	assert.NoError(t, err)
+
+	// A lock of a user leaves the blocks of others alone.
+	own, err := s.WithUser("a@example.com").AddLock(may, june, "a@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "a@example.com", own.Owner)
+	_, err = s.WithUser("a@example.com").AddBlock(models.BlockCreate{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T15:00:00Z"})
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+	_, err = s.WithUser("b@example.com").AddBlock(models.BlockCreate{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T15:00:00Z"})
+	assert.NoError(t, err)
+	_, err = s.UpdateBlockHomeoffice(utils.BID, true)
+	assert.NoError(t, err)
+	_, err = s.UpdateBlockHomeoffice(utils.BID, false)
+	assert.NoError(t, err)
+	rowsAffected, err := s.DeleteLock(own.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rowsAffected)
+
+	lock, err := s.WithUser("a@example.com").AddLock(may, june, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-05-01T00:00:00Z", lock.Start)
+	assert.Equal(t, "a@example.com", lock.LockedBy)
+	locks, err := s.GetLocks()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.PeriodLock{lock}, locks)
+
+	_, err = s.AddBlock(models.BlockCreate{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T15:00:00Z"})
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+	_, err = s.UpdateBlockHomeoffice(utils.BID, true)
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+	_, err = s.UpdatePauseEnd(utils.PID, utils.PEndUpdated)
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+	_, err = s.AddPause(models.PauseCreate{Start: utils.PStartUpdated, End: utils.PEndUpdated, BlockID: utils.BID})
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+	_, err = s.DeletePause(utils.PID)
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+	_, err = s.DeleteBlock(utils.BID)
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+	_, err = s.StartBlock(false, may.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+	_, err = s.RestoreBackup(backup, RestoreReplace)
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+
+	// a block ending where the lock starts is not locked, moving it into
+	// the locked period is
+	_, err = s.UpdateBlockHomeoffice(april.Id, true)
+	assert.NoError(t, err)
+	_, err = s.UpdateBlockEnd(april.Id, "2023-05-01T01:00:00Z")
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+
+	report, err := s.ImportBlocks([]models.BlockImport{
+		{UID: "a", Block: models.BlockCreate{Start: "2023-05-20T07:00:00Z", End: "2023-05-20T15:00:00Z"}},
+		{UID: "b", Block: models.BlockCreate{Start: "2023-06-20T07:00:00Z", End: "2023-06-20T15:00:00Z"}},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportLocked, report.Results[0].Status)
+	assert.Equal(t, models.ImportCreated, report.Results[1].Status)
+
+	block, err := s.GetBlockByID(utils.BID)
+	assert.NoError(t, err)
+	utils.AssertTestBlock(t, block)
+	assert.Equal(t, 1, len(block.Pauses))
+	utils.AssertTestPause(t, block.Pauses[0])
+
+	before, err := s.VerifyAuditChain()
+	assert.NoError(t, err)
+	rowsAffected, err = s.DeleteLock(lock.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rowsAffected)
+	after, err := s.VerifyAuditChain()
+	assert.NoError(t, err)
+	assert.Equal(t, before.Entries+1, after.Entries)
+	rowsAffected, err = s.DeleteLock(lock.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rowsAffected)
+	_, err = s.UpdateBlockHomeoffice(utils.BID, true)
+	assert.NoError(t, err)
+}
+
+func testStoreTrash(t *testing.T, s Store) {
+	_, err := s.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	trash, err := s.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.TrashItem{}, trash)
+
+	rowsAffected, err := s.DeletePause(utils.PID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rowsAffected)
+	_, err = s.GetPauseByID(utils.PID)
+	assert.ErrorIs(t, err, ErrPauseNotFound)
+	rowsAffected, err = s.UpdatePauseEnd(utils.PID, utils.PEndUpdated)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rowsAffected)
+	trash, err = s.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(trash))
+	assert.Equal(t, models.TrashPause, trash[0].Type)
+	assert.Equal(t, utils.PID, trash[0].Id)
+	assert.NotEqual(t, "", trash[0].DeletedAt)
+	utils.AssertTestPause(t, *trash[0].Pause)
+
+	pause, err := s.RestorePause(utils.PID)
+	assert.NoError(t, err)
+	utils.AssertTestPause(t, pause)
+	_, err = s.RestorePause(utils.PID)
+	assert.ErrorIs(t, err, ErrTrashItemNotFound)
+	block, err := s.GetBlockByID(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(block.Pauses))
+
+	// a deleted block keeps its pauses, a pause deleted before is listed
+	// again once the block is restored
+	_, err = s.AddPause(models.PauseCreate{Start: utils.PStartUpdated, End: utils.PEndUpdated, BlockID: utils.BID})
+	assert.NoError(t, err)
+	_, err = s.DeletePause(utils.PID)
+	assert.NoError(t, err)
+	rowsAffected, err = s.DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rowsAffected)
+	rowsAffected, err = s.DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rowsAffected)
+	blocks, err := s.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(blocks))
+	_, err = s.GetBlockByID(utils.BID)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+	_, err = s.AddPause(utils.TestPauseCreate())
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+	_, err = s.RestorePause(utils.PID)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+	trash, err = s.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(trash))
+	assert.Equal(t, models.TrashBlock, trash[0].Type)
+	assert.Equal(t, 1, len(trash[0].Block.Pauses))
+	assert.Equal(t, utils.PStartUpdated, trash[0].Block.Pauses[0].Start)
+
+	block, err = s.RestoreBlock(utils.BID)
+	assert.NoError(t, err)
+	utils.AssertTestBlock(t, block)
+	assert.Equal(t, 1, len(block.Pauses))
+	history, err := s.GetBlockHistory(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, OpRestore, history[len(history)-1].Operation)
+	trash, err = s.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(trash))
+	assert.Equal(t, models.TrashPause, trash[0].Type)
+
+	// a deleted block gives up its import UID
+	imported := []models.BlockImport{
+		{UID: "a", Block: models.BlockCreate{Start: "2023-06-20T07:00:00Z", End: "2023-06-20T15:00:00Z"}},
+	}
+	report, err := s.ImportBlocks(imported, false)
+	assert.NoError(t, err)
+	_, err = s.DeleteBlock(report.Results[0].BlockID)
+	assert.NoError(t, err)
+	report, err = s.ImportBlocks(imported, false)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportCreated, report.Results[0].Status)
+
+	_, err = s.DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+	purged, err := s.PurgeTrash(time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, purged)
+	purged, err = s.PurgeTrash(time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, purged)
+	trash, err = s.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.TrashItem{}, trash)
+	_, err = s.RestoreBlock(utils.BID)
+	assert.ErrorIs(t, err, ErrTrashItemNotFound)
+	history, err = s.GetBlockHistory(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, OpPurge, history[len(history)-1].Operation)
+
+	// replacing restores purge the trash, since backups do not include it
+	block, err = s.AddBlock(models.BlockCreate{Start: "2023-06-21T07:00:00Z", End: "2023-06-21T15:00:00Z"})
+	assert.NoError(t, err)
+	_, err = s.DeleteBlock(block.Id)
+	assert.NoError(t, err)
+	backup, err := s.ExportBackup()
+	assert.NoError(t, err)
+	_, err = s.RestoreBackup(backup, RestoreReplace)
+	assert.NoError(t, err)
+	trash, err = s.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.TrashItem{}, trash)
+	history, err = s.GetBlockHistory(block.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, OpPurge, history[len(history)-1].Operation)
+	verification, err := s.VerifyAuditChain()
+	assert.NoError(t, err)
+	assert.True(t, verification.Valid)
+}
+
+func testStoreOwner(t *testing.T, s Store) {
+	a := s.WithOwner("a@example.com")
+	b := s.WithOwner("b@example.com")
+	_, err := a.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+
+	_, err = b.GetBlockByID(utils.BID)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+	_, err = b.GetPauseByID(utils.PID)
+	assert.ErrorIs(t, err, ErrPauseNotFound)
+	_, err = b.GetBlockHistory(utils.BID)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+	blocks, err := b.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(blocks))
+	pauses, err := b.GetPausesByBlockID(utils.BID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(pauses))
+	_, err = b.AddPause(utils.TestPauseCreate())
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+	for _, update := range []func() (int, error){
+		func() (int, error) { return b.UpdateBlockHomeoffice(utils.BID, true) },
+		func() (int, error) { return b.UpdatePauseEnd(utils.PID, utils.PEndUpdated) },
+		func() (int, error) { return b.DeletePause(utils.PID) },
+		func() (int, error) { return b.DeleteBlock(utils.BID) },
+	} {
+		rowsAffected, err := update()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, rowsAffected)
+	}
+	block, err := a.GetBlockByID(utils.BID)
+	assert.NoError(t, err)
+	utils.AssertTestBlock(t, block)
+
+	_, err = a.DeletePause(utils.PID)
+	assert.NoError(t, err)
+	_, err = a.DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+	trash, err := b.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.TrashItem{}, trash)
+	_, err = b.RestoreBlock(utils.BID)
+	assert.ErrorIs(t, err, ErrTrashItemNotFound)
+	trash, err = a.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(trash))
+	_, err = a.RestoreBlock(utils.BID)
+	assert.NoError(t, err)
+	_, err = b.RestorePause(utils.PID)
+	assert.ErrorIs(t, err, ErrTrashItemNotFound)
+	_, err = a.RestorePause(utils.PID)
+	assert.NoError(t, err)
+
+	// views without an owner see the blocks of all users
+	blocks, err = s.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+}
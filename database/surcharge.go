@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+func invalidSurcharges(format string, args ...any) error {
+	return NewValidationError("invalid_surcharges", fmt.Sprintf(format, args...))
+}
+
+func validateSurchargeConfig(config models.SurchargeConfig) error {
+	categories := make(map[string]bool)
+	for _, rule := range config.Rules {
+		if rule.Category == "" || rule.Category == models.RegularCategory {
+			return invalidSurcharges("category must not be empty or %q", models.RegularCategory)
+		}
+		if categories[rule.Category] {
+			return invalidSurcharges("duplicate category %q", rule.Category)
+		}
+		categories[rule.Category] = true
+
+		if rule.Percent < 0 {
+			return invalidSurcharges("percent of %q must not be negative", rule.Category)
+		}
+		for _, day := range rule.Weekdays {
+			if day < time.Sunday || day > time.Saturday {
+				return invalidSurcharges("invalid weekday %d in %q", day, rule.Category)
+			}
+		}
+		if _, _, _, err := rule.Window(); err != nil {
+			return invalidSurcharges("from and to of %q must both be given as 15:04", rule.Category)
+		}
+	}
+
+	for _, holiday := range config.Holidays {
+		if _, err := time.Parse(time.DateOnly, holiday); err != nil {
+			return invalidSurcharges("invalid holiday %q", holiday)
+		}
+	}
+	return nil
+}
+
+// GetSurchargeConfig returns the surcharge rules and holidays, or the default
+// configuration if none has been saved.
+func (db *DB) GetSurchargeConfig() (models.SurchargeConfig, error) {
+	q := `
+  SELECT config FROM surcharge_config
+  WHERE id = 1
+  `
+	var data string
+	if err := db.queryRow(q).Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DefaultSurchargeConfig(), nil
+		}
+		return models.SurchargeConfig{}, err
+	}
+
+	var config models.SurchargeConfig
+	err := json.Unmarshal([]byte(data), &config)
+	return config, err
+}
+
+func (db *DB) UpdateSurchargeConfig(config models.SurchargeConfig) error {
+	if err := validateSurchargeConfig(config); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return db.transaction(func(tx *DB) error {
+		before, err := tx.GetSurchargeConfig()
+		if err != nil {
+			return err
+		}
+
+		q := `
+    INSERT INTO surcharge_config (id, config)
+    VALUES (1, ?)
+    ON CONFLICT (id) DO UPDATE SET config = excluded.config
+    `
+		if _, err := tx.exec(q, string(data)); err != nil {
+			return err
+		}
+		return tx.audit(EntitySurcharges, "", 0, OpUpdate, before, config)
+	})
+}
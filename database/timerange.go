@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type RangeMode string
+
+const (
+	// RangeContained selects the blocks that lie completely within a range.
+	// Running blocks are only contained in ranges without an end.
+	RangeContained RangeMode = "contained"
+	// RangeOverlapping selects the blocks that overlap a range. Running
+	// blocks extend indefinitely.
+	RangeOverlapping RangeMode = "overlapping"
+)
+
+// TimeRange is the half-open interval [Start, End). A zero Start or End
+// leaves that side of the range unbounded. Blocks are compared by their
+// instants, so the offsets they were recorded with do not matter.
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+	Mode  RangeMode
+}
+
+// ParseTimeRange parses optional RFC3339 bounds and a mode, which defaults to
+// RangeContained.
+func ParseTimeRange(start, end, mode string) (TimeRange, error) {
+	var r TimeRange
+	var err error
+	if start != "" {
+		if r.Start, err = time.Parse(time.RFC3339, start); err != nil {
+			return r, ErrInvalidStart
+		}
+	}
+	if end != "" {
+		if r.End, err = time.Parse(time.RFC3339, end); err != nil {
+			return r, ErrInvalidEnd
+		}
+	}
+
+	switch RangeMode(mode) {
+	case "", RangeContained:
+		r.Mode = RangeContained
+	case RangeOverlapping:
+		r.Mode = RangeOverlapping
+	default:
+		return r, ErrInvalidRangeMode
+	}
+
+	return r, nil
+}
+
+// matches reports whether a block with the given start and end matches the
+// range. end is zero for running blocks.
+func (r TimeRange) matches(start, end time.Time) bool {
+	if r.Mode == RangeOverlapping {
+		if !r.End.IsZero() && !start.Before(r.End) {
+			return false
+		}
+		return r.Start.IsZero() || end.IsZero() || end.After(r.Start)
+	}
+
+	if !r.Start.IsZero() && start.Before(r.Start) {
+		return false
+	}
+	return r.End.IsZero() || (!end.IsZero() && !end.After(r.End))
+}
+
+// where joins conditions to a WHERE clause, which is empty without any.
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+func (r TimeRange) conditions() ([]string, []any) {
+	var conditions []string
+	var args []any
+	if r.Mode == RangeOverlapping {
+		if !r.End.IsZero() {
+			conditions = append(conditions, "block.start_unix < ?")
+			args = append(args, r.End.Unix())
+		}
+		if !r.Start.IsZero() {
+			conditions = append(conditions, "(block.end_unix IS NULL OR block.end_unix > ?)")
+			args = append(args, r.Start.Unix())
+		}
+	} else {
+		if !r.Start.IsZero() {
+			conditions = append(conditions, "block.start_unix >= ?")
+			args = append(args, r.Start.Unix())
+		}
+		if !r.End.IsZero() {
+			conditions = append(conditions, "block.end_unix <= ?")
+			args = append(args, r.End.Unix())
+		}
+	}
+
+	return conditions, args
+}
+
+// unixSeconds returns the instant of an RFC3339 timestamp as stored in the
+// *_unix columns, or NULL for an empty or invalid timestamp.
+func unixSeconds(value string) sql.NullInt64 {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
@@ -0,0 +1,370 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// sortTrash orders the items by deletion, newest first.
+func sortTrash(items []models.TrashItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].DeletedAt != items[j].DeletedAt {
+			return items[i].DeletedAt > items[j].DeletedAt
+		}
+		if items[i].Type != items[j].Type {
+			return items[i].Type < items[j].Type
+		}
+		return items[i].Id > items[j].Id
+	})
+}
+
+func deletedAt(at time.Time) string {
+	return at.UTC().Format(time.RFC3339)
+}
+
+// GetTrash lists the deleted blocks with their pauses and the deleted pauses
+// of blocks that still exist. DeleteBlock and DeletePause only set
+// deleted_at, so that both can be restored until they are purged.
+func (db *DB) GetTrash() ([]models.TrashItem, error) {
+	items := []models.TrashItem{}
+	err := db.transaction(func(tx *DB) error {
+		owned, args := tx.andOwned()
+		q := `
+    SELECT id, deleted_at FROM block
+    WHERE deleted_at IS NOT NULL` + owned
+		rows, err := tx.query(q, args...)
+		if err != nil {
+			return err
+		}
+		deleted := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var at string
+			if err := rows.Scan(&id, &at); err != nil {
+				rows.Close()
+				return err
+			}
+			deleted[id] = at
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		blocks, err := tx.queryBlocks("WHERE block.deleted_at IS NOT NULL"+owned, args...)
+		if err != nil {
+			return err
+		}
+		for i := range blocks {
+			items = append(items, models.TrashItem{
+				Type:      models.TrashBlock,
+				Id:        blocks[i].Id,
+				DeletedAt: deleted[blocks[i].Id],
+				Block:     &blocks[i],
+			})
+		}
+
+		pauses, err := tx.deletedPauses("block.deleted_at IS NULL")
+		if err != nil {
+			return err
+		}
+		items = append(items, pauses...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortTrash(items)
+	return items, nil
+}
+
+// deletedPauses returns the deleted pauses matching the condition on pause
+// and block as trash items.
+func (db *DB) deletedPauses(condition string, args ...any) ([]models.TrashItem, error) {
+	owned, ownerArgs := db.andOwned()
+	q := `
+  SELECT pause.id, pause.start, pause."end", pause.block_id, pause.deleted_at FROM pause
+  JOIN block ON block.id = pause.block_id
+  WHERE pause.deleted_at IS NOT NULL AND ` + condition + owned + `
+  ORDER BY pause.id
+  `
+	rows, err := db.query(q, append(args, ownerArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.TrashItem
+	for rows.Next() {
+		var p models.Pause
+		var at string
+		if err := rows.Scan(&p.Id, &p.Start, &p.End, &p.BlockID, &at); err != nil {
+			return nil, err
+		}
+		items = append(items, models.TrashItem{Type: models.TrashPause, Id: p.Id, DeletedAt: at, Pause: &p})
+	}
+	return items, rows.Err()
+}
+
+// RestoreBlock brings a deleted block back together with its pauses. It
+// fails with ErrTrashItemNotFound if the block is not in the trash.
+func (db *DB) RestoreBlock(id int) (models.Block, error) {
+	var block models.Block
+	err := db.transaction(func(tx *DB) error {
+		owned, args := tx.andOwned()
+		q := `
+    UPDATE block
+    SET deleted_at = NULL
+    WHERE id = ? AND deleted_at IS NOT NULL` + owned
+		result, err := tx.exec(q, append([]any{id}, args...)...)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrTrashItemNotFound
+		}
+
+		if block, err = tx.GetBlockByID(id); err != nil {
+			return err
+		}
+		return tx.auditBlock(OpRestore, id, nil, &block)
+	})
+	if err != nil {
+		return models.Block{}, err
+	}
+	return block, nil
+}
+
+// RestorePause brings a deleted pause back. It fails with
+// ErrTrashItemNotFound if the pause is not in the trash and with
+// ErrBlockNotFound if its block has been deleted.
+func (db *DB) RestorePause(id int) (models.Pause, error) {
+	var pause models.Pause
+	err := db.transaction(func(tx *DB) error {
+		owned, args := tx.andOwned()
+		q := `
+    SELECT pause.block_id, block.deleted_at FROM pause
+    JOIN block ON block.id = pause.block_id
+    WHERE pause.id = ? AND pause.deleted_at IS NOT NULL` + owned
+		var blockID int
+		var blockDeletedAt sql.NullString
+		if err := tx.queryRow(q, append([]any{id}, args...)...).Scan(&blockID, &blockDeletedAt); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrTrashItemNotFound
+			}
+			return err
+		}
+		if blockDeletedAt.Valid {
+			return ErrBlockNotFound
+		}
+		if err := tx.checkBlockEditable(blockID); err != nil {
+			return err
+		}
+
+		q = `
+    UPDATE pause
+    SET deleted_at = NULL
+    WHERE id = ?
+    `
+		if _, err := tx.exec(q, id); err != nil {
+			return err
+		}
+
+		var err error
+		if pause, err = tx.GetPauseByID(id); err != nil {
+			return err
+		}
+		return tx.auditPause(OpRestore, id, blockID, nil, &pause)
+	})
+	if err != nil {
+		return models.Pause{}, err
+	}
+	return pause, nil
+}
+
+// PurgeTrash permanently deletes the blocks and pauses deleted before the
+// given time and returns the number of purged trash items. Purging ignores
+// locks, since the purged items are no longer part of any period.
+func (db *DB) PurgeTrash(before time.Time) (int, error) {
+	cutoff := deletedAt(before)
+	purged := 0
+	err := db.transaction(func(tx *DB) error {
+		pauses, err := tx.deletedPauses("pause.deleted_at < ?", cutoff)
+		if err != nil {
+			return err
+		}
+		for _, item := range pauses {
+			if _, err := tx.exec(`DELETE FROM pause WHERE id = ?`, item.Id); err != nil {
+				return err
+			}
+			if err := tx.audit(EntityPause, strconv.Itoa(item.Id), item.Pause.BlockID, OpPurge, item.Pause, nil); err != nil {
+				return err
+			}
+			purged++
+		}
+
+		blocks, err := tx.queryBlocks("WHERE block.deleted_at IS NOT NULL AND block.deleted_at < ?", cutoff)
+		if err != nil {
+			return err
+		}
+		for i, b := range blocks {
+			if _, err := tx.exec(`DELETE FROM pause WHERE block_id = ?`, b.Id); err != nil {
+				return err
+			}
+			if _, err := tx.exec(`DELETE FROM block WHERE id = ?`, b.Id); err != nil {
+				return err
+			}
+			if err := tx.audit(EntityBlock, strconv.Itoa(b.Id), b.Id, OpPurge, &blocks[i], nil); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+type memoryTrashBlock struct {
+	block     memoryBlock
+	pauses    []models.Pause
+	deletedAt string
+}
+
+func (t memoryTrashBlock) toBlock(id int) models.Block {
+	return models.Block{
+		Id:         id,
+		Start:      t.block.start,
+		End:        t.block.end,
+		Homeoffice: t.block.homeoffice,
+		Project:    t.block.project,
+		Billable:   t.block.billable,
+		Pauses:     t.pauses,
+	}
+}
+
+type memoryTrashPause struct {
+	pause     models.Pause
+	deletedAt string
+}
+
+func (m *MemoryStore) GetTrash() ([]models.TrashItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.trashItems(), nil
+}
+
+// trashItems is GetTrash. m.mu must be held.
+func (m *MemoryStore) trashItems() []models.TrashItem {
+	items := []models.TrashItem{}
+	for id, t := range m.trashBlocks {
+		if !m.owns(t.block) {
+			continue
+		}
+		b := t.toBlock(id)
+		items = append(items, models.TrashItem{Type: models.TrashBlock, Id: id, DeletedAt: t.deletedAt, Block: &b})
+	}
+	for id, t := range m.trashPauses {
+		if b, ok := m.blocks[t.pause.BlockID]; !ok || !m.owns(b) {
+			continue
+		}
+		p := t.pause
+		items = append(items, models.TrashItem{Type: models.TrashPause, Id: id, DeletedAt: t.deletedAt, Pause: &p})
+	}
+	sortTrash(items)
+	return items
+}
+
+func (m *MemoryStore) RestoreBlock(id int) (models.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.trashBlocks[id]
+	if !ok || !m.owns(t.block) {
+		return models.Block{}, ErrTrashItemNotFound
+	}
+	block := t.toBlock(id)
+	if err := m.checkUnlocked(t.block.createdBy, blockSpans(&block)...); err != nil {
+		return models.Block{}, err
+	}
+
+	delete(m.trashBlocks, id)
+	m.blocks[id] = t.block
+	for _, p := range t.pauses {
+		m.pauses[p.Id] = p
+	}
+	m.auditBlock(OpRestore, id, nil, &block)
+	return block, nil
+}
+
+func (m *MemoryStore) RestorePause(id int) (models.Pause, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.trashPauses[id]
+	if !ok {
+		return models.Pause{}, ErrTrashItemNotFound
+	}
+	if b, ok := m.blocks[t.pause.BlockID]; !ok || !m.owns(b) {
+		if trashed, ok := m.trashBlocks[t.pause.BlockID]; !ok || !m.owns(trashed.block) {
+			return models.Pause{}, ErrTrashItemNotFound
+		}
+		return models.Pause{}, ErrBlockNotFound
+	}
+	if err := m.checkUnlocked(m.blocks[t.pause.BlockID].createdBy, pauseSpans(&t.pause)...); err != nil {
+		return models.Pause{}, err
+	}
+
+	delete(m.trashPauses, id)
+	m.pauses[id] = t.pause
+	m.auditPause(OpRestore, id, t.pause.BlockID, nil, &t.pause)
+	return t.pause, nil
+}
+
+func (m *MemoryStore) PurgeTrash(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := deletedAt(before)
+	var pauseIDs, blockIDs []int
+	for id, t := range m.trashPauses {
+		if t.deletedAt < cutoff {
+			pauseIDs = append(pauseIDs, id)
+		}
+	}
+	for id, t := range m.trashBlocks {
+		if t.deletedAt < cutoff {
+			blockIDs = append(blockIDs, id)
+		}
+	}
+	sort.Ints(pauseIDs)
+	sort.Ints(blockIDs)
+
+	for _, id := range pauseIDs {
+		p := m.trashPauses[id].pause
+		delete(m.trashPauses, id)
+		m.audit(EntityPause, strconv.Itoa(id), p.BlockID, OpPurge, &p, nil)
+	}
+	for _, id := range blockIDs {
+		b := m.trashBlocks[id].toBlock(id)
+		delete(m.trashBlocks, id)
+		for pauseID, t := range m.trashPauses {
+			if t.pause.BlockID == id {
+				delete(m.trashPauses, pauseID)
+			}
+		}
+		m.audit(EntityBlock, strconv.Itoa(id), id, OpPurge, &b, nil)
+	}
+	return len(pauseIDs) + len(blockIDs), nil
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// AddUser adds a login account. The password hash is not recorded in the
+// audit log.
+func (db *DB) AddUser(email string, hash string) (models.User, error) {
+	var newUser models.User
+	err := db.transaction(func(tx *DB) error {
+		q := `
+    INSERT INTO account (email, pw_hash)
+    VALUES (?, ?)
+    `
+		id, err := tx.insert(q, email, hash)
+		if err != nil {
+			return err
+		}
+
+		newUser = models.User{Id: id, Email: email, Role: models.RoleEmployee}
+		return tx.audit(EntityUser, email, 0, OpCreate, nil, newUser)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return newUser, nil
+}
+
+func (db *DB) GetAllUsers() ([]models.User, error) {
+	q := `
+  SELECT id, email, disabled, role FROM account
+  ORDER BY id
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.Id, &u.Email, &u.Disabled, &u.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// GetUserCredentials returns the user with the given email together with its
+// password hash.
+func (db *DB) GetUserCredentials(email string) (models.User, string, error) {
+	q := `
+  SELECT id, email, disabled, role, pw_hash FROM account
+  WHERE email = ?
+  `
+	var u models.User
+	var hash string
+	row := db.queryRow(q, email)
+	if err := row.Scan(&u.Id, &u.Email, &u.Disabled, &u.Role, &hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return u, "", ErrUserNotFound
+		}
+		return u, "", err
+	}
+	return u, hash, nil
+}
+
+func (db *DB) SetUserDisabled(email string, disabled bool) (int, error) {
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		before, _, err := tx.GetUserCredentials(email)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		q := `
+    UPDATE account
+    SET disabled = ?
+    WHERE email = ?
+    `
+		result, err := tx.exec(q, disabled, email)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		after := before
+		after.Disabled = disabled
+		return tx.audit(EntityUser, email, 0, OpUpdate, before, after)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
@@ -0,0 +1,496 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/report"
+)
+
+func validRole(role string) bool {
+	switch role {
+	case models.RoleEmployee, models.RoleManager, models.RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// emailFilter returns a condition on column that matches the given emails,
+// or every email if emails is nil.
+func emailFilter(column string, emails []string) (string, []any) {
+	if emails == nil {
+		return "1 = 1", nil
+	}
+	if len(emails) == 0 {
+		return "1 = 0", nil
+	}
+	args := make([]any, len(emails))
+	for i, email := range emails {
+		args[i] = email
+	}
+	return column + " IN (?" + strings.Repeat(", ?", len(emails)-1) + ")", args
+}
+
+func (db *DB) SetUserRole(email string, role string) (int, error) {
+	if !validRole(role) {
+		return 0, ErrInvalidRole
+	}
+
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		before, _, err := tx.GetUserCredentials(email)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		q := `
+    UPDATE account
+    SET role = ?
+    WHERE email = ?
+    `
+		result, err := tx.exec(q, role, email)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		after := before
+		after.Role = role
+		return tx.audit(EntityUser, email, 0, OpUpdate, before, after)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(rowsAffected), nil
+}
+
+// GetTeams returns all teams ordered by name, each with its members ordered
+// by email.
+func (db *DB) GetTeams() ([]models.Team, error) {
+	q := `
+  SELECT id, name FROM team
+  ORDER BY name
+  `
+	rows, err := db.query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []models.Team{}
+	for rows.Next() {
+		t := models.Team{Members: []string{}}
+		if err := rows.Scan(&t.Id, &t.Name); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range teams {
+		if teams[i].Members, err = db.teamMembers(teams[i].Id); err != nil {
+			return nil, err
+		}
+	}
+	return teams, nil
+}
+
+func (db *DB) GetTeam(id int) (models.Team, error) {
+	q := `
+  SELECT id, name FROM team
+  WHERE id = ?
+  `
+	var t models.Team
+	err := db.queryRow(q, id).Scan(&t.Id, &t.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ErrTeamNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+	t.Members, err = db.teamMembers(id)
+	return t, err
+}
+
+func (db *DB) teamMembers(teamID int) ([]string, error) {
+	q := `
+  SELECT email FROM team_member
+  WHERE team_id = ?
+  ORDER BY email
+  `
+	rows, err := db.query(q, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		members = append(members, email)
+	}
+	return members, rows.Err()
+}
+
+func (db *DB) AddTeam(name string) (models.Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return models.Team{}, ErrInvalidTeam
+	}
+
+	var team models.Team
+	err := db.transaction(func(tx *DB) error {
+		q := `
+    SELECT COUNT(*) FROM team
+    WHERE name = ?
+    `
+		var count int
+		if err := tx.queryRow(q, name).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrTeamExists
+		}
+
+		q = `
+    INSERT INTO team (name)
+    VALUES (?)
+    `
+		id, err := tx.insert(q, name)
+		if err != nil {
+			return err
+		}
+
+		team = models.Team{Id: id, Name: name, Members: []string{}}
+		return tx.audit(EntityTeam, strconv.Itoa(id), 0, OpCreate, nil, team)
+	})
+	if err != nil {
+		return models.Team{}, err
+	}
+	return team, nil
+}
+
+// AddTeamMember adds the user with the given email to a team. Adding a
+// member twice does nothing.
+func (db *DB) AddTeamMember(teamID int, email string) error {
+	return db.transaction(func(tx *DB) error {
+		before, err := tx.GetTeam(teamID)
+		if err != nil {
+			return err
+		}
+		if _, _, err := tx.GetUserCredentials(email); err != nil {
+			return err
+		}
+		for _, member := range before.Members {
+			if member == email {
+				return nil
+			}
+		}
+
+		q := `
+    INSERT INTO team_member (team_id, email)
+    VALUES (?, ?)
+    `
+		if _, err := tx.exec(q, teamID, email); err != nil {
+			return err
+		}
+
+		after, err := tx.GetTeam(teamID)
+		if err != nil {
+			return err
+		}
+		return tx.audit(EntityTeam, strconv.Itoa(teamID), 0, OpUpdate, before, after)
+	})
+}
+
+func (db *DB) RemoveTeamMember(teamID int, email string) (int, error) {
+	var rowsAffected int64
+	err := db.transaction(func(tx *DB) error {
+		before, err := tx.GetTeam(teamID)
+		if err != nil {
+			return err
+		}
+
+		q := `
+    DELETE FROM team_member
+    WHERE team_id = ? AND email = ?
+    `
+		result, err := tx.exec(q, teamID, email)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err = result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return err
+		}
+
+		after, err := tx.GetTeam(teamID)
+		if err != nil {
+			return err
+		}
+		return tx.audit(EntityTeam, strconv.Itoa(teamID), 0, OpUpdate, before, after)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(rowsAffected), nil
+}
+
+// ManagedUsers returns the other members of the teams the manager belongs
+// to, ordered by email.
+func (db *DB) ManagedUsers(manager string) ([]string, error) {
+	q := `
+  SELECT DISTINCT member.email FROM team_member member
+  JOIN team_member own ON own.team_id = member.team_id
+  WHERE own.email = ? AND member.email <> ?
+  ORDER BY member.email
+  `
+	rows, err := db.query(q, manager, manager)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		users = append(users, email)
+	}
+	return users, rows.Err()
+}
+
+// GetUserBlocksInRange returns the blocks created by the user with the given
+// email that match the range, ordered by id.
+func (db *DB) GetUserBlocksInRange(email string, r TimeRange) ([]models.Block, error) {
+	conditions, args := r.conditions()
+	conditions = append(conditions, "block.created_by = ?")
+	return db.getBlocks(conditions, append(args, email)...)
+}
+
+const submissionColumns = `id, email, period, start, "end", status, comment, review_comment,
+  reviewed_by, submitted, reviewed, lock_id`
+
+func scanSubmission(row interface{ Scan(...any) error }) (models.Submission, error) {
+	var s models.Submission
+	err := row.Scan(&s.Id, &s.Email, &s.Period, &s.Start, &s.End, &s.Status, &s.Comment,
+		&s.ReviewComment, &s.ReviewedBy, &s.Submitted, &s.Reviewed, &s.LockID)
+	return s, err
+}
+
+// Submit hands in the week or month from start to end for review. A period
+// can be submitted again once it has been rejected.
+func (db *DB) Submit(email string, period string, start, end time.Time, comment string) (models.Submission, error) {
+	if (period != string(report.Week) && period != string(report.Month)) || !start.Before(end) {
+		return models.Submission{}, ErrInvalidSubmission
+	}
+
+	s := models.Submission{
+		Email:     email,
+		Period:    period,
+		Start:     start.UTC().Format(time.RFC3339),
+		End:       end.UTC().Format(time.RFC3339),
+		Status:    models.SubmissionSubmitted,
+		Comment:   comment,
+		Submitted: time.Now().UTC().Format(time.RFC3339),
+	}
+	err := db.transaction(func(tx *DB) error {
+		q := `
+    SELECT COUNT(*) FROM submission
+    WHERE email = ? AND period = ? AND start = ? AND status <> ?
+    `
+		var count int
+		if err := tx.queryRow(q, email, period, s.Start, models.SubmissionRejected).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadySubmitted
+		}
+
+		q = `
+    INSERT INTO submission (email, period, start, "end", status, comment, submitted)
+    VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+		id, err := tx.insert(q, s.Email, s.Period, s.Start, s.End, s.Status, s.Comment, s.Submitted)
+		if err != nil {
+			return err
+		}
+		s.Id = id
+
+		if err := tx.addWorkflowEvent(s, s.Comment, s.Submitted); err != nil {
+			return err
+		}
+		return tx.audit(EntitySubmission, strconv.Itoa(id), 0, OpCreate, nil, s)
+	})
+	if err != nil {
+		return models.Submission{}, err
+	}
+	return s, nil
+}
+
+func (db *DB) GetSubmission(id int) (models.Submission, error) {
+	return db.getSubmission(id, "")
+}
+
+// getSubmission appends suffix, e.g. forUpdate, to the query.
+func (db *DB) getSubmission(id int, suffix string) (models.Submission, error) {
+	q := `
+  SELECT ` + submissionColumns + ` FROM submission
+  WHERE id = ?
+  `
+	s, err := scanSubmission(db.queryRow(q+suffix, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, ErrSubmissionNotFound
+	}
+	return s, err
+}
+
+// GetSubmissions returns the submissions of the given users, of everyone if
+// emails is nil, ordered by their start. An empty status matches all.
+func (db *DB) GetSubmissions(emails []string, status string) ([]models.Submission, error) {
+	filter, args := emailFilter("email", emails)
+	q := `
+  SELECT ` + submissionColumns + ` FROM submission
+  WHERE ` + filter + ` AND (? = '' OR status = ?)
+  ORDER BY start, id
+  `
+	rows, err := db.query(q, append(args, status, status)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	submissions := []models.Submission{}
+	for rows.Next() {
+		s, err := scanSubmission(rows)
+		if err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, s)
+	}
+	return submissions, rows.Err()
+}
+
+// ApproveSubmission approves a pending submission and locks its period for
+// the blocks of the employee who submitted it.
+func (db *DB) ApproveSubmission(id int, comment string) (models.Submission, error) {
+	return db.review(id, func(tx *DB, s *models.Submission) error {
+		start, err := time.Parse(time.RFC3339, s.Start)
+		if err != nil {
+			return err
+		}
+		end, err := time.Parse(time.RFC3339, s.End)
+		if err != nil {
+			return err
+		}
+		lock, err := tx.AddLock(start, end, s.Email)
+		if err != nil {
+			return err
+		}
+		s.Status, s.ReviewComment, s.LockID = models.SubmissionApproved, comment, lock.Id
+		return nil
+	})
+}
+
+// RejectSubmission returns a pending submission to its employee with the
+// reason, which is required.
+func (db *DB) RejectSubmission(id int, reason string) (models.Submission, error) {
+	if strings.TrimSpace(reason) == "" {
+		return models.Submission{}, ErrReasonRequired
+	}
+	return db.review(id, func(tx *DB, s *models.Submission) error {
+		s.Status, s.ReviewComment = models.SubmissionRejected, reason
+		return nil
+	})
+}
+
+// review applies decide to a pending submission and records the review.
+func (db *DB) review(id int, decide func(tx *DB, s *models.Submission) error) (models.Submission, error) {
+	var after models.Submission
+	err := db.transaction(func(tx *DB) error {
+		before, err := tx.getSubmission(id, tx.forUpdate())
+		if err != nil {
+			return err
+		}
+		if before.Status != models.SubmissionSubmitted {
+			return ErrSubmissionNotPending
+		}
+
+		after = before
+		if err := decide(tx, &after); err != nil {
+			return err
+		}
+		after.ReviewedBy = auditUser(tx.user)
+		after.Reviewed = time.Now().UTC().Format(time.RFC3339)
+
+		q := `
+    UPDATE submission
+    SET status = ?, review_comment = ?, reviewed_by = ?, reviewed = ?, lock_id = ?
+    WHERE id = ?
+    `
+		if _, err := tx.exec(q, after.Status, after.ReviewComment, after.ReviewedBy, after.Reviewed,
+			after.LockID, id); err != nil {
+			return err
+		}
+
+		if err := tx.addWorkflowEvent(after, after.ReviewComment, after.Reviewed); err != nil {
+			return err
+		}
+		return tx.audit(EntitySubmission, strconv.Itoa(id), 0, OpUpdate, before, after)
+	})
+	if err != nil {
+		return models.Submission{}, err
+	}
+	return after, nil
+}
+
+func (db *DB) addWorkflowEvent(s models.Submission, comment string, at string) error {
+	q := `
+  INSERT INTO submission_event (submission_id, email, actor, type, comment, ts)
+  VALUES (?, ?, ?, ?, ?, ?)
+  `
+	_, err := db.exec(q, s.Id, s.Email, auditUser(db.user), s.Status, comment, at)
+	return err
+}
+
+// GetWorkflowEvents returns the events of submissions of the given users, of
+// everyone if emails is nil, that came after the event with the id since.
+func (db *DB) GetWorkflowEvents(emails []string, since int) ([]models.WorkflowEvent, error) {
+	filter, args := emailFilter("email", emails)
+	q := `
+  SELECT id, submission_id, email, actor, type, comment, ts FROM submission_event
+  WHERE ` + filter + ` AND id > ?
+  ORDER BY id
+  `
+	rows, err := db.query(q, append(args, since)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.WorkflowEvent{}
+	for rows.Next() {
+		var e models.WorkflowEvent
+		if err := rows.Scan(&e.Id, &e.SubmissionID, &e.Email, &e.Actor, &e.Type,
+			&e.Comment, &e.Timestamp); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteWorkflow(t *testing.T) {
+	db := GetNewTestDatabase()
+	defer db.Close()
+	testWorkflow(t, db)
+}
+
+func TestPostgresWorkflow(t *testing.T) {
+	db := newPostgresTestDatabase(t)
+	defer db.Close()
+	testWorkflow(t, db)
+}
+
+func testWorkflow(t *testing.T, db *DB) {
+	const employee, manager, outsider = "employee@test.com", "manager@test.com", "outsider@test.com"
+	for _, email := range []string{employee, manager, outsider} {
+		_, err := db.AddUser(email, "hash")
+		assert.NoError(t, err)
+	}
+
+	user, _, err := db.GetUserCredentials(employee)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleEmployee, user.Role)
+
+	_, err = db.SetUserRole(manager, "boss")
+	assert.ErrorIs(t, err, ErrInvalidRole)
+	rowsAffected, err := db.SetUserRole("nobody@test.com", models.RoleManager)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rowsAffected)
+	rowsAffected, err = db.SetUserRole(manager, models.RoleManager)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rowsAffected)
+
+	_, err = db.AddTeam(" ")
+	assert.ErrorIs(t, err, ErrInvalidTeam)
+	team, err := db.AddTeam("Backend")
+	assert.NoError(t, err)
+	_, err = db.AddTeam("Backend")
+	assert.ErrorIs(t, err, ErrTeamExists)
+	other, err := db.AddTeam("Frontend")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, db.AddTeamMember(team.Id+other.Id, employee), ErrTeamNotFound)
+	assert.ErrorIs(t, db.AddTeamMember(team.Id, "nobody@test.com"), ErrUserNotFound)
+	assert.NoError(t, db.AddTeamMember(team.Id, employee))
+	assert.NoError(t, db.AddTeamMember(team.Id, employee))
+	assert.NoError(t, db.AddTeamMember(team.Id, manager))
+	assert.NoError(t, db.AddTeamMember(other.Id, outsider))
+	assert.NoError(t, db.AddTeamMember(other.Id, manager))
+	rowsAffected, err = db.RemoveTeamMember(other.Id, manager)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rowsAffected)
+
+	teams, err := db.GetTeams()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Team{
+		{Id: team.Id, Name: "Backend", Members: []string{employee, manager}},
+		{Id: other.Id, Name: "Frontend", Members: []string{outsider}},
+	}, teams)
+
+	managed, err := db.ManagedUsers(manager)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{employee}, managed)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	start := time.Date(2023, 5, 8, 0, 0, 0, 0, berlin)
+	end := start.AddDate(0, 0, 7)
+
+	_, err = db.Submit(employee, "day", start, end, "")
+	assert.ErrorIs(t, err, ErrInvalidSubmission)
+	submitted, err := db.Submit(employee, "week", start, end, "all done")
+	assert.NoError(t, err)
+	assert.Equal(t, models.SubmissionSubmitted, submitted.Status)
+	assert.Equal(t, "2023-05-07T22:00:00Z", submitted.Start)
+	_, err = db.Submit(employee, "week", start, end, "")
+	assert.ErrorIs(t, err, ErrAlreadySubmitted)
+
+	reviewer := db.WithUser(manager).(*DB)
+	_, err = reviewer.RejectSubmission(submitted.Id, "")
+	assert.ErrorIs(t, err, ErrReasonRequired)
+	rejected, err := reviewer.RejectSubmission(submitted.Id, "Tuesday is missing")
+	assert.NoError(t, err)
+	assert.Equal(t, models.SubmissionRejected, rejected.Status)
+	assert.Equal(t, "Tuesday is missing", rejected.ReviewComment)
+	assert.Equal(t, manager, rejected.ReviewedBy)
+	_, err = reviewer.ApproveSubmission(submitted.Id, "")
+	assert.ErrorIs(t, err, ErrSubmissionNotPending)
+
+	resubmitted, err := db.Submit(employee, "week", start, end, "fixed")
+	assert.NoError(t, err)
+	approved, err := reviewer.ApproveSubmission(resubmitted.Id, "thanks")
+	assert.NoError(t, err)
+	assert.Equal(t, models.SubmissionApproved, approved.Status)
+
+	locks, err := db.GetLocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(locks))
+	assert.Equal(t, approved.LockID, locks[0].Id)
+	assert.Equal(t, approved.Start, locks[0].Start)
+	assert.Equal(t, manager, locks[0].LockedBy)
+	assert.Equal(t, employee, locks[0].Owner)
+	_, err = db.WithUser(employee).AddBlock(models.BlockCreate{Start: "2023-05-09T08:00:00Z", End: "2023-05-09T16:00:00Z"})
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+	// The approval only locks the blocks of the employee.
+	_, err = db.WithUser(outsider).AddBlock(models.BlockCreate{Start: "2023-05-09T08:00:00Z", End: "2023-05-09T16:00:00Z"})
+	assert.NoError(t, err)
+
+	_, err = db.GetSubmission(approved.Id + 1)
+	assert.ErrorIs(t, err, ErrSubmissionNotFound)
+	submissions, err := db.GetSubmissions([]string{employee}, models.SubmissionRejected)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Submission{rejected}, submissions)
+	submissions, err = db.GetSubmissions([]string{}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(submissions))
+	submissions, err = db.GetSubmissions(nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(submissions))
+
+	events, err := db.GetWorkflowEvents([]string{employee}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, models.SubmissionRejected, events[1].Type)
+	assert.Equal(t, manager, events[1].Actor)
+	assert.Equal(t, "Tuesday is missing", events[1].Comment)
+	events, err = db.GetWorkflowEvents(nil, events[2].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, models.SubmissionApproved, events[0].Type)
+	events, err = db.GetWorkflowEvents([]string{outsider}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(events))
+
+	_, err = db.WithUser(employee).AddBlock(models.BlockCreate{Start: "2023-06-01T08:00:00Z", End: "2023-06-01T16:00:00Z"})
+	assert.NoError(t, err)
+	blocks, err := db.GetUserBlocksInRange(employee, TimeRange{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+	blocks, err = db.GetUserBlocksInRange(manager, TimeRange{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(blocks))
+
+	_, err = reviewer.GetCurrentBlock()
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+	managerBlock, err := reviewer.StartBlock(false, time.Date(2023, 6, 2, 8, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	employeeBlock, err := db.WithUser(employee).StartBlock(true, time.Date(2023, 6, 2, 9, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	_, err = db.WithUser(employee).StartPause(time.Date(2023, 6, 2, 10, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	current, err := reviewer.GetCurrentBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, managerBlock.Id, current.Id)
+	assert.Equal(t, 0, len(current.Pauses))
+	current, err = db.WithUser(employee).GetCurrentBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, employeeBlock.Id, current.Id)
+	assert.Equal(t, 1, len(current.Pauses))
+
+	_, err = reviewer.EndBlock(time.Date(2023, 6, 2, 12, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	_, err = reviewer.GetCurrentBlock()
+	assert.ErrorIs(t, err, ErrNoBlockActive)
+	_, err = db.WithUser(employee).EndBlock(time.Date(2023, 6, 2, 12, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, err, ErrPauseNotEnded)
+
+	// Backups hold the workflow, and the submissions keep their locks.
+	backup, err := db.ExportBackup()
+	assert.NoError(t, err)
+	assert.NotNil(t, backup.Workflow)
+	assert.Equal(t, 3, len(backup.Workflow.Accounts))
+	assert.Equal(t, "hash", backup.Workflow.Accounts[0].PasswordHash)
+	assert.Equal(t, teams, backup.Workflow.Teams)
+	assert.Equal(t, 2, len(backup.Workflow.Submissions))
+	assert.Equal(t, 4, len(backup.Workflow.Events))
+	want, err := json.Marshal(backup)
+	assert.NoError(t, err)
+
+	_, err = db.SetUserRole(manager, models.RoleEmployee)
+	assert.NoError(t, err)
+	_, err = db.RemoveTeamMember(team.Id, employee)
+	assert.NoError(t, err)
+	_, err = db.DeleteLock(approved.LockID)
+	assert.NoError(t, err)
+
+	withoutWorkflow := backup
+	withoutWorkflow.Workflow = nil
+	_, err = db.RestoreBackup(withoutWorkflow, RestoreReplace)
+	assert.ErrorIs(t, err, ErrValidation)
+	invalid := backup
+	invalid.Locks = nil
+	_, err = db.RestoreBackup(invalid, RestoreReplace)
+	assert.ErrorIs(t, err, ErrValidation)
+	_, err = NewMemoryStore().RestoreBackup(backup, RestoreReplace)
+	assert.ErrorIs(t, err, ErrValidation)
+
+	_, err = db.RestoreBackup(backup, RestoreReplace)
+	assert.NoError(t, err)
+	restored, err := db.ExportBackup()
+	assert.NoError(t, err)
+	data, err := json.Marshal(restored)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(want), string(data))
+	restoredApproval, err := db.GetSubmission(approved.Id)
+	assert.NoError(t, err)
+	locks, err = db.GetLocks()
+	assert.NoError(t, err)
+	assert.Equal(t, restoredApproval.LockID, locks[0].Id)
+	_, err = db.WithUser(employee).AddBlock(models.BlockCreate{Start: "2023-05-10T08:00:00Z", End: "2023-05-10T16:00:00Z"})
+	assert.ErrorIs(t, err, ErrPeriodLocked)
+
+	// New rows continue after the restored ids.
+	newUser, err := db.AddUser("new@test.com", "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, newUser.Id)
+	newTeam, err := db.AddTeam("Ops")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, newTeam.Id)
+	june := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	newSubmission, err := db.Submit(employee, "month", june, june.AddDate(0, 1, 0), "")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, newSubmission.Id)
+}
@@ -0,0 +1,121 @@
+package ical
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// Summaries of the events that blocks and pauses are exported as.
+const (
+	WorkSummary  = "Work"
+	PauseSummary = "Pause"
+)
+
+func parseRange(start string, end string) (time.Time, time.Time, error) {
+	s, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return s, s, err
+	}
+	e, err := time.Parse(time.RFC3339, end)
+	return s, e, err
+}
+
+// FromBlocks turns finished blocks into events. Every block becomes an event
+// categorised with its project, and every finished pause becomes a separate
+// event within it. Blocks that are still running are left out.
+func FromBlocks(blocks []models.Block) ([]Event, error) {
+	var events []Event
+	for _, b := range blocks {
+		if b.End == "" {
+			continue
+		}
+		start, end, err := parseRange(b.Start, b.End)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", b.Id, err)
+		}
+
+		event := Event{
+			UID:     fmt.Sprintf("block-%d@work_hours", b.Id),
+			Summary: WorkSummary,
+			Start:   start,
+			End:     end,
+		}
+		if b.Homeoffice {
+			event.Summary += " (homeoffice)"
+		}
+		if b.Project != "" {
+			event.Summary += ": " + b.Project
+			event.Categories = []string{b.Project}
+		}
+		events = append(events, event)
+
+		for _, p := range b.Pauses {
+			if p.End == "" {
+				continue
+			}
+			start, end, err := parseRange(p.Start, p.End)
+			if err != nil {
+				return nil, fmt.Errorf("pause %d: %w", p.Id, err)
+			}
+			events = append(events, Event{
+				UID:     fmt.Sprintf("pause-%d@work_hours", p.Id),
+				Summary: PauseSummary,
+				Start:   start,
+				End:     end,
+			})
+		}
+	}
+	return events, nil
+}
+
+// Filter selects the events to import. Categories and summaries are compared
+// case-insensitively, empty fields match every event.
+type Filter struct {
+	Category      string
+	SummaryPrefix string
+}
+
+func (f Filter) matches(e Event) bool {
+	if !strings.HasPrefix(strings.ToLower(e.Summary), strings.ToLower(f.SummaryPrefix)) {
+		return false
+	}
+	if f.Category == "" {
+		return true
+	}
+	for _, c := range e.Categories {
+		if strings.EqualFold(c, f.Category) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToBlocks turns the timed events matching the filter into blocks to import,
+// with their times in loc. The first category other than the one filtered by
+// becomes the project, so that exported blocks keep theirs when imported
+// again. All-day events are skipped.
+func ToBlocks(events []Event, filter Filter, loc *time.Location) []models.BlockImport {
+	blocks := []models.BlockImport{}
+	for _, e := range events {
+		if e.AllDay || !filter.matches(e) {
+			continue
+		}
+
+		block := models.BlockCreate{
+			Start:      e.Start.In(loc).Format(time.RFC3339),
+			End:        e.End.In(loc).Format(time.RFC3339),
+			Homeoffice: strings.HasPrefix(e.Summary, WorkSummary+" (homeoffice)"),
+		}
+		for _, c := range e.Categories {
+			if !strings.EqualFold(c, filter.Category) {
+				block.Project = c
+				break
+			}
+		}
+		blocks = append(blocks, models.BlockImport{UID: e.UID, Block: block})
+	}
+	return blocks
+}
@@ -0,0 +1,302 @@
+// Package ical reads and writes iCalendar (RFC 5545) documents with the
+// subset of properties needed to exchange work blocks as events.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// dateTimeFormat is the UTC form of an iCalendar DATE-TIME value.
+const dateTimeFormat = "20060102T150405Z"
+
+// dateFormat is the form of an iCalendar DATE value.
+const dateFormat = "20060102"
+
+// Event is a VEVENT with a start and an end. AllDay events span whole days
+// and start at midnight.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Categories  []string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+}
+
+// Calendar is a VCALENDAR containing events.
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// writeLine writes a content line terminated by CRLF, folding it into
+// continuation lines so that no line exceeds 75 octets.
+func writeLine(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space of a continuation line counts toward its length.
+		limit = 74
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+// Encode writes the calendar to w. stamp is the DTSTAMP of all events, the
+// time the document was created.
+func Encode(w io.Writer, cal Calendar, stamp time.Time) error {
+	bw := bufio.NewWriter(w)
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:-//work_hours//EN")
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	if cal.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(cal.Name))
+	}
+
+	for _, e := range cal.Events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+escapeText(e.UID))
+		writeLine(bw, "DTSTAMP:"+stamp.UTC().Format(dateTimeFormat))
+		writeLine(bw, "DTSTART:"+e.Start.UTC().Format(dateTimeFormat))
+		writeLine(bw, "DTEND:"+e.End.UTC().Format(dateTimeFormat))
+		writeLine(bw, "SUMMARY:"+escapeText(e.Summary))
+		if e.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escapeText(e.Description))
+		}
+		if len(e.Categories) > 0 {
+			categories := make([]string, len(e.Categories))
+			for i, c := range e.Categories {
+				categories[i] = escapeText(c)
+			}
+			writeLine(bw, "CATEGORIES:"+strings.Join(categories, ","))
+		}
+		writeLine(bw, "END:VEVENT")
+	}
+
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+// property is a content line like DTSTART;TZID=Europe/Berlin:20230509T090000.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfold joins continuation lines, which start with a space or a tab, to the
+// line before them.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func parseProperty(line string) (property, error) {
+	// The value starts at the first colon that is not part of a quoted
+	// parameter value.
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon == -1 {
+		return property{}, fmt.Errorf("missing colon in %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	p := property{name: strings.ToUpper(parts[0]), params: make(map[string]string), value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return p, nil
+}
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
+
+// splitText splits a list of text values at the commas that are not escaped.
+func splitText(s string) []string {
+	var values []string
+	var current strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			current.WriteByte(s[i])
+			current.WriteByte(s[i+1])
+			i++
+		case s[i] == ',':
+			values = append(values, unescapeText(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(s[i])
+		}
+	}
+	return append(values, unescapeText(current.String()))
+}
+
+// parseTime parses a DATE or DATE-TIME value. Floating times without a time
+// zone are interpreted in loc.
+func parseTime(p property, loc *time.Location) (time.Time, bool, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == len(dateFormat) {
+		t, err := time.ParseInLocation(dateFormat, p.value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(p.value, "Z") {
+		t, err := time.Parse(dateTimeFormat, p.value)
+		return t, false, err
+	}
+	if tzid := p.params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown time zone %q", tzid)
+		}
+	}
+	t, err := time.ParseInLocation(strings.TrimSuffix(dateTimeFormat, "Z"), p.value, loc)
+	return t, false, err
+}
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration parses a DURATION value like PT1H30M.
+func parseDuration(value string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(value)
+	if m == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// Decode reads the events of a calendar. Properties other than the ones of
+// Event are ignored, as are components other than VEVENT. Events without an
+// end last as long as their DURATION, a day if they are all-day events and
+// no time at all otherwise.
+func Decode(r io.Reader, loc *time.Location) (Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return Calendar{}, err
+	}
+
+	var cal Calendar
+	var event *Event
+	var duration *time.Duration
+	// depth counts the components nested in the current event, like VALARM.
+	depth := 0
+	for i, line := range lines {
+		p, err := parseProperty(line)
+		if err != nil {
+			return cal, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT") && event == nil:
+			event, duration, depth = &Event{}, nil, 0
+		case event == nil:
+			if p.name == "X-WR-CALNAME" {
+				cal.Name = unescapeText(p.value)
+			}
+		case p.name == "BEGIN":
+			depth++
+		case p.name == "END" && depth > 0:
+			depth--
+		case p.name == "END":
+			if event.End.IsZero() {
+				event.End = event.Start
+				if duration != nil {
+					event.End = event.Start.Add(*duration)
+				} else if event.AllDay {
+					event.End = event.Start.AddDate(0, 0, 1)
+				}
+			}
+			cal.Events = append(cal.Events, *event)
+			event = nil
+		case depth > 0:
+			// Properties of nested components are not the event's.
+		case p.name == "UID":
+			event.UID = unescapeText(p.value)
+		case p.name == "SUMMARY":
+			event.Summary = unescapeText(p.value)
+		case p.name == "DESCRIPTION":
+			event.Description = unescapeText(p.value)
+		case p.name == "CATEGORIES":
+			event.Categories = append(event.Categories, splitText(p.value)...)
+		case p.name == "DTSTART" || p.name == "DTEND":
+			t, allDay, err := parseTime(p, loc)
+			if err != nil {
+				return cal, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if p.name == "DTSTART" {
+				event.Start, event.AllDay = t, allDay
+			} else {
+				event.End = t
+			}
+		case p.name == "DURATION":
+			d, err := parseDuration(p.value)
+			if err != nil {
+				return cal, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			duration = &d
+		}
+	}
+
+	if event != nil {
+		return cal, fmt.Errorf("event %q is not terminated", event.UID)
+	}
+	return cal, nil
+}
@@ -0,0 +1,197 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	cal := Calendar{
+		Name: "Work hours",
+		Events: []Event{{
+			UID:         "block-1@work_hours",
+			Summary:     "Work: Website, Shop; Café",
+			Description: strings.Repeat("ä", 60) + "\nend",
+			Categories:  []string{"Website, Shop"},
+			Start:       time.Date(2023, 5, 9, 9, 0, 0, 0, time.FixedZone("", 2*60*60)),
+			End:         time.Date(2023, 5, 9, 15, 0, 0, 0, time.UTC),
+		}},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, cal, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)))
+	doc := buf.String()
+
+	assert.True(t, strings.HasPrefix(doc, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(doc, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.Contains(t, doc, "DTSTAMP:20230601T000000Z\r\n")
+	assert.Contains(t, doc, "DTSTART:20230509T070000Z\r\n")
+	assert.Contains(t, doc, "DTEND:20230509T150000Z\r\n")
+	assert.Contains(t, doc, `SUMMARY:Work: Website\, Shop\; Café`)
+	assert.Contains(t, doc, `CATEGORIES:Website\, Shop`)
+
+	for _, line := range strings.Split(strings.TrimSuffix(doc, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+	}
+	unfolded := strings.ReplaceAll(doc, "\r\n ", "")
+	assert.Contains(t, unfolded, "DESCRIPTION:"+strings.Repeat("ä", 60)+`\nend`+"\r\n")
+}
+
+func TestFromBlocks(t *testing.T) {
+	blocks := []models.Block{
+		{
+			Id:         1,
+			Start:      "2023-05-09T07:00:00Z",
+			End:        "2023-05-09T15:30:00Z",
+			Homeoffice: true,
+			Project:    "Website",
+			Pauses: []models.Pause{
+				{Id: 3, Start: "2023-05-09T12:00:00Z", End: "2023-05-09T12:30:00Z"},
+			},
+		},
+		{Id: 2, Start: "2023-05-10T07:00:00Z"},
+	}
+
+	events, err := FromBlocks(blocks)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "block-1@work_hours", events[0].UID)
+	assert.Equal(t, "Work (homeoffice): Website", events[0].Summary)
+	assert.Equal(t, []string{"Website"}, events[0].Categories)
+	assert.Equal(t, 8*time.Hour+30*time.Minute, events[0].End.Sub(events[0].Start))
+	assert.Equal(t, "pause-3@work_hours", events[1].UID)
+	assert.Equal(t, PauseSummary, events[1].Summary)
+
+	_, err = FromBlocks([]models.Block{{Id: 4, Start: "invalid", End: "2023-05-10T07:00:00Z"}})
+	assert.Error(t, err)
+}
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"X-WR-CALNAME:Old\\, hours\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:utc@example.com\r\n" +
+	"SUMMARY:Work: long\r\n" +
+	"  description\r\n" +
+	"CATEGORIES:Work,Web\\,site\r\n" +
+	"DTSTART:20230509T070000Z\r\n" +
+	"DTEND:20230509T150000Z\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"SUMMARY:Alarm\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:zone@example.com\r\n" +
+	"SUMMARY:Meeting\r\n" +
+	"DTSTART;TZID=\"America/New_York\":20230510T090000\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:floating@example.com\r\n" +
+	"DTSTART:20230511T090000\r\n" +
+	"DTEND:20230511T100000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:day@example.com\r\n" +
+	"DTSTART;VALUE=DATE:20230512\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestDecode(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	cal, err := Decode(strings.NewReader(testCalendar), berlin)
+	assert.NoError(t, err)
+	assert.Equal(t, "Old, hours", cal.Name)
+	assert.Equal(t, 4, len(cal.Events))
+
+	utc := cal.Events[0]
+	assert.Equal(t, "utc@example.com", utc.UID)
+	assert.Equal(t, "Work: long description", utc.Summary)
+	assert.Equal(t, []string{"Work", "Web,site"}, utc.Categories)
+	assert.True(t, utc.Start.Equal(time.Date(2023, 5, 9, 7, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 8*time.Hour, utc.End.Sub(utc.Start))
+
+	zone := cal.Events[1]
+	assert.Equal(t, "2023-05-10T13:00:00Z", zone.Start.UTC().Format(time.RFC3339))
+	assert.Equal(t, 90*time.Minute, zone.End.Sub(zone.Start))
+
+	floating := cal.Events[2]
+	assert.Equal(t, "2023-05-11T07:00:00Z", floating.Start.UTC().Format(time.RFC3339))
+
+	day := cal.Events[3]
+	assert.True(t, day.AllDay)
+	assert.Equal(t, 24*time.Hour, day.End.Sub(day.Start))
+
+	for _, invalid := range []string{
+		"BEGIN:VEVENT\r\nDTSTART:tomorrow\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nDTSTART;TZID=Mars/Olympus_Mons:20230510T090000\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nDURATION:1 hour\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nSUMMARY Work\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nUID:open\r\n",
+	} {
+		_, err := Decode(strings.NewReader(invalid), berlin)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	blocks := []models.Block{{
+		Id:         1,
+		Start:      "2023-05-09T07:00:00Z",
+		End:        "2023-05-09T15:30:00Z",
+		Homeoffice: true,
+		Project:    "Web, site",
+		Pauses: []models.Pause{
+			{Id: 1, Start: "2023-05-09T12:00:00Z", End: "2023-05-09T12:30:00Z"},
+		},
+	}}
+	events, err := FromBlocks(blocks)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, Calendar{Events: events}, time.Now()))
+
+	cal, err := Decode(&buf, time.UTC)
+	assert.NoError(t, err)
+	imports := ToBlocks(cal.Events, Filter{SummaryPrefix: WorkSummary}, time.UTC)
+	assert.Equal(t, []models.BlockImport{{
+		UID: "block-1@work_hours",
+		Block: models.BlockCreate{
+			Start:      "2023-05-09T07:00:00Z",
+			End:        "2023-05-09T15:30:00Z",
+			Homeoffice: true,
+			Project:    "Web, site",
+		},
+	}}, imports)
+}
+
+func TestToBlocksFilter(t *testing.T) {
+	cal, err := Decode(strings.NewReader(testCalendar), time.UTC)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		filter Filter
+		uids   []string
+	}{
+		{Filter{}, []string{"utc@example.com", "zone@example.com", "floating@example.com"}},
+		{Filter{Category: "work"}, []string{"utc@example.com"}},
+		{Filter{SummaryPrefix: "meet"}, []string{"zone@example.com"}},
+		{Filter{Category: "Work", SummaryPrefix: "Meeting"}, nil},
+	}
+	for _, test := range tests {
+		var uids []string
+		for _, b := range ToBlocks(cal.Events, test.filter, time.UTC) {
+			uids = append(uids, b.UID)
+		}
+		assert.Equal(t, test.uids, uids, test.filter)
+	}
+
+	blocks := ToBlocks(cal.Events, Filter{Category: "Work"}, time.UTC)
+	assert.Equal(t, "Web,site", blocks[0].Block.Project)
+}
@@ -1,23 +1,56 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"log"
-
-	"github.com/kilianmandscharo/work_hours/database"
-	"github.com/kilianmandscharo/work_hours/server"
+	"os"
 )
 
-func main() {
-	db, err := database.NewDatabase()
-	if err != nil {
-		log.Fatal("ERROR: could not open database", err)
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"serve", "start the HTTP server", runServe},
+	{"migrate", "apply pending database migrations", runMigrate},
+	{"hash-password", "print the bcrypt hash of a password (e.g. for PW_HASH)", runHashPassword},
+	{"digest-key", "print a new key that signs audit digests (for DIGEST_KEY)", runDigestKey},
+	{"user", "manage users (add, list, disable, enable, role)", runUser},
+	{"export", "write blocks as JSON or for Timewarrior or Toggl", runExport},
+	{"import", "read blocks from JSON or from Timewarrior or Toggl", runImport},
+	{"backup", "write a copy of the database to a file", runBackup},
+	{"restore", "replace the database with a snapshot or backup file", runRestore},
+	{"report", "print worked hours per day, week or month", runReport},
+	{"audit", "verify the audit log or export a signed monthly digest", runAudit},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s <command> [flags]\n\ncommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", c.name, c.usage)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return runServe(args, stdin, stdout)
 	}
-	defer db.Close()
-	err = db.Init()
-	if err != nil {
-		log.Fatal("ERROR: could not initialize database", err)
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdin, stdout)
+		}
 	}
 
-	router := server.NewRouter(db)
-	router.Run(":8080")
+	usage(os.Stderr)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		log.Fatal("ERROR: ", err)
+	}
 }
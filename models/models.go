@@ -1,6 +1,9 @@
 package models
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/kilianmandscharo/work_hours/datetime"
 )
 
@@ -9,7 +12,12 @@ type Block struct {
 	Start      string  `json:"start" binding:"required"`
 	End        string  `json:"end" binding:"required"`
 	Homeoffice bool    `json:"homeoffice"`
+	Project    string  `json:"project"`
+	Billable   bool    `json:"billable"`
 	Pauses     []Pause `json:"pauses"`
+	// InvoiceID is the invoice the block has been billed with, 0 if it has
+	// not been billed. Billed blocks and their pauses cannot be changed.
+	InvoiceID int `json:"invoiceID,omitempty"`
 }
 
 func (b *Block) Valid() bool {
@@ -26,6 +34,8 @@ type BlockCreate struct {
 	Start      string                `json:"start" binding:"required"`
 	End        string                `json:"end" binding:"required"`
 	Homeoffice bool                  `json:"homeoffice"`
+	Project    string                `json:"project"`
+	Billable   bool                  `json:"billable"`
 	Pauses     []PauseWithoutBlockID `json:"pauses"`
 }
 
@@ -88,3 +98,497 @@ func (b *BodyEnd) Valid() bool {
 type BodyHomeoffice struct {
 	Homeoffice bool `json:"homeoffice" binding:"required"`
 }
+
+type User struct {
+	Id       int    `json:"id"`
+	Email    string `json:"email"`
+	Disabled bool   `json:"disabled"`
+	Role     string `json:"role"`
+}
+
+// Roles of a user. Employees submit their own periods, managers review the
+// submissions of their teams and admins those of everyone.
+const (
+	RoleEmployee = "employee"
+	RoleManager  = "manager"
+	RoleAdmin    = "admin"
+)
+
+type RoleUpdate struct {
+	Role string `json:"role"`
+}
+
+// Settings are the preferences of a single user.
+type Settings struct {
+	// Timezone is an IANA time zone name like Europe/Berlin. It determines
+	// the calendar days in reports and the offset of timestamps recorded by
+	// the current block endpoints.
+	Timezone string `json:"timezone" binding:"required"`
+	// TargetMinutes are the minutes the user is expected to work on each day
+	// of the week, starting with Sunday. Overtime is measured against them.
+	// Without them the default of 8 hours from Monday to Friday applies.
+	TargetMinutes []int `json:"targetMinutes,omitempty"`
+}
+
+// DefaultSettings apply to users that have not saved any settings, they use
+// the time zone of the server.
+func DefaultSettings() Settings {
+	return Settings{Timezone: "Local", TargetMinutes: DefaultTargetMinutes()}
+}
+
+func DefaultTargetMinutes() []int {
+	return []int{0, 480, 480, 480, 480, 480, 0}
+}
+
+// Target returns the time the user is expected to work on the given day of
+// the week.
+func (s Settings) Target(day time.Weekday) time.Duration {
+	targets := s.TargetMinutes
+	if len(targets) != 7 {
+		targets = DefaultTargetMinutes()
+	}
+	return time.Duration(targets[day]) * time.Minute
+}
+
+// Feed is the secret subscription URL of a user's calendar feed. Anyone who
+// knows the URL can read the feed without a token.
+type Feed struct {
+	URL string `json:"url"`
+}
+
+func (s Settings) Location() (*time.Location, error) {
+	return time.LoadLocation(s.Timezone)
+}
+
+// RegularCategory is the surcharge category of work no rule applies to.
+const RegularCategory = "regular"
+
+// SurchargeRule grants a percentage on top of the regular pay for work that
+// falls on its days and within its time of day. A rule without restrictions
+// applies to all work.
+type SurchargeRule struct {
+	Category string `json:"category"`
+	Percent  int    `json:"percent"`
+	// Weekdays restricts the rule to these days of the week, 0 is Sunday.
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+	// Holiday restricts the rule to the holidays of the configuration.
+	Holiday bool `json:"holiday,omitempty"`
+	// From and To restrict the rule to a time of day given as "15:04". The
+	// window wraps midnight if From is not before To.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// Window returns the start and end of the rule's time of day as offsets from
+// midnight. ok is false if the rule applies all day.
+func (r SurchargeRule) Window() (from time.Duration, to time.Duration, ok bool, err error) {
+	if r.From == "" && r.To == "" {
+		return 0, 0, false, nil
+	}
+	f, err := time.Parse("15:04", r.From)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	t, err := time.Parse("15:04", r.To)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	midnight := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
+	return f.Sub(midnight), t.Sub(midnight), true, nil
+}
+
+type SurchargeConfig struct {
+	Rules []SurchargeRule `json:"rules" binding:"required"`
+	// Holidays are the public holidays as "2006-01-02".
+	Holidays []string `json:"holidays"`
+}
+
+// DefaultSurchargeConfig applies until a configuration has been saved. It
+// has no holidays, those depend on the region.
+func DefaultSurchargeConfig() SurchargeConfig {
+	return SurchargeConfig{
+		Rules: []SurchargeRule{
+			{Category: "night", Percent: 25, From: "20:00", To: "06:00"},
+			{Category: "sunday", Percent: 50, Weekdays: []time.Weekday{time.Sunday}},
+			{Category: "holiday", Percent: 125, Holiday: true},
+		},
+		Holidays: []string{},
+	}
+}
+
+// Rate is the hourly rate of a user, in cents, from a date on. A rate with
+// an empty project applies to all projects without a rate of their own.
+type Rate struct {
+	Id            int    `json:"id"`
+	Email         string `json:"email"`
+	Project       string `json:"project"`
+	CentsPerHour  int64  `json:"centsPerHour"`
+	EffectiveFrom string `json:"effectiveFrom"`
+}
+
+type RateCreate struct {
+	Project      string `json:"project"`
+	CentsPerHour int64  `json:"centsPerHour" binding:"required"`
+	// EffectiveFrom is the first day the rate applies to, as "2006-01-02".
+	EffectiveFrom string `json:"effectiveFrom" binding:"required"`
+}
+
+type InvoiceCreate struct {
+	Start string `json:"start" binding:"required"`
+	End   string `json:"end" binding:"required"`
+}
+
+// Invoice bills the billable blocks of a range that had not been billed
+// before. Its number is unique and counts up per year.
+type Invoice struct {
+	Id         int           `json:"id"`
+	Number     string        `json:"number"`
+	Email      string        `json:"email"`
+	Created    string        `json:"created"`
+	Start      string        `json:"start"`
+	End        string        `json:"end"`
+	TotalCents int64         `json:"totalCents"`
+	Lines      []InvoiceLine `json:"lines"`
+}
+
+// InvoiceLine is a single billed block. Date is the day the block started on
+// in the time zone of the user.
+type InvoiceLine struct {
+	BlockID      int    `json:"blockID"`
+	Date         string `json:"date"`
+	Project      string `json:"project"`
+	Minutes      int    `json:"minutes"`
+	CentsPerHour int64  `json:"centsPerHour"`
+	AmountCents  int64  `json:"amountCents"`
+}
+
+// BlockImport is a block read from another application, like an event of a
+// calendar. UID identifies it there, so that importing it again is a no-op.
+type BlockImport struct {
+	UID   string      `json:"uid"`
+	Block BlockCreate `json:"block"`
+}
+
+// Outcomes of importing a single block.
+const (
+	ImportCreated   = "created"
+	ImportDuplicate = "duplicate"
+	ImportOverlap   = "overlap"
+	ImportInvalid   = "invalid"
+	ImportLocked    = "locked"
+)
+
+// ImportResult is the outcome of importing a single block. BlockID is the
+// created block, the block imported before for duplicates or the existing
+// block for overlaps.
+type ImportResult struct {
+	UID     string `json:"uid"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	Status  string `json:"status"`
+	BlockID int    `json:"blockID,omitempty"`
+}
+
+// ImportReport lists the outcome of every imported block. In a dry run
+// nothing is written, created blocks have no id yet.
+type ImportReport struct {
+	DryRun  bool           `json:"dryRun"`
+	Created int            `json:"created"`
+	Skipped int            `json:"skipped"`
+	Results []ImportResult `json:"results"`
+}
+
+// BackupVersion is the version of the backup document. Restores also accept
+// version 1, which had a single current block and pause, and reject others.
+const BackupVersion = 2
+
+// Backup is a copy of all tracked time and settings. Blocks, pauses, rates,
+// invoices, locks, accounts, teams and submissions keep their ids, so
+// restoring a backup and backing up again yields the same document.
+type Backup struct {
+	Version  int            `json:"version"`
+	Blocks   []BackupBlock  `json:"blocks"`
+	Current  BackupCurrents `json:"current"`
+	Settings []UserSettings `json:"settings"`
+	// Surcharges is left unchanged by restores when it is missing.
+	Surcharges *SurchargeConfig `json:"surcharges,omitempty"`
+	// Rates, invoices and locks are only restored by replacing restores.
+	// Every billed block refers to an invoice of the backup.
+	Rates    []Rate       `json:"rates,omitempty"`
+	Invoices []Invoice    `json:"invoices,omitempty"`
+	Locks    []PeriodLock `json:"locks,omitempty"`
+	// Workflow is only restored by replacing restores. Replacing restores
+	// of backups without it keep the accounts and teams and fail while there
+	// are submissions, since their locks are replaced.
+	Workflow *BackupWorkflow `json:"workflow,omitempty"`
+	// Feeds are only restored by replacing restores, so that the feed URLs
+	// keep working.
+	Feeds []BackupFeed `json:"feeds,omitempty"`
+}
+
+// BackupFeed is the secret of a user's calendar feed.
+type BackupFeed struct {
+	Email  string `json:"email"`
+	Secret string `json:"secret"`
+}
+
+// BackupWorkflow holds the accounts with their roles, the teams and the
+// submissions with their events. The locks of approved submissions are part
+// of the backup's locks.
+type BackupWorkflow struct {
+	Accounts    []BackupAccount `json:"accounts"`
+	Teams       []Team          `json:"teams"`
+	Submissions []Submission    `json:"submissions"`
+	Events      []WorkflowEvent `json:"events"`
+}
+
+// BackupAccount is a login account together with its password hash.
+type BackupAccount struct {
+	User
+	PasswordHash string `json:"passwordHash"`
+}
+
+// BackupBlock is a block together with the UID it was imported with, so
+// that importing the same events after a restore still skips them, and the
+// user who created it. Blocks without a creator are restored as created by
+// the user who restores them.
+type BackupBlock struct {
+	Block
+	ImportUID string `json:"importUID,omitempty"`
+	CreatedBy string `json:"createdBy,omitempty"`
+}
+
+// BackupCurrent holds the ids of the current block and pause of a user, -1
+// if none is running.
+type BackupCurrent struct {
+	Email   string `json:"email,omitempty"`
+	BlockID int    `json:"blockID"`
+	PauseID int    `json:"pauseID"`
+}
+
+// BackupCurrents lists the users with a running block. Version 1 documents
+// hold a single BackupCurrent without an email instead.
+type BackupCurrents []BackupCurrent
+
+func (c *BackupCurrents) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		var current BackupCurrent
+		if err := json.Unmarshal(data, &current); err != nil {
+			return err
+		}
+		*c = BackupCurrents{current}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]BackupCurrent)(c))
+}
+
+type UserSettings struct {
+	Email string `json:"email"`
+	Settings
+}
+
+// RestoreReport counts the restored blocks and pauses. A merge skips the
+// blocks that already exist with the same start and end, and running blocks.
+type RestoreReport struct {
+	Mode    string `json:"mode"`
+	Blocks  int    `json:"blocks"`
+	Pauses  int    `json:"pauses"`
+	Skipped int    `json:"skipped"`
+}
+
+// PeriodLock closes the range from Start to End, both RFC3339 in UTC, for
+// changes of blocks and pauses.
+type PeriodLock struct {
+	Id       int    `json:"id"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	LockedBy string `json:"lockedBy"`
+	Created  string `json:"created"`
+	// Owner is the user whose blocks are locked. Locks without an owner
+	// apply to the blocks of all users.
+	Owner string `json:"owner,omitempty"`
+}
+
+// PeriodLockCreate locks either a month like 2023-05 in the user's time zone
+// or the range from Start to End for the blocks of Owner, the requesting user
+// if it is empty, or of all users if All is set.
+type PeriodLockCreate struct {
+	Month string `json:"month,omitempty"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	All   bool   `json:"all,omitempty"`
+}
+
+// Snapshot is a copy of the database file written by the snapshot worker or
+// on demand.
+type Snapshot struct {
+	Name    string `json:"name"`
+	Created string `json:"created"`
+	Size    int64  `json:"size"`
+}
+
+// AuditEntry records a single change. Before and After are the entity as
+// JSON before and after the change, null when it did not exist.
+type AuditEntry struct {
+	Id        int    `json:"id"`
+	Timestamp string `json:"timestamp"`
+	User      string `json:"user"`
+	Entity    string `json:"entity"`
+	EntityID  string `json:"entityID"`
+	// BlockID is the block a block or pause entry belongs to.
+	BlockID   int             `json:"blockID,omitempty"`
+	Operation string          `json:"operation"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	// PrevHash is the Hash of the entry before, Hash the SHA-256 of PrevHash
+	// and this entry. Both are empty for entries recorded before the log was
+	// chained.
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// AuditVerification is the result of checking the hash chain of the audit
+// log. If it is not valid, BrokenID is the first entry that does not match.
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int    `json:"entries"`
+	Head     string `json:"head"`
+	BrokenID int    `json:"brokenID,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// AuditDigest sums up the audit log of a closed month: Hash is the head of
+// the chain at the end of the month, so it covers every change recorded
+// until then. Signature is the base64 Ed25519 signature of the digest as
+// JSON with an empty Signature.
+type AuditDigest struct {
+	Month     string `json:"month"`
+	Timezone  string `json:"timezone"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Entries   int    `json:"entries"`
+	FirstID   int    `json:"firstID,omitempty"`
+	LastID    int    `json:"lastID,omitempty"`
+	PrevHash  string `json:"prevHash"`
+	Hash      string `json:"hash"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+// Team groups users. A manager reviews the submissions of the other members
+// of their teams.
+type Team struct {
+	Id      int      `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+type TeamCreate struct {
+	Name string `json:"name"`
+}
+
+type TeamMemberCreate struct {
+	Email string `json:"email"`
+}
+
+// States of a submission.
+const (
+	SubmissionSubmitted = "submitted"
+	SubmissionApproved  = "approved"
+	SubmissionRejected  = "rejected"
+)
+
+// Submission hands in the week or month from Start to End, both RFC3339 in
+// UTC, for review. LockID is the lock that closed the period when it was
+// approved.
+type Submission struct {
+	Id      int    `json:"id"`
+	Email   string `json:"email"`
+	Period  string `json:"period"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	Status  string `json:"status"`
+	Comment string `json:"comment"`
+	// ReviewComment is the comment of the reviewer, the reason if the
+	// submission was rejected.
+	ReviewComment string `json:"reviewComment,omitempty"`
+	ReviewedBy    string `json:"reviewedBy,omitempty"`
+	Submitted     string `json:"submitted"`
+	Reviewed      string `json:"reviewed,omitempty"`
+	LockID        int    `json:"lockID,omitempty"`
+}
+
+// SubmissionCreate submits the week or month that contains Date, a
+// YYYY-MM-DD in the user's time zone.
+type SubmissionCreate struct {
+	Period  string `json:"period"`
+	Date    string `json:"date"`
+	Comment string `json:"comment"`
+}
+
+// SubmissionReview is the comment of a reviewer. It is required to reject a
+// submission.
+type SubmissionReview struct {
+	Comment string `json:"comment"`
+}
+
+// WorkflowEvent records that a submission was submitted, approved or
+// rejected. Type is the status the submission moved to.
+type WorkflowEvent struct {
+	Id           int    `json:"id"`
+	SubmissionID int    `json:"submissionID"`
+	Email        string `json:"email"`
+	Actor        string `json:"actor"`
+	Type         string `json:"type"`
+	Comment      string `json:"comment"`
+	Timestamp    string `json:"timestamp"`
+}
+
+// States of a team member.
+const (
+	MemberWorking = "working"
+	MemberPaused  = "paused"
+	MemberIdle    = "idle"
+)
+
+// TeamOverview shows what the members of a team are doing at At.
+type TeamOverview struct {
+	TeamID  int            `json:"teamID"`
+	Name    string         `json:"name"`
+	At      string         `json:"at"`
+	Members []MemberStatus `json:"members"`
+}
+
+// MemberStatus is the state of a team member and their net minutes of
+// today and this week in their time zone, counting a running block until
+// now. BalanceMinutes is the overtime of the month so far. BlockID and
+// Since, the start of the current block or pause, are set unless the member
+// is idle.
+type MemberStatus struct {
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	State          string `json:"state"`
+	BlockID        int    `json:"blockID,omitempty"`
+	Since          string `json:"since,omitempty"`
+	TodayMinutes   int    `json:"todayMinutes"`
+	WeekMinutes    int    `json:"weekMinutes"`
+	BalanceMinutes int    `json:"balanceMinutes"`
+}
+
+// Types of trash items.
+const (
+	TrashBlock = "block"
+	TrashPause = "pause"
+)
+
+// TrashItem is a deleted block with its pauses or a deleted pause of a block
+// that still exists. Items are purged for good once the retention of the
+// server has passed.
+type TrashItem struct {
+	Type      string `json:"type"`
+	Id        int    `json:"id"`
+	DeletedAt string `json:"deletedAt"`
+	Block     *Block `json:"block,omitempty"`
+	Pause     *Pause `json:"pause,omitempty"`
+}
@@ -0,0 +1,113 @@
+// Package render turns reports and invoices into documents.
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// Money formats an amount in cents with two decimals.
+func Money(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Minutes formats a number of minutes as hours and minutes, like 7:30.
+func Minutes(minutes int) string {
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money":   Money,
+	"minutes": Minutes,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 12px; text-align: left; }
+td.number, th.number { text-align: right; }
+tfoot td { border-top: 1px solid; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<p>{{.Email}}<br>Created {{.Created}}<br>Period {{.Start}} to {{.End}}</p>
+<table>
+<thead>
+<tr><th>Date</th><th>Project</th><th class="number">Hours</th><th class="number">Rate</th><th class="number">Amount</th></tr>
+</thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{.Date}}</td><td>{{.Project}}</td><td class="number">{{minutes .Minutes}}</td><td class="number">{{money .CentsPerHour}}</td><td class="number">{{money .AmountCents}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+<tr><td colspan="4">Total</td><td class="number">{{money .TotalCents}}</td></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`))
+
+// InvoiceHTML writes the invoice as a standalone HTML page.
+func InvoiceHTML(w io.Writer, invoice models.Invoice) error {
+	return invoiceTemplate.Execute(w, invoice)
+}
+
+// InvoicePDF writes the invoice as a single A4 PDF document.
+func InvoicePDF(w io.Writer, invoice models.Invoice) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle("Invoice "+invoice.Number, true)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.Cell(0, 10, tr("Invoice "+invoice.Number))
+	pdf.Ln(12)
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range []string{
+		invoice.Email,
+		"Created " + invoice.Created,
+		"Period " + invoice.Start + " to " + invoice.End,
+	} {
+		pdf.Cell(0, 5, tr(line))
+		pdf.Ln(5)
+	}
+	pdf.Ln(5)
+
+	widths := []float64{30, 70, 25, 30, 30}
+	row := func(cells []string, border string) {
+		for i, cell := range cells {
+			align := "R"
+			if i < 2 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 7, tr(cell), border, 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	pdf.SetFont("Helvetica", "B", 10)
+	row([]string{"Date", "Project", "Hours", "Rate", "Amount"}, "B")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, l := range invoice.Lines {
+		row([]string{l.Date, l.Project, Minutes(l.Minutes), Money(l.CentsPerHour), Money(l.AmountCents)}, "")
+	}
+	pdf.SetFont("Helvetica", "B", 10)
+	row([]string{"Total", "", "", "", Money(invoice.TotalCents)}, "T")
+
+	return pdf.Output(w)
+}
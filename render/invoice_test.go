@@ -0,0 +1,53 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func testInvoice() models.Invoice {
+	return models.Invoice{
+		Id:         1,
+		Number:     "2023-0001",
+		Email:      "test@test.com",
+		Created:    "2023-06-01T10:00:00+02:00",
+		Start:      "2023-05-01T00:00:00+02:00",
+		End:        "2023-06-01T00:00:00+02:00",
+		TotalCents: 60050,
+		Lines: []models.InvoiceLine{
+			{BlockID: 1, Date: "2023-05-09", Project: "<Website>", Minutes: 480, CentsPerHour: 7500, AmountCents: 60000},
+			{BlockID: 2, Date: "2023-05-10", Project: "Café", Minutes: 1, CentsPerHour: 3000, AmountCents: 50},
+		},
+	}
+}
+
+func TestMoney(t *testing.T) {
+	assert.Equal(t, "0.00", Money(0))
+	assert.Equal(t, "12.05", Money(1205))
+	assert.Equal(t, "-0.50", Money(-50))
+}
+
+func TestMinutes(t *testing.T) {
+	assert.Equal(t, "0:00", Minutes(0))
+	assert.Equal(t, "7:30", Minutes(450))
+}
+
+func TestInvoiceHTML(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, InvoiceHTML(&buf, testInvoice()))
+
+	html := buf.String()
+	assert.Contains(t, html, "<h1>Invoice 2023-0001</h1>")
+	assert.Contains(t, html, "&lt;Website&gt;")
+	assert.Contains(t, html, "8:00")
+	assert.Contains(t, html, "600.50")
+}
+
+func TestInvoicePDF(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, InvoicePDF(&buf, testInvoice()))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+}
@@ -0,0 +1,100 @@
+package render
+
+import (
+	"io"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/kilianmandscharo/work_hours/report"
+)
+
+// Duration formats a duration rounded to minutes as hours and minutes, with
+// a leading minus for negative durations, like -1:15.
+func Duration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes < 0 {
+		return "-" + Minutes(-minutes)
+	}
+	return Minutes(minutes)
+}
+
+// TimesheetPDF writes the monthly timesheet of the user with the given email
+// as an A4 PDF document with weekly subtotals, the overtime balance of the
+// month and lines for the signatures of employee and employer.
+func TimesheetPDF(w io.Writer, email string, sheet report.Timesheet) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle("Timesheet "+sheet.Month, true)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.Cell(0, 10, tr("Timesheet "+sheet.Month))
+	pdf.Ln(12)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.Cell(0, 5, tr(email))
+	pdf.Ln(8)
+
+	widths := []float64{38, 20, 20, 22, 22, 22, 26}
+	row := func(cells []string, border string) {
+		for i, cell := range cells {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 5.5, tr(cell), border, 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	pdf.SetFont("Helvetica", "B", 9)
+	row([]string{"Day", "Start", "End", "Breaks", "Net", "Target", "Homeoffice"}, "B")
+	for i, d := range sheet.Days {
+		pdf.SetFont("Helvetica", "", 9)
+		label := d.Date.Format("Mon 2006-01-02")
+		if d.Holiday {
+			label += " (holiday)"
+		}
+		homeoffice := ""
+		if d.Homeoffice {
+			homeoffice = "yes"
+		}
+		breaks, net := "", ""
+		if d.Start != "" {
+			breaks, net = Duration(d.Pauses), Duration(d.Net)
+		}
+		row([]string{label, d.Start, d.End, breaks, net, Duration(d.Target), homeoffice}, "")
+
+		if i == len(sheet.Days)-1 || sheet.Days[i+1].Week != d.Week {
+			for _, week := range sheet.Weeks {
+				if week.Week == d.Week {
+					pdf.SetFont("Helvetica", "B", 9)
+					row([]string{"Week " + week.Week, "", "", "", Duration(week.Net), Duration(week.Target), ""}, "T")
+				}
+			}
+		}
+	}
+
+	pdf.Ln(4)
+	pdf.SetFont("Helvetica", "B", 10)
+	for _, total := range [][]string{
+		{"Breaks", Duration(sheet.Pauses)},
+		{"Worked", Duration(sheet.Net)},
+		{"Target", Duration(sheet.Target)},
+		{"Overtime balance", Duration(sheet.Balance)},
+	} {
+		pdf.CellFormat(50, 6, tr(total[0]), "", 0, "L", false, 0, "")
+		pdf.CellFormat(30, 6, tr(total[1]), "", 0, "R", false, 0, "")
+		pdf.Ln(-1)
+	}
+
+	pdf.Ln(18)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, signature := range []string{"Date, signature of the employee", "Date, signature of the employer"} {
+		pdf.CellFormat(80, 5, tr(signature), "T", 0, "L", false, 0, "")
+		pdf.CellFormat(10, 5, "", "", 0, "L", false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	return pdf.Output(w)
+}
@@ -0,0 +1,29 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration(t *testing.T) {
+	assert.Equal(t, "0:00", Duration(0))
+	assert.Equal(t, "7:30", Duration(7*time.Hour+30*time.Minute+20*time.Second))
+	assert.Equal(t, "-1:15", Duration(-75*time.Minute))
+}
+
+func TestTimesheetPDF(t *testing.T) {
+	start, _, err := report.MonthBounds("2023-05", time.UTC)
+	assert.NoError(t, err)
+	blocks := []models.Block{{Start: "2023-05-02T08:00:00Z", End: "2023-05-02T16:00:00Z", Homeoffice: true}}
+	sheet, err := report.BuildTimesheet(start, blocks, time.UTC, models.DefaultSettings(), []string{"2023-05-01"})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, TimesheetPDF(&buf, "test@test.com", sheet))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+}
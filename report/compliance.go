@@ -0,0 +1,99 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// Rule names a working time rule a Violation breaks.
+type Rule string
+
+const (
+	// MaxDaily limits the net time worked on a calendar day.
+	MaxDaily Rule = "max-daily"
+	// MinRest is the rest required between the work of one day and the
+	// next.
+	MinRest Rule = "min-rest"
+)
+
+// ComplianceRules are the limits Check applies.
+type ComplianceRules struct {
+	MaxDaily time.Duration
+	MinRest  time.Duration
+}
+
+// DefaultComplianceRules allows 10 hours of work a day and requires 11 hours
+// of rest between working days.
+func DefaultComplianceRules() ComplianceRules {
+	return ComplianceRules{MaxDaily: 10 * time.Hour, MinRest: 11 * time.Hour}
+}
+
+// Violation is a day on which a rule was broken. Actual is the net time
+// worked that day for MaxDaily and the rest before the day's first block for
+// MinRest.
+type Violation struct {
+	Rule   Rule          `json:"rule"`
+	Day    string        `json:"day"`
+	Actual time.Duration `json:"actual"`
+	Limit  time.Duration `json:"limit"`
+}
+
+// Check returns the violations of the rules by the finished blocks of one
+// user, ordered by day and rule. Days are those of loc, and a block crossing
+// midnight counts toward the days like in Summarize. The rest is checked
+// between blocks that start on different days, so that blocks on the same
+// day may follow each other closely. Zero limits are not checked.
+func Check(blocks []models.Block, loc *time.Location, attribution Attribution, rules ComplianceRules) ([]Violation, error) {
+	var violations []Violation
+
+	if rules.MaxDaily > 0 {
+		days, err := Summarize(blocks, Day, loc, attribution)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range days {
+			if d.Net > rules.MaxDaily {
+				violations = append(violations, Violation{Rule: MaxDaily, Day: d.Period, Actual: d.Net, Limit: rules.MaxDaily})
+			}
+		}
+	}
+
+	if rules.MinRest > 0 {
+		var intervals []interval
+		for _, b := range blocks {
+			if b.End == "" {
+				continue
+			}
+			i, err := parseInterval(b.Start, b.End)
+			if err != nil {
+				return nil, err
+			}
+			intervals = append(intervals, i)
+		}
+		sort.Slice(intervals, func(i, j int) bool {
+			return intervals[i].start.Before(intervals[j].start)
+		})
+
+		// lastEnd is the latest end so far, in case blocks overlap.
+		var lastEnd time.Time
+		for i, current := range intervals {
+			if i > 0 {
+				prevDay, _ := DayBounds(intervals[i-1].start, loc)
+				day, _ := DayBounds(current.start, loc)
+				if rest := current.start.Sub(lastEnd); day.After(prevDay) && rest < rules.MinRest {
+					violations = append(violations, Violation{Rule: MinRest, Day: day.Format(time.DateOnly), Actual: rest, Limit: rules.MinRest})
+				}
+			}
+			if current.end.After(lastEnd) {
+				lastEnd = current.end
+			}
+		}
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Day < violations[j].Day
+	})
+	return violations, nil
+}
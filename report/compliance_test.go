@@ -0,0 +1,50 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	blocks := []models.Block{
+		{Start: "2023-05-08T08:00:00+02:00", End: "2023-05-08T19:30:00+02:00",
+			Pauses: []models.Pause{{Start: "2023-05-08T12:00:00+02:00", End: "2023-05-08T12:30:00+02:00"}}},
+		// Only 10.5 hours of rest, then a second block on the same day.
+		{Start: "2023-05-09T06:00:00+02:00", End: "2023-05-09T14:00:00+02:00"},
+		{Start: "2023-05-09T15:00:00+02:00", End: "2023-05-09T17:00:00+02:00"},
+		// A night shift, 2 hours on May 10 and 8 on May 11.
+		{Start: "2023-05-10T22:00:00+02:00", End: "2023-05-11T08:00:00+02:00"},
+		{Start: "2023-05-11T16:00:00+02:00", End: "2023-05-11T19:00:00+02:00"},
+		{Start: "2023-05-12T08:00:00+02:00"},
+	}
+
+	violations, err := Check(blocks, berlin, Split, DefaultComplianceRules())
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Rule: MaxDaily, Day: "2023-05-08", Actual: 11 * time.Hour, Limit: 10 * time.Hour},
+		{Rule: MinRest, Day: "2023-05-09", Actual: 10*time.Hour + 30*time.Minute, Limit: 11 * time.Hour},
+		{Rule: MaxDaily, Day: "2023-05-11", Actual: 11 * time.Hour, Limit: 10 * time.Hour},
+		{Rule: MinRest, Day: "2023-05-11", Actual: 8 * time.Hour, Limit: 11 * time.Hour},
+	}, violations)
+
+	// On its start day, the night shift alone stays within the limit.
+	violations, err = Check(blocks, berlin, StartDay, DefaultComplianceRules())
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{
+		{Rule: MaxDaily, Day: "2023-05-08", Actual: 11 * time.Hour, Limit: 10 * time.Hour},
+		{Rule: MinRest, Day: "2023-05-09", Actual: 10*time.Hour + 30*time.Minute, Limit: 11 * time.Hour},
+		{Rule: MinRest, Day: "2023-05-11", Actual: 8 * time.Hour, Limit: 11 * time.Hour},
+	}, violations)
+
+	violations, err = Check(blocks, berlin, Split, ComplianceRules{})
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+
+	_, err = Check([]models.Block{{Start: "invalid", End: "2023-05-08T19:30:00+02:00"}}, berlin, Split, DefaultComplianceRules())
+	assert.Error(t, err)
+}
@@ -0,0 +1,256 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+type Period string
+
+const (
+	Day   Period = "day"
+	Week  Period = "week"
+	Month Period = "month"
+)
+
+func ParsePeriod(s string) (Period, error) {
+	switch p := Period(s); p {
+	case Day, Week, Month:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown period %q", s)
+}
+
+// Attribution decides which calendar days a block that crosses midnight
+// counts toward.
+type Attribution string
+
+const (
+	// Split apportions block and pause durations to every day they overlap.
+	Split Attribution = "split"
+	// StartDay attributes the whole block to the day it started on.
+	StartDay Attribution = "start"
+)
+
+func ParseAttribution(s string) (Attribution, error) {
+	switch a := Attribution(s); a {
+	case Split, StartDay:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown attribution %q", s)
+}
+
+type Entry struct {
+	Period     string        `json:"period"`
+	Blocks     int           `json:"blocks"`
+	Homeoffice int           `json:"homeoffice"`
+	Net        time.Duration `json:"net"`
+	Pauses     time.Duration `json:"pauses"`
+}
+
+type interval struct {
+	start time.Time
+	end   time.Time
+}
+
+// overlap returns how long i and other overlap.
+func (i interval) overlap(other interval) time.Duration {
+	start, end := i.start, i.end
+	if other.start.After(start) {
+		start = other.start
+	}
+	if other.end.Before(end) {
+		end = other.end
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+func parseInterval(start string, end string) (interval, error) {
+	s, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return interval{}, err
+	}
+	e, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		return interval{}, err
+	}
+	return interval{start: s, end: e}, nil
+}
+
+func blockIntervals(b models.Block) (interval, []interval, error) {
+	block, err := parseInterval(b.Start, b.End)
+	if err != nil {
+		return interval{}, nil, err
+	}
+
+	pauses := make([]interval, 0, len(b.Pauses))
+	for _, p := range b.Pauses {
+		pause, err := parseInterval(p.Start, p.End)
+		if err != nil {
+			return interval{}, nil, err
+		}
+		pauses = append(pauses, pause)
+	}
+	return block, pauses, nil
+}
+
+// NetDuration returns the time worked in a finished block minus its pauses.
+func NetDuration(b models.Block) (time.Duration, time.Duration, error) {
+	block, pauses, err := blockIntervals(b)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var paused time.Duration
+	for _, p := range pauses {
+		paused += p.end.Sub(p.start)
+	}
+
+	return block.end.Sub(block.start) - paused, paused, nil
+}
+
+// DayBounds returns the start of the calendar day t falls on in loc and the
+// start of the following day. Around DST transitions the day is 23 or 25
+// hours long.
+func DayBounds(t time.Time, loc *time.Location) (time.Time, time.Time) {
+	year, month, day := t.In(loc).Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	return start, time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+}
+
+// PeriodBounds returns the start of the day, ISO week or month t falls on in
+// loc and the start of the following one. Weeks start on Monday.
+func PeriodBounds(t time.Time, period Period, loc *time.Location) (time.Time, time.Time) {
+	year, month, day := t.In(loc).Date()
+	switch period {
+	case Week:
+		day -= (int(t.In(loc).Weekday()) + 6) % 7
+		start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+		return start, time.Date(year, month, day+7, 0, 0, 0, 0, loc)
+	case Month:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		return start, time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+	default:
+		return DayBounds(t, loc)
+	}
+}
+
+// DayShare is the part of a block that falls on one calendar day.
+type DayShare struct {
+	Day    time.Time
+	Net    time.Duration
+	Pauses time.Duration
+}
+
+// SplitByDay apportions the durations of a finished block and its pauses to
+// the calendar days in loc they overlap. Day is the start of each day. A
+// block that starts and ends at the same instant yields a single empty share.
+func SplitByDay(b models.Block, loc *time.Location) ([]DayShare, error) {
+	block, pauses, err := blockIntervals(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var shares []DayShare
+	dayStart, dayEnd := DayBounds(block.start, loc)
+	for {
+		day := interval{start: dayStart, end: dayEnd}
+		share := DayShare{Day: dayStart}
+		for _, p := range pauses {
+			share.Pauses += day.overlap(p)
+		}
+		share.Net = day.overlap(block) - share.Pauses
+		shares = append(shares, share)
+
+		if !dayEnd.Before(block.end) {
+			return shares, nil
+		}
+		dayStart, dayEnd = DayBounds(dayEnd, loc)
+	}
+}
+
+func periodKey(t time.Time, period Period) string {
+	switch period {
+	case Week:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case Month:
+		return t.Format("2006-01")
+	default:
+		return t.Format(time.DateOnly)
+	}
+}
+
+// Summarize groups finished blocks by period using the calendar of loc.
+// With Split, durations are apportioned to every day a block overlaps and the
+// block counts toward each period it touches; with StartDay a block belongs
+// entirely to the period its start falls into. Blocks that have not ended yet
+// are skipped.
+func Summarize(blocks []models.Block, period Period, loc *time.Location, attribution Attribution) ([]Entry, error) {
+	entries := make(map[string]*Entry)
+	add := func(key string, net time.Duration, pauses time.Duration) {
+		e, ok := entries[key]
+		if !ok {
+			e = &Entry{Period: key}
+			entries[key] = e
+		}
+		e.Net += net
+		e.Pauses += pauses
+	}
+
+	for _, b := range blocks {
+		if b.End == "" {
+			continue
+		}
+
+		var keys []string
+		if attribution == StartDay {
+			start, err := time.Parse(time.RFC3339, b.Start)
+			if err != nil {
+				return nil, err
+			}
+			net, pauses, err := NetDuration(b)
+			if err != nil {
+				return nil, err
+			}
+			key := periodKey(start.In(loc), period)
+			add(key, net, pauses)
+			keys = append(keys, key)
+		} else {
+			shares, err := SplitByDay(b, loc)
+			if err != nil {
+				return nil, err
+			}
+			for _, share := range shares {
+				key := periodKey(share.Day, period)
+				add(key, share.Net, share.Pauses)
+				if len(keys) == 0 || keys[len(keys)-1] != key {
+					keys = append(keys, key)
+				}
+			}
+		}
+
+		for _, key := range keys {
+			entries[key].Blocks++
+			if b.Homeoffice {
+				entries[key].Homeoffice++
+			}
+		}
+	}
+
+	result := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Period < result[j].Period
+	})
+
+	return result, nil
+}
@@ -0,0 +1,248 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetDuration(t *testing.T) {
+	net, pauses, err := NetDuration(utils.TestBlock())
+	assert.NoError(t, err)
+	assert.Equal(t, 8*time.Hour, net)
+	assert.Equal(t, 30*time.Minute, pauses)
+
+	block := utils.TestBlock()
+	block.End = "invalid"
+	_, _, err = NetDuration(block)
+	assert.Error(t, err)
+}
+
+func TestSummarize(t *testing.T) {
+	blocks := []models.Block{
+		utils.TestBlock(),
+		{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T11:00:00Z", Homeoffice: true},
+		{Start: "2023-06-01T07:00:00Z", End: "2023-06-01T08:00:00Z"},
+		{Start: "2023-06-02T07:00:00Z"},
+	}
+
+	tests := []struct {
+		period  Period
+		entries []Entry
+	}{
+		{
+			period: Day,
+			entries: []Entry{
+				{Period: "2023-05-09", Blocks: 1, Net: 8 * time.Hour, Pauses: 30 * time.Minute},
+				{Period: "2023-05-10", Blocks: 1, Homeoffice: 1, Net: 4 * time.Hour},
+				{Period: "2023-06-01", Blocks: 1, Net: time.Hour},
+			},
+		},
+		{
+			period: Week,
+			entries: []Entry{
+				{Period: "2023-W19", Blocks: 2, Homeoffice: 1, Net: 12 * time.Hour, Pauses: 30 * time.Minute},
+				{Period: "2023-W22", Blocks: 1, Net: time.Hour},
+			},
+		},
+		{
+			period: Month,
+			entries: []Entry{
+				{Period: "2023-05", Blocks: 2, Homeoffice: 1, Net: 12 * time.Hour, Pauses: 30 * time.Minute},
+				{Period: "2023-06", Blocks: 1, Net: time.Hour},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.period), func(t *testing.T) {
+			entries, err := Summarize(blocks, test.period, time.UTC, Split)
+			assert.NoError(t, err)
+			assert.Equal(t, test.entries, entries)
+		})
+	}
+}
+
+func TestSummarizeLocation(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	blocks := []models.Block{
+		{Start: "2023-03-25T23:30:00Z", End: "2023-03-26T01:30:00Z"},
+		{Start: "2023-10-28T21:30:00Z", End: "2023-10-28T23:30:00Z"},
+	}
+
+	entries, err := Summarize(blocks, Day, time.UTC, StartDay)
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-03-25", entries[0].Period)
+	assert.Equal(t, "2023-10-28", entries[1].Period)
+
+	entries, err = Summarize(blocks, Day, berlin, StartDay)
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Period: "2023-03-26", Blocks: 1, Net: 2 * time.Hour},
+		{Period: "2023-10-28", Blocks: 1, Net: 2 * time.Hour},
+	}, entries)
+}
+
+func TestDayBounds(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		at     string
+		start  string
+		end    string
+		length time.Duration
+	}{
+		{"2023-03-26T12:00:00Z", "2023-03-26T00:00:00+01:00", "2023-03-27T00:00:00+02:00", 23 * time.Hour},
+		{"2023-10-29T12:00:00Z", "2023-10-29T00:00:00+02:00", "2023-10-30T00:00:00+01:00", 25 * time.Hour},
+		{"2023-05-09T22:30:00Z", "2023-05-10T00:00:00+02:00", "2023-05-11T00:00:00+02:00", 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.at, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, test.at)
+			assert.NoError(t, err)
+
+			start, end := DayBounds(at, berlin)
+			assert.Equal(t, test.start, start.Format(time.RFC3339))
+			assert.Equal(t, test.end, end.Format(time.RFC3339))
+			assert.Equal(t, test.length, end.Sub(start))
+		})
+	}
+}
+
+func TestPeriodBounds(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		at     string
+		period Period
+		start  string
+		end    string
+	}{
+		{"2023-05-09T12:00:00Z", Day, "2023-05-09T00:00:00+02:00", "2023-05-10T00:00:00+02:00"},
+		{"2023-05-09T12:00:00Z", Week, "2023-05-08T00:00:00+02:00", "2023-05-15T00:00:00+02:00"},
+		{"2023-05-14T22:30:00Z", Week, "2023-05-15T00:00:00+02:00", "2023-05-22T00:00:00+02:00"},
+		{"2023-03-29T12:00:00Z", Week, "2023-03-27T00:00:00+02:00", "2023-04-03T00:00:00+02:00"},
+		{"2023-10-31T23:30:00Z", Month, "2023-11-01T00:00:00+01:00", "2023-12-01T00:00:00+01:00"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.period)+" "+test.at, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, test.at)
+			assert.NoError(t, err)
+
+			start, end := PeriodBounds(at, test.period, berlin)
+			assert.Equal(t, test.start, start.Format(time.RFC3339))
+			assert.Equal(t, test.end, end.Format(time.RFC3339))
+		})
+	}
+}
+
+func TestSplitByDay(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	block := models.Block{
+		Start: "2023-05-09T22:00:00+02:00",
+		End:   "2023-05-11T06:00:00+02:00",
+		Pauses: []models.Pause{
+			{Start: "2023-05-09T23:30:00+02:00", End: "2023-05-10T00:30:00+02:00"},
+		},
+	}
+	shares, err := SplitByDay(block, berlin)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(shares))
+	assert.Equal(t, "2023-05-09T00:00:00+02:00", shares[0].Day.Format(time.RFC3339))
+	assert.Equal(t, DayShare{Day: shares[0].Day, Net: 90 * time.Minute, Pauses: 30 * time.Minute}, shares[0])
+	assert.Equal(t, DayShare{Day: shares[1].Day, Net: 23*time.Hour + 30*time.Minute, Pauses: 30 * time.Minute}, shares[1])
+	assert.Equal(t, DayShare{Day: shares[2].Day, Net: 6 * time.Hour}, shares[2])
+
+	// The night of the switch to summer time has one hour less.
+	block = models.Block{Start: "2023-03-25T22:00:00+01:00", End: "2023-03-26T06:00:00+02:00"}
+	shares, err = SplitByDay(block, berlin)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(shares))
+	assert.Equal(t, 2*time.Hour, shares[0].Net)
+	assert.Equal(t, 5*time.Hour, shares[1].Net)
+
+	block = models.Block{Start: "2023-05-10T00:00:00+02:00", End: "2023-05-10T00:00:00+02:00"}
+	shares, err = SplitByDay(block, berlin)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(shares))
+
+	block.End = "invalid"
+	_, err = SplitByDay(block, berlin)
+	assert.Error(t, err)
+}
+
+func TestSummarizeAttribution(t *testing.T) {
+	blocks := []models.Block{
+		{Start: "2023-05-07T22:00:00Z", End: "2023-05-08T06:00:00Z", Homeoffice: true},
+		{Start: "2023-05-08T22:00:00Z", End: "2023-05-09T06:00:00Z"},
+	}
+
+	tests := []struct {
+		attribution Attribution
+		period      Period
+		entries     []Entry
+	}{
+		{
+			attribution: Split,
+			period:      Day,
+			entries: []Entry{
+				{Period: "2023-05-07", Blocks: 1, Homeoffice: 1, Net: 2 * time.Hour},
+				{Period: "2023-05-08", Blocks: 2, Homeoffice: 1, Net: 8 * time.Hour},
+				{Period: "2023-05-09", Blocks: 1, Net: 6 * time.Hour},
+			},
+		},
+		{
+			attribution: Split,
+			period:      Week,
+			entries: []Entry{
+				{Period: "2023-W18", Blocks: 1, Homeoffice: 1, Net: 2 * time.Hour},
+				{Period: "2023-W19", Blocks: 2, Homeoffice: 1, Net: 14 * time.Hour},
+			},
+		},
+		{
+			attribution: StartDay,
+			period:      Day,
+			entries: []Entry{
+				{Period: "2023-05-07", Blocks: 1, Homeoffice: 1, Net: 8 * time.Hour},
+				{Period: "2023-05-08", Blocks: 1, Net: 8 * time.Hour},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.attribution)+"/"+string(test.period), func(t *testing.T) {
+			entries, err := Summarize(blocks, test.period, time.UTC, test.attribution)
+			assert.NoError(t, err)
+			assert.Equal(t, test.entries, entries)
+		})
+	}
+}
+
+func TestParseAttribution(t *testing.T) {
+	a, err := ParseAttribution("start")
+	assert.NoError(t, err)
+	assert.Equal(t, StartDay, a)
+
+	_, err = ParseAttribution("end")
+	assert.Error(t, err)
+}
+
+func TestParsePeriod(t *testing.T) {
+	p, err := ParsePeriod("week")
+	assert.NoError(t, err)
+	assert.Equal(t, Week, p)
+
+	_, err = ParsePeriod("year")
+	assert.Error(t, err)
+}
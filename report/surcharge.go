@@ -0,0 +1,232 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// CategoryMinutes is the time worked in one surcharge category.
+type CategoryMinutes struct {
+	Category string `json:"category"`
+	Percent  int    `json:"percent"`
+	Minutes  int    `json:"minutes"`
+}
+
+// PayrollEntry lists the minutes worked per surcharge category in a month.
+type PayrollEntry struct {
+	Month      string            `json:"month"`
+	Categories []CategoryMinutes `json:"categories"`
+}
+
+type surchargeRule struct {
+	models.SurchargeRule
+	from     time.Duration
+	to       time.Duration
+	windowed bool
+}
+
+// covers reports whether the rule applies at the given time of day on a day
+// that is a holiday or not.
+func (r surchargeRule) covers(weekday time.Weekday, holiday bool, clock time.Duration) bool {
+	if r.Holiday && !holiday {
+		return false
+	}
+	if len(r.Weekdays) > 0 {
+		found := false
+		for _, d := range r.Weekdays {
+			found = found || d == weekday
+		}
+		if !found {
+			return false
+		}
+	}
+	if !r.windowed {
+		return true
+	}
+	if r.from < r.to {
+		return clock >= r.from && clock < r.to
+	}
+	return clock >= r.from || clock < r.to
+}
+
+// SurchargeEngine assigns worked time to the surcharge categories of a
+// configuration. Where several rules apply the one with the highest percentage
+// wins, on a tie the one listed first. Time no rule applies to is regular.
+type SurchargeEngine struct {
+	rules    []surchargeRule
+	holidays map[string]bool
+	loc      *time.Location
+}
+
+// NewSurchargeEngine evaluates config on the calendar and clock of loc.
+func NewSurchargeEngine(config models.SurchargeConfig, loc *time.Location) (*SurchargeEngine, error) {
+	e := &SurchargeEngine{holidays: make(map[string]bool), loc: loc}
+	for _, r := range config.Rules {
+		from, to, windowed, err := r.Window()
+		if err != nil {
+			return nil, fmt.Errorf("invalid window of %q: %w", r.Category, err)
+		}
+		e.rules = append(e.rules, surchargeRule{SurchargeRule: r, from: from, to: to, windowed: windowed})
+	}
+	for _, h := range config.Holidays {
+		e.holidays[h] = true
+	}
+	return e, nil
+}
+
+// category returns the index of the rule that applies at t, or -1.
+func (e *SurchargeEngine) category(t time.Time) int {
+	local := t.In(e.loc)
+	hour, min, sec := local.Clock()
+	clock := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+	holiday := e.holidays[local.Format(time.DateOnly)]
+
+	best := -1
+	for i, r := range e.rules {
+		if r.covers(local.Weekday(), holiday, clock) && (best == -1 || r.Percent > e.rules[best].Percent) {
+			best = i
+		}
+	}
+	return best
+}
+
+// nextBoundary returns the first instant after t at which the applicable
+// rule may change: a rule's window opening or closing, or midnight.
+func (e *SurchargeEngine) nextBoundary(t time.Time) time.Time {
+	dayStart, next := DayBounds(t, e.loc)
+	year, month, day := dayStart.Date()
+	for _, r := range e.rules {
+		if !r.windowed {
+			continue
+		}
+		for _, offset := range []time.Duration{r.from, r.to} {
+			b := time.Date(year, month, day, 0, 0, int(offset/time.Second), 0, e.loc)
+			if b.After(t) && b.Before(next) {
+				next = b
+			}
+		}
+	}
+	return next
+}
+
+// split calls add for every stretch of the worked interval with the index of
+// the rule that applies to it.
+func (e *SurchargeEngine) split(worked interval, add func(t time.Time, rule int, d time.Duration)) {
+	for t := worked.start; t.Before(worked.end); {
+		next := e.nextBoundary(t)
+		if next.After(worked.end) {
+			next = worked.end
+		}
+		add(t, e.category(t), next.Sub(t))
+		t = next
+	}
+}
+
+// workedIntervals returns the parts of a finished block not covered by its
+// pauses.
+func workedIntervals(b models.Block) ([]interval, error) {
+	block, pauses, err := blockIntervals(b)
+	if err != nil {
+		return nil, err
+	}
+
+	worked := []interval{block}
+	for _, p := range pauses {
+		var rest []interval
+		for _, w := range worked {
+			if p.start.After(w.start) {
+				rest = append(rest, interval{start: w.start, end: minTime(w.end, p.start)})
+			}
+			if p.end.Before(w.end) {
+				rest = append(rest, interval{start: maxTime(w.start, p.end), end: w.end})
+			}
+		}
+		worked = rest
+	}
+	return worked, nil
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Breakdown returns the net time of a finished block per surcharge category.
+func (e *SurchargeEngine) Breakdown(b models.Block) (map[string]time.Duration, error) {
+	worked, err := workedIntervals(b)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]time.Duration)
+	for _, w := range worked {
+		e.split(w, func(t time.Time, rule int, d time.Duration) {
+			result[e.categoryName(rule)] += d
+		})
+	}
+	return result, nil
+}
+
+func (e *SurchargeEngine) categoryName(rule int) string {
+	if rule == -1 {
+		return models.RegularCategory
+	}
+	return e.rules[rule].Category
+}
+
+// Payroll sums up the net time of finished blocks per month and surcharge
+// category. Every entry lists all categories, regular first, in the order of
+// the configuration. Blocks that have not ended yet are skipped.
+func (e *SurchargeEngine) Payroll(blocks []models.Block) ([]PayrollEntry, error) {
+	months := make(map[string][]time.Duration)
+	var keys []string
+	for _, b := range blocks {
+		if b.End == "" {
+			continue
+		}
+		worked, err := workedIntervals(b)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range worked {
+			e.split(w, func(t time.Time, rule int, d time.Duration) {
+				key := t.In(e.loc).Format("2006-01")
+				if _, ok := months[key]; !ok {
+					months[key] = make([]time.Duration, len(e.rules)+1)
+					keys = append(keys, key)
+				}
+				months[key][rule+1] += d
+			})
+		}
+	}
+
+	sort.Strings(keys)
+	entries := make([]PayrollEntry, 0, len(keys))
+	for _, key := range keys {
+		entry := PayrollEntry{Month: key}
+		for i, d := range months[key] {
+			category := CategoryMinutes{
+				Category: e.categoryName(i - 1),
+				Minutes:  int(d.Round(time.Minute) / time.Minute),
+			}
+			if i > 0 {
+				category.Percent = e.rules[i-1].Percent
+			}
+			entry.Categories = append(entry.Categories, category)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,127 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSurchargeEngine(t *testing.T) *SurchargeEngine {
+	config := models.DefaultSurchargeConfig()
+	config.Holidays = []string{"2023-05-01"}
+	e, err := NewSurchargeEngine(config, time.UTC)
+	assert.NoError(t, err)
+	return e
+}
+
+func TestSurchargeBreakdown(t *testing.T) {
+	e := newTestSurchargeEngine(t)
+
+	tests := []struct {
+		name  string
+		block models.Block
+		want  map[string]time.Duration
+	}{
+		{
+			name:  "regular",
+			block: utils.TestBlock(),
+			want:  map[string]time.Duration{"regular": 8 * time.Hour},
+		},
+		{
+			name: "night shift",
+			block: models.Block{
+				Start: "2023-05-09T18:00:00Z",
+				End:   "2023-05-10T07:00:00Z",
+				Pauses: []models.Pause{
+					{Start: "2023-05-10T00:00:00Z", End: "2023-05-10T01:00:00Z"},
+				},
+			},
+			want: map[string]time.Duration{"regular": 3 * time.Hour, "night": 9 * time.Hour},
+		},
+		{
+			name:  "sunday beats night",
+			block: models.Block{Start: "2023-05-06T22:00:00Z", End: "2023-05-07T08:00:00Z"},
+			want:  map[string]time.Duration{"night": 2 * time.Hour, "sunday": 8 * time.Hour},
+		},
+		{
+			name:  "holiday",
+			block: models.Block{Start: "2023-04-30T23:00:00Z", End: "2023-05-01T21:00:00Z"},
+			want:  map[string]time.Duration{"sunday": time.Hour, "holiday": 21 * time.Hour},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := e.Breakdown(test.block)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestSurchargeLocation(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	e, err := NewSurchargeEngine(models.DefaultSurchargeConfig(), berlin)
+	assert.NoError(t, err)
+
+	// 17:00 to 23:00 UTC is 19:00 to 01:00 in Berlin.
+	got, err := e.Breakdown(models.Block{Start: "2023-05-09T17:00:00Z", End: "2023-05-09T23:00:00Z"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"regular": time.Hour, "night": 5 * time.Hour}, got)
+
+	// The night of the switch to summer time has one hour less.
+	got, err = e.Breakdown(models.Block{Start: "2023-03-27T20:00:00+02:00", End: "2023-03-28T06:00:00+02:00"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"night": 10 * time.Hour}, got)
+	got, err = e.Breakdown(models.Block{Start: "2023-03-25T20:00:00+01:00", End: "2023-03-26T06:00:00+02:00"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"night": 4 * time.Hour, "sunday": 5 * time.Hour}, got)
+}
+
+func TestPayroll(t *testing.T) {
+	e := newTestSurchargeEngine(t)
+
+	blocks := []models.Block{
+		{Start: "2023-04-30T22:00:00Z", End: "2023-05-01T02:00:00Z"},
+		utils.TestBlock(),
+		{Start: "2023-06-01T07:00:00Z"},
+	}
+
+	entries, err := e.Payroll(blocks)
+	assert.NoError(t, err)
+	assert.Equal(t, []PayrollEntry{
+		{
+			Month: "2023-04",
+			Categories: []CategoryMinutes{
+				{Category: "regular", Minutes: 0},
+				{Category: "night", Percent: 25, Minutes: 0},
+				{Category: "sunday", Percent: 50, Minutes: 120},
+				{Category: "holiday", Percent: 125, Minutes: 0},
+			},
+		},
+		{
+			Month: "2023-05",
+			Categories: []CategoryMinutes{
+				{Category: "regular", Minutes: 480},
+				{Category: "night", Percent: 25, Minutes: 0},
+				{Category: "sunday", Percent: 50, Minutes: 0},
+				{Category: "holiday", Percent: 125, Minutes: 120},
+			},
+		},
+	}, entries)
+
+	block := utils.TestBlock()
+	block.End = "invalid"
+	_, err = e.Payroll([]models.Block{block})
+	assert.Error(t, err)
+}
+
+func TestNewSurchargeEngine(t *testing.T) {
+	config := models.SurchargeConfig{Rules: []models.SurchargeRule{{Category: "night", From: "20:00"}}}
+	_, err := NewSurchargeEngine(config, time.UTC)
+	assert.Error(t, err)
+}
@@ -0,0 +1,210 @@
+package report
+
+import (
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+// TimesheetDay is one calendar day of a timesheet. Start and End are the wall
+// clock times of the first and last work on that day, empty if nothing was
+// worked; work continuing past midnight ends at 24:00.
+type TimesheetDay struct {
+	Date       time.Time
+	Week       string
+	Start      string
+	End        string
+	Pauses     time.Duration
+	Net        time.Duration
+	Target     time.Duration
+	Homeoffice bool
+	Holiday    bool
+}
+
+// TimesheetWeek sums the days of an ISO week that fall into the month.
+type TimesheetWeek struct {
+	Week   string
+	Net    time.Duration
+	Target time.Duration
+}
+
+// Timesheet lists every day of a month with weekly and monthly totals.
+// Balance is the overtime of the month, the net time minus the target.
+type Timesheet struct {
+	Month   string
+	Days    []TimesheetDay
+	Weeks   []TimesheetWeek
+	Net     time.Duration
+	Pauses  time.Duration
+	Target  time.Duration
+	Balance time.Duration
+}
+
+// MonthBounds parses a month like 2023-05 and returns its first instant in
+// loc and the first instant of the following month.
+func MonthBounds(month string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", month, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// BuildTimesheet lays out the finished blocks overlapping the month starting
+// at monthStart on the calendar of loc. The target of each day comes from
+// settings, except on holidays where nothing is expected.
+func BuildTimesheet(monthStart time.Time, blocks []models.Block, loc *time.Location, settings models.Settings, holidays []string) (Timesheet, error) {
+	isHoliday := make(map[string]bool)
+	for _, h := range holidays {
+		isHoliday[h] = true
+	}
+
+	sheet := Timesheet{Month: monthStart.Format("2006-01")}
+	index := make(map[string]int)
+	for day := monthStart; day.Month() == monthStart.Month(); day = day.AddDate(0, 0, 1) {
+		key := day.Format(time.DateOnly)
+		d := TimesheetDay{
+			Date:    day,
+			Week:    periodKey(day, Week),
+			Holiday: isHoliday[key],
+		}
+		if !d.Holiday {
+			d.Target = settings.Target(day.Weekday())
+		}
+		index[key] = len(sheet.Days)
+		sheet.Days = append(sheet.Days, d)
+	}
+
+	for _, b := range blocks {
+		if b.End == "" {
+			continue
+		}
+		block, _, err := blockIntervals(b)
+		if err != nil {
+			return sheet, err
+		}
+		shares, err := SplitByDay(b, loc)
+		if err != nil {
+			return sheet, err
+		}
+
+		for _, share := range shares {
+			i, ok := index[share.Day.Format(time.DateOnly)]
+			if !ok {
+				continue
+			}
+			d := &sheet.Days[i]
+			_, dayEnd := DayBounds(share.Day, loc)
+
+			start := maxTime(block.start, share.Day).In(loc).Format("15:04")
+			end := "24:00"
+			if block.end.Before(dayEnd) {
+				end = block.end.In(loc).Format("15:04")
+			}
+			if d.Start == "" || start < d.Start {
+				d.Start = start
+			}
+			if end > d.End {
+				d.End = end
+			}
+
+			d.Net += share.Net
+			d.Pauses += share.Pauses
+			d.Homeoffice = d.Homeoffice || b.Homeoffice
+		}
+	}
+
+	for _, d := range sheet.Days {
+		if len(sheet.Weeks) == 0 || sheet.Weeks[len(sheet.Weeks)-1].Week != d.Week {
+			sheet.Weeks = append(sheet.Weeks, TimesheetWeek{Week: d.Week})
+		}
+		w := &sheet.Weeks[len(sheet.Weeks)-1]
+		w.Net += d.Net
+		w.Target += d.Target
+
+		sheet.Net += d.Net
+		sheet.Pauses += d.Pauses
+		sheet.Target += d.Target
+	}
+	sheet.Balance = sheet.Net - sheet.Target
+
+	return sheet, nil
+}
+
+// Totals sum up the work of a user as of an instant on the calendar of their
+// time zone. Balance is the overtime of the month so far, the net time of the
+// month minus the target of its days up to and including today.
+type Totals struct {
+	Today   time.Duration
+	Week    time.Duration
+	Month   time.Duration
+	Target  time.Duration
+	Balance time.Duration
+}
+
+// TotalsAt sums up the blocks as of now. A running block or pause counts
+// until now, and blocks that start after now are ignored.
+func TotalsAt(now time.Time, blocks []models.Block, loc *time.Location, settings models.Settings, holidays []string) (Totals, error) {
+	var totals Totals
+	dayStart, dayEnd := DayBounds(now, loc)
+	weekStart, _ := PeriodBounds(now, Week, loc)
+	monthStart, _ := PeriodBounds(now, Month, loc)
+
+	isHoliday := make(map[string]bool)
+	for _, h := range holidays {
+		isHoliday[h] = true
+	}
+	for day := monthStart; day.Before(dayEnd); day = day.AddDate(0, 0, 1) {
+		if !isHoliday[day.Format(time.DateOnly)] {
+			totals.Target += settings.Target(day.Weekday())
+		}
+	}
+
+	until := now.Format(time.RFC3339)
+	for _, b := range blocks {
+		b = runUntil(b, until)
+		if start, err := time.Parse(time.RFC3339, b.Start); err != nil {
+			return totals, err
+		} else if !start.Before(now) {
+			continue
+		}
+		shares, err := SplitByDay(b, loc)
+		if err != nil {
+			return totals, err
+		}
+		for _, share := range shares {
+			if share.Day.After(now) {
+				continue
+			}
+			if !share.Day.Before(dayStart) {
+				totals.Today += share.Net
+			}
+			if !share.Day.Before(weekStart) {
+				totals.Week += share.Net
+			}
+			if !share.Day.Before(monthStart) {
+				totals.Month += share.Net
+			}
+		}
+	}
+	totals.Balance = totals.Month - totals.Target
+
+	return totals, nil
+}
+
+// runUntil returns a copy of b where the block and its pauses that are still
+// running end at until.
+func runUntil(b models.Block, until string) models.Block {
+	if b.End == "" {
+		b.End = until
+	}
+	pauses := make([]models.Pause, len(b.Pauses))
+	for i, p := range b.Pauses {
+		if p.End == "" {
+			p.End = until
+		}
+		pauses[i] = p
+	}
+	b.Pauses = pauses
+	return b
+}
@@ -0,0 +1,116 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonthBounds(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	start, end, err := MonthBounds("2023-03", loc)
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-03-01T00:00:00+01:00", start.Format(time.RFC3339))
+	assert.Equal(t, "2023-04-01T00:00:00+02:00", end.Format(time.RFC3339))
+
+	for _, invalid := range []string{"", "2023-13", "2023-05-01", "May 2023"} {
+		_, _, err = MonthBounds(invalid, loc)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestBuildTimesheet(t *testing.T) {
+	start, _, err := MonthBounds("2023-05", time.UTC)
+	assert.NoError(t, err)
+
+	blocks := []models.Block{
+		{
+			Start:      "2023-04-30T22:00:00Z",
+			End:        "2023-05-01T02:00:00Z",
+			Homeoffice: true,
+		},
+		{
+			Start: "2023-05-02T08:00:00Z",
+			End:   "2023-05-02T16:30:00Z",
+			Pauses: []models.Pause{
+				{Start: "2023-05-02T12:00:00Z", End: "2023-05-02T12:30:00Z"},
+			},
+		},
+		{
+			Start: "2023-05-02T18:00:00Z",
+			End:   "2023-05-02T19:00:00Z",
+		},
+		{
+			Start: "2023-05-31T22:00:00Z",
+			End:   "2023-06-01T01:00:00Z",
+		},
+		{Start: "2023-05-12T08:00:00Z"},
+	}
+	settings := models.Settings{Timezone: "UTC", TargetMinutes: models.DefaultTargetMinutes()}
+
+	sheet, err := BuildTimesheet(start, blocks, time.UTC, settings, []string{"2023-05-01"})
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-05", sheet.Month)
+	assert.Equal(t, 31, len(sheet.Days))
+
+	holiday := sheet.Days[0]
+	assert.True(t, holiday.Holiday)
+	assert.True(t, holiday.Homeoffice)
+	assert.Equal(t, "00:00", holiday.Start)
+	assert.Equal(t, "02:00", holiday.End)
+	assert.Equal(t, 2*time.Hour, holiday.Net)
+	assert.Equal(t, time.Duration(0), holiday.Target)
+
+	tuesday := sheet.Days[1]
+	assert.Equal(t, "08:00", tuesday.Start)
+	assert.Equal(t, "19:00", tuesday.End)
+	assert.Equal(t, 30*time.Minute, tuesday.Pauses)
+	assert.Equal(t, 9*time.Hour, tuesday.Net)
+	assert.Equal(t, 8*time.Hour, tuesday.Target)
+	assert.False(t, tuesday.Homeoffice)
+
+	last := sheet.Days[30]
+	assert.Equal(t, "22:00", last.Start)
+	assert.Equal(t, "24:00", last.End)
+	assert.Equal(t, 2*time.Hour, last.Net)
+
+	assert.Equal(t, "", sheet.Days[11].Start)
+	assert.Equal(t, time.Duration(0), sheet.Days[11].Net)
+
+	assert.Equal(t, 5, len(sheet.Weeks))
+	assert.Equal(t, TimesheetWeek{Week: "2023-W18", Net: 11 * time.Hour, Target: 32 * time.Hour}, sheet.Weeks[0])
+	assert.Equal(t, TimesheetWeek{Week: "2023-W22", Net: 2 * time.Hour, Target: 24 * time.Hour}, sheet.Weeks[4])
+
+	assert.Equal(t, 13*time.Hour, sheet.Net)
+	assert.Equal(t, 30*time.Minute, sheet.Pauses)
+	assert.Equal(t, 176*time.Hour, sheet.Target)
+	assert.Equal(t, -163*time.Hour, sheet.Balance)
+}
+
+func TestTotalsAt(t *testing.T) {
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	blocks := []models.Block{
+		{Start: "2023-05-02T08:00:00Z", End: "2023-05-02T18:00:00Z"},
+		{Start: "2023-05-08T08:00:00Z", End: "2023-05-08T16:00:00Z"},
+		{Start: "2023-05-10T08:00:00Z", Pauses: []models.Pause{
+			{Start: "2023-05-10T10:00:00Z", End: "2023-05-10T10:30:00Z"},
+			{Start: "2023-05-10T11:30:00Z"},
+		}},
+		{Start: "2023-05-11T08:00:00Z", End: "2023-05-11T16:00:00Z"},
+	}
+	settings := models.Settings{Timezone: "UTC", TargetMinutes: models.DefaultTargetMinutes()}
+
+	totals, err := TotalsAt(now, blocks, time.UTC, settings, []string{"2023-05-01"})
+	assert.NoError(t, err)
+	assert.Equal(t, Totals{
+		Today:   3 * time.Hour,
+		Week:    11 * time.Hour,
+		Month:   21 * time.Hour,
+		Target:  56 * time.Hour,
+		Balance: -35 * time.Hour,
+	}, totals)
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kilianmandscharo/work_hours/auth"
+	"github.com/kilianmandscharo/work_hours/database"
+)
+
+// apiError is an error that is specific to the HTTP layer, e.g. a body that
+// could not be parsed.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+var (
+	errInvalidBody = &apiError{
+		status:  http.StatusBadRequest,
+		code:    "invalid_body",
+		message: "could not read body",
+	}
+	errInvalidParameter = &apiError{
+		status:  http.StatusBadRequest,
+		code:    "invalid_parameter",
+		message: "could not read query parameter",
+	}
+	errInvalidDatetime = &apiError{
+		status:  http.StatusBadRequest,
+		code:    "invalid_datetime",
+		message: "invalid datetime found",
+	}
+	errInvalidMonth = &apiError{
+		status:  http.StatusBadRequest,
+		code:    "invalid_month",
+		message: "month must have the format YYYY-MM",
+	}
+	errInvalidCalendar = &apiError{
+		status:  http.StatusBadRequest,
+		code:    "invalid_calendar",
+		message: "could not read iCalendar file",
+	}
+	errInvalidFormat = &apiError{
+		status:  http.StatusBadRequest,
+		code:    "invalid_format",
+		message: "format must be one of timewarrior, toggl-csv and toggl-json",
+	}
+	errInvalidImport = &apiError{
+		status:  http.StatusBadRequest,
+		code:    "invalid_import",
+		message: "could not read imported file",
+	}
+	errInvalidEmail = &apiError{
+		status:  http.StatusUnauthorized,
+		code:    "invalid_email",
+		message: "invalid email",
+	}
+	errInvalidPassword = &apiError{
+		status:  http.StatusUnauthorized,
+		code:    "invalid_password",
+		message: "invalid password",
+	}
+	errTokenStillValid = &apiError{
+		status:  http.StatusBadRequest,
+		code:    "token_still_valid",
+		message: "token still valid",
+	}
+	errForbidden = &apiError{
+		status:  http.StatusForbidden,
+		code:    "forbidden",
+		message: "your role does not allow this",
+	}
+	errNotSupported = &apiError{
+		status:  http.StatusNotImplemented,
+		code:    "not_supported",
+		message: "not supported by this database",
+	}
+	errSnapshotsDisabled = &apiError{
+		status:  http.StatusNotImplemented,
+		code:    "snapshots_disabled",
+		message: "snapshots are not configured, start the server with -snapshot-dir",
+	}
+	errDigestKeyMissing = &apiError{
+		status:  http.StatusNotImplemented,
+		code:    "digest_key_missing",
+		message: "audit digests are not configured, set DIGEST_KEY",
+	}
+	errInternal = &apiError{
+		status:  http.StatusInternalServerError,
+		code:    "internal_error",
+		message: "internal server error",
+	}
+)
+
+// Problem is an RFC 7807 problem details object extended with a stable error
+// code.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var dbErr *database.Error
+	if errors.As(err, &dbErr) {
+		status := http.StatusInternalServerError
+		switch dbErr.Kind {
+		case database.ErrNotFound:
+			status = http.StatusNotFound
+		case database.ErrConflict, database.ErrInvalidState:
+			status = http.StatusConflict
+		case database.ErrValidation:
+			status = http.StatusBadRequest
+		}
+		return &apiError{status: status, code: dbErr.Code, message: dbErr.Message}
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrMissingToken):
+		return &apiError{status: http.StatusBadRequest, code: "missing_token", message: err.Error()}
+	case errors.Is(err, auth.ErrInvalidToken):
+		return &apiError{status: http.StatusBadRequest, code: "invalid_token", message: err.Error()}
+	case errors.Is(err, auth.ErrUnauthorized):
+		return &apiError{status: http.StatusUnauthorized, code: "unauthorized", message: err.Error()}
+	}
+
+	return errInternal
+}
+
+func newProblem(err *apiError, instance string) Problem {
+	return Problem{
+		Type:     "/problems/" + err.code,
+		Title:    http.StatusText(err.status),
+		Status:   err.status,
+		Detail:   err.message,
+		Instance: instance,
+		Code:     err.code,
+	}
+}
+
+// errorHandler turns the last error attached to the context into a
+// problem+json response, unless the handler already wrote a response.
+func errorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		apiErr := toAPIError(err)
+		if apiErr == errInternal {
+			log.Printf("ERROR: %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		}
+
+		c.Header("Content-Type", "application/problem+json")
+		c.JSON(apiErr.status, newProblem(apiErr, c.Request.URL.Path))
+	}
+}
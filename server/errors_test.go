@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kilianmandscharo/work_hours/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func assertProblem(t *testing.T, r *gin.Engine, token string, method string, route string, status int, code string) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, route, nil)
+	if token != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, status, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var p Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, status, p.Status)
+	assert.Equal(t, code, p.Code)
+	assert.Equal(t, "/problems/"+code, p.Type)
+	assert.Equal(t, http.StatusText(status), p.Title)
+	assert.NotEmpty(t, p.Detail)
+}
+
+func TestProblemResponses(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("missing token", func(t *testing.T) {
+		assertProblem(t, r, "", http.MethodGet, "/block", http.StatusBadRequest, "missing_token")
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		assertProblem(t, r, "invalid", http.MethodGet, "/block", http.StatusBadRequest, "invalid_token")
+	})
+
+	t.Run("invalid parameter", func(t *testing.T) {
+		assertProblem(t, r, token, http.MethodGet, "/block/a", http.StatusBadRequest, "invalid_parameter")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		assertProblem(t, r, token, http.MethodGet, "/block/12", http.StatusNotFound, "block_not_found")
+	})
+
+	t.Run("invalid state", func(t *testing.T) {
+		assertProblem(t, r, token, http.MethodPost, "/current_block_end", http.StatusConflict, "no_block_active")
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		db.WithUser(email).StartBlock(false, time.Now())
+		assertProblem(t, r, token, http.MethodPost, "/current_block_start?homeoffice=false", http.StatusConflict, "block_already_active")
+	})
+}
+
+func TestToAPIError(t *testing.T) {
+	assert.Equal(t, http.StatusBadRequest, toAPIError(database.NewValidationError("invalid", "invalid")).status)
+	assert.Equal(t, errInternal, toAPIError(fmt.Errorf("unexpected")))
+	assert.Equal(t, "block_not_found", toAPIError(fmt.Errorf("wrapped: %w", database.ErrBlockNotFound)).code)
+	assert.Equal(t, "invalid_timezone", toAPIError(database.ErrInvalidTimezone).code)
+}
@@ -0,0 +1,802 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kilianmandscharo/work_hours/auth"
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/report"
+)
+
+type parameter struct {
+	name        string
+	in          string
+	typ         string
+	required    bool
+	description string
+}
+
+// operation documents a single route. The OpenAPI document is generated from
+// this table, with schemas derived from the Go types of body and response.
+type operation struct {
+	method   string
+	path     string
+	summary  string
+	params   []parameter
+	body     any
+	response any
+	// contentType is set for responses that are not JSON.
+	contentType string
+	// bodyContentType is set for request bodies that are not JSON.
+	bodyContentType string
+	errors          []int
+	public          bool
+}
+
+var idParam = parameter{name: "id", in: "path", typ: "integer", required: true}
+
+// rangeParams select blocks like database.ParseTimeRange.
+var rangeParams = []parameter{
+	{name: "start", in: "query", typ: "string", description: "RFC3339 start of the range, inclusive"},
+	{name: "end", in: "query", typ: "string", description: "RFC3339 end of the range, exclusive"},
+	{name: "mode", in: "query", typ: "string", description: "contained (default) selects blocks completely within the range, overlapping selects blocks that overlap it"},
+}
+
+var emailParam = parameter{name: "email", in: "path", typ: "string", required: true}
+
+var formatParam = parameter{name: "format", in: "query", typ: "string", required: true, description: "timewarrior, toggl-csv or toggl-json"}
+
+var operations = []operation{
+	{
+		method:   http.MethodPost,
+		path:     "/block",
+		summary:  "Add a finished block with its pauses",
+		body:     models.BlockCreate{},
+		response: models.Block{},
+		errors:   []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/block",
+		summary: "Replace start, end and homeoffice of a block",
+		body:    models.Block{},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/block_start/{id}",
+		summary: "Update the start of a block",
+		params:  []parameter{idParam},
+		body:    models.BodyStart{},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/block_end/{id}",
+		summary: "Update the end of a block",
+		params:  []parameter{idParam},
+		body:    models.BodyEnd{},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/block_homeoffice/{id}",
+		summary: "Update the homeoffice flag of a block",
+		params:  []parameter{idParam},
+		body:    models.BodyHomeoffice{},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:  http.MethodDelete,
+		path:    "/block/{id}",
+		summary: "Move a block and its pauses to the trash",
+		params:  []parameter{idParam},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/block/{id}",
+		summary:  "Get a block with its pauses",
+		params:   []parameter{idParam},
+		response: models.Block{},
+		errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/block/{id}/history",
+		summary:  "List the changes of a block and its pauses, including deleted ones",
+		params:   []parameter{idParam},
+		response: []models.AuditEntry{},
+		errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/block",
+		summary:  "List blocks, optionally restricted to a range",
+		params:   rangeParams,
+		response: []models.Block{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/pause",
+		summary:  "Add a finished pause to a block",
+		body:     models.PauseCreate{},
+		response: models.Pause{},
+		errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/pause",
+		summary: "Replace start and end of a pause",
+		body:    models.Pause{},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/pause_start/{id}",
+		summary: "Update the start of a pause",
+		params:  []parameter{idParam},
+		body:    models.BodyStart{},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/pause_end/{id}",
+		summary: "Update the end of a pause",
+		params:  []parameter{idParam},
+		body:    models.BodyEnd{},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:  http.MethodDelete,
+		path:    "/pause/{id}",
+		summary: "Move a pause to the trash",
+		params:  []parameter{idParam},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/trash",
+		summary:  "List the deleted blocks and pauses that have not been purged yet, newest first",
+		response: []models.TrashItem{},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/trash/{id}/restore",
+		summary: "Restore a deleted block with its pauses or a deleted pause and return its block",
+		params: []parameter{
+			idParam,
+			{name: "type", in: "query", typ: "string", description: "block (default) or pause"},
+		},
+		response: models.Block{},
+		errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/current_block_start",
+		summary: "Start a new current block now",
+		params: []parameter{
+			{name: "homeoffice", in: "query", typ: "boolean", required: true},
+		},
+		response: models.Block{},
+		errors:   []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/current_block_end",
+		summary:  "End the current block now",
+		response: models.Block{},
+		errors:   []int{http.StatusConflict},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/block_current",
+		summary:  "Get the current block",
+		response: models.Block{},
+		errors:   []int{http.StatusConflict},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/current_pause_start",
+		summary:  "Start a new pause in the current block now",
+		response: models.Pause{},
+		errors:   []int{http.StatusConflict},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/current_pause_end",
+		summary:  "End the current pause now",
+		response: models.Pause{},
+		errors:   []int{http.StatusConflict},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/settings",
+		summary:  "Get the settings of the current user",
+		response: models.Settings{},
+	},
+	{
+		method:   http.MethodPut,
+		path:     "/settings",
+		summary:  "Replace the settings of the current user",
+		body:     models.Settings{},
+		response: models.Settings{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/surcharges",
+		summary:  "Get the surcharge rules and holidays",
+		response: models.SurchargeConfig{},
+	},
+	{
+		method:   http.MethodPut,
+		path:     "/surcharges",
+		summary:  "Replace the surcharge rules and holidays, for admins",
+		body:     models.SurchargeConfig{},
+		response: models.SurchargeConfig{},
+		errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/payroll",
+		summary:  "Minutes worked per surcharge category and month in the user's time zone",
+		params:   rangeParams,
+		response: []report.PayrollEntry{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/export/timesheet.pdf",
+		summary: "Monthly timesheet with weekly subtotals, overtime balance and signature lines as PDF",
+		params: []parameter{
+			{name: "month", in: "query", typ: "string", description: "Month in the format YYYY-MM, days follow the user's time zone"},
+		},
+		contentType: "application/pdf",
+		errors:      []int{http.StatusBadRequest},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/export/blocks.ics",
+		summary:     "Blocks in a range as iCalendar events, pauses as separate events",
+		params:      rangeParams,
+		contentType: "text/calendar",
+		errors:      []int{http.StatusBadRequest},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/feed",
+		summary:  "Get the secret subscription URL of the user's calendar feed",
+		response: models.Feed{},
+		errors:   []int{http.StatusNotFound},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/feed",
+		summary:  "Create a new subscription URL, the previous one stops working",
+		response: models.Feed{},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/feed/{secret}/blocks.ics",
+		summary: "Calendar feed authorized by the secret in its URL instead of a token",
+		params: append([]parameter{
+			{name: "secret", in: "path", typ: "string", required: true, description: "Secret of the feed"},
+		}, rangeParams...),
+		contentType: "text/calendar",
+		errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+		public:      true,
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/import/ics",
+		summary: "Import the events of an iCalendar file as blocks, skipping events imported before and events overlapping existing blocks",
+		params: []parameter{
+			{name: "category", in: "query", typ: "string", description: "Only import events with this category"},
+			{name: "prefix", in: "query", typ: "string", description: "Only import events whose summary starts with this prefix"},
+			{name: "dryRun", in: "query", typ: "boolean", description: "Report what would be imported without writing anything"},
+		},
+		bodyContentType: "text/calendar",
+		response:        models.ImportReport{},
+		errors:          []int{http.StatusBadRequest},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/export/blocks",
+		summary: "Blocks in a range in the format of another time tracker, each stretch between pauses as an entry",
+		params: append([]parameter{
+			formatParam,
+		}, rangeParams...),
+		contentType: "text/plain",
+		errors:      []int{http.StatusBadRequest},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/import/blocks",
+		summary: "Import the entries of another time tracker, merging the entries of a day into blocks with the gaps as pauses",
+		params: []parameter{
+			formatParam,
+			{name: "dryRun", in: "query", typ: "boolean", description: "Report what would be imported without writing anything"},
+		},
+		bodyContentType: "text/plain",
+		response:        models.ImportReport{},
+		errors:          []int{http.StatusBadRequest},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/lock",
+		summary:  "List the locked periods",
+		response: []models.PeriodLock{},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/lock",
+		summary:  "Lock a month in the user's time zone or a range for changes of the user's blocks and pauses, those of other users or everyone for managers and admins",
+		body:     models.PeriodLockCreate{},
+		response: models.PeriodLock{},
+		errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+	},
+	{
+		method:  http.MethodDelete,
+		path:    "/lock/{id}",
+		summary: "Reopen a period the user locked for themselves, other locks for managers and admins, recorded in the audit log",
+		params:  []parameter{idParam},
+		errors:  []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/audit/verify",
+		summary:  "Verify the hash chain of the audit log and report the first broken entry, for managers and admins",
+		response: models.AuditVerification{},
+		errors:   []int{http.StatusForbidden},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/audit/digest",
+		summary: "Signed digest of the audit log of a month that has ended",
+		params: []parameter{
+			{name: "month", in: "query", typ: "string", description: "Month in the format YYYY-MM in the user's time zone", required: true},
+		},
+		response: models.AuditDigest{},
+		errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/backup",
+		summary:  "All blocks with their pauses, the current block and pause, the settings of all users, the surcharges, rates, invoices, locks, accounts, teams, submissions and feeds, for admins",
+		response: models.Backup{},
+		errors:   []int{http.StatusForbidden},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/restore",
+		summary: "Validate a backup and restore it in a single transaction, for admins",
+		params: []parameter{
+			{name: "mode", in: "query", typ: "string", description: "replace (default) replaces all data with the backup, merge adds the finished blocks that do not exist yet and overwrites the settings"},
+		},
+		body:     models.Backup{},
+		response: models.RestoreReport{},
+		errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/snapshot",
+		summary:  "List the snapshots of the database file, newest first",
+		response: []models.Snapshot{},
+		errors:   []int{http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/snapshot",
+		summary:  "Write a snapshot of the database file now and prune the old ones, for admins",
+		response: models.Snapshot{},
+		errors:   []int{http.StatusForbidden, http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/rate",
+		summary:  "List the hourly rates of the current user",
+		response: []models.Rate{},
+		errors:   []int{http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/rate",
+		summary:  "Add an hourly rate for the current user",
+		body:     models.RateCreate{},
+		response: models.Rate{},
+		errors:   []int{http.StatusBadRequest, http.StatusNotImplemented},
+	},
+	{
+		method:  http.MethodDelete,
+		path:    "/rate/{id}",
+		summary: "Delete an hourly rate",
+		params:  []parameter{idParam},
+		errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/invoice",
+		summary:  "Bill the unbilled billable blocks within a range",
+		body:     models.InvoiceCreate{},
+		response: models.Invoice{},
+		errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/invoice",
+		summary:  "List the invoices of the current user",
+		response: []models.Invoice{},
+		errors:   []int{http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/invoice/{id}",
+		summary:  "Get an invoice",
+		params:   []parameter{idParam},
+		response: models.Invoice{},
+		errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/invoice/{id}/html",
+		summary:     "Render an invoice as HTML",
+		params:      []parameter{idParam},
+		contentType: "text/html",
+		errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/invoice/{id}/pdf",
+		summary:     "Render an invoice as PDF",
+		params:      []parameter{idParam},
+		contentType: "application/pdf",
+		errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	{
+		method:  http.MethodPut,
+		path:    "/user/{email}/role",
+		summary: "Set the role of a user, employee, manager or admin; admins only",
+		params:  []parameter{emailParam},
+		body:    models.RoleUpdate{},
+		errors:  []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/team",
+		summary:  "List the teams with their members",
+		response: []models.Team{},
+		errors:   []int{http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/team",
+		summary:  "Add a team; admins only",
+		body:     models.TeamCreate{},
+		response: models.Team{},
+		errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusNotImplemented},
+	},
+	{
+		method:  http.MethodPost,
+		path:    "/team/{id}/member",
+		summary: "Add a user to a team; admins only",
+		params:  []parameter{idParam},
+		body:    models.TeamMemberCreate{},
+		errors:  []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	{
+		method:  http.MethodDelete,
+		path:    "/team/{id}/member/{email}",
+		summary: "Remove a user from a team; admins only",
+		params:  []parameter{idParam, emailParam},
+		errors:  []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/team/{id}/overview",
+		summary:  "Current state, today's and this week's net minutes and the overtime balance of each member of a team; admins and managers of the team",
+		params:   []parameter{idParam},
+		response: models.TeamOverview{},
+		errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/submission",
+		summary:  "Submit the week or month containing a date in the user's time zone for review",
+		body:     models.SubmissionCreate{},
+		response: models.Submission{},
+		errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusNotImplemented},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/submission",
+		summary: "List the user's own submissions and those they may review",
+		params: []parameter{
+			{name: "status", in: "query", typ: "string", description: "submitted, approved or rejected; all if empty"},
+		},
+		response: []models.Submission{},
+		errors:   []int{http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/submission/{id}",
+		summary:  "Get a submission",
+		params:   []parameter{idParam},
+		response: models.Submission{},
+		errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/submission/{id}/approve",
+		summary:  "Approve a submission and lock its period; managers of the employee's teams and admins",
+		params:   []parameter{idParam},
+		body:     models.SubmissionReview{},
+		response: models.Submission{},
+		errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusNotImplemented},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/submission/{id}/reject",
+		summary:  "Return a submission to the employee with the reason in the comment",
+		params:   []parameter{idParam},
+		body:     models.SubmissionReview{},
+		response: models.Submission{},
+		errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusNotImplemented},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/events",
+		summary: "List the submitted, approved and rejected events the user may see",
+		params: []parameter{
+			{name: "since", in: "query", typ: "integer", description: "only events with a greater id"},
+		},
+		response: []models.WorkflowEvent{},
+		errors:   []int{http.StatusBadRequest, http.StatusNotImplemented},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/login",
+		summary:     "Exchange email and password for a bearer token",
+		body:        auth.Login{},
+		contentType: "text/plain",
+		errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+		public:      true,
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/refresh",
+		summary:     "Exchange a token that is about to expire for a new one",
+		contentType: "text/plain",
+		errors:      []int{http.StatusBadRequest, http.StatusUnauthorized},
+	},
+	{
+		method:  http.MethodGet,
+		path:    "/openapi.json",
+		summary: "Get this OpenAPI document",
+		public:  true,
+	},
+}
+
+// ginPath converts an OpenAPI path like /block/{id} to the gin syntax.
+func ginPath(path string) string {
+	return strings.NewReplacer("{", ":", "}", "").Replace(path)
+}
+
+func publicPaths() []string {
+	var paths []string
+	for _, op := range operations {
+		if op.public {
+			paths = append(paths, ginPath(op.path))
+		}
+	}
+	return paths
+}
+
+type schemaGenerator struct {
+	components map[string]any
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]any{"type": "integer", "description": "duration in nanoseconds"}
+	}
+	if t == reflect.TypeOf(json.RawMessage(nil)) {
+		// any JSON value
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return g.object(t)
+		}
+		if _, ok := g.components[name]; !ok {
+			// reserve the name first, so recursive types terminate
+			g.components[name] = nil
+			g.components[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+func (g *schemaGenerator) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := g.fields(t, properties, []string{})
+
+	object := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+// fields adds the properties of the fields of t and returns the required
+// ones appended to required. Embedded structs are inlined like encoding/json
+// does.
+func (g *schemaGenerator) fields(t reflect.Type, properties map[string]any, required []string) []string {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			required = g.fields(field.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			required = append(required, name)
+		}
+	}
+	return required
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// newOpenAPISpec generates the OpenAPI 3 document for all operations.
+func newOpenAPISpec() map[string]any {
+	g := schemaGenerator{components: map[string]any{}}
+	problem := map[string]any{
+		"application/problem+json": map[string]any{"schema": g.schema(reflect.TypeOf(Problem{}))},
+	}
+
+	paths := map[string]any{}
+	for _, op := range operations {
+		item, ok := paths[op.path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[op.path] = item
+		}
+
+		success := map[string]any{"description": "OK"}
+		if op.contentType == "application/pdf" {
+			success["content"] = map[string]any{
+				op.contentType: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+			}
+		} else if op.contentType != "" {
+			success["content"] = map[string]any{
+				op.contentType: map[string]any{"schema": map[string]any{"type": "string"}},
+			}
+		} else if op.response != nil {
+			success["content"] = jsonContent(g.schema(reflect.TypeOf(op.response)))
+		}
+
+		responses := map[string]any{"200": success}
+		for _, status := range op.errors {
+			responses[statusKey(status)] = map[string]any{
+				"description": http.StatusText(status),
+				"content":     problem,
+			}
+		}
+		if !op.public {
+			responses[statusKey(http.StatusUnauthorized)] = map[string]any{
+				"description": http.StatusText(http.StatusUnauthorized),
+				"content":     problem,
+			}
+		}
+		responses[statusKey(http.StatusInternalServerError)] = map[string]any{
+			"description": http.StatusText(http.StatusInternalServerError),
+			"content":     problem,
+		}
+
+		spec := map[string]any{
+			"summary":   op.summary,
+			"responses": responses,
+		}
+		if op.public {
+			spec["security"] = []any{}
+		}
+
+		var params []any
+		for _, p := range op.params {
+			param := map[string]any{
+				"name":     p.name,
+				"in":       p.in,
+				"required": p.required,
+				"schema":   map[string]any{"type": p.typ},
+			}
+			if p.description != "" {
+				param["description"] = p.description
+			}
+			params = append(params, param)
+		}
+		if len(params) > 0 {
+			spec["parameters"] = params
+		}
+
+		if op.bodyContentType != "" {
+			spec["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					op.bodyContentType: map[string]any{"schema": map[string]any{"type": "string"}},
+				},
+			}
+		} else if op.body != nil {
+			spec["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(g.schema(reflect.TypeOf(op.body))),
+			}
+		}
+
+		item[strings.ToLower(op.method)] = spec
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Work Hours API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.components,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []any{}}},
+	}
+}
+
+func statusKey(status int) string {
+	return strconv.Itoa(status)
+}
+
+func handleOpenAPI(spec map[string]any) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kilianmandscharo/work_hours/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func getOpenAPISpec(t *testing.T, r *gin.Engine) map[string]any {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var spec map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	return spec
+}
+
+func TestOpenAPISpecCoversAllRoutes(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	spec := getOpenAPISpec(t, r)
+	assert.Equal(t, "3.0.3", spec["openapi"])
+	paths := spec["paths"].(map[string]any)
+
+	documented := 0
+	for _, route := range r.Routes() {
+		path := route.Path
+		segments := strings.Split(path, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, ":") {
+				segments[i] = "{" + segment[1:] + "}"
+			}
+		}
+		path = strings.Join(segments, "/")
+
+		item, ok := paths[path].(map[string]any)
+		if !assert.True(t, ok, "path %s is missing from the spec", path) {
+			continue
+		}
+		_, ok = item[strings.ToLower(route.Method)]
+		assert.True(t, ok, "%s %s is missing from the spec", route.Method, path)
+		documented++
+	}
+
+	assert.Equal(t, len(operations), documented, "the spec documents routes that are not registered")
+}
+
+func TestOpenAPISpecSchemas(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	spec := getOpenAPISpec(t, r)
+	schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+	for _, name := range []string{"Block", "BlockCreate", "Pause", "PauseCreate", "BodyStart", "Problem"} {
+		assert.Contains(t, schemas, name)
+	}
+
+	blockCreate := schemas["BlockCreate"].(map[string]any)
+	assert.ElementsMatch(t, []any{"start", "end"}, blockCreate["required"])
+	properties := blockCreate["properties"].(map[string]any)
+	assert.Equal(t, "#/components/schemas/PauseWithoutBlockID", properties["pauses"].(map[string]any)["items"].(map[string]any)["$ref"])
+
+	addBlock := spec["paths"].(map[string]any)["/block"].(map[string]any)["post"].(map[string]any)
+	assert.Contains(t, addBlock["responses"], "400")
+	assert.Contains(t, addBlock["responses"], "401")
+	assert.Contains(t, addBlock, "requestBody")
+}
@@ -1,6 +1,10 @@
 package server
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -8,34 +12,72 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"github.com/kilianmandscharo/work_hours/auth"
+	"github.com/kilianmandscharo/work_hours/convert"
 	"github.com/kilianmandscharo/work_hours/database"
-	"github.com/kilianmandscharo/work_hours/datetime"
+	"github.com/kilianmandscharo/work_hours/ical"
 	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/render"
+	"github.com/kilianmandscharo/work_hours/report"
+	"github.com/kilianmandscharo/work_hours/snapshot"
 	"github.com/kilianmandscharo/work_hours/utils"
 )
 
 type RequestHandler struct {
-	db *database.DB
+	db  database.Store
+	now func() time.Time
+	// snapshots is nil unless snapshots are enabled.
+	snapshots *snapshot.Manager
 }
 
-func newRequestHandler(db *database.DB) RequestHandler {
-	return RequestHandler{db: db}
+func newRequestHandler(db database.Store) RequestHandler {
+	return RequestHandler{db: db, now: time.Now}
+}
+
+// store returns the store as seen by the requesting user, so that the audit
+// log records who made a change and only their own blocks and pauses are
+// visible.
+func (r *RequestHandler) store(c *gin.Context) database.Store {
+	return r.db.WithOwner(auth.User(c))
+}
+
+// allUsers is store with the blocks and pauses of all users. Handlers have
+// to check the role of the requesting user first.
+func (r *RequestHandler) allUsers(c *gin.Context) database.Store {
+	return r.db.WithUser(auth.User(c))
+}
+
+// userLocation returns the time zone of the requesting user.
+func (r *RequestHandler) userLocation(c *gin.Context) (*time.Location, error) {
+	settings, err := r.store(c).GetSettings(auth.User(c))
+	if err != nil {
+		return nil, err
+	}
+	return settings.Location()
+}
+
+// userNow returns the current time in the time zone of the requesting user.
+func (r *RequestHandler) userNow(c *gin.Context) (time.Time, error) {
+	loc, err := r.userLocation(c)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.now().In(loc), nil
 }
 
 func (r *RequestHandler) handleAddBlock(c *gin.Context) {
 	var block models.BlockCreate
-	if err := c.BindJSON(&block); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+	if err := c.ShouldBindJSON(&block); err != nil {
+		c.Error(errInvalidBody)
 		return
 	}
 
 	if !block.Valid() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid datetime found"})
+		c.Error(errInvalidDatetime)
 		return
 	}
 
-	if newBlock, err := r.db.AddBlock(block); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not add block"})
+	if newBlock, err := r.store(c).AddBlock(block); err != nil {
+		c.Error(err)
 	} else {
 		c.JSON(http.StatusOK, newBlock)
 	}
@@ -43,190 +85,177 @@ func (r *RequestHandler) handleAddBlock(c *gin.Context) {
 
 func (r *RequestHandler) handleUpdateBlock(c *gin.Context) {
 	var block models.Block
-	if err := c.BindJSON(&block); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+	if err := c.ShouldBindJSON(&block); err != nil {
+		c.Error(errInvalidBody)
 		return
 	}
 
 	if !block.Valid() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid datetime found"})
+		c.Error(errInvalidDatetime)
 		return
 	}
 
-	if rowsAffected, err := r.db.UpdateBlock(block); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update block"})
+	if rowsAffected, err := r.store(c).UpdateBlock(block); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrBlockNotFound)
 	} else {
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "block not found"})
-		} else {
-			c.Status(http.StatusOK)
-		}
+		c.Status(http.StatusOK)
 	}
 }
 
 func (r *RequestHandler) handleUpdateBlockStart(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read query parameter"})
+		c.Error(errInvalidParameter)
 		return
 	}
 
 	var body models.BodyStart
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(errInvalidBody)
 		return
 	}
 
 	if !body.Valid() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid datetime found"})
+		c.Error(errInvalidDatetime)
 		return
 	}
 
-	if rowsAffected, err := r.db.UpdateBlockStart(id, body.Start); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update block"})
+	if rowsAffected, err := r.store(c).UpdateBlockStart(id, body.Start); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrBlockNotFound)
 	} else {
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "block not found"})
-		} else {
-			c.Status(http.StatusOK)
-		}
+		c.Status(http.StatusOK)
 	}
 }
 
 func (r *RequestHandler) handleUpdateBlockEnd(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read query parameter"})
+		c.Error(errInvalidParameter)
 		return
 	}
 
 	var body models.BodyEnd
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(errInvalidBody)
 		return
 	}
 
 	if !body.Valid() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid datetime found"})
+		c.Error(errInvalidDatetime)
 		return
 	}
 
-	if rowsAffected, err := r.db.UpdateBlockEnd(id, body.End); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update block"})
+	if rowsAffected, err := r.store(c).UpdateBlockEnd(id, body.End); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrBlockNotFound)
 	} else {
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "block not found"})
-		} else {
-			c.Status(http.StatusOK)
-		}
+		c.Status(http.StatusOK)
 	}
 }
 
 func (r *RequestHandler) handleUpdateBlockHomeoffice(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read query parameter"})
+		c.Error(errInvalidParameter)
 		return
 	}
 
 	var body models.BodyHomeoffice
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(errInvalidBody)
 		return
 	}
 
-	if rowsAffected, err := r.db.UpdateBlockHomeoffice(id, body.Homeoffice); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update block"})
+	if rowsAffected, err := r.store(c).UpdateBlockHomeoffice(id, body.Homeoffice); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrBlockNotFound)
 	} else {
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "block not found"})
-		} else {
-			c.Status(http.StatusOK)
-		}
+		c.Status(http.StatusOK)
 	}
 }
 
 func (r *RequestHandler) handleDeleteBlock(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read query parameter"})
+		c.Error(errInvalidParameter)
 		return
 	}
 
-	if rowsAffected, err := r.db.DeleteBlock(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete block"})
+	if rowsAffected, err := r.store(c).DeleteBlock(id); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrBlockNotFound)
 	} else {
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "block not found"})
-		} else {
-			c.Status(http.StatusOK)
-		}
+		c.Status(http.StatusOK)
 	}
 }
 
 func (r *RequestHandler) handleGetBlockByID(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read query parameter"})
+		c.Error(errInvalidParameter)
 		return
 	}
 
-	if block, err := r.db.GetBlockByID(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get block"})
+	if block, err := r.store(c).GetBlockByID(id); err != nil {
+		c.Error(err)
 	} else {
 		c.JSON(http.StatusOK, block)
 	}
 }
 
-func (r *RequestHandler) handleGetBlocksWithinRange(c *gin.Context) {
-	start := c.Query("start")
-	end := c.Query("end")
-
-	if len(start) > 0 && !datetime.IsValidRFC3339(start) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start format"})
+func (r *RequestHandler) handleGetBlockHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
 		return
 	}
 
-	if len(end) > 0 && !datetime.IsValidRFC3339(end) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end format"})
-		return
+	if history, err := r.store(c).GetBlockHistory(id); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, history)
 	}
+}
 
-	var blocks []models.Block
-	var err error
-
-	if len(start) == 0 && len(end) == 0 {
-		blocks, err = r.db.GetAllBlocks()
-	} else if len(start) > 0 && len(end) > 0 {
-		blocks, err = r.db.GetBlocksWithinRange(start, end)
-	} else if len(start) > 0 {
-		blocks, err = r.db.GetBlocksAfterStart(start)
-	} else {
-		blocks, err = r.db.GetBlocksBeforeEnd(end)
+func (r *RequestHandler) handleGetBlocksWithinRange(c *gin.Context) {
+	timeRange, err := database.ParseTimeRange(c.Query("start"), c.Query("end"), c.Query("mode"))
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
+	blocks, err := r.store(c).GetBlocksInRange(timeRange)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get blocks"})
-	} else if len(blocks) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "no blocks available"})
-	} else {
-		c.JSON(http.StatusOK, blocks)
+		c.Error(err)
+		return
+	}
+	if blocks == nil {
+		blocks = []models.Block{}
 	}
+	c.JSON(http.StatusOK, blocks)
 }
 
 func (r *RequestHandler) handleAddPause(c *gin.Context) {
 	var pause models.PauseCreate
-	if err := c.BindJSON(&pause); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+	if err := c.ShouldBindJSON(&pause); err != nil {
+		c.Error(errInvalidBody)
+		return
 	}
 
 	if !pause.Valid() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid datetime found"})
+		c.Error(errInvalidDatetime)
 		return
 	}
 
-	if newPause, err := r.db.AddPause(pause); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not add pause"})
+	if newPause, err := r.store(c).AddPause(pause); err != nil {
+		c.Error(err)
 	} else {
 		c.JSON(http.StatusOK, newPause)
 	}
@@ -234,239 +263,1488 @@ func (r *RequestHandler) handleAddPause(c *gin.Context) {
 
 func (r *RequestHandler) handleUpdatePause(c *gin.Context) {
 	var pause models.Pause
-	if err := c.BindJSON(&pause); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+	if err := c.ShouldBindJSON(&pause); err != nil {
+		c.Error(errInvalidBody)
 		return
 	}
 
 	if !pause.Valid() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid datetime found"})
+		c.Error(errInvalidDatetime)
 		return
 	}
 
-	if rowsAffected, err := r.db.UpdatePause(pause); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update pause"})
+	if rowsAffected, err := r.store(c).UpdatePause(pause); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrPauseNotFound)
 	} else {
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "pause not found"})
-		} else {
-			c.Status(http.StatusOK)
-		}
+		c.Status(http.StatusOK)
 	}
 }
 
 func (r *RequestHandler) handleUpdatePauseStart(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read query parameter"})
+		c.Error(errInvalidParameter)
 		return
 	}
 
 	var body models.BodyStart
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(errInvalidBody)
 		return
 	}
 
 	if !body.Valid() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid datetime found"})
+		c.Error(errInvalidDatetime)
 		return
 	}
 
-	if rowsAffected, err := r.db.UpdatePauseStart(id, body.Start); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update pause"})
+	if rowsAffected, err := r.store(c).UpdatePauseStart(id, body.Start); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrPauseNotFound)
 	} else {
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "pause not found"})
-		} else {
-			c.Status(http.StatusOK)
-		}
+		c.Status(http.StatusOK)
 	}
 }
 
 func (r *RequestHandler) handleUpdatePauseEnd(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read query parameter"})
+		c.Error(errInvalidParameter)
 		return
 	}
 
 	var body models.BodyEnd
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(errInvalidBody)
 		return
 	}
 
 	if !body.Valid() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid datetime found"})
+		c.Error(errInvalidDatetime)
 		return
 	}
 
-	if rowsAffected, err := r.db.UpdatePauseEnd(id, body.End); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update pause"})
+	if rowsAffected, err := r.store(c).UpdatePauseEnd(id, body.End); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrPauseNotFound)
 	} else {
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "pause not found"})
-		} else {
-			c.Status(http.StatusOK)
-		}
+		c.Status(http.StatusOK)
 	}
 }
 
 func (r *RequestHandler) handleDeletePause(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read query parameter"})
+		c.Error(errInvalidParameter)
 		return
 	}
 
-	if rowsAffected, err := r.db.DeletePause(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete pause"})
+	if rowsAffected, err := r.store(c).DeletePause(id); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrPauseNotFound)
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+func (r *RequestHandler) handleGetTrash(c *gin.Context) {
+	if trash, err := r.store(c).GetTrash(); err != nil {
+		c.Error(err)
 	} else {
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "pause not found"})
-		} else {
-			c.Status(http.StatusOK)
+		c.JSON(http.StatusOK, trash)
+	}
+}
+
+// handleRestoreFromTrash restores a deleted block or, with type=pause, a
+// deleted pause. It responds with the block the item belongs to.
+func (r *RequestHandler) handleRestoreFromTrash(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return
+	}
+
+	store := r.store(c)
+	var blockID int
+	switch c.DefaultQuery("type", models.TrashBlock) {
+	case models.TrashBlock:
+		if _, err := store.RestoreBlock(id); err != nil {
+			c.Error(err)
+			return
+		}
+		blockID = id
+	case models.TrashPause:
+		pause, err := store.RestorePause(id)
+		if err != nil {
+			c.Error(err)
+			return
 		}
+		blockID = pause.BlockID
+	default:
+		c.Error(errInvalidParameter)
+		return
+	}
+
+	if block, err := store.GetBlockByID(blockID); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, block)
 	}
 }
 
 func (r *RequestHandler) handleStartBlock(c *gin.Context) {
 	homeoffice, err := strconv.ParseBool(c.Query("homeoffice"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read query parameter"})
+		c.Error(errInvalidParameter)
 		return
 	}
 
-	if block, err := r.db.StartBlock(homeoffice); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start block"})
+	now, err := r.userNow(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if block, err := r.store(c).StartBlock(homeoffice, now); err != nil {
+		c.Error(err)
 	} else {
 		c.JSON(http.StatusOK, block)
 	}
 }
 
 func (r *RequestHandler) handleEndBlock(c *gin.Context) {
-	if block, err := r.db.EndBlock(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not end block"})
+	now, err := r.userNow(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if block, err := r.store(c).EndBlock(now); err != nil {
+		c.Error(err)
 	} else {
 		c.JSON(http.StatusOK, block)
 	}
 }
 
 func (r *RequestHandler) handleStartPause(c *gin.Context) {
-	if pause, err := r.db.StartPause(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start pause"})
+	now, err := r.userNow(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if pause, err := r.store(c).StartPause(now); err != nil {
+		c.Error(err)
 	} else {
 		c.JSON(http.StatusOK, pause)
 	}
 }
 
 func (r *RequestHandler) handleEndPause(c *gin.Context) {
-	if pause, err := r.db.EndPause(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete pause"})
+	now, err := r.userNow(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if pause, err := r.store(c).EndPause(now); err != nil {
+		c.Error(err)
 	} else {
 		c.JSON(http.StatusOK, pause)
 	}
 }
 
 func (r *RequestHandler) handleGetCurrentBlock(c *gin.Context) {
-	if block, err := r.db.GetCurrentBlock(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get current block"})
+	if block, err := r.store(c).GetCurrentBlock(); err != nil {
+		c.Error(err)
 	} else {
 		c.JSON(http.StatusOK, block)
 	}
 }
 
-func (r *RequestHandler) handleLogin(c *gin.Context) {
-	env, err := utils.EnvVariables()
+func (r *RequestHandler) handleGetSettings(c *gin.Context) {
+	if settings, err := r.store(c).GetSettings(auth.User(c)); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+func (r *RequestHandler) handleUpdateSettings(c *gin.Context) {
+	var settings models.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+
+	if err := r.store(c).UpdateSettings(auth.User(c), settings); err != nil {
+		c.Error(err)
+		return
+	}
+	r.handleGetSettings(c)
+}
+
+func (r *RequestHandler) handleGetSurchargeConfig(c *gin.Context) {
+	if config, err := r.store(c).GetSurchargeConfig(); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, config)
+	}
+}
+
+func (r *RequestHandler) handleUpdateSurchargeConfig(c *gin.Context) {
+	if !r.requireRole(c, models.RoleAdmin) {
+		return
+	}
+
+	var config models.SurchargeConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+	if config.Holidays == nil {
+		config.Holidays = []string{}
+	}
+
+	if err := r.store(c).UpdateSurchargeConfig(config); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, config)
+	}
+}
+
+func (r *RequestHandler) handleGetPayroll(c *gin.Context) {
+	timeRange, err := database.ParseTimeRange(c.Query("start"), c.Query("end"), c.Query("mode"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load .env file"})
+		c.Error(err)
 		return
 	}
-	envTest, err := utils.EnvTestVariables()
+
+	loc, err := r.userLocation(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	config, err := r.store(c).GetSurchargeConfig()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	engine, err := report.NewSurchargeEngine(config, loc)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load .env file"})
+		c.Error(err)
 		return
 	}
 
-	var email string
-	if gin.Mode() == gin.TestMode {
-		email = envTest.Email
-	} else {
-		email = env.Email
+	blocks, err := r.store(c).GetUserBlocksInRange(auth.User(c), timeRange)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	var hash string
-	if gin.Mode() == gin.TestMode {
-		hash = envTest.Hash
+	if entries, err := engine.Payroll(blocks); err != nil {
+		c.Error(err)
 	} else {
-		hash = env.Hash
+		c.JSON(http.StatusOK, entries)
 	}
+}
 
-	var login auth.Login
-	if err := c.BindJSON(&login); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+func (r *RequestHandler) handleExportTimesheetPDF(c *gin.Context) {
+	loc, err := r.userLocation(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	month := c.Query("month")
+	start, end, err := report.MonthBounds(month, loc)
+	if err != nil {
+		c.Error(errInvalidMonth)
 		return
 	}
 
-	if login.Email != email {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email"})
+	settings, err := r.store(c).GetSettings(auth.User(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	config, err := r.store(c).GetSurchargeConfig()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	blocks, err := r.store(c).GetUserBlocksInRange(auth.User(c), database.TimeRange{Start: start, End: end, Mode: database.RangeOverlapping})
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	if !auth.ValidatePassword(login.Password, hash) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password"})
+	sheet, err := report.BuildTimesheet(start, blocks, loc, settings, config.Holidays)
+	if err != nil {
+		c.Error(err)
 		return
 	}
+	var buf bytes.Buffer
+	if err := render.TimesheetPDF(&buf, auth.User(c), sheet); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", "timesheet-"+sheet.Month+".pdf"))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
 
-	token, err := auth.CreateToken(login.Email, env.TokenKey)
+// writeCalendar responds with the blocks in the range as an iCalendar feed.
+func (r *RequestHandler) writeCalendar(c *gin.Context, blocks []models.Block) {
+	events, err := ical.FromBlocks(blocks)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, ical.Calendar{Name: "Work hours", Events: events}, r.now()); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", "blocks.ics"))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
 
+func (r *RequestHandler) handleExportBlocksICS(c *gin.Context) {
+	timeRange, err := database.ParseTimeRange(c.Query("start"), c.Query("end"), c.Query("mode"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+		c.Error(err)
 		return
 	}
+	if blocks, err := r.store(c).GetUserBlocksInRange(auth.User(c), timeRange); err != nil {
+		c.Error(err)
+	} else {
+		r.writeCalendar(c, blocks)
+	}
+}
 
-	c.String(http.StatusOK, token)
+// feedURL returns the absolute URL of the feed with the given secret, as seen
+// by the client of the current request.
+func feedURL(c *gin.Context, secret string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s/feed/%s/blocks.ics", scheme, c.Request.Host, secret)
 }
 
-func (r *RequestHandler) handleRefresh(c *gin.Context) {
-	tokenString, err := auth.ExtractBearerToken(c.GetHeader("Authorization"))
+func (r *RequestHandler) handleGetFeed(c *gin.Context) {
+	if secret, err := r.store(c).GetFeedSecret(auth.User(c)); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, models.Feed{URL: feedURL(c, secret)})
+	}
+}
+
+func (r *RequestHandler) handleRegenerateFeed(c *gin.Context) {
+	if secret, err := r.store(c).RegenerateFeedSecret(auth.User(c)); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, models.Feed{URL: feedURL(c, secret)})
+	}
+}
+
+// handleFeed serves the calendar feed of the user the secret in the path
+// belongs to. It is public, the secret takes the place of the token.
+func (r *RequestHandler) handleFeed(c *gin.Context) {
+	store := r.store(c)
+	email, err := store.GetFeedUser(c.Param("secret"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	timeRange, err := database.ParseTimeRange(c.Query("start"), c.Query("end"), c.Query("mode"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if blocks, err := store.GetUserBlocksInRange(email, timeRange); err != nil {
+		c.Error(err)
+	} else {
+		r.writeCalendar(c, blocks)
+	}
+}
+
+// maxImportSize limits the size of uploaded files.
+const maxImportSize = 10 << 20
+
+// dryRun reads the optional dryRun query parameter.
+func dryRun(c *gin.Context) (bool, bool) {
+	value := c.Query("dryRun")
+	if value == "" {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return false, false
+	}
+	return dryRun, true
+}
+
+func (r *RequestHandler) handleImportICS(c *gin.Context) {
+	dryRun, ok := dryRun(c)
+	if !ok {
+		return
+	}
+	loc, err := r.userLocation(c)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "could not extract token"})
+		c.Error(err)
 		return
 	}
 
-	env, err := utils.EnvVariables()
+	cal, err := ical.Decode(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize), loc)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load .env file"})
+		c.Error(errInvalidCalendar)
+		return
 	}
+	filter := ical.Filter{Category: c.Query("category"), SummaryPrefix: c.Query("prefix")}
 
-	claims := &jwt.StandardClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(env.TokenKey), nil
-	})
+	if report, err := r.store(c).ImportBlocks(ical.ToBlocks(cal.Events, filter, loc), dryRun); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, report)
+	}
+}
 
+func (r *RequestHandler) handleExportBlocks(c *gin.Context) {
+	format, err := convert.LookupFormat(c.Query("format"))
 	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-			return
+		c.Error(errInvalidFormat)
+		return
+	}
+	timeRange, err := database.ParseTimeRange(c.Query("start"), c.Query("end"), c.Query("mode"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	loc, err := r.userLocation(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	blocks, err := r.store(c).GetUserBlocksInRange(auth.User(c), timeRange)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	entries, err := convert.FromBlocks(blocks)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := format.Encode(&buf, entries, convert.Options{Loc: loc, Email: auth.User(c)}); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "blocks."+format.Extension))
+	c.Data(http.StatusOK, format.ContentType, buf.Bytes())
+}
+
+func (r *RequestHandler) handleImportBlocks(c *gin.Context) {
+	format, err := convert.LookupFormat(c.Query("format"))
+	if err != nil {
+		c.Error(errInvalidFormat)
+		return
+	}
+	dryRun, ok := dryRun(c)
+	if !ok {
+		return
+	}
+	loc, err := r.userLocation(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	opts := convert.Options{Loc: loc, Email: auth.User(c)}
+	entries, err := format.Decode(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize), opts)
+	if err != nil {
+		c.Error(errInvalidImport)
+		return
+	}
+
+	if report, err := r.store(c).ImportBlocks(convert.ToBlocks(entries, format.Name, loc), dryRun); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func (r *RequestHandler) handleGetLocks(c *gin.Context) {
+	if locks, err := r.store(c).GetLocks(); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, locks)
+	}
+}
+
+// lockRange returns the range a lock request covers, a month in the time
+// zone of the requesting user or the given instants.
+func (r *RequestHandler) lockRange(c *gin.Context, lock models.PeriodLockCreate) (time.Time, time.Time, error) {
+	if lock.Month != "" {
+		loc, err := r.userLocation(c)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		start, end, err := report.MonthBounds(lock.Month, loc)
+		if err != nil {
+			return start, end, database.ErrInvalidLock
 		}
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse token"})
+		return start, end, nil
+	}
+
+	start, startErr := time.Parse(time.RFC3339, lock.Start)
+	end, endErr := time.Parse(time.RFC3339, lock.End)
+	if startErr != nil || endErr != nil {
+		return start, end, database.ErrInvalidLock
+	}
+	return start, end, nil
+}
+
+// handleAddLock locks a period for the blocks of the requesting user. Locks
+// for other users or for everyone are reserved to managers and admins.
+func (r *RequestHandler) handleAddLock(c *gin.Context) {
+	var lock models.PeriodLockCreate
+	if err := c.ShouldBindJSON(&lock); err != nil {
+		c.Error(errInvalidBody)
 		return
 	}
-	if !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+
+	owner := auth.User(c)
+	if lock.All {
+		owner = ""
+	} else if lock.Owner != "" {
+		owner = lock.Owner
+	}
+	if owner != auth.User(c) && !r.requireRole(c, models.RoleManager, models.RoleAdmin) {
 		return
 	}
 
-	if time.Until(time.UnixMilli(claims.ExpiresAt)) > 30*time.Second {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "token still valid"})
+	start, end, err := r.lockRange(c, lock)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if newLock, err := r.store(c).AddLock(start, end, owner); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, newLock)
+	}
+}
+
+// handleDeleteLock reopens a period. Users reopen the periods they locked
+// for themselves, approvals and the locks of others are reopened by managers
+// and admins.
+func (r *RequestHandler) handleDeleteLock(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return
+	}
+	locks, err := r.store(c).GetLocks()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	for _, l := range locks {
+		if l.Id != id {
+			continue
+		}
+		if (l.Owner != auth.User(c) || l.LockedBy != auth.User(c)) &&
+			!r.requireRole(c, models.RoleManager, models.RoleAdmin) {
+			return
+		}
+	}
+
+	if rowsAffected, err := r.store(c).DeleteLock(id); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrLockNotFound)
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+func (r *RequestHandler) handleVerifyAudit(c *gin.Context) {
+	if !r.requireRole(c, models.RoleManager, models.RoleAdmin) {
+		return
+	}
+	if v, err := r.store(c).VerifyAuditChain(); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, v)
+	}
+}
+
+func (r *RequestHandler) handleGetAuditDigest(c *gin.Context) {
+	loc, err := r.userLocation(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	env, err := utils.EnvVariables()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	key, err := auth.DigestKey(env.DigestKey)
+	if err != nil {
+		c.Error(errDigestKeyMissing)
+		return
+	}
+
+	digest, err := database.MonthAuditDigest(r.store(c), c.Query("month"), loc, r.now(), key)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, digest)
+}
+
+func (r *RequestHandler) handleGetBackup(c *gin.Context) {
+	if !r.requireRole(c, models.RoleAdmin) {
+		return
+	}
+
+	backup, err := r.allUsers(c).ExportBackup()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	filename := fmt.Sprintf("work_hours-%s.json", r.now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.JSON(http.StatusOK, backup)
+}
+
+func (r *RequestHandler) handleRestore(c *gin.Context) {
+	if !r.requireRole(c, models.RoleAdmin) {
+		return
+	}
+
+	mode, err := database.ParseRestoreMode(c.Query("mode"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var backup models.Backup
+	if err := c.ShouldBindJSON(&backup); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+
+	if report, err := r.allUsers(c).RestoreBackup(backup, mode); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func (r *RequestHandler) handleGetSnapshots(c *gin.Context) {
+	if r.snapshots == nil {
+		c.Error(errSnapshotsDisabled)
+		return
+	}
+	if snapshots, err := r.snapshots.List(); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, snapshots)
+	}
+}
+
+func (r *RequestHandler) handleCreateSnapshot(c *gin.Context) {
+	if r.snapshots == nil {
+		c.Error(errSnapshotsDisabled)
+		return
+	}
+	if !r.requireRole(c, models.RoleAdmin) {
+		return
+	}
+	if s, err := r.snapshots.Create(); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// billing returns the store as a BillingStore, or attaches errNotSupported
+// to the context if it is none.
+func (r *RequestHandler) billing(c *gin.Context) (database.BillingStore, bool) {
+	billing, ok := r.store(c).(database.BillingStore)
+	if !ok {
+		c.Error(errNotSupported)
+	}
+	return billing, ok
+}
+
+func (r *RequestHandler) handleGetRates(c *gin.Context) {
+	billing, ok := r.billing(c)
+	if !ok {
+		return
+	}
+
+	rates, err := billing.GetRates(auth.User(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if rates == nil {
+		rates = []models.Rate{}
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+func (r *RequestHandler) handleAddRate(c *gin.Context) {
+	billing, ok := r.billing(c)
+	if !ok {
+		return
+	}
+
+	var rate models.RateCreate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+
+	if newRate, err := billing.AddRate(auth.User(c), rate); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, newRate)
+	}
+}
+
+func (r *RequestHandler) handleDeleteRate(c *gin.Context) {
+	billing, ok := r.billing(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return
+	}
+
+	if rowsAffected, err := billing.DeleteRate(auth.User(c), id); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrRateNotFound)
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+func (r *RequestHandler) handleCreateInvoice(c *gin.Context) {
+	billing, ok := r.billing(c)
+	if !ok {
+		return
+	}
+
+	var body models.InvoiceCreate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+	timeRange, err := database.ParseTimeRange(body.Start, body.End, "")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	now, err := r.userNow(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if invoice, err := billing.CreateInvoice(auth.User(c), timeRange, now); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, invoice)
+	}
+}
+
+func (r *RequestHandler) handleGetInvoices(c *gin.Context) {
+	billing, ok := r.billing(c)
+	if !ok {
+		return
+	}
+
+	invoices, err := billing.GetInvoices(auth.User(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if invoices == nil {
+		invoices = []models.Invoice{}
+	}
+	c.JSON(http.StatusOK, invoices)
+}
+
+func (r *RequestHandler) invoice(c *gin.Context) (models.Invoice, bool) {
+	billing, ok := r.billing(c)
+	if !ok {
+		return models.Invoice{}, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return models.Invoice{}, false
+	}
+
+	invoice, err := billing.GetInvoiceByID(auth.User(c), id)
+	if err != nil {
+		c.Error(err)
+		return models.Invoice{}, false
+	}
+	return invoice, true
+}
+
+func (r *RequestHandler) handleGetInvoice(c *gin.Context) {
+	if invoice, ok := r.invoice(c); ok {
+		c.JSON(http.StatusOK, invoice)
+	}
+}
+
+func (r *RequestHandler) handleGetInvoiceHTML(c *gin.Context) {
+	invoice, ok := r.invoice(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := render.InvoiceHTML(&buf, invoice); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+func (r *RequestHandler) handleGetInvoicePDF(c *gin.Context) {
+	invoice, ok := r.invoice(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := render.InvoicePDF(&buf, invoice); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", "invoice-"+invoice.Number+".pdf"))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// workflow returns the store as a WorkflowStore, or attaches errNotSupported
+// to the context if it is none.
+func (r *RequestHandler) workflow(c *gin.Context) (database.WorkflowStore, bool) {
+	workflow, ok := r.store(c).(database.WorkflowStore)
+	if !ok {
+		c.Error(errNotSupported)
+	}
+	return workflow, ok
+}
+
+// role returns the role of the requesting user. The user of the env file is
+// an admin.
+func (r *RequestHandler) role(c *gin.Context, workflow database.WorkflowStore) (string, error) {
+	env, err := utils.EnvVariables()
+	if err != nil {
+		return "", err
+	}
+	if auth.User(c) == env.Email {
+		return models.RoleAdmin, nil
+	}
+	user, _, err := workflow.GetUserCredentials(auth.User(c))
+	if err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+// requireAdmin attaches errForbidden to the context unless the requesting
+// user is an admin.
+func (r *RequestHandler) requireAdmin(c *gin.Context, workflow database.WorkflowStore) bool {
+	role, err := r.role(c, workflow)
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+	if role != models.RoleAdmin {
+		c.Error(errForbidden)
+		return false
+	}
+	return true
+}
+
+// requireRole attaches errForbidden to the context unless the requesting
+// user has one of the roles. Stores without users only let the user of the
+// env file log in, who is an admin.
+func (r *RequestHandler) requireRole(c *gin.Context, roles ...string) bool {
+	role := models.RoleAdmin
+	if workflow, ok := r.store(c).(database.WorkflowStore); ok {
+		var err error
+		if role, err = r.role(c, workflow); err != nil {
+			c.Error(err)
+			return false
+		}
+	}
+	for _, allowed := range roles {
+		if role == allowed {
+			return true
+		}
+	}
+	c.Error(errForbidden)
+	return false
+}
+
+// reviewable returns the users whose submissions the requesting user may
+// review, nil for everyone.
+func (r *RequestHandler) reviewable(c *gin.Context, workflow database.WorkflowStore) ([]string, error) {
+	role, err := r.role(c, workflow)
+	if err != nil {
+		return nil, err
+	}
+	switch role {
+	case models.RoleAdmin:
+		return nil, nil
+	case models.RoleManager:
+		return workflow.ManagedUsers(auth.User(c))
+	}
+	return []string{}, nil
+}
+
+// visible returns the users whose submissions and events the requesting
+// user may see, their own and those they review, nil for everyone.
+func (r *RequestHandler) visible(c *gin.Context, workflow database.WorkflowStore) ([]string, error) {
+	users, err := r.reviewable(c, workflow)
+	if users == nil || err != nil {
+		return users, err
+	}
+	return append(users, auth.User(c)), nil
+}
+
+// includes reports whether email is one of users, where nil means everyone.
+func includes(users []string, email string) bool {
+	if users == nil {
+		return true
+	}
+	for _, u := range users {
+		if u == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RequestHandler) handleSetUserRole(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok || !r.requireAdmin(c, workflow) {
+		return
+	}
+
+	var update models.RoleUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+
+	if rowsAffected, err := workflow.SetUserRole(c.Param("email"), update.Role); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrUserNotFound)
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+func (r *RequestHandler) handleGetTeams(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok {
+		return
+	}
+	if teams, err := workflow.GetTeams(); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, teams)
+	}
+}
+
+func (r *RequestHandler) handleAddTeam(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok || !r.requireAdmin(c, workflow) {
+		return
+	}
+
+	var team models.TeamCreate
+	if err := c.ShouldBindJSON(&team); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+
+	if newTeam, err := workflow.AddTeam(team.Name); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, newTeam)
+	}
+}
+
+func (r *RequestHandler) handleAddTeamMember(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok || !r.requireAdmin(c, workflow) {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return
+	}
+	var member models.TeamMemberCreate
+	if err := c.ShouldBindJSON(&member); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+
+	if err := workflow.AddTeamMember(id, member.Email); err != nil {
+		c.Error(err)
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+func (r *RequestHandler) handleRemoveTeamMember(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok || !r.requireAdmin(c, workflow) {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return
+	}
+
+	if rowsAffected, err := workflow.RemoveTeamMember(id, c.Param("email")); err != nil {
+		c.Error(err)
+	} else if rowsAffected == 0 {
+		c.Error(database.ErrTeamMemberNotFound)
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// handleGetTeamOverview shows the state and totals of each member of a team.
+// Admins see every team, managers the teams they belong to.
+func (r *RequestHandler) handleGetTeamOverview(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return
+	}
+
+	role, err := r.role(c, workflow)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	team, err := workflow.GetTeam(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if role != models.RoleAdmin && (role != models.RoleManager || !includes(team.Members, auth.User(c))) {
+		c.Error(errForbidden)
+		return
+	}
+
+	store := r.allUsers(c)
+	config, err := store.GetSurchargeConfig()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	now := r.now()
+	overview := models.TeamOverview{
+		TeamID:  team.Id,
+		Name:    team.Name,
+		At:      now.UTC().Format(time.RFC3339),
+		Members: []models.MemberStatus{},
+	}
+	for _, email := range team.Members {
+		status, err := memberStatus(store, workflow, email, now, config.Holidays)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		overview.Members = append(overview.Members, status)
+	}
+	c.JSON(http.StatusOK, overview)
+}
+
+// memberStatus sums up the blocks the user created as of now and tells
+// whether the user is working or paused in their current block.
+func memberStatus(store database.Store, workflow database.WorkflowStore, email string, now time.Time, holidays []string) (models.MemberStatus, error) {
+	status := models.MemberStatus{Email: email, State: models.MemberIdle}
+	user, _, err := workflow.GetUserCredentials(email)
+	if err != nil {
+		return status, err
+	}
+	status.Role = user.Role
+
+	settings, err := store.GetSettings(email)
+	if err != nil {
+		return status, err
+	}
+	loc, err := settings.Location()
+	if err != nil {
+		return status, err
+	}
+	start, _ := report.PeriodBounds(now, report.Month, loc)
+	if weekStart, _ := report.PeriodBounds(now, report.Week, loc); weekStart.Before(start) {
+		start = weekStart
+	}
+	blocks, err := store.GetUserBlocksInRange(email, database.TimeRange{Start: start, End: now, Mode: database.RangeOverlapping})
+	if err != nil {
+		return status, err
+	}
+
+	totals, err := report.TotalsAt(now, blocks, loc, settings, holidays)
+	if err != nil {
+		return status, err
+	}
+	status.TodayMinutes = int(totals.Today / time.Minute)
+	status.WeekMinutes = int(totals.Week / time.Minute)
+	status.BalanceMinutes = int(totals.Balance / time.Minute)
+
+	current, err := store.WithUser(email).GetCurrentBlock()
+	if errors.Is(err, database.ErrNoBlockActive) {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	status.State, status.BlockID, status.Since = models.MemberWorking, current.Id, current.Start
+	for _, p := range current.Pauses {
+		if p.End == "" {
+			status.State, status.Since = models.MemberPaused, p.Start
+		}
+	}
+	return status, nil
+}
+
+func (r *RequestHandler) handleSubmit(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok {
+		return
+	}
+
+	var submission models.SubmissionCreate
+	if err := c.ShouldBindJSON(&submission); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+
+	loc, err := r.userLocation(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	period, err := report.ParsePeriod(submission.Period)
+	if err != nil || period == report.Day {
+		c.Error(database.ErrInvalidSubmission)
+		return
+	}
+	date, err := time.ParseInLocation(time.DateOnly, submission.Date, loc)
+	if err != nil {
+		c.Error(database.ErrInvalidSubmission)
+		return
+	}
+	start, end := report.PeriodBounds(date, period, loc)
+
+	if s, err := workflow.Submit(auth.User(c), string(period), start, end, submission.Comment); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+func (r *RequestHandler) handleGetSubmissions(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok {
+		return
+	}
+	users, err := r.visible(c, workflow)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if submissions, err := workflow.GetSubmissions(users, c.Query("status")); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, submissions)
+	}
+}
+
+func (r *RequestHandler) handleGetSubmission(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return
+	}
+	users, err := r.visible(c, workflow)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	s, err := workflow.GetSubmission(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !includes(users, s.Email) {
+		c.Error(errForbidden)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// review checks that the requesting user may review the submission with the
+// id of the path and reads the comment of the body, which may be empty.
+func (r *RequestHandler) review(c *gin.Context, workflow database.WorkflowStore) (int, string, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidParameter)
+		return 0, "", false
+	}
+	var review models.SubmissionReview
+	if err := c.ShouldBindJSON(&review); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(errInvalidBody)
+		return 0, "", false
+	}
+
+	users, err := r.reviewable(c, workflow)
+	if err != nil {
+		c.Error(err)
+		return 0, "", false
+	}
+	s, err := workflow.GetSubmission(id)
+	if err != nil {
+		c.Error(err)
+		return 0, "", false
+	}
+	if s.Email == auth.User(c) || !includes(users, s.Email) {
+		c.Error(errForbidden)
+		return 0, "", false
+	}
+	return id, review.Comment, true
+}
+
+func (r *RequestHandler) handleApproveSubmission(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok {
+		return
+	}
+	id, comment, ok := r.review(c, workflow)
+	if !ok {
+		return
+	}
+
+	if s, err := workflow.ApproveSubmission(id, comment); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+func (r *RequestHandler) handleRejectSubmission(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok {
+		return
+	}
+	id, comment, ok := r.review(c, workflow)
+	if !ok {
+		return
+	}
+
+	if s, err := workflow.RejectSubmission(id, comment); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+func (r *RequestHandler) handleGetEvents(c *gin.Context) {
+	workflow, ok := r.workflow(c)
+	if !ok {
+		return
+	}
+	since := 0
+	if s := c.Query("since"); s != "" {
+		var err error
+		if since, err = strconv.Atoi(s); err != nil {
+			c.Error(errInvalidParameter)
+			return
+		}
+	}
+	users, err := r.visible(c, workflow)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if events, err := workflow.GetWorkflowEvents(users, since); err != nil {
+		c.Error(err)
+	} else {
+		c.JSON(http.StatusOK, events)
+	}
+}
+
+// account returns the password hash of the account with the given email:
+// the account of the env file, its test account in test mode, or an account
+// of the user store. It fails with errInvalidEmail if there is no such
+// account or it has been disabled.
+func (r *RequestHandler) account(email string) (string, error) {
+	env, err := utils.EnvVariables()
+	if err != nil {
+		return "", err
+	}
+	envTest, err := utils.EnvTestVariables()
+	if err != nil {
+		return "", err
+	}
+
+	envEmail, envHash := env.Email, env.Hash
+	if gin.Mode() == gin.TestMode {
+		envEmail, envHash = envTest.Email, envTest.Hash
+	}
+	if email == envEmail {
+		return envHash, nil
+	}
+
+	users, ok := r.db.(database.UserStore)
+	if !ok {
+		return "", errInvalidEmail
+	}
+	user, hash, err := users.GetUserCredentials(email)
+	if err != nil || user.Disabled {
+		return "", errInvalidEmail
+	}
+	return hash, nil
+}
+
+func (r *RequestHandler) handleLogin(c *gin.Context) {
+	env, err := utils.EnvVariables()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var login auth.Login
+	if err := c.ShouldBindJSON(&login); err != nil {
+		c.Error(errInvalidBody)
+		return
+	}
+
+	hash, err := r.account(login.Email)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if !auth.ValidatePassword(login.Password, hash) {
+		c.Error(errInvalidPassword)
+		return
+	}
+
+	token, err := auth.CreateToken(login.Email, env.TokenKey)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.String(http.StatusOK, token)
+}
+
+func (r *RequestHandler) handleRefresh(c *gin.Context) {
+	tokenString, err := auth.ExtractBearerToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.Error(auth.ErrMissingToken)
+		return
+	}
+
+	env, err := utils.EnvVariables()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	claims := &jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(env.TokenKey), nil
+	})
+
+	if err != nil {
+		if err == jwt.ErrSignatureInvalid {
+			c.Error(auth.ErrUnauthorized)
+			return
+		}
+		c.Error(auth.ErrInvalidToken)
+		return
+	}
+	if !token.Valid {
+		c.Error(auth.ErrUnauthorized)
+		return
+	}
+
+	if time.Until(time.UnixMilli(claims.ExpiresAt)) > 30*time.Second {
+		c.Error(errTokenStillValid)
+		return
+	}
+
+	// tokens issued before they carried a subject belong to the env user
+	user := claims.Subject
+	if user == "" {
+		user = env.Email
+	}
+	// accounts that have been disabled or removed since cannot refresh
+	if _, err := r.account(user); err != nil {
+		c.Error(err)
 		return
 	}
 
-	newToken, err := auth.CreateToken(env.Email, env.TokenKey)
+	newToken, err := auth.CreateToken(user, env.TokenKey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create new token"})
+		c.Error(err)
 		return
 	}
 
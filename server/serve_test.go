@@ -0,0 +1,116 @@
+//go:build cgo
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kilianmandscharo/work_hours/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	db := database.GetNewTestDatabase()
+	s := NewServer("", db)
+	gin.SetMode(gin.TestMode)
+
+	started := make(chan struct{})
+	s.router.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		_, err := db.StartBlock(false, time.Now())
+		assert.NoError(t, err)
+		c.Status(http.StatusOK)
+	})
+
+	workerStopped := make(chan struct{})
+	s.AddWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerStopped)
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(l)
+	}()
+
+	responded := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/slow", l.Addr()), nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			responded <- 0
+			return
+		}
+		res.Body.Close()
+		responded <- res.StatusCode
+	}()
+
+	<-started
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	assert.Equal(t, http.StatusOK, <-responded)
+	assert.NoError(t, <-served)
+	<-workerStopped
+
+	_, err = db.GetCurrentBlock()
+	assert.Error(t, err)
+
+	_, err = net.Dial("tcp", l.Addr().String())
+	assert.Error(t, err)
+}
+
+// Running blocks and open pauses are left open on shutdown, so that they
+// continue after a restart.
+func TestShutdownKeepsOpenPause(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+	db, err := database.NewDatabaseAt(dbPath)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Init())
+	block, err := db.StartBlock(false, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	_, err = db.StartPause(time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+
+	s := NewServer("", db)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(l)
+	}()
+	// Wait until the signal handler is installed.
+	for {
+		res, err := http.Get(fmt.Sprintf("http://%s/openapi.json", l.Addr()))
+		if err == nil {
+			res.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	assert.NoError(t, <-served)
+
+	db, err = database.NewDatabaseAt(dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+	current, err := db.GetCurrentBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, block.Id, current.Id)
+	assert.Equal(t, "", current.End)
+	assert.Equal(t, 1, len(current.Pauses))
+	assert.Equal(t, "", current.Pauses[0].End)
+}
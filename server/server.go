@@ -1,18 +1,34 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/kilianmandscharo/work_hours/auth"
 	"github.com/kilianmandscharo/work_hours/database"
+	"github.com/kilianmandscharo/work_hours/snapshot"
 )
 
-func NewRouter(db *database.DB) *gin.Engine {
+func NewRouter(db database.Store) *gin.Engine {
+	return newRouter(newRequestHandler(db))
+}
+
+func newRouter(h RequestHandler) *gin.Engine {
 	r := gin.Default()
 	r.Use(cors.Default())
-	r.Use(auth.Authorizer())
-
-	h := newRequestHandler(db)
+	r.Use(errorHandler())
+	r.Use(auth.Authorizer(publicPaths()...))
 
 	r.POST("/block", h.handleAddBlock)
 	r.PUT("/block", h.handleUpdateBlock)
@@ -21,12 +37,15 @@ func NewRouter(db *database.DB) *gin.Engine {
 	r.PUT("/block_homeoffice/:id", h.handleUpdateBlockHomeoffice)
 	r.DELETE("/block/:id", h.handleDeleteBlock)
 	r.GET("/block/:id", h.handleGetBlockByID)
+	r.GET("/block/:id/history", h.handleGetBlockHistory)
 	r.GET("/block", h.handleGetBlocksWithinRange)
 	r.POST("/pause", h.handleAddPause)
 	r.PUT("/pause", h.handleUpdatePause)
 	r.PUT("/pause_start/:id", h.handleUpdatePauseStart)
 	r.PUT("/pause_end/:id", h.handleUpdatePauseEnd)
 	r.DELETE("/pause/:id", h.handleDeletePause)
+	r.GET("/trash", h.handleGetTrash)
+	r.POST("/trash/:id/restore", h.handleRestoreFromTrash)
 
 	r.POST("/current_block_start", h.handleStartBlock)
 	r.POST("/current_block_end", h.handleEndBlock)
@@ -34,8 +53,187 @@ func NewRouter(db *database.DB) *gin.Engine {
 	r.POST("/current_pause_start", h.handleStartPause)
 	r.POST("/current_pause_end", h.handleEndPause)
 
+	r.GET("/settings", h.handleGetSettings)
+	r.PUT("/settings", h.handleUpdateSettings)
+	r.GET("/surcharges", h.handleGetSurchargeConfig)
+	r.PUT("/surcharges", h.handleUpdateSurchargeConfig)
+	r.GET("/payroll", h.handleGetPayroll)
+	r.GET("/export/timesheet.pdf", h.handleExportTimesheetPDF)
+	r.GET("/export/blocks.ics", h.handleExportBlocksICS)
+	r.GET("/feed", h.handleGetFeed)
+	r.POST("/feed", h.handleRegenerateFeed)
+	r.GET("/feed/:secret/blocks.ics", h.handleFeed)
+	r.GET("/export/blocks", h.handleExportBlocks)
+	r.POST("/import/ics", h.handleImportICS)
+	r.POST("/import/blocks", h.handleImportBlocks)
+	r.GET("/lock", h.handleGetLocks)
+	r.POST("/lock", h.handleAddLock)
+	r.DELETE("/lock/:id", h.handleDeleteLock)
+	r.GET("/audit/verify", h.handleVerifyAudit)
+	r.GET("/audit/digest", h.handleGetAuditDigest)
+	r.GET("/backup", h.handleGetBackup)
+	r.POST("/restore", h.handleRestore)
+	r.GET("/snapshot", h.handleGetSnapshots)
+	r.POST("/snapshot", h.handleCreateSnapshot)
+
+	r.GET("/rate", h.handleGetRates)
+	r.POST("/rate", h.handleAddRate)
+	r.DELETE("/rate/:id", h.handleDeleteRate)
+	r.POST("/invoice", h.handleCreateInvoice)
+	r.GET("/invoice", h.handleGetInvoices)
+	r.GET("/invoice/:id", h.handleGetInvoice)
+	r.GET("/invoice/:id/html", h.handleGetInvoiceHTML)
+	r.GET("/invoice/:id/pdf", h.handleGetInvoicePDF)
+
+	r.PUT("/user/:email/role", h.handleSetUserRole)
+	r.GET("/team", h.handleGetTeams)
+	r.POST("/team", h.handleAddTeam)
+	r.POST("/team/:id/member", h.handleAddTeamMember)
+	r.DELETE("/team/:id/member/:email", h.handleRemoveTeamMember)
+	r.GET("/team/:id/overview", h.handleGetTeamOverview)
+	r.POST("/submission", h.handleSubmit)
+	r.GET("/submission", h.handleGetSubmissions)
+	r.GET("/submission/:id", h.handleGetSubmission)
+	r.POST("/submission/:id/approve", h.handleApproveSubmission)
+	r.POST("/submission/:id/reject", h.handleRejectSubmission)
+	r.GET("/events", h.handleGetEvents)
+
 	r.POST("/login", h.handleLogin)
 	r.POST("/refresh", h.handleRefresh)
 
+	r.GET("/openapi.json", handleOpenAPI(newOpenAPISpec()))
+
 	return r
 }
+
+// Worker is a background job that runs alongside the HTTP server until its
+// context is cancelled on shutdown.
+type Worker func(ctx context.Context)
+
+type Server struct {
+	router          *gin.Engine
+	httpServer      *http.Server
+	db              database.Store
+	workers         []Worker
+	ShutdownTimeout time.Duration
+}
+
+func NewServer(addr string, db database.Store) *Server {
+	router := NewRouter(db)
+	return &Server{
+		router:          router,
+		httpServer:      &http.Server{Addr: addr, Handler: router},
+		db:              db,
+		ShutdownTimeout: 10 * time.Second,
+	}
+}
+
+func (s *Server) AddWorker(w Worker) {
+	s.workers = append(s.workers, w)
+}
+
+// EnableSnapshots serves the snapshot routes with m and adds a worker that
+// writes a snapshot every day at the given time after local midnight. It has
+// to be called before the server is started.
+func (s *Server) EnableSnapshots(m *snapshot.Manager, at time.Duration) {
+	h := newRequestHandler(s.db)
+	h.snapshots = m
+	s.router = newRouter(h)
+	s.httpServer.Handler = s.router
+	s.AddWorker(func(ctx context.Context) {
+		m.Run(ctx, at)
+	})
+}
+
+// EnableTrashPurge adds a worker that deletes blocks and pauses for good once
+// they have been in the trash for longer than retention. It purges on start
+// and then every hour.
+func (s *Server) EnableTrashPurge(retention time.Duration) {
+	s.AddWorker(func(ctx context.Context) {
+		purgeTrash(ctx, s.db, retention, time.Hour)
+	})
+}
+
+func purgeTrash(ctx context.Context, db database.Store, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if purged, err := db.PurgeTrash(time.Now().Add(-retention)); err != nil {
+			log.Printf("ERROR: could not purge trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("purged %d items from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve handles requests on l until SIGINT or SIGTERM is received. It then
+// stops accepting connections, waits up to ShutdownTimeout for in-flight
+// requests, stops the workers and checkpoints and closes the database.
+// Running blocks and open pauses are left open, so that they continue after
+// a restart.
+func (s *Server) Serve(l net.Listener) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var wg sync.WaitGroup
+	for _, w := range s.workers {
+		wg.Add(1)
+		go func(w Worker) {
+			defer wg.Done()
+			w(workerCtx)
+		}(w)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.httpServer.Serve(l)
+	}()
+
+	var errs []error
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			errs = append(errs, err)
+		}
+	case <-ctx.Done():
+		log.Println("shutting down server")
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("could not drain connections: %w", err))
+	}
+
+	stopWorkers()
+	wg.Wait()
+
+	if db, ok := s.db.(database.Checkpointer); ok {
+		if err := db.Checkpoint(); err != nil {
+			errs = append(errs, fmt.Errorf("could not checkpoint database: %w", err))
+		}
+	}
+	if err := s.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("could not close database: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
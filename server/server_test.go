@@ -1,26 +1,43 @@
 package server
 
 import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kilianmandscharo/work_hours/auth"
 	"github.com/kilianmandscharo/work_hours/database"
 	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/report"
+	"github.com/kilianmandscharo/work_hours/snapshot"
 	"github.com/kilianmandscharo/work_hours/utils"
 	"github.com/stretchr/testify/assert"
 )
 
 var token string
+var email string
 
 func init() {
 	env, err := utils.EnvVariables()
 	if err != nil {
 		log.Fatal("could not load env file")
 	}
+	email = env.Email
 	token, err = auth.CreateToken(env.Email, env.TokenKey)
 	if err != nil {
 		log.Fatal("could not create token")
@@ -28,7 +45,7 @@ func init() {
 }
 
 func TestAddBlockRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -93,7 +110,7 @@ func TestAddBlockRoute(t *testing.T) {
 }
 
 func TestUpdateBlockRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -159,7 +176,7 @@ func TestUpdateBlockRoute(t *testing.T) {
 	})
 
 	t.Run("valid body", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequestWithBody(
 			t,
 			r,
@@ -172,7 +189,7 @@ func TestUpdateBlockRoute(t *testing.T) {
 }
 
 func TestUpdateBlockStartRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -231,7 +248,7 @@ func TestUpdateBlockStartRoute(t *testing.T) {
 	})
 
 	t.Run("valid body", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequestWithBody(
 			t,
 			r,
@@ -244,7 +261,7 @@ func TestUpdateBlockStartRoute(t *testing.T) {
 }
 
 func TestUpdateBlockEndRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -303,7 +320,7 @@ func TestUpdateBlockEndRoute(t *testing.T) {
 	})
 
 	t.Run("valid body", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequestWithBody(
 			t,
 			r,
@@ -316,7 +333,7 @@ func TestUpdateBlockEndRoute(t *testing.T) {
 }
 
 func TestUpdateBlockHomeofficeRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -364,7 +381,7 @@ func TestUpdateBlockHomeofficeRoute(t *testing.T) {
 	})
 
 	t.Run("valid body", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequestWithBody(
 			t,
 			r,
@@ -377,7 +394,7 @@ func TestUpdateBlockHomeofficeRoute(t *testing.T) {
 }
 
 func TestUpdatePauseStartRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -436,7 +453,7 @@ func TestUpdatePauseStartRoute(t *testing.T) {
 	})
 
 	t.Run("valid body", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequestWithBody(
 			t,
 			r,
@@ -449,7 +466,7 @@ func TestUpdatePauseStartRoute(t *testing.T) {
 }
 
 func TestUpdatePauseEndRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -508,7 +525,7 @@ func TestUpdatePauseEndRoute(t *testing.T) {
 	})
 
 	t.Run("valid body", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequestWithBody(
 			t,
 			r,
@@ -521,7 +538,7 @@ func TestUpdatePauseEndRoute(t *testing.T) {
 }
 
 func TestDeleteBlockRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -547,7 +564,7 @@ func TestDeleteBlockRoute(t *testing.T) {
 	})
 
 	t.Run("valid request", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequest(
 			t,
 			r,
@@ -559,7 +576,7 @@ func TestDeleteBlockRoute(t *testing.T) {
 }
 
 func TestGetBlockByIDRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -581,11 +598,11 @@ func TestGetBlockByIDRoute(t *testing.T) {
 			token,
 			http.MethodGet,
 			"/block/12",
-			http.StatusInternalServerError)
+			http.StatusNotFound)
 	})
 
 	t.Run("valid request", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequest(
 			t,
 			r,
@@ -596,8 +613,80 @@ func TestGetBlockByIDRoute(t *testing.T) {
 	})
 }
 
+func TestOtherUsersBlocks(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	other := db.WithUser("other@example.com")
+	_, err := other.AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	_, err = other.DeletePause(utils.PID)
+	assert.NoError(t, err)
+
+	for _, request := range []struct {
+		method string
+		route  string
+		body   any
+	}{
+		{http.MethodGet, "/block/1", nil},
+		{http.MethodGet, "/block/1/history", nil},
+		{http.MethodPut, "/block_homeoffice/1", models.BodyHomeoffice{Homeoffice: true}},
+		{http.MethodDelete, "/block/1", nil},
+		{http.MethodPost, "/pause", utils.TestPauseCreate()},
+		{http.MethodPost, "/trash/1/restore?type=pause", nil},
+	} {
+		t.Run(request.method+" "+request.route, func(t *testing.T) {
+			utils.AssertRequestWithBody(t, r, token, request.method, request.route, request.body, http.StatusNotFound)
+		})
+	}
+
+	for _, route := range []string{"/block", "/trash"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, route, nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "[]", w.Body.String())
+	}
+
+	block, err := other.GetBlockByID(utils.BID)
+	assert.NoError(t, err)
+	assert.False(t, block.Homeoffice)
+}
+
+func TestGetBlockHistoryRoute(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("invalid query param", func(t *testing.T) {
+		utils.AssertRequest(t, r, token, http.MethodGet, "/block/a/history", http.StatusBadRequest)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		utils.AssertRequest(t, r, token, http.MethodGet, "/block/12/history", http.StatusNotFound)
+	})
+
+	t.Run("records the user", func(t *testing.T) {
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
+		utils.AssertRequest(t, r, token, http.MethodDelete, fmt.Sprintf("/block/%d", utils.BID), http.StatusOK)
+
+		history, err := db.GetBlockHistory(utils.BID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(history))
+		assert.Equal(t, email, history[0].User)
+		assert.Equal(t, email, history[1].User)
+		assert.Equal(t, database.OpDelete, history[1].Operation)
+
+		utils.AssertRequest(t, r, token, http.MethodGet, fmt.Sprintf("/block/%d/history", utils.BID), http.StatusOK)
+	})
+}
+
 func TestGetBlocksWithinRangeRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -609,11 +698,12 @@ func TestGetBlocksWithinRangeRoute(t *testing.T) {
 			token,
 			http.MethodGet,
 			"/block",
-			http.StatusNotFound)
+			http.StatusOK)
+		assertEmptyList(t, r, "/block")
 	})
 
 	for _, block := range utils.CreateRangeTestBlocks() {
-		db.AddBlock(block)
+		db.WithUser(email).AddBlock(block)
 	}
 
 	t.Run("no range provided", func(t *testing.T) {
@@ -653,7 +743,8 @@ func TestGetBlocksWithinRangeRoute(t *testing.T) {
 			token,
 			http.MethodGet,
 			fmt.Sprintf("/block?start=%s", "2023-07-31T07:00:00Z"),
-			http.StatusNotFound)
+			http.StatusOK)
+		assertEmptyList(t, r, fmt.Sprintf("/block?start=%s", "2023-07-31T07:00:00Z"))
 	})
 
 	t.Run("valid start, blocks found", func(t *testing.T) {
@@ -673,7 +764,8 @@ func TestGetBlocksWithinRangeRoute(t *testing.T) {
 			token,
 			http.MethodGet,
 			fmt.Sprintf("/block?end=%s", "2023-05-01T15:30:00Z"),
-			http.StatusNotFound)
+			http.StatusOK)
+		assertEmptyList(t, r, fmt.Sprintf("/block?end=%s", "2023-05-01T15:30:00Z"))
 	})
 
 	t.Run("valid end, blocks found", func(t *testing.T) {
@@ -697,7 +789,7 @@ func TestGetBlocksWithinRangeRoute(t *testing.T) {
 				"2023-01-01T07:00:00Z",
 				"2023-01-31T15:30:00Z",
 			),
-			http.StatusNotFound)
+			http.StatusOK)
 	})
 
 	t.Run("valid range, blocks found", func(t *testing.T) {
@@ -713,10 +805,42 @@ func TestGetBlocksWithinRangeRoute(t *testing.T) {
 			),
 			http.StatusOK)
 	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		utils.AssertRequest(
+			t,
+			r,
+			token,
+			http.MethodGet,
+			"/block?mode=within",
+			http.StatusBadRequest)
+	})
+
+	t.Run("overlapping range", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/block?start=2023-05-09T12:00:00Z&end=2023-05-10T00:00:00Z&mode=overlapping", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var blocks []models.Block
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &blocks))
+		assert.Equal(t, 1, len(blocks))
+		assert.Equal(t, 1, blocks[0].Id)
+	})
+}
+
+func assertEmptyList(t *testing.T, r *gin.Engine, route string) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, route, nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
 }
 
 func TestAddPauseRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -739,11 +863,11 @@ func TestAddPauseRoute(t *testing.T) {
 			http.MethodPost,
 			"/pause",
 			utils.TestPauseCreate(),
-			http.StatusInternalServerError)
+			http.StatusNotFound)
 	})
 
 	t.Run("valid body", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreateWithoutPause())
+		db.WithUser(email).AddBlock(utils.TestBlockCreateWithoutPause())
 		utils.AssertRequestWithBody(
 			t,
 			r,
@@ -756,7 +880,7 @@ func TestAddPauseRoute(t *testing.T) {
 }
 
 func TestUpdatePauseRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -783,7 +907,7 @@ func TestUpdatePauseRoute(t *testing.T) {
 	})
 
 	t.Run("valid body", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequestWithBody(
 			t,
 			r,
@@ -796,7 +920,7 @@ func TestUpdatePauseRoute(t *testing.T) {
 }
 
 func TestDeletePauseRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -822,7 +946,7 @@ func TestDeletePauseRoute(t *testing.T) {
 	})
 
 	t.Run("valid request", func(t *testing.T) {
-		db.AddBlock(utils.TestBlockCreate())
+		db.WithUser(email).AddBlock(utils.TestBlockCreate())
 		utils.AssertRequest(
 			t,
 			r,
@@ -834,7 +958,7 @@ func TestDeletePauseRoute(t *testing.T) {
 }
 
 func TestStartBlockRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -866,12 +990,12 @@ func TestStartBlockRoute(t *testing.T) {
 			token,
 			http.MethodPost,
 			"/current_block_start?homeoffice=false",
-			http.StatusInternalServerError)
+			http.StatusConflict)
 	})
 }
 
 func TestEndBlockRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -883,23 +1007,23 @@ func TestEndBlockRoute(t *testing.T) {
 			token,
 			http.MethodPost,
 			"/current_block_end",
-			http.StatusInternalServerError)
+			http.StatusConflict)
 	})
 
 	t.Run("pause still active", func(t *testing.T) {
-		db.StartBlock(false)
-		db.StartPause()
+		db.WithUser(email).StartBlock(false, time.Now())
+		db.WithUser(email).StartPause(time.Now())
 		utils.AssertRequest(
 			t,
 			r,
 			token,
 			http.MethodPost,
 			"/current_block_end",
-			http.StatusInternalServerError)
+			http.StatusConflict)
 	})
 
 	t.Run("valid request", func(t *testing.T) {
-		db.EndPause()
+		db.WithUser(email).EndPause(time.Now())
 		utils.AssertRequest(
 			t,
 			r,
@@ -911,7 +1035,7 @@ func TestEndBlockRoute(t *testing.T) {
 }
 
 func TestStartPauseRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -923,11 +1047,11 @@ func TestStartPauseRoute(t *testing.T) {
 			token,
 			http.MethodPost,
 			"/current_pause_start",
-			http.StatusInternalServerError)
+			http.StatusConflict)
 	})
 
 	t.Run("valid request", func(t *testing.T) {
-		db.StartBlock(false)
+		db.WithUser(email).StartBlock(false, time.Now())
 		utils.AssertRequest(
 			t,
 			r,
@@ -944,12 +1068,12 @@ func TestStartPauseRoute(t *testing.T) {
 			token,
 			http.MethodPost,
 			"/current_pause_start",
-			http.StatusInternalServerError)
+			http.StatusConflict)
 	})
 }
 
 func TestEndPauseRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -961,22 +1085,22 @@ func TestEndPauseRoute(t *testing.T) {
 			token,
 			http.MethodPost,
 			"/current_pause_end",
-			http.StatusInternalServerError)
+			http.StatusConflict)
 	})
 
 	t.Run("no pause active", func(t *testing.T) {
-		db.StartBlock(false)
+		db.WithUser(email).StartBlock(false, time.Now())
 		utils.AssertRequest(
 			t,
 			r,
 			token,
 			http.MethodPost,
 			"/current_pause_end",
-			http.StatusInternalServerError)
+			http.StatusConflict)
 	})
 
 	t.Run("valid request", func(t *testing.T) {
-		db.StartPause()
+		db.WithUser(email).StartPause(time.Now())
 		utils.AssertRequest(
 			t,
 			r,
@@ -988,7 +1112,7 @@ func TestEndPauseRoute(t *testing.T) {
 }
 
 func TestGetCurrentBlockRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -1000,11 +1124,11 @@ func TestGetCurrentBlockRoute(t *testing.T) {
 			token,
 			http.MethodGet,
 			"/block_current",
-			http.StatusInternalServerError)
+			http.StatusConflict)
 	})
 
 	t.Run("valid request", func(t *testing.T) {
-		db.StartBlock(false)
+		db.WithUser(email).StartBlock(false, time.Now())
 		utils.AssertRequest(
 			t,
 			r,
@@ -1016,7 +1140,7 @@ func TestGetCurrentBlockRoute(t *testing.T) {
 }
 
 func TestLoginRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -1080,7 +1204,7 @@ func TestLoginRoute(t *testing.T) {
 }
 
 func TestRefreshRoute(t *testing.T) {
-	db := database.GetNewTestDatabase()
+	db := database.NewMemoryStore()
 	defer db.Close()
 	r := NewRouter(db)
 	gin.SetMode(gin.TestMode)
@@ -1095,3 +1219,676 @@ func TestRefreshRoute(t *testing.T) {
 			http.StatusBadRequest)
 	})
 }
+
+func TestSettingsRoute(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("default settings", func(t *testing.T) {
+		utils.AssertRequest(
+			t,
+			r,
+			token,
+			http.MethodGet,
+			"/settings",
+			http.StatusOK)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPut,
+			"/settings",
+			struct{ Invalid string }{Invalid: "test"},
+			http.StatusBadRequest)
+	})
+
+	t.Run("invalid timezone", func(t *testing.T) {
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPut,
+			"/settings",
+			models.Settings{Timezone: "Mars/Olympus_Mons"},
+			http.StatusBadRequest)
+	})
+
+	t.Run("valid request", func(t *testing.T) {
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPut,
+			"/settings",
+			models.Settings{Timezone: "Europe/Berlin"},
+			http.StatusOK)
+
+		settings, err := db.GetSettings(email)
+		assert.NoError(t, err)
+		assert.Equal(t, "Europe/Berlin", settings.Timezone)
+	})
+}
+
+func TestCurrentBlockTimezone(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	assert.NoError(t, db.UpdateSettings(email, models.Settings{Timezone: "Europe/Berlin"}))
+
+	h := newRequestHandler(db)
+	now, _ := time.Parse(time.RFC3339, "2023-03-26T00:30:00Z")
+	h.now = func() time.Time { return now }
+	r := newRouter(h)
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		route string
+		now   string
+		want  string
+	}{
+		{"/current_block_start?homeoffice=false", "2023-03-26T00:30:00Z", "2023-03-26T01:30:00+01:00"},
+		{"/current_pause_start", "2023-03-26T00:45:00Z", "2023-03-26T01:45:00+01:00"},
+		{"/current_pause_end", "2023-03-26T01:15:00Z", "2023-03-26T03:15:00+02:00"},
+		{"/current_block_end", "2023-03-26T06:00:00Z", "2023-03-26T08:00:00+02:00"},
+	}
+
+	for _, test := range tests {
+		now, _ = time.Parse(time.RFC3339, test.now)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, test.route, nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, test.route)
+	}
+
+	blocks, err := db.GetAllBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(blocks))
+	assert.Equal(t, tests[0].want, blocks[0].Start)
+	assert.Equal(t, tests[1].want, blocks[0].Pauses[0].Start)
+	assert.Equal(t, tests[2].want, blocks[0].Pauses[0].End)
+	assert.Equal(t, tests[3].want, blocks[0].End)
+}
+
+func TestSurchargesRoute(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("default config", func(t *testing.T) {
+		utils.AssertRequest(
+			t,
+			r,
+			token,
+			http.MethodGet,
+			"/surcharges",
+			http.StatusOK)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		utils.AssertRequest(
+			t,
+			r,
+			token,
+			http.MethodPut,
+			"/surcharges",
+			http.StatusBadRequest)
+	})
+
+	t.Run("invalid rule", func(t *testing.T) {
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPut,
+			"/surcharges",
+			models.SurchargeConfig{Rules: []models.SurchargeRule{{Category: "night", From: "20:00"}}},
+			http.StatusBadRequest)
+	})
+
+	t.Run("valid request", func(t *testing.T) {
+		config := models.SurchargeConfig{Rules: []models.SurchargeRule{{Category: "night", Percent: 30, From: "22:00", To: "06:00"}}}
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPut,
+			"/surcharges",
+			config,
+			http.StatusOK)
+
+		updated, err := db.GetSurchargeConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, config.Rules, updated.Rules)
+		assert.Equal(t, []string{}, updated.Holidays)
+	})
+}
+
+func TestTimesheetRoute(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	for _, route := range []string{"/export/timesheet.pdf", "/export/timesheet.pdf?month=2023-13"} {
+		t.Run(route, func(t *testing.T) {
+			utils.AssertRequest(t, r, token, http.MethodGet, route, http.StatusBadRequest)
+		})
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/export/timesheet.pdf?month=2023-05", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		return w
+	}
+	// streams returns the decompressed streams of a PDF document in order,
+	// since the objects they belong to and the dates of the document change
+	// from one request to the next.
+	streams := func(pdf []byte) []string {
+		var result []string
+		for _, m := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(pdf, -1) {
+			z, err := zlib.NewReader(bytes.NewReader(m[1]))
+			assert.NoError(t, err)
+			data, err := io.ReadAll(z)
+			assert.NoError(t, err)
+			result = append(result, string(data))
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	t.Run("valid month", func(t *testing.T) {
+		_, err := db.WithUser(email).AddBlock(utils.TestBlockCreate())
+		assert.NoError(t, err)
+
+		w := get()
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "timesheet-2023-05.pdf")
+		assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")))
+	})
+
+	t.Run("other users", func(t *testing.T) {
+		before := get()
+		_, err := db.WithUser("other@example.com").AddBlock(models.BlockCreate{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T15:00:00Z"})
+		assert.NoError(t, err)
+		after := get()
+		assert.Equal(t, http.StatusOK, after.Code)
+		assert.Equal(t, streams(before.Body.Bytes()), streams(after.Body.Bytes()))
+	})
+}
+
+func TestCalendarRoutes(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	_, err := db.WithUser(email).AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	_, err = db.WithUser("other@example.com").AddBlock(models.BlockCreate{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T15:00:00Z"})
+	assert.NoError(t, err)
+
+	get := func(route string, authorized bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, route, nil)
+		if authorized {
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("export", func(t *testing.T) {
+		w := get("/export/blocks.ics", true)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "UID:block-1@work_hours")
+		assert.Contains(t, w.Body.String(), "UID:pause-1@work_hours")
+		assert.NotContains(t, w.Body.String(), "UID:block-2@work_hours")
+
+		assert.Equal(t, http.StatusBadRequest, get("/export/blocks.ics", false).Code)
+		assert.Equal(t, http.StatusBadRequest, get("/export/blocks.ics?start=invalid", true).Code)
+	})
+
+	t.Run("no feed", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/feed", true).Code)
+	})
+
+	t.Run("subscribe", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/feed", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var feed models.Feed
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &feed))
+		secret, err := db.GetFeedSecret(email)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasSuffix(feed.URL, "/feed/"+secret+"/blocks.ics"))
+
+		w = get("/feed/"+secret+"/blocks.ics", false)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "UID:block-1@work_hours")
+		assert.NotContains(t, w.Body.String(), "UID:block-2@work_hours")
+
+		_, err = db.RegenerateFeedSecret(email)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, get("/feed/"+secret+"/blocks.ics", false).Code)
+	})
+}
+
+func TestImportRoute(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	calendar := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nUID:1\r\nSUMMARY:Work\r\nDTSTART:20230509T070000\r\nDTEND:20230509T150000\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:2\r\nSUMMARY:Dentist\r\nDTSTART:20230510T070000\r\nDTEND:20230510T080000\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	post := func(route string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, route, strings.NewReader(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Add("Content-Type", "text/calendar")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	assert.NoError(t, db.UpdateSettings(email, models.Settings{Timezone: "Europe/Berlin"}))
+
+	t.Run("invalid calendar", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, post("/import/ics", "BEGIN:VEVENT\r\nDTSTART:soon\r\n").Code)
+	})
+
+	t.Run("invalid dry run", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, post("/import/ics?dryRun=maybe", calendar).Code)
+	})
+
+	for _, dryRun := range []bool{true, false} {
+		t.Run(fmt.Sprintf("dry run %t", dryRun), func(t *testing.T) {
+			w := post(fmt.Sprintf("/import/ics?prefix=work&dryRun=%t", dryRun), calendar)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var report models.ImportReport
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+			assert.Equal(t, dryRun, report.DryRun)
+			assert.Equal(t, 1, report.Created)
+			assert.Equal(t, "2023-05-09T07:00:00+02:00", report.Results[0].Start)
+		})
+	}
+
+	t.Run("again", func(t *testing.T) {
+		w := post("/import/ics?prefix=work", calendar)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var report models.ImportReport
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, models.ImportDuplicate, report.Results[0].Status)
+
+		blocks, err := db.GetAllBlocks()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(blocks))
+	})
+}
+
+func TestConvertRoutes(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	send := func(method string, route string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, route, strings.NewReader(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		return w
+	}
+	timewarrior := "inc 20230509T070000Z - 20230509T120000Z # Website\n" +
+		"inc 20230509T123000Z - 20230509T153000Z # Website\n"
+
+	t.Run("invalid format", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/export/blocks?format=excel", "").Code)
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/import/blocks", timewarrior).Code)
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/import/blocks?format=timewarrior", "garbage").Code)
+	})
+
+	t.Run("import", func(t *testing.T) {
+		w := send(http.MethodPost, "/import/blocks?format=timewarrior", timewarrior)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var report models.ImportReport
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, 1, report.Created)
+
+		block, err := db.GetBlockByID(report.Results[0].BlockID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Website", block.Project)
+		assert.Equal(t, 1, len(block.Pauses))
+	})
+
+	t.Run("export", func(t *testing.T) {
+		_, err := db.WithUser("other@example.com").AddBlock(models.BlockCreate{Start: "2023-05-10T07:00:00Z", End: "2023-05-10T15:00:00Z"})
+		assert.NoError(t, err)
+
+		w := send(http.MethodGet, "/export/blocks?format=toggl-csv", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, 3, strings.Count(w.Body.String(), "\n"))
+		assert.Contains(t, w.Body.String(), email+",Website,,No,2023-05-09,07:00:00")
+	})
+}
+
+func TestBackupRoutes(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	send := func(method string, route string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, route, strings.NewReader(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		return w
+	}
+	_, err := db.WithUser(email).AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	assert.NoError(t, db.UpdateSettings(email, models.Settings{Timezone: "Europe/Berlin"}))
+
+	w := send(http.MethodGet, "/backup", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	backup := w.Body.String()
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/restore?mode=append", backup).Code)
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/restore", "{").Code)
+		w := send(http.MethodPost, "/restore", `{"version": 3}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_backup")
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		_, err := db.WithUser(email).DeleteBlock(utils.BID)
+		assert.NoError(t, err)
+
+		w := send(http.MethodPost, "/restore", backup)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var report models.RestoreReport
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, models.RestoreReport{Mode: "replace", Blocks: 1, Pauses: 1}, report)
+
+		w = send(http.MethodGet, "/backup", "")
+		assert.JSONEq(t, backup, w.Body.String())
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		w := send(http.MethodPost, "/restore?mode=merge", backup)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var report models.RestoreReport
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, models.RestoreReport{Mode: "merge", Skipped: 1}, report)
+	})
+}
+
+func TestLockRoutes(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	_, err := db.WithUser(email).AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+
+	t.Run("invalid", func(t *testing.T) {
+		utils.AssertRequestWithBody(t, r, token, http.MethodPost, "/lock", models.PeriodLockCreate{Month: "May"}, http.StatusBadRequest)
+		utils.AssertRequestWithBody(t, r, token, http.MethodPost, "/lock",
+			models.PeriodLockCreate{Start: "2023-06-01T00:00:00Z", End: "2023-05-01T00:00:00Z"}, http.StatusBadRequest)
+		utils.AssertRequest(t, r, token, http.MethodDelete, "/lock/a", http.StatusBadRequest)
+		utils.AssertRequest(t, r, token, http.MethodDelete, "/lock/12", http.StatusNotFound)
+	})
+
+	t.Run("lock and reopen", func(t *testing.T) {
+		utils.AssertRequestWithBody(t, r, token, http.MethodPost, "/lock", models.PeriodLockCreate{Month: "2023-05"}, http.StatusOK)
+		locks, err := db.GetLocks()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(locks))
+		assert.Equal(t, email, locks[0].LockedBy)
+
+		utils.AssertRequestWithBody(t, r, token, http.MethodPut, "/block", utils.TestBlockUpdated(), http.StatusConflict)
+		utils.AssertRequest(t, r, token, http.MethodDelete, fmt.Sprintf("/block/%d", utils.BID), http.StatusConflict)
+		utils.AssertRequest(t, r, token, http.MethodDelete, fmt.Sprintf("/pause/%d", utils.PID), http.StatusConflict)
+
+		utils.AssertRequest(t, r, token, http.MethodDelete, fmt.Sprintf("/lock/%d", locks[0].Id), http.StatusOK)
+		utils.AssertRequest(t, r, token, http.MethodDelete, fmt.Sprintf("/pause/%d", utils.PID), http.StatusOK)
+	})
+}
+
+func TestTrashRoutes(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	_, err := db.WithUser(email).AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+
+	t.Run("invalid", func(t *testing.T) {
+		utils.AssertRequest(t, r, token, http.MethodPost, "/trash/a/restore", http.StatusBadRequest)
+		utils.AssertRequest(t, r, token, http.MethodPost, fmt.Sprintf("/trash/%d/restore?type=invoice", utils.BID), http.StatusBadRequest)
+		utils.AssertRequest(t, r, token, http.MethodPost, fmt.Sprintf("/trash/%d/restore", utils.BID), http.StatusNotFound)
+	})
+
+	t.Run("delete and restore", func(t *testing.T) {
+		utils.AssertRequest(t, r, token, http.MethodDelete, fmt.Sprintf("/pause/%d", utils.PID), http.StatusOK)
+		utils.AssertRequest(t, r, token, http.MethodDelete, fmt.Sprintf("/block/%d", utils.BID), http.StatusOK)
+		utils.AssertRequest(t, r, token, http.MethodGet, fmt.Sprintf("/block/%d", utils.BID), http.StatusNotFound)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/trash", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var trash []models.TrashItem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &trash))
+		assert.Equal(t, 1, len(trash))
+		assert.Equal(t, models.TrashBlock, trash[0].Type)
+
+		utils.AssertRequest(t, r, token, http.MethodPost, fmt.Sprintf("/trash/%d/restore?type=pause", utils.PID), http.StatusNotFound)
+		utils.AssertRequest(t, r, token, http.MethodPost, fmt.Sprintf("/trash/%d/restore", utils.BID), http.StatusOK)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/trash/%d/restore?type=pause", utils.PID), nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var block models.Block
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &block))
+		utils.AssertTestBlock(t, block)
+		assert.Equal(t, 1, len(block.Pauses))
+	})
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+
+	_, err := db.WithUser(email).AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+	_, err = db.WithUser(email).DeleteBlock(utils.BID)
+	assert.NoError(t, err)
+
+	// the worker purges once before it notices the cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	purgeTrash(ctx, db, time.Hour, time.Hour)
+	trash, err := db.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(trash))
+
+	purgeTrash(ctx, db, -time.Hour, time.Hour)
+	trash, err = db.GetTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(trash))
+}
+
+func TestAuditRoutes(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	send := func(route string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, route, nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		return w
+	}
+	_, err := db.WithUser(email).AddBlock(utils.TestBlockCreate())
+	assert.NoError(t, err)
+
+	w := send("/audit/verify")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var v models.AuditVerification
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &v))
+	assert.True(t, v.Valid)
+	assert.Equal(t, 1, v.Entries)
+
+	t.Setenv("DIGEST_KEY", "")
+	w = send("/audit/digest?month=2023-05")
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	assert.Contains(t, w.Body.String(), "digest_key_missing")
+
+	seed, err := auth.NewDigestKey()
+	assert.NoError(t, err)
+	key, err := auth.DigestKey(seed)
+	assert.NoError(t, err)
+	t.Setenv("DIGEST_KEY", seed)
+	assert.Equal(t, http.StatusBadRequest, send("/audit/digest?month=May").Code)
+	w = send("/audit/digest?month=" + time.Now().Format("2006-01"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "month_not_closed")
+
+	w = send("/audit/digest?month=2023-05")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var d models.AuditDigest
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &d))
+	assert.Equal(t, "2023-05", d.Month)
+	assert.Equal(t, 0, d.Entries)
+	assert.True(t, database.VerifyAuditDigest(d))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)), d.PublicKey)
+}
+
+type snapshotSource struct{}
+
+func (snapshotSource) Backup(dest string) error {
+	return os.WriteFile(dest, []byte("snapshot"), 0o600)
+}
+
+func TestSnapshotRoutes(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	gin.SetMode(gin.TestMode)
+
+	t.Run("disabled", func(t *testing.T) {
+		r := NewRouter(db)
+		utils.AssertRequest(t, r, token, http.MethodGet, "/snapshot", http.StatusNotImplemented)
+		utils.AssertRequest(t, r, token, http.MethodPost, "/snapshot", http.StatusNotImplemented)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		h := newRequestHandler(db)
+		h.snapshots = snapshot.New(t.TempDir(), snapshotSource{}, snapshot.Retention{Daily: 1})
+		r := newRouter(h)
+		send := func(method string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, "/snapshot", nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+			return w
+		}
+
+		w := send(http.MethodPost)
+		var created models.Snapshot
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.True(t, strings.HasPrefix(created.Name, "work_hours-"))
+
+		w = send(http.MethodGet)
+		var snapshots []models.Snapshot
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshots))
+		assert.Equal(t, []models.Snapshot{created}, snapshots)
+	})
+}
+
+func TestPayrollRoute(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("invalid range", func(t *testing.T) {
+		utils.AssertRequest(
+			t,
+			r,
+			token,
+			http.MethodGet,
+			"/payroll?start=invalid",
+			http.StatusBadRequest)
+	})
+
+	t.Run("no blocks", func(t *testing.T) {
+		assertEmptyList(t, r, "/payroll")
+	})
+
+	t.Run("night shift", func(t *testing.T) {
+		assert.NoError(t, db.UpdateSettings(email, models.Settings{Timezone: "Europe/Berlin"}))
+		_, err := db.WithUser(email).AddBlock(models.BlockCreate{Start: "2023-05-31T18:00:00Z", End: "2023-06-01T02:00:00Z"})
+		assert.NoError(t, err)
+		// The night shift of another user is not part of the payroll.
+		_, err = db.WithUser("other@example.com").AddBlock(models.BlockCreate{Start: "2023-05-30T18:00:00Z", End: "2023-05-31T02:00:00Z"})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/payroll", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var entries []report.PayrollEntry
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+		assert.Equal(t, 2, len(entries))
+		assert.Equal(t, "2023-05", entries[0].Month)
+		assert.Equal(t, report.CategoryMinutes{Category: "night", Percent: 25, Minutes: 240}, entries[0].Categories[1])
+		assert.Equal(t, "2023-06", entries[1].Month)
+		assert.Equal(t, report.CategoryMinutes{Category: "night", Percent: 25, Minutes: 240}, entries[1].Categories[1])
+	})
+}
+
+func TestBillingNotSupported(t *testing.T) {
+	db := database.NewMemoryStore()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	utils.AssertRequest(
+		t,
+		r,
+		token,
+		http.MethodGet,
+		"/invoice",
+		http.StatusNotImplemented)
+}
@@ -0,0 +1,447 @@
+//go:build cgo
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/kilianmandscharo/work_hours/auth"
+	"github.com/kilianmandscharo/work_hours/database"
+	"github.com/kilianmandscharo/work_hours/models"
+	"github.com/kilianmandscharo/work_hours/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginRouteDatabaseUser(t *testing.T) {
+	db := database.GetNewTestDatabase()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	hash, err := auth.HashPassword("userpassword")
+	assert.NoError(t, err)
+	_, err = db.AddUser("user@example.com", hash)
+	assert.NoError(t, err)
+
+	t.Run("valid database user", func(t *testing.T) {
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPost,
+			"/login",
+			auth.Login{Email: "user@example.com", Password: "userpassword"},
+			http.StatusOK)
+	})
+
+	t.Run("disabled database user", func(t *testing.T) {
+		db.SetUserDisabled("user@example.com", true)
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPost,
+			"/login",
+			auth.Login{Email: "user@example.com", Password: "userpassword"},
+			http.StatusUnauthorized)
+	})
+}
+
+func TestRefreshAccounts(t *testing.T) {
+	db := database.GetNewTestDatabase()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	env, err := utils.EnvVariables()
+	assert.NoError(t, err)
+	envTest, err := utils.EnvTestVariables()
+	assert.NoError(t, err)
+	expiring := func(email string) string {
+		claims := &jwt.StandardClaims{Subject: email, ExpiresAt: time.Now().Add(10 * time.Second).UnixMilli()}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(env.TokenKey))
+		assert.NoError(t, err)
+		return token
+	}
+	_, err = db.AddUser("active@example.com", "hash")
+	assert.NoError(t, err)
+	_, err = db.AddUser("disabled@example.com", "hash")
+	assert.NoError(t, err)
+	_, err = db.SetUserDisabled("disabled@example.com", true)
+	assert.NoError(t, err)
+
+	for email, status := range map[string]int{
+		envTest.Email:          http.StatusOK,
+		"active@example.com":   http.StatusOK,
+		"disabled@example.com": http.StatusUnauthorized,
+		"removed@example.com":  http.StatusUnauthorized,
+	} {
+		t.Run(email, func(t *testing.T) {
+			utils.AssertRequest(t, r, expiring(email), http.MethodPost, "/refresh", status)
+		})
+	}
+}
+
+func TestInvoiceRoutes(t *testing.T) {
+	db := database.GetNewTestDatabase()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	block, err := db.WithUser(email).AddBlock(models.BlockCreate{
+		Start:    "2023-05-09T08:00:00Z",
+		End:      "2023-05-09T16:00:00Z",
+		Billable: true,
+	})
+	assert.NoError(t, err)
+
+	t.Run("invalid rate", func(t *testing.T) {
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPost,
+			"/rate",
+			models.RateCreate{CentsPerHour: 5000, EffectiveFrom: "May 2023"},
+			http.StatusBadRequest)
+	})
+
+	t.Run("no rate", func(t *testing.T) {
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPost,
+			"/invoice",
+			models.InvoiceCreate{Start: "2023-05-01T00:00:00Z", End: "2023-06-01T00:00:00Z"},
+			http.StatusConflict)
+	})
+
+	t.Run("create invoice", func(t *testing.T) {
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPost,
+			"/rate",
+			models.RateCreate{CentsPerHour: 5000, EffectiveFrom: "2023-01-01"},
+			http.StatusOK)
+		utils.AssertRequestWithBody(
+			t,
+			r,
+			token,
+			http.MethodPost,
+			"/invoice",
+			models.InvoiceCreate{Start: "2023-05-01T00:00:00Z", End: "2023-06-01T00:00:00Z"},
+			http.StatusOK)
+
+		invoices, err := db.GetInvoices(email)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(invoices))
+		assert.Equal(t, int64(40000), invoices[0].TotalCents)
+	})
+
+	t.Run("billed block", func(t *testing.T) {
+		utils.AssertRequest(
+			t,
+			r,
+			token,
+			http.MethodDelete,
+			fmt.Sprintf("/block/%d", block.Id),
+			http.StatusConflict)
+	})
+
+	t.Run("render invoice", func(t *testing.T) {
+		for _, test := range []struct {
+			route       string
+			contentType string
+		}{
+			{"/invoice/1", "application/json; charset=utf-8"},
+			{"/invoice/1/html", "text/html; charset=utf-8"},
+			{"/invoice/1/pdf", "application/pdf"},
+		} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, test.route, nil)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, test.contentType, w.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("invoice not found", func(t *testing.T) {
+		utils.AssertRequest(
+			t,
+			r,
+			token,
+			http.MethodGet,
+			"/invoice/2/pdf",
+			http.StatusNotFound)
+	})
+}
+
+func TestWorkflowRoutes(t *testing.T) {
+	db := database.GetNewTestDatabase()
+	defer db.Close()
+	r := NewRouter(db)
+	gin.SetMode(gin.TestMode)
+
+	env, err := utils.EnvVariables()
+	assert.NoError(t, err)
+	tokens := map[string]string{"admin": token}
+	for _, user := range []string{"employee", "manager", "outsider"} {
+		_, err := db.AddUser(user+"@example.com", "hash")
+		assert.NoError(t, err)
+		tokens[user], err = auth.CreateToken(user+"@example.com", env.TokenKey)
+		assert.NoError(t, err)
+	}
+
+	send := func(user string, method string, route string, body any) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		var data []byte
+		if body != nil {
+			data, err = json.Marshal(body)
+			assert.NoError(t, err)
+		}
+		req, _ := http.NewRequest(method, route, bytes.NewReader(data))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", tokens[user]))
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("roles and teams are managed by admins", func(t *testing.T) {
+		role := models.RoleUpdate{Role: models.RoleManager}
+		assert.Equal(t, http.StatusForbidden, send("manager", http.MethodPut, "/user/manager@example.com/role", role).Code)
+		assert.Equal(t, http.StatusBadRequest, send("admin", http.MethodPut, "/user/manager@example.com/role", models.RoleUpdate{Role: "boss"}).Code)
+		assert.Equal(t, http.StatusNotFound, send("admin", http.MethodPut, "/user/nobody@example.com/role", role).Code)
+		assert.Equal(t, http.StatusOK, send("admin", http.MethodPut, "/user/manager@example.com/role", role).Code)
+
+		assert.Equal(t, http.StatusForbidden, send("manager", http.MethodPost, "/team", models.TeamCreate{Name: "Backend"}).Code)
+		w := send("admin", http.MethodPost, "/team", models.TeamCreate{Name: "Backend"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var team models.Team
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &team))
+		assert.Equal(t, http.StatusConflict, send("admin", http.MethodPost, "/team", models.TeamCreate{Name: "Backend"}).Code)
+
+		members := fmt.Sprintf("/team/%d/member", team.Id)
+		for _, user := range []string{"employee", "manager", "outsider"} {
+			assert.Equal(t, http.StatusOK, send("admin", http.MethodPost, members, models.TeamMemberCreate{Email: user + "@example.com"}).Code)
+		}
+		assert.Equal(t, http.StatusForbidden, send("manager", http.MethodDelete, members+"/outsider@example.com", nil).Code)
+		assert.Equal(t, http.StatusOK, send("admin", http.MethodDelete, members+"/outsider@example.com", nil).Code)
+		assert.Equal(t, http.StatusNotFound, send("admin", http.MethodDelete, members+"/outsider@example.com", nil).Code)
+		assert.Equal(t, http.StatusNotFound, send("admin", http.MethodPost, "/team/99/member", models.TeamMemberCreate{Email: "employee@example.com"}).Code)
+
+		w = send("employee", http.MethodGet, "/team", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "manager@example.com")
+	})
+
+	var submission models.Submission
+	t.Run("submit", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send("employee", http.MethodPost, "/submission", models.SubmissionCreate{Period: "day", Date: "2023-05-10"}).Code)
+		assert.Equal(t, http.StatusBadRequest, send("employee", http.MethodPost, "/submission", models.SubmissionCreate{Period: "week", Date: "2023-05"}).Code)
+
+		w := send("employee", http.MethodPost, "/submission", models.SubmissionCreate{Period: "week", Date: "2023-05-10", Comment: "done"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &submission))
+		assert.Equal(t, "2023-05-08T00:00:00Z", submission.Start)
+		assert.Equal(t, "2023-05-15T00:00:00Z", submission.End)
+		assert.Equal(t, http.StatusConflict, send("employee", http.MethodPost, "/submission", models.SubmissionCreate{Period: "week", Date: "2023-05-12"}).Code)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		route := fmt.Sprintf("/submission/%d/reject", submission.Id)
+		assert.Equal(t, http.StatusForbidden, send("employee", http.MethodPost, route, models.SubmissionReview{Comment: "no"}).Code)
+		assert.Equal(t, http.StatusForbidden, send("outsider", http.MethodPost, route, models.SubmissionReview{Comment: "no"}).Code)
+		assert.Equal(t, http.StatusBadRequest, send("manager", http.MethodPost, route, nil).Code)
+
+		w := send("manager", http.MethodPost, route, models.SubmissionReview{Comment: "Tuesday is missing"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var rejected models.Submission
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rejected))
+		assert.Equal(t, models.SubmissionRejected, rejected.Status)
+		assert.Equal(t, "Tuesday is missing", rejected.ReviewComment)
+		assert.Equal(t, http.StatusConflict, send("manager", http.MethodPost, route, models.SubmissionReview{Comment: "again"}).Code)
+	})
+
+	t.Run("approve locks the period", func(t *testing.T) {
+		w := send("employee", http.MethodPost, "/submission", models.SubmissionCreate{Period: "week", Date: "2023-05-10"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &submission))
+
+		route := fmt.Sprintf("/submission/%d/approve", submission.Id)
+		w = send("manager", http.MethodPost, route, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var approved models.Submission
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &approved))
+		block := models.BlockCreate{Start: "2023-05-09T08:00:00Z", End: "2023-05-09T16:00:00Z"}
+		assert.Equal(t, http.StatusConflict, send("employee", http.MethodPost, "/block", block).Code)
+		assert.Equal(t, http.StatusOK, send("outsider", http.MethodPost, "/block", block).Code)
+
+		// Employees lock and reopen their own periods, but neither reopen
+		// approvals nor lock the periods of others.
+		lock := fmt.Sprintf("/lock/%d", approved.LockID)
+		assert.Equal(t, http.StatusForbidden, send("employee", http.MethodDelete, lock, nil).Code)
+		assert.Equal(t, http.StatusForbidden, send("employee", http.MethodPost, "/lock", models.PeriodLockCreate{Month: "2023-04", All: true}).Code)
+		assert.Equal(t, http.StatusForbidden,
+			send("employee", http.MethodPost, "/lock", models.PeriodLockCreate{Month: "2023-04", Owner: "outsider@example.com"}).Code)
+		w = send("employee", http.MethodPost, "/lock", models.PeriodLockCreate{Month: "2023-04"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var april models.PeriodLock
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &april))
+		assert.Equal(t, "employee@example.com", april.Owner)
+		april28 := models.BlockCreate{Start: "2023-04-28T08:00:00Z", End: "2023-04-28T16:00:00Z"}
+		assert.Equal(t, http.StatusConflict, send("employee", http.MethodPost, "/block", april28).Code)
+		assert.Equal(t, http.StatusOK, send("outsider", http.MethodPost, "/block", april28).Code)
+		assert.Equal(t, http.StatusForbidden, send("outsider", http.MethodDelete, fmt.Sprintf("/lock/%d", april.Id), nil).Code)
+		assert.Equal(t, http.StatusOK, send("employee", http.MethodDelete, fmt.Sprintf("/lock/%d", april.Id), nil).Code)
+
+		w = send("manager", http.MethodPost, "/lock", models.PeriodLockCreate{Month: "2023-03", All: true})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var march models.PeriodLock
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &march))
+		assert.Equal(t, "", march.Owner)
+		assert.Equal(t, http.StatusForbidden, send("employee", http.MethodDelete, fmt.Sprintf("/lock/%d", march.Id), nil).Code)
+		assert.Equal(t, http.StatusOK, send("manager", http.MethodDelete, fmt.Sprintf("/lock/%d", march.Id), nil).Code)
+
+		// Backups contain everyone's data and restores replace it.
+		assert.Equal(t, http.StatusForbidden, send("manager", http.MethodGet, "/backup", nil).Code)
+		assert.Equal(t, http.StatusForbidden, send("employee", http.MethodPost, "/restore", models.Backup{}).Code)
+		assert.Equal(t, http.StatusOK, send("admin", http.MethodGet, "/backup", nil).Code)
+
+		// So do the surcharges and the audit log.
+		config := models.SurchargeConfig{Rules: []models.SurchargeRule{}, Holidays: []string{}}
+		assert.Equal(t, http.StatusForbidden, send("manager", http.MethodPut, "/surcharges", config).Code)
+		assert.Equal(t, http.StatusOK, send("admin", http.MethodPut, "/surcharges", config).Code)
+		assert.Equal(t, http.StatusForbidden, send("employee", http.MethodGet, "/audit/verify", nil).Code)
+		assert.Equal(t, http.StatusOK, send("manager", http.MethodGet, "/audit/verify", nil).Code)
+	})
+
+	t.Run("visibility", func(t *testing.T) {
+		route := fmt.Sprintf("/submission/%d", submission.Id)
+		assert.Equal(t, http.StatusOK, send("employee", http.MethodGet, route, nil).Code)
+		assert.Equal(t, http.StatusOK, send("manager", http.MethodGet, route, nil).Code)
+		assert.Equal(t, http.StatusForbidden, send("outsider", http.MethodGet, route, nil).Code)
+
+		var submissions []models.Submission
+		w := send("outsider", http.MethodGet, "/submission", nil)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &submissions))
+		assert.Equal(t, 0, len(submissions))
+		w = send("manager", http.MethodGet, "/submission?status=approved", nil)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &submissions))
+		assert.Equal(t, 1, len(submissions))
+
+		var events []models.WorkflowEvent
+		w = send("employee", http.MethodGet, "/events", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+		assert.Equal(t, 4, len(events))
+		w = send("employee", http.MethodGet, fmt.Sprintf("/events?since=%d", events[2].Id), nil)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, models.SubmissionApproved, events[0].Type)
+		w = send("outsider", http.MethodGet, "/events", nil)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+		assert.Equal(t, 0, len(events))
+		assert.Equal(t, http.StatusBadRequest, send("employee", http.MethodGet, "/events?since=x", nil).Code)
+	})
+}
+
+func TestTeamOverviewRoute(t *testing.T) {
+	db := database.GetNewTestDatabase()
+	defer db.Close()
+	gin.SetMode(gin.TestMode)
+	h := newRequestHandler(db)
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	r := newRouter(h)
+
+	env, err := utils.EnvVariables()
+	assert.NoError(t, err)
+	tokens := map[string]string{"admin": token}
+	for _, user := range []string{"employee", "manager", "outsider"} {
+		email := user + "@example.com"
+		_, err := db.AddUser(email, "hash")
+		assert.NoError(t, err)
+		assert.NoError(t, db.UpdateSettings(email, models.Settings{Timezone: "UTC"}))
+		tokens[user], err = auth.CreateToken(email, env.TokenKey)
+		assert.NoError(t, err)
+	}
+	_, err = db.SetUserRole("manager@example.com", models.RoleManager)
+	assert.NoError(t, err)
+	_, err = db.SetUserRole("outsider@example.com", models.RoleManager)
+	assert.NoError(t, err)
+	team, err := db.AddTeam("Backend")
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddTeamMember(team.Id, "employee@example.com"))
+	assert.NoError(t, db.AddTeamMember(team.Id, "manager@example.com"))
+
+	employee := db.WithUser("employee@example.com")
+	_, err = employee.AddBlock(models.BlockCreate{Start: "2023-05-08T08:00:00Z", End: "2023-05-08T16:00:00Z"})
+	assert.NoError(t, err)
+	block, err := employee.StartBlock(false, time.Date(2023, 5, 10, 8, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	_, err = employee.StartPause(time.Date(2023, 5, 10, 11, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	manager := db.WithUser("manager@example.com")
+	_, err = manager.AddBlock(models.BlockCreate{Start: "2023-05-09T08:00:00Z", End: "2023-05-09T12:00:00Z"})
+	assert.NoError(t, err)
+	managerBlock, err := manager.StartBlock(true, time.Date(2023, 5, 10, 9, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	get := func(user string, route string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, route, nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", tokens[user]))
+		r.ServeHTTP(w, req)
+		return w
+	}
+	route := fmt.Sprintf("/team/%d/overview", team.Id)
+
+	t.Run("restricted by role", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get("employee", route).Code)
+		assert.Equal(t, http.StatusForbidden, get("outsider", route).Code)
+		assert.Equal(t, http.StatusOK, get("admin", route).Code)
+		assert.Equal(t, http.StatusNotFound, get("admin", "/team/99/overview").Code)
+	})
+
+	t.Run("members", func(t *testing.T) {
+		w := get("manager", route)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var overview models.TeamOverview
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &overview))
+		assert.Equal(t, "Backend", overview.Name)
+		assert.Equal(t, "2023-05-10T12:00:00Z", overview.At)
+		assert.Equal(t, []models.MemberStatus{
+			{
+				Email:          "employee@example.com",
+				Role:           models.RoleEmployee,
+				State:          models.MemberPaused,
+				BlockID:        block.Id,
+				Since:          "2023-05-10T11:00:00Z",
+				TodayMinutes:   3 * 60,
+				WeekMinutes:    11 * 60,
+				BalanceMinutes: (11 - 64) * 60,
+			},
+			{
+				Email:          "manager@example.com",
+				Role:           models.RoleManager,
+				State:          models.MemberWorking,
+				BlockID:        managerBlock.Id,
+				Since:          "2023-05-10T09:00:00Z",
+				TodayMinutes:   3 * 60,
+				WeekMinutes:    7 * 60,
+				BalanceMinutes: (7 - 64) * 60,
+			},
+		}, overview.Members)
+	})
+}
@@ -0,0 +1,258 @@
+// Package snapshot writes timestamped copies of the database to a directory
+// while the server is running and prunes the old ones.
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kilianmandscharo/work_hours/models"
+)
+
+const (
+	prefix      = "work_hours-"
+	suffix      = ".db"
+	stampLayout = "20060102T150405Z"
+)
+
+// Source writes a consistent copy of the database to dest, which must not
+// exist yet. database.DB implements it with VACUUM INTO.
+type Source interface {
+	Backup(dest string) error
+}
+
+// Retention keeps the newest snapshot of each of the last Daily days and of
+// each of the last Monthly months that have snapshots, in UTC. A snapshot is
+// kept if either rule keeps it. If both are zero, all snapshots are kept.
+type Retention struct {
+	Daily   int
+	Monthly int
+}
+
+// Manager writes the snapshots of a source to a directory. Snapshots and
+// pruning are serialized, so the worker and on-demand snapshots can run
+// concurrently.
+type Manager struct {
+	dir       string
+	source    Source
+	retention Retention
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+func New(dir string, source Source, retention Retention) *Manager {
+	return &Manager{dir: dir, source: source, retention: retention, now: time.Now}
+}
+
+type file struct {
+	name    string
+	created time.Time
+}
+
+// parseName returns the time a snapshot was created from its file name. It
+// fails for files that are not snapshots.
+func parseName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, suffix)
+	if !ok {
+		return time.Time{}, false
+	}
+	created, err := time.Parse(stampLayout, stamp)
+	return created, err == nil
+}
+
+// files returns the snapshots in the directory, newest first.
+func (m *Manager) files() ([]file, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var files []file
+	for _, entry := range entries {
+		if created, ok := parseName(entry.Name()); ok && entry.Type().IsRegular() {
+			files = append(files, file{name: entry.Name(), created: created})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].created.After(files[j].created)
+	})
+	return files, nil
+}
+
+func (m *Manager) snapshot(f file) (models.Snapshot, error) {
+	info, err := os.Stat(filepath.Join(m.dir, f.name))
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+	return models.Snapshot{
+		Name:    f.name,
+		Created: f.created.Format(time.RFC3339),
+		Size:    info.Size(),
+	}, nil
+}
+
+// List returns the snapshots in the directory, newest first.
+func (m *Manager) List() ([]models.Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files, err := m.files()
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []models.Snapshot{}
+	for _, f := range files {
+		s, err := m.snapshot(f)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
+
+// Create writes a new snapshot and prunes the old ones afterwards. The copy
+// is written under a temporary name first, so that the directory never
+// contains a partial snapshot.
+func (m *Manager) Create() (models.Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return models.Snapshot{}, err
+	}
+
+	f := file{created: m.now().UTC().Truncate(time.Second)}
+	f.name = prefix + f.created.Format(stampLayout) + suffix
+	dest := filepath.Join(m.dir, f.name)
+	if _, err := os.Stat(dest); err == nil {
+		return models.Snapshot{}, fmt.Errorf("snapshot %s already exists", f.name)
+	}
+
+	tmp := filepath.Join(m.dir, "."+f.name+".tmp")
+	os.Remove(tmp)
+	if err := m.source.Backup(tmp); err != nil {
+		os.Remove(tmp)
+		return models.Snapshot{}, err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return models.Snapshot{}, err
+	}
+
+	s, err := m.snapshot(f)
+	if err != nil {
+		return s, err
+	}
+	_, err = m.prune()
+	return s, err
+}
+
+// Prune deletes the snapshots the retention does not keep and returns their
+// names.
+func (m *Manager) Prune() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prune()
+}
+
+func (m *Manager) prune() ([]string, error) {
+	files, err := m.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for i, keep := range m.retention.keep(files) {
+		if keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.dir, files[i].name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, files[i].name)
+	}
+	return removed, nil
+}
+
+// keep reports for each of the files, newest first, whether it is kept.
+func (r Retention) keep(files []file) []bool {
+	keep := make([]bool, len(files))
+	if r.Daily == 0 && r.Monthly == 0 {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+
+	days := make(map[string]bool)
+	months := make(map[string]bool)
+	for i, f := range files {
+		day := f.created.Format(time.DateOnly)
+		if !days[day] && len(days) < r.Daily {
+			days[day] = true
+			keep[i] = true
+		}
+		month := f.created.Format("2006-01")
+		if !months[month] && len(months) < r.Monthly {
+			months[month] = true
+			keep[i] = true
+		}
+	}
+	return keep
+}
+
+// ParseClock parses a time of day like 03:00 as the duration since midnight.
+func ParseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected 15:04", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// nextRun returns the next time after now at the given time of day in now's
+// location.
+func nextRun(now time.Time, at time.Duration) time.Time {
+	hour, minute := int(at/time.Hour), int(at%time.Hour/time.Minute)
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, hour, minute, 0, 0, now.Location())
+	}
+	return next
+}
+
+// Run writes a snapshot every day at the given time of day in local time
+// until ctx is cancelled. Failures are logged and retried the next day.
+func (m *Manager) Run(ctx context.Context, at time.Duration) {
+	for {
+		now := m.now()
+		timer := time.NewTimer(nextRun(now, at).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if s, err := m.Create(); err != nil {
+			log.Printf("ERROR: could not write snapshot: %v", err)
+		} else {
+			log.Printf("wrote snapshot %s", s.Name)
+		}
+	}
+}
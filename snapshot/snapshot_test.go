@@ -0,0 +1,147 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fileSource struct {
+	err error
+}
+
+func (s fileSource) Backup(dest string) error {
+	if s.err != nil {
+		return s.err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return errors.New("destination exists")
+	}
+	return os.WriteFile(dest, []byte("snapshot"), 0o600)
+}
+
+func names(t *testing.T, m *Manager) []string {
+	t.Helper()
+	snapshots, err := m.List()
+	assert.NoError(t, err)
+	var names []string
+	for _, s := range snapshots {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	m := New(dir, fileSource{}, Retention{})
+	now := time.Date(2023, 5, 9, 3, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	m.now = func() time.Time { return now }
+
+	snapshots, err := m.List()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(snapshots))
+
+	s, err := m.Create()
+	assert.NoError(t, err)
+	assert.Equal(t, "work_hours-20230509T010000Z.db", s.Name)
+	assert.Equal(t, "2023-05-09T01:00:00Z", s.Created)
+	assert.Equal(t, int64(8), s.Size)
+
+	_, err = m.Create()
+	assert.Error(t, err)
+
+	now = now.Add(time.Hour)
+	_, err = m.Create()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o600))
+	assert.Equal(t, []string{"work_hours-20230509T020000Z.db", "work_hours-20230509T010000Z.db"}, names(t, m))
+
+	now = now.Add(time.Hour)
+	m.source = fileSource{err: errors.New("disk full")}
+	_, err = m.Create()
+	assert.Error(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	m := New(dir, fileSource{}, Retention{Daily: 2, Monthly: 3})
+	for _, stamp := range []string{
+		"20230301T010000Z",
+		"20230315T010000Z",
+		"20230401T010000Z",
+		"20230508T010000Z",
+		"20230508T120000Z",
+		"20230509T010000Z",
+		"20230509T120000Z",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, prefix+stamp+suffix), nil, 0o600))
+	}
+
+	removed, err := m.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"work_hours-20230509T010000Z.db",
+		"work_hours-20230508T010000Z.db",
+		"work_hours-20230301T010000Z.db",
+	}, removed)
+	assert.Equal(t, []string{
+		"work_hours-20230509T120000Z.db",
+		"work_hours-20230508T120000Z.db",
+		"work_hours-20230401T010000Z.db",
+		"work_hours-20230315T010000Z.db",
+	}, names(t, m))
+
+	m.retention = Retention{}
+	removed, err = m.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(removed))
+}
+
+func TestParseClock(t *testing.T) {
+	at, err := ParseClock("03:30")
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Hour+30*time.Minute, at)
+
+	_, err = ParseClock("25:00")
+	assert.Error(t, err)
+}
+
+func TestNextRun(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	at := 3 * time.Hour
+
+	now := time.Date(2023, 5, 9, 2, 0, 0, 0, berlin)
+	assert.Equal(t, time.Date(2023, 5, 9, 3, 0, 0, 0, berlin), nextRun(now, at))
+	now = time.Date(2023, 5, 9, 3, 0, 0, 0, berlin)
+	assert.Equal(t, time.Date(2023, 5, 10, 3, 0, 0, 0, berlin), nextRun(now, at))
+
+	// the night of the switch to daylight saving time is an hour shorter
+	now = time.Date(2023, 3, 25, 12, 0, 0, 0, berlin)
+	assert.Equal(t, 14*time.Hour, nextRun(now, at).Sub(now))
+}
+
+func TestRunStops(t *testing.T) {
+	m := New(t.TempDir(), fileSource{}, Retention{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx, 3*time.Hour)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
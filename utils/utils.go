@@ -11,6 +11,9 @@ type Env struct {
 	Email    string
 	Hash     string
 	TokenKey string
+	// DigestKey is the base64 encoded seed of the key that signs audit
+	// digests.
+	DigestKey string
 }
 
 type EnvTest struct {
@@ -34,6 +37,7 @@ func EnvVariables() (Env, error) {
 	env.Email = os.Getenv("EMAIL")
 	env.Hash = os.Getenv("PW_HASH")
 	env.TokenKey = os.Getenv("TOKEN_KEY")
+	env.DigestKey = os.Getenv("DIGEST_KEY")
 	return env, nil
 }
 